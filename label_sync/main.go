@@ -591,7 +591,10 @@ func (ru RepoUpdates) DoUpdates(org string, gc client) error {
 					}
 				case "migrate":
 					issues, err := gc.FindIssues(fmt.Sprintf("is:open repo:%s/%s label:\"%s\" -label:\"%s\"", org, repo, update.Current.Name, update.Wanted.Name), "", false)
-					if err != nil {
+					if truncated, ok := err.(*github.SearchResultsTruncated); ok {
+						// The rest are migrated by the next run.
+						logrus.WithError(truncated).Warnf("Migrating the first %d issues only.", len(issues))
+					} else if err != nil {
 						errChan <- err
 					}
 					if len(issues) == 0 {
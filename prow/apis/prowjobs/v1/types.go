@@ -78,6 +78,10 @@ const (
 	DefaultClusterAlias = "default"
 )
 
+// UnlimitedConcurrency is the MaxConcurrency of jobs that may run any number
+// of instances at once, regardless of the default and global limits.
+const UnlimitedConcurrency = -1
+
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
@@ -122,17 +126,34 @@ type ProwJobSpec struct {
 	// Context is the name of the status context used to
 	// report back to GitHub
 	Context string `json:"context,omitempty"`
+	// Optional indicates that the status context this job
+	// reports is informational and not required for merge
+	Optional bool `json:"optional,omitempty"`
 	// RerunCommand is the command a user would write to
 	// trigger this job on their pull request
 	RerunCommand string `json:"rerun_command,omitempty"`
 	// MaxConcurrency restricts the total number of instances
-	// of this job that can run in parallel at once
+	// of this job that can run in parallel at once. 0 falls back
+	// to the default of the controller, UnlimitedConcurrency
+	// lifts every limit.
 	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// ConcurrencyGroup is the key under which MaxConcurrency is
+	// enforced. Jobs that share a group are limited together, which
+	// allows distinct jobs that contend for the same resource to be
+	// serialized. Defaults to the job name.
+	ConcurrencyGroup string `json:"concurrency_group,omitempty"`
 	// ErrorOnEviction indicates that the ProwJob should be completed and given
 	// the ErrorState status if the pod that is executing the job is evicted.
 	// If this field is unspecified or false, a new pod will be created to replace
 	// the evicted one.
 	ErrorOnEviction bool `json:"error_on_eviction,omitempty"`
+	// SlackReport opts the job in to having its completion reported to
+	// the Slack channel configured for the slack reporter.
+	SlackReport bool `json:"slack_report,omitempty"`
+	// Annotations are added to the pod that runs the job, which
+	// allows external systems to attach metadata such as trace IDs.
+	// Annotations that prow manages itself cannot be overridden.
+	Annotations map[string]string `json:"annotations,omitempty"`
 
 	// PodSpec provides the basis for running the test under
 	// a Kubernetes agent
@@ -398,6 +419,40 @@ type ProwJobStatus struct {
 	// ProwJob.
 	JenkinsBuildID string `json:"jenkins_build_id,omitempty"`
 
+	// PodEvictions applies only to ProwJobs fulfilled by
+	// plank. It counts how many times the pod running the
+	// job was evicted and replaced.
+	PodEvictions int `json:"pod_evictions,omitempty"`
+
+	// ErrorRetries applies only to ProwJobs fulfilled by
+	// plank. It counts how many times the job was reset to
+	// the TriggeredState after a retryable error.
+	ErrorRetries int `json:"error_retries,omitempty"`
+
+	// StartFailures applies only to ProwJobs fulfilled by
+	// plank. It counts how many times in a row the pod of the
+	// job could not be started because of an unexpected error.
+	StartFailures int `json:"start_failures,omitempty"`
+
+	// UnschedulableReason applies only to ProwJobs fulfilled by
+	// plank. It is set while the pod running the pending job
+	// cannot be scheduled, and explains why. It is empty while
+	// the pod is scheduled or the job is waiting for capacity.
+	UnschedulableReason string `json:"unschedulable_reason,omitempty"`
+
+	// PodRunning applies only to ProwJobs fulfilled by plank.
+	// It is set once the pod of the job was seen running, so
+	// that a pod that later disappears, for example because
+	// its node was drained, can be told apart from a pod that
+	// was never created.
+	PodRunning bool `json:"pod_running,omitempty"`
+
+	// Paused applies only to ProwJobs fulfilled by plank.
+	// While it is set, plank leaves the job and its pod
+	// alone and does not count it against any concurrency
+	// limit. Unsetting it resumes the job where it was.
+	Paused bool `json:"paused,omitempty"`
+
 	// PrevReportStates stores the previous reported prowjob state per reporter
 	// So crier won't make duplicated report attempt
 	PrevReportStates map[string]ProwJobState `json:"prev_report_states,omitempty"`
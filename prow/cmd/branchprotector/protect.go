@@ -21,6 +21,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 
@@ -131,6 +132,7 @@ func main() {
 }
 
 type client interface {
+	GetBranchProtection(org, repo, branch string) (*github.BranchProtection, error)
 	RemoveBranchProtection(org, repo, branch string) error
 	UpdateBranchProtection(org, repo, branch string, config github.BranchProtectionRequest) error
 	GetBranches(org, repo string, onlyProtected bool) ([]github.Branch, error)
@@ -284,6 +286,20 @@ func (p *protector) UpdateBranch(orgName, repo string, branchName string, branch
 	var req *github.BranchProtectionRequest
 	if *bp.Protect {
 		r := makeRequest(*bp)
+		if protected {
+			current, err := p.client.GetBranchProtection(orgName, repo, branchName)
+			if err != nil {
+				return fmt.Errorf("get current protection: %v", err)
+			}
+			if current != nil {
+				cr := current.Request()
+				keepUnmanaged(&r, cr, *bp)
+				if reflect.DeepEqual(r, cr) {
+					logrus.Infof("%s/%s=%s: already up to date", orgName, repo, branchName)
+					return nil
+				}
+			}
+		}
 		req = &r
 	}
 	p.updates <- requirements{
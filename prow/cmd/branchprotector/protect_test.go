@@ -77,10 +77,22 @@ func TestOptions_Validate(t *testing.T) {
 type fakeClient struct {
 	repos    map[string][]github.Repo
 	branches map[string][]github.Branch
+	current  map[string]github.BranchProtection
 	deleted  map[string]bool
 	updated  map[string]github.BranchProtectionRequest
 }
 
+func (c fakeClient) GetBranchProtection(org, repo, branch string) (*github.BranchProtection, error) {
+	if branch == "error" {
+		return nil, errors.New("failed to get branch protection")
+	}
+	bp, ok := c.current[org+"/"+repo+"="+branch]
+	if !ok {
+		return nil, nil
+	}
+	return &bp, nil
+}
+
 func (c fakeClient) GetRepo(org string, repo string) (github.Repo, error) {
 	r, ok := c.repos[org]
 	if !ok {
@@ -264,6 +276,7 @@ func TestProtect(t *testing.T) {
 		name             string
 		branches         []string
 		startUnprotected bool
+		current          map[string]github.BranchProtection
 		config           string
 		archived         string
 		expected         []requirements
@@ -272,6 +285,103 @@ func TestProtect(t *testing.T) {
 		{
 			name: "nothing",
 		},
+		{
+			name:     "skip branches whose protection is up to date",
+			branches: []string{"org/repo=master"},
+			current: map[string]github.BranchProtection{
+				"org/repo=master": {
+					RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"lint", "unit"}},
+				},
+			},
+			config: `
+branch-protection:
+  orgs:
+    org:
+      protect: true
+      required_status_checks:
+        contexts: [unit, lint]
+`,
+		},
+		{
+			name:     "add required contexts",
+			branches: []string{"org/repo=master"},
+			current: map[string]github.BranchProtection{
+				"org/repo=master": {
+					RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"unit"}},
+				},
+			},
+			config: `
+branch-protection:
+  orgs:
+    org:
+      protect: true
+      required_status_checks:
+        contexts: [unit, lint]
+`,
+			expected: []requirements{
+				{
+					Org:    "org",
+					Repo:   "repo",
+					Branch: "master",
+					Request: &github.BranchProtectionRequest{
+						RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"lint", "unit"}},
+					},
+				},
+			},
+		},
+		{
+			name:     "remove managed protections but keep unmanaged ones",
+			branches: []string{"org/repo=master"},
+			current: map[string]github.BranchProtection{
+				"org/repo=master": {
+					EnforceAdmins:        github.EnforceAdmins{Enabled: true},
+					RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"unit", "removed"}},
+					RequiredPullRequestReviews: &github.PullRequestReviewsProtection{
+						RequiredApprovingReviewCount: 2,
+					},
+					Restrictions: &github.RestrictionsProtection{
+						Teams: []github.Team{{Slug: "movers"}},
+					},
+				},
+			},
+			config: `
+branch-protection:
+  orgs:
+    org:
+      protect: true
+      enforce_admins: false
+      required_status_checks:
+        contexts: [unit]
+`,
+			expected: []requirements{
+				{
+					Org:    "org",
+					Repo:   "repo",
+					Branch: "master",
+					Request: &github.BranchProtectionRequest{
+						RequiredStatusChecks: &github.RequiredStatusChecks{Contexts: []string{"unit"}},
+						RequiredPullRequestReviews: &github.RequiredPullRequestReviews{
+							RequiredApprovingReviewCount: 2,
+						},
+						Restrictions: &github.Restrictions{
+							Users: &[]string{},
+							Teams: &[]string{"movers"},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "fail to get current protection",
+			branches: []string{"org/repo=error"},
+			config: `
+branch-protection:
+  orgs:
+    org:
+      protect: true
+`,
+			errors: 1,
+		},
 		{
 			name: "unknown org",
 			config: `
@@ -719,6 +829,7 @@ branch-protection:
 			fc := fakeClient{
 				branches: branches,
 				repos:    map[string][]github.Repo{},
+				current:  tc.current,
 			}
 			for org, r := range repos {
 				for rname := range r {
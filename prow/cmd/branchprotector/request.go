@@ -35,6 +35,24 @@ func makeRequest(policy branchprotection.Policy) github.BranchProtectionRequest
 
 }
 
+// keepUnmanaged copies the protections that the policy leaves unset from the
+// current protection of the branch into the request, so that protections
+// configured by other means are never removed.
+func keepUnmanaged(req *github.BranchProtectionRequest, current github.BranchProtectionRequest, policy branchprotection.Policy) {
+	if policy.Admins == nil {
+		req.EnforceAdmins = current.EnforceAdmins
+	}
+	if policy.RequiredStatusChecks == nil {
+		req.RequiredStatusChecks = current.RequiredStatusChecks
+	}
+	if policy.RequiredPullRequestReviews == nil {
+		req.RequiredPullRequestReviews = current.RequiredPullRequestReviews
+	}
+	if policy.Restrictions == nil {
+		req.Restrictions = current.Restrictions
+	}
+}
+
 // makeAdmins returns true iff *val == true, else nil
 func makeAdmins(val *bool) *bool {
 	if v := makeBool(val); v {
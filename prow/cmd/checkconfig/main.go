@@ -53,8 +53,9 @@ type options struct {
 	jobConfigPath string
 	pluginConfig  string
 
-	warnings flagutil.Strings
-	strict   bool
+	warnings     flagutil.Strings
+	strict       bool
+	strictConfig bool
 }
 
 func reportWarning(strict bool, errs errorutil.Aggregate) {
@@ -117,6 +118,7 @@ func gatherOptions() options {
 	flag.StringVar(&o.pluginConfig, "plugin-config", "", "Path to plugin config file.")
 	flag.Var(&o.warnings, "warnings", "Comma-delimited list of warnings to validate.")
 	flag.BoolVar(&o.strict, "strict", false, "If set, consider all warnings as errors.")
+	flag.BoolVar(&o.strictConfig, "strict-config", false, "If set, consider fields in the config that are unknown or set twice as errors.")
 	flag.Parse()
 	return o
 }
@@ -136,7 +138,7 @@ func main() {
 		logrusutil.NewDefaultFieldsFormatter(&logrus.TextFormatter{}, logrus.Fields{"component": "checkconfig"}),
 	)
 
-	configAgent := config.Agent{}
+	configAgent := config.Agent{Strict: o.strictConfig}
 	if err := configAgent.Start(o.configPath, o.jobConfigPath); err != nil {
 		logrus.WithError(err).Fatal("Error loading Prow config.")
 	}
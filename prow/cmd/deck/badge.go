@@ -25,6 +25,7 @@ import (
 	"strings"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/pjutil"
 )
 
 var svg = `<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20">
@@ -83,24 +84,30 @@ func makeShield(subject, status, color string) []byte {
 	return buf.Bytes()
 }
 
-// pickLatestJobs returns the most recent run of each job matching the selector,
-// which is comma-separated list of globs, for example "ci-ti-*,ci-other".
+// pickLatestJobs returns the most recent completed run of each job matching
+// the selector, which is comma-separated list of globs, for example
+// "ci-ti-*,ci-other", ordered by job name.
 func pickLatestJobs(jobs []prowapi.ProwJob, selector string) []prowapi.ProwJob {
-	var out []prowapi.ProwJob
-	have := make(map[string]bool)
+	var matched []prowapi.ProwJob
 	want := strings.Split(selector, ",")
 	for _, job := range jobs {
-		if have[job.Spec.Job] {
-			continue // already have the latest result for this job
+		if !job.Complete() {
+			continue
 		}
 		for _, pat := range want {
 			if match, _ := filepath.Match(pat, job.Spec.Job); match {
-				have[job.Spec.Job] = true
-				out = append(out, job)
+				matched = append(matched, job)
 				break
 			}
 		}
 	}
+	// Batch runs of a presubmit share its name, so the latest run of a job
+	// is picked regardless of its type.
+	var out []prowapi.ProwJob
+	for _, job := range pjutil.GetLatestProwJobs(matched, "") {
+		out = append(out, job)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Spec.Job < out[j].Spec.Job })
 	return out
 }
 
@@ -113,7 +120,7 @@ func renderBadge(jobs []prowapi.ProwJob) (string, string, []byte) {
 	} else {
 		failedJobs := []string{}
 		for _, job := range jobs {
-			if job.Status.State == "failure" {
+			if job.Status.State != prowapi.SuccessState {
 				failedJobs = append(failedJobs, job.Spec.Job)
 			}
 		}
@@ -18,36 +18,54 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/deck/jobs"
 )
 
 func TestPickLatest(t *testing.T) {
+	start := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	typedJob := func(jobType prowapi.ProwJobType, name, cluster string, minute int, complete bool) prowapi.ProwJob {
+		pj := prowapi.ProwJob{
+			// We're using Cluster as a simple way to distinguish runs
+			Spec:   prowapi.ProwJobSpec{Type: jobType, Job: name, Cluster: cluster},
+			Status: prowapi.ProwJobStatus{StartTime: metav1.NewTime(start.Add(time.Duration(minute) * time.Minute))},
+		}
+		if complete {
+			pj.SetComplete()
+		}
+		return pj
+	}
+	job := func(name, cluster string, minute int, complete bool) prowapi.ProwJob {
+		return typedJob(prowapi.PeriodicJob, name, cluster, minute, complete)
+	}
 	jobs := []prowapi.ProwJob{
-		// We're using Cluster as a simple way to distinguish runs
-		{Spec: prowapi.ProwJobSpec{Job: "glob-1", Cluster: "1"}},
-		{Spec: prowapi.ProwJobSpec{Job: "glob-1", Cluster: "2"}},
-		{Spec: prowapi.ProwJobSpec{Job: "glob-2", Cluster: "1"}},
-		{Spec: prowapi.ProwJobSpec{Job: "job-a", Cluster: "1"}},
-		{Spec: prowapi.ProwJobSpec{Job: "job-ab", Cluster: "1"}},
+		job("glob-1", "1", 1, true),
+		job("glob-1", "2", 2, true),
+		job("glob-1", "3", 3, false),
+		job("glob-2", "1", 1, true),
+		job("glob-3", "1", 1, false),
+		job("job-a", "1", 1, true),
+		job("job-ab", "1", 1, true),
+		typedJob(prowapi.PresubmitJob, "glob-pr", "1", 1, true),
+		typedJob(prowapi.BatchJob, "glob-pr", "2", 2, true),
+		typedJob(prowapi.PresubmitJob, "glob-pr", "3", 3, false),
 	}
-	expected := []prowapi.ProwJob{
-		{Spec: prowapi.ProwJobSpec{Job: "glob-1", Cluster: "1"}},
-		{Spec: prowapi.ProwJobSpec{Job: "glob-2", Cluster: "1"}},
-		{Spec: prowapi.ProwJobSpec{Job: "job-a", Cluster: "1"}},
+	expected := []string{"glob-1 2", "glob-2 1", "glob-pr 2", "job-a 1"}
+	var actual []string
+	for _, job := range pickLatestJobs(jobs, "glob-*,job-a") {
+		actual = append(actual, job.Spec.Job+" "+job.Spec.Cluster)
 	}
-	result := pickLatestJobs(jobs, "glob-*,job-a")
-	if !reflect.DeepEqual(result, expected) {
-		fmt.Println("expected:")
-		for _, job := range expected {
-			fmt.Printf("  job: %s cluster: %s,", job.Spec.Job, job.Spec.Cluster)
-		}
-		fmt.Println("got:")
-		for _, job := range result {
-			fmt.Printf("  job: %s cluster: %s,", job.Spec.Job, job.Spec.Cluster)
-		}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the latest completed runs %v, got %v", expected, actual)
 	}
 }
 
@@ -60,6 +78,7 @@ func TestRenderBadge(t *testing.T) {
 		{nil, "darkgrey", "no results"},
 		{[]string{"success"}, "brightgreen", "passing"},
 		{[]string{"success", "failure"}, "red", "failing 2"},
+		{[]string{"success", "error"}, "red", "failing 2"},
 		{[]string{"success", "failure", "failure", "failure", "failure"}, "red", "failing 2, 3, 4, ..."},
 	} {
 		jobs := []prowapi.ProwJob{}
@@ -78,3 +97,74 @@ func TestRenderBadge(t *testing.T) {
 		}
 	}
 }
+
+func TestHandleBadge(t *testing.T) {
+	start := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	job := func(name string, minute int, state prowapi.ProwJobState) prowapi.ProwJob {
+		pj := prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", name, minute)},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: name},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(start.Add(time.Duration(minute) * time.Minute)),
+			},
+		}
+		if state != prowapi.PendingState {
+			pj.SetComplete()
+		}
+		return pj
+	}
+	ja := jobs.NewJobAgent(fjkc{
+		job("ci-foo", 1, prowapi.FailureState),
+		job("ci-foo", 2, prowapi.SuccessState),
+		job("ci-bar", 1, prowapi.SuccessState),
+		job("ci-bar", 2, prowapi.PendingState),
+		job("ci-baz", 1, prowapi.SuccessState),
+		job("ci-baz", 2, prowapi.FailureState),
+		job("ci-pending", 1, prowapi.PendingState),
+	}, nil, nil)
+	ja.Start()
+	handler := handleBadge(ja)
+
+	testCases := []struct {
+		jobs   string
+		status string
+		color  string
+	}{
+		{jobs: "ci-foo,ci-bar", status: "passing", color: "#4c1"},
+		{jobs: "ci-foo,ci-baz", status: "failing ci-baz", color: "#e05d44"},
+		{jobs: "ci-*", status: "failing ci-baz", color: "#e05d44"},
+		{jobs: "ci-unknown,ci-pending", status: "no results", color: "darkgrey"},
+		{jobs: "ci-foo,ci-unknown", status: "passing", color: "#4c1"},
+	}
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/badge.svg?jobs="+tc.jobs, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", tc.jobs, http.StatusOK, rr.Code)
+			continue
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "image/svg+xml" {
+			t.Errorf("%s: expected an SVG, got %q", tc.jobs, contentType)
+		}
+		if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != "max-age=60" {
+			t.Errorf("%s: expected the badge to be cached for a minute, got %q", tc.jobs, cacheControl)
+		}
+		body := rr.Body.String()
+		if !strings.Contains(body, ">"+tc.status+"</text>") {
+			t.Errorf("%s: expected status %q in badge %s", tc.jobs, tc.status, body)
+		}
+		if !strings.Contains(body, `fill="`+tc.color+`"`) {
+			t.Errorf("%s: expected color %q in badge %s", tc.jobs, tc.color, body)
+		}
+		if width := fmt.Sprintf(`width="%d"`, 13+6*len("build")+13+6*len(tc.status)); !strings.Contains(body, width) {
+			t.Errorf("%s: expected the badge to fit its text with %s, got %s", tc.jobs, width, body)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/badge.svg", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without jobs, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
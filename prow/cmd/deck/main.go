@@ -25,10 +25,12 @@ import (
 	"flag"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -48,6 +50,7 @@ import (
 	"k8s.io/test-infra/prow/githuboauth"
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/logrusutil"
+	"k8s.io/test-infra/prow/metrics"
 	"k8s.io/test-infra/prow/pjutil"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/prstatus"
@@ -78,6 +81,9 @@ type options struct {
 	spyglass              bool
 	spyglassFilesLocation string
 	gcsCredentialsFile    string
+	allowAnyone           bool
+	maxLogStreams         int
+	maxLogStreamDuration  time.Duration
 }
 
 func (o *options) Validate() error {
@@ -115,6 +121,9 @@ func gatherOptions() options {
 	flag.StringVar(&o.staticFilesLocation, "static-files-location", "/static", "Path to the static files")
 	flag.StringVar(&o.templateFilesLocation, "template-files-location", "/template", "Path to the template files")
 	flag.StringVar(&o.gcsCredentialsFile, "gcs-credentials-file", "", "Path to the GCS credentials file")
+	flag.IntVar(&o.maxLogStreams, "max-log-streams", 50, "Maximum number of job logs that are followed at the same time.")
+	flag.DurationVar(&o.maxLogStreamDuration, "max-log-stream-duration", time.Hour, "Maximum time a job log is followed for.")
+	flag.BoolVar(&o.allowAnyone, "allow-anyone", false, "Allow anyone to rerun jobs by POSTing to /rerun. Requests are not authenticated.")
 	flag.Parse()
 	return o
 }
@@ -222,12 +231,19 @@ func prodOnlyMain(cfg config.Getter, o options, mux *http.ServeMux) *http.ServeM
 	ja := jobs.NewJobAgent(kc, plClients, cfg)
 	ja.Start()
 
+	// Push metrics to the configured prometheus pushgateway endpoint.
+	pushGateway := cfg().PushGateway
+	if pushGateway.Endpoint != "" {
+		go metrics.PushMetrics("deck", pushGateway.Endpoint, pushGateway.Interval)
+	}
+
 	// setup prod only handlers
 	mux.Handle("/data.js", gziphandler.GzipHandler(handleData(ja)))
 	mux.Handle("/prowjobs.js", gziphandler.GzipHandler(handleProwJobs(ja)))
 	mux.Handle("/badge.svg", gziphandler.GzipHandler(handleBadge(ja)))
-	mux.Handle("/log", gziphandler.GzipHandler(handleLog(ja)))
-	mux.Handle("/rerun", gziphandler.GzipHandler(handleRerun(kc)))
+	mux.Handle("/log", gziphandler.GzipHandler(handleLog(ja, newLogStreams(o.maxLogStreams, o.maxLogStreamDuration))))
+	mux.Handle("/rerun", gziphandler.GzipHandler(handleRerun(kc, cfg, o.allowAnyone)))
+	mux.Handle("/prowjob", gziphandler.GzipHandler(handleProwJob(kc, cfg)))
 
 	if o.spyglass {
 		initSpyglass(cfg, o, mux, ja)
@@ -251,6 +267,7 @@ func prodOnlyMain(cfg config.Getter, o options, mux *http.ServeMux) *http.ServeM
 		ta.start()
 		mux.Handle("/tide.js", gziphandler.GzipHandler(handleTidePools(cfg, ta)))
 		mux.Handle("/tide-history.js", gziphandler.GzipHandler(handleTideHistory(ta)))
+		mux.Handle("/tide-queue.js", gziphandler.GzipHandler(handleTideQueue(ta)))
 	}
 
 	// Enable Git OAuth feature if oauthURL is provided.
@@ -311,6 +328,7 @@ func prodOnlyMain(cfg config.Getter, o options, mux *http.ServeMux) *http.ServeM
 		prStatusAgent := prstatus.NewDashboardAgent(
 			repos,
 			&githubOAuthConfig,
+			ja.ProwJobs,
 			logrus.WithField("client", "pr-status"))
 
 		mux.Handle("/pr-data.js", handleNotCached(
@@ -409,6 +427,14 @@ func setHeadersNoCaching(w http.ResponseWriter) {
 	w.Header().Set("Expires", "0")
 }
 
+// setLastModified tells clients when the jobs they are served were listed.
+// It is called before the jobs are read, so the jobs are at least as recent.
+func setLastModified(w http.ResponseWriter, ja *jobs.JobAgent) {
+	if updated := ja.LastUpdated(); !updated.IsZero() {
+		w.Header().Set("Last-Modified", updated.UTC().Format(http.TimeFormat))
+	}
+}
+
 func handleNotCached(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setHeadersNoCaching(w)
@@ -419,6 +445,7 @@ func handleNotCached(next http.Handler) http.HandlerFunc {
 func handleProwJobs(ja *jobs.JobAgent) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setHeadersNoCaching(w)
+		setLastModified(w, ja)
 		jobs := ja.ProwJobs()
 		if v := r.URL.Query().Get("omit"); v == "pod_spec" {
 			for i := range jobs {
@@ -442,18 +469,62 @@ func handleProwJobs(ja *jobs.JobAgent) http.HandlerFunc {
 	}
 }
 
+// handleData serves the jobs that match the filters in the query:
+//
+// /data.js?type=<type>&repo=<org/repo>&job=<job>&state=<state>&pull=<number>&author=<login>
+//
+// The jobs are served as a list, unless a limit or a continuation token is
+// given, in which case they are served as a page:
+//
+// {"items": [...], "continue": "<token of the next page>"}
 func handleData(ja *jobs.JobAgent) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setHeadersNoCaching(w)
-		jobs := ja.Jobs()
-		jd, err := json.Marshal(jobs)
+		query := r.URL.Query()
+		filter, err := jobFilter(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		setLastModified(w, ja)
+		matched := []jobs.Job{}
+		for _, job := range ja.Jobs() {
+			if filter.Matches(job) {
+				matched = append(matched, job)
+			}
+		}
+		var data interface{} = matched
+		if query.Get("limit") != "" || query.Get("continue") != "" {
+			limit := 0
+			if l := query.Get("limit"); l != "" {
+				if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+					http.Error(w, fmt.Sprintf("limit must be a positive number, got %q", l), http.StatusBadRequest)
+					return
+				}
+			}
+			page, next, err := jobs.Page(matched, limit, query.Get("continue"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data = struct {
+				Items    []jobs.Job `json:"items"`
+				Continue string     `json:"continue,omitempty"`
+			}{page, next}
+		}
+		jd, err := json.Marshal(data)
 		if err != nil {
 			logrus.WithError(err).Error("Error marshaling jobs.")
 			jd = []byte("[]")
 		}
+		if acceptsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, string(jd))
+			return
+		}
 		// If we have a "var" query, then write out "var value = {...};".
 		// Otherwise, just write out the JSON.
-		if v := r.URL.Query().Get("var"); v != "" {
+		if v := query.Get("var"); v != "" {
 			fmt.Fprintf(w, "var %s = %s;", v, string(jd))
 		} else {
 			fmt.Fprint(w, string(jd))
@@ -461,6 +532,35 @@ func handleData(ja *jobs.JobAgent) http.HandlerFunc {
 	}
 }
 
+// jobFilter returns the filter given by the query.
+func jobFilter(query url.Values) (jobs.Filter, error) {
+	filter := jobs.Filter{
+		Type:   query.Get("type"),
+		Repo:   query.Get("repo"),
+		Job:    query.Get("job"),
+		State:  query.Get("state"),
+		Author: query.Get("author"),
+	}
+	if p := query.Get("pull"); p != "" {
+		pull, err := strconv.Atoi(p)
+		if err != nil || pull <= 0 {
+			return filter, fmt.Errorf("pull must be a pull request number, got %q", p)
+		}
+		filter.Pull = pull
+	}
+	return filter, nil
+}
+
+// acceptsJSON tells whether the request asks for plain JSON.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.SplitN(accept, ";", 2)[0]) == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
 // handleBadge handles requests to get a badge for one or more jobs
 // The url must look like this, where `jobs` is a comma-separated
 // list of globs:
@@ -473,13 +573,17 @@ func handleData(ja *jobs.JobAgent) http.HandlerFunc {
 // - /badge.svg?jobs=pull-kubernetes-e2e*,pull-kubernetes-*,pull-kubernetes-integration-*
 func handleBadge(ja *jobs.JobAgent) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		setHeadersNoCaching(w)
 		wantJobs := r.URL.Query().Get("jobs")
 		if wantJobs == "" {
+			setHeadersNoCaching(w)
 			http.Error(w, "missing jobs query parameter", http.StatusBadRequest)
 			return
 		}
+		// Badges are embedded in READMEs, so let them be cached for as
+		// long as it takes to sync the jobs again.
+		w.Header().Set("Cache-Control", "max-age=60")
 		w.Header().Set("Content-Type", "image/svg+xml")
+		setLastModified(w, ja)
 
 		allJobs := ja.ProwJobs()
 		_, _, svg := renderBadge(pickLatestJobs(allJobs, wantJobs))
@@ -805,6 +909,31 @@ func handleTidePools(cfg config.Getter, ta *tideAgent) http.HandlerFunc {
 	}
 }
 
+// handleTideQueue serves the status of the tide pools, including when tide
+// last synced them and why its last sync failed.
+func handleTideQueue(ta *tideAgent) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setHeadersNoCaching(w)
+
+		ta.Lock()
+		queue := ta.queue
+		ta.Unlock()
+
+		pd, err := json.Marshal(queue)
+		if err != nil {
+			logrus.WithError(err).Error("Error marshaling payload.")
+			pd = []byte("{}")
+		}
+		// If we have a "var" query, then write out "var value = {...};".
+		// Otherwise, just write out the JSON.
+		if v := r.URL.Query().Get("var"); v != "" {
+			fmt.Fprintf(w, "var %s = %s;", v, string(pd))
+		} else {
+			fmt.Fprint(w, string(pd))
+		}
+	}
+}
+
 func handleTideHistory(ta *tideAgent) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setHeadersNoCaching(w)
@@ -856,10 +985,26 @@ func handlePluginHelp(ha *helpAgent) http.HandlerFunc {
 
 type logClient interface {
 	GetJobLog(job, id string) ([]byte, error)
+	FollowJobLog(job, id string) (io.ReadCloser, error)
+	GetProwJob(job, id string) (prowapi.ProwJob, error)
+}
+
+// logStreams limits how many job logs are followed at the same time, and
+// for how long, so that the streams do not overload the apiserver.
+type logStreams struct {
+	slots       chan struct{}
+	maxDuration time.Duration
+}
+
+func newLogStreams(max int, maxDuration time.Duration) *logStreams {
+	return &logStreams{
+		slots:       make(chan struct{}, max),
+		maxDuration: maxDuration,
+	}
 }
 
 // TODO(spxtr): Cache, rate limit.
-func handleLog(lc logClient) http.HandlerFunc {
+func handleLog(lc logClient, streams *logStreams) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		setHeadersNoCaching(w)
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -870,6 +1015,10 @@ func handleLog(lc logClient) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if follow, _ := strconv.ParseBool(r.URL.Query().Get("follow")); follow {
+			followLog(w, r, lc, streams, logger)
+			return
+		}
 		log, err := lc.GetJobLog(job, id)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Log not found: %v", err), http.StatusNotFound)
@@ -891,6 +1040,68 @@ func handleLog(lc logClient) http.HandlerFunc {
 	}
 }
 
+// followLog streams the log of the job as it is written, flushing every
+// chunk to the client. Jobs that completed are redirected to their URL if
+// their log cannot be followed, as their pod is likely gone.
+func followLog(w http.ResponseWriter, r *http.Request, lc logClient, streams *logStreams, logger *logrus.Entry) {
+	select {
+	case streams.slots <- struct{}{}:
+		defer func() { <-streams.slots }()
+	default:
+		http.Error(w, "Too many logs are being followed, try again later.", http.StatusTooManyRequests)
+		return
+	}
+	job := r.URL.Query().Get("job")
+	id := r.URL.Query().Get("id")
+	stream, err := lc.FollowJobLog(job, id)
+	if err != nil {
+		if pj, pjErr := lc.GetProwJob(job, id); pjErr == nil && pj.Complete() && pj.Status.URL != "" {
+			http.Redirect(w, r, pj.Status.URL, http.StatusFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Log not found: %v", err), http.StatusNotFound)
+		logger.WithError(err).Info("Log cannot be followed.")
+		return
+	}
+	defer stream.Close()
+
+	// Reads from the stream only stop when it is closed.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		timer := time.NewTimer(streams.maxDuration)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+		case <-timer.C:
+		case <-done:
+		}
+		stream.Close()
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				logger.WithError(err).Debug("Error writing log.")
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			logger.WithError(err).Debug("Stopped following log.")
+			return
+		}
+	}
+}
+
 func validateLogRequest(r *http.Request) error {
 	job := r.URL.Query().Get("job")
 	id := r.URL.Query().Get("id")
@@ -906,22 +1117,65 @@ func validateLogRequest(r *http.Request) error {
 
 type pjClient interface {
 	GetProwJob(string) (prowapi.ProwJob, error)
+	CreateProwJob(prowapi.ProwJob) (prowapi.ProwJob, error)
 }
 
-func handleRerun(kc pjClient) http.HandlerFunc {
+// handleRerun serves a new ProwJob with the spec of the given one:
+//
+// GET /rerun?prowjob=<name> serves the new ProwJob for the user to create.
+// GET /rerun?prowjob=<name>&mode=gh serves the command that reruns the job
+// when commented on its pull request.
+// POST /rerun?prowjob=<name> creates the new ProwJob, if allowAnyone is set.
+//
+// Jobs that are no longer configured are not rerun.
+func handleRerun(kc pjClient, cfg config.Getter, allowAnyone bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		name := r.URL.Query().Get("prowjob")
 		if name == "" {
 			http.Error(w, "request did not provide the 'name' query parameter", http.StatusBadRequest)
 			return
 		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
 		pj, err := kc.GetProwJob(name)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("ProwJob not found: %v", err), http.StatusNotFound)
 			logrus.WithError(err).Warning("ProwJob not found.")
 			return
 		}
+		c := cfg()
+		if err := c.CheckJobExists(pj.Spec); err != nil {
+			http.Error(w, fmt.Sprintf("ProwJob %s cannot be rerun: %v", name, err), http.StatusGone)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Query().Get("mode") == "gh" {
+			if pj.Spec.Type != prowapi.PresubmitJob {
+				http.Error(w, fmt.Sprintf("ProwJob %s is a %s job, only presubmits can be rerun from GitHub", name, pj.Spec.Type), http.StatusBadRequest)
+				return
+			}
+			ps := c.GetPresubmit(pj.Spec.Refs.Org+"/"+pj.Spec.Refs.Repo, pj.Spec.Job)
+			if ps == nil {
+				http.Error(w, fmt.Sprintf("ProwJob %s cannot be rerun: no config for presubmit %s", name, pj.Spec.Job), http.StatusGone)
+				return
+			}
+			fmt.Fprint(w, ps.RerunCommand)
+			return
+		}
 		pjutil := pjutil.NewProwJob(pj.Spec, pj.ObjectMeta.Labels)
+		if r.Method == http.MethodPost {
+			if !allowAnyone {
+				http.Error(w, "Rerunning jobs from deck is not allowed.", http.StatusForbidden)
+				return
+			}
+			if pjutil, err = kc.CreateProwJob(pjutil); err != nil {
+				http.Error(w, fmt.Sprintf("Error creating ProwJob: %v", err), http.StatusInternalServerError)
+				logrus.WithError(err).Error("Error creating ProwJob.")
+				return
+			}
+			logrus.WithField("prowjob", pjutil.ObjectMeta.Name).WithField("from", name).Info("Rerunning ProwJob.")
+		}
 		b, err := yaml.Marshal(&pjutil)
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Error marshaling: %v", err), http.StatusInternalServerError)
@@ -934,6 +1188,68 @@ func handleRerun(kc pjClient) http.HandlerFunc {
 	}
 }
 
+// handleProwJob serves the ProwJob with the given name as YAML:
+//
+// /prowjob?prowjob=<name>
+//
+// The values of environment variables whose names match deck.redacted_env
+// are redacted.
+func handleProwJob(kc pjClient, cfg config.Getter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setHeadersNoCaching(w)
+		name := r.URL.Query().Get("prowjob")
+		if name == "" {
+			http.Error(w, "request did not provide the 'prowjob' query parameter", http.StatusBadRequest)
+			return
+		}
+		pj, err := kc.GetProwJob(name)
+		if err != nil {
+			if _, isNotFound := err.(kube.NotFoundError); isNotFound {
+				http.Error(w, fmt.Sprintf("ProwJob %s not found", name), http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Error getting ProwJob: %v", err), http.StatusInternalServerError)
+			logrus.WithError(err).WithField("prowjob", name).Warning("Error getting ProwJob.")
+			return
+		}
+		redacted := redactEnv(pj, cfg().Deck.RedactedEnv)
+		b, err := yaml.Marshal(&redacted)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error marshaling: %v", err), http.StatusInternalServerError)
+			logrus.WithError(err).Error("Error marshaling ProwJob.")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write(b); err != nil {
+			logrus.WithError(err).Error("Error writing ProwJob.")
+		}
+	}
+}
+
+// redactEnv returns a copy of the ProwJob with the values of the environment
+// variables of its containers that match any of the patterns redacted.
+func redactEnv(pj prowapi.ProwJob, patterns []*regexp.Regexp) prowapi.ProwJob {
+	pj = *pj.DeepCopy()
+	if pj.Spec.PodSpec == nil {
+		return pj
+	}
+	redact := func(containers []kube.Container) {
+		for i := range containers {
+			for j, env := range containers[i].Env {
+				for _, pattern := range patterns {
+					if pattern.MatchString(env.Name) {
+						containers[i].Env[j].Value = "[REDACTED]"
+						break
+					}
+				}
+			}
+		}
+	}
+	redact(pj.Spec.PodSpec.InitContainers)
+	redact(pj.Spec.PodSpec.Containers)
+	return pj
+}
+
 func handleConfig(cfg config.Getter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// TODO(bentheelder): add the ability to query for portions of the config?
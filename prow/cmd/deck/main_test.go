@@ -19,6 +19,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,14 +29,20 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
+	"k8s.io/test-infra/prow/deck/jobs"
+	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/tide"
 	"k8s.io/test-infra/prow/tide/history"
@@ -100,15 +107,32 @@ func TestOptions_Validate(t *testing.T) {
 	}
 }
 
-type flc int
+type flc struct {
+	stream io.ReadCloser
+	pj     prowapi.ProwJob
+}
 
-func (f flc) GetJobLog(job, id string) ([]byte, error) {
+func (f *flc) GetJobLog(job, id string) ([]byte, error) {
 	if job == "job" && id == "123" {
 		return []byte("hello"), nil
 	}
 	return nil, errors.New("muahaha")
 }
 
+func (f *flc) FollowJobLog(job, id string) (io.ReadCloser, error) {
+	if job == "job" && id == "123" && f.stream != nil {
+		return f.stream, nil
+	}
+	return nil, errors.New("muahaha")
+}
+
+func (f *flc) GetProwJob(job, id string) (prowapi.ProwJob, error) {
+	if job == "job" && id == "123" {
+		return f.pj, nil
+	}
+	return prowapi.ProwJob{}, errors.New("muahaha")
+}
+
 func TestHandleLog(t *testing.T) {
 	var testcases = []struct {
 		name string
@@ -141,7 +165,7 @@ func TestHandleLog(t *testing.T) {
 			code: http.StatusNotFound,
 		},
 	}
-	handler := handleLog(flc(0))
+	handler := handleLog(&flc{}, newLogStreams(1, time.Minute))
 	for _, tc := range testcases {
 		req, err := http.NewRequest(http.MethodGet, "", nil)
 		if err != nil {
@@ -192,56 +216,523 @@ func TestHandleLog(t *testing.T) {
 	}
 }
 
-type fpjc prowapi.ProwJob
+func TestHandleLogFollow(t *testing.T) {
+	const path = "?job=job&id=123&follow=true"
+	// read returns what the next read of the log gets, failing if the
+	// chunk that was written is not flushed right away.
+	read := func(body io.Reader, pw *io.PipeWriter, chunk string) string {
+		go pw.Write([]byte(chunk))
+		buf := make([]byte, 64)
+		n, err := body.Read(buf)
+		if err != nil && err != io.EOF {
+			t.Fatalf("Error reading log: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	pr, pw := io.Pipe()
+	streams := newLogStreams(1, time.Minute)
+	ts := httptest.NewServer(handleLog(&flc{stream: pr}, streams))
+	defer ts.Close()
+	go pw.Write([]byte("first\n"))
+	resp, err := http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("Error following log: %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 64)
+	if n, _ := resp.Body.Read(buf); string(buf[:n]) != "first\n" {
+		t.Errorf("Expected the first chunk as soon as it is written, got %q", string(buf[:n]))
+	}
+	if chunk := read(resp.Body, pw, "second\n"); chunk != "second\n" {
+		t.Errorf("Expected the second chunk as soon as it is written, got %q", chunk)
+	}
+	if other, err := http.Get(ts.URL + path); err != nil {
+		t.Errorf("Error following log: %v", err)
+	} else if other.Body.Close(); other.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d while another log is followed, got %d", http.StatusTooManyRequests, other.StatusCode)
+	}
+	pw.Close()
+	if rest, err := ioutil.ReadAll(resp.Body); err != nil || len(rest) != 0 {
+		t.Errorf("Expected the response to end with the log, got %q, %v", string(rest), err)
+	}
+
+	// The stream is closed when the client goes away.
+	pr, pw = io.Pipe()
+	ts = httptest.NewServer(handleLog(&flc{stream: pr}, newLogStreams(1, time.Minute)))
+	defer ts.Close()
+	req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go pw.Write([]byte("first\n"))
+	resp, err = http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("Error following log: %v", err)
+	}
+	defer resp.Body.Close()
+	cancel()
+	closed := false
+	for i := 0; i < 100 && !closed; i++ {
+		if _, err := pw.Write([]byte("after the client is gone\n")); err == io.ErrClosedPipe {
+			closed = true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !closed {
+		t.Error("Expected the log stream to be closed after the client went away")
+	}
+
+	// The stream is closed after the maximum duration.
+	pr, pw = io.Pipe()
+	ts = httptest.NewServer(handleLog(&flc{stream: pr}, newLogStreams(1, 10*time.Millisecond)))
+	defer ts.Close()
+	go pw.Write([]byte("first\n"))
+	resp, err = http.Get(ts.URL + path)
+	if err != nil {
+		t.Fatalf("Error following log: %v", err)
+	}
+	defer resp.Body.Close()
+	if log, err := ioutil.ReadAll(resp.Body); err != nil || string(log) != "first\n" {
+		t.Errorf("Expected the log to end after the maximum duration, got %q, %v", string(log), err)
+	}
+}
+
+func TestHandleLogFollowCompleted(t *testing.T) {
+	completed := metav1.Now()
+	testCases := []struct {
+		name     string
+		pj       prowapi.ProwJob
+		code     int
+		location string
+	}{
+		{
+			name: "completed job is redirected to its URL",
+			pj: prowapi.ProwJob{Status: prowapi.ProwJobStatus{
+				State:          prowapi.SuccessState,
+				CompletionTime: &completed,
+				URL:            "https://prow.k8s.io/view/gcs/bucket/logs/job/123",
+			}},
+			code:     http.StatusFound,
+			location: "https://prow.k8s.io/view/gcs/bucket/logs/job/123",
+		},
+		{
+			name: "running job is not found",
+			pj: prowapi.ProwJob{Status: prowapi.ProwJobStatus{
+				State: prowapi.PendingState,
+				URL:   "https://prow.k8s.io/view/gcs/bucket/logs/job/123",
+			}},
+			code: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		handler := handleLog(&flc{pj: tc.pj}, newLogStreams(1, time.Minute))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/log?job=job&id=123&follow=true", nil))
+		if rr.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.name, tc.code, rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != tc.location {
+			t.Errorf("%s: expected location %q, got %q", tc.name, tc.location, location)
+		}
+	}
+}
+
+type fjkc []prowapi.ProwJob
+
+func (f fjkc) GetLog(pod string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f fjkc) ListPods(selector string) ([]kube.Pod, error) {
+	return nil, nil
+}
+
+func (f fjkc) ListProwJobs(selector string) ([]prowapi.ProwJob, error) {
+	return f, nil
+}
+
+func TestHandleData(t *testing.T) {
+	start := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	job := func(name string, minute int, jobType prowapi.ProwJobType, repo, job string, state prowapi.ProwJobState, pulls ...prowapi.Pull) prowapi.ProwJob {
+		org := strings.Split(repo, "/")[0]
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Type: jobType,
+				Job:  job,
+				Refs: &prowapi.Refs{Org: org, Repo: strings.TrimPrefix(repo, org+"/"), Pulls: pulls},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(start.Add(time.Duration(minute) * time.Minute)),
+			},
+		}
+	}
+	alice := prowapi.Pull{Number: 12345, Author: "alice"}
+	bob := prowapi.Pull{Number: 54321, Author: "bob"}
+	ja := jobs.NewJobAgent(fjkc{
+		job("a", 5, prowapi.PresubmitJob, "kubernetes/kubernetes", "pull-e2e", prowapi.FailureState, alice),
+		job("b", 4, prowapi.PresubmitJob, "kubernetes/kubernetes", "pull-e2e", prowapi.SuccessState, bob),
+		job("c", 3, prowapi.PresubmitJob, "kubernetes/test-infra", "pull-e2e", prowapi.FailureState, alice),
+		job("d", 3, prowapi.BatchJob, "kubernetes/kubernetes", "pull-e2e", prowapi.FailureState, alice, bob),
+		job("e", 2, prowapi.PostsubmitJob, "kubernetes/kubernetes", "post-build", prowapi.FailureState),
+		job("f", 1, prowapi.PresubmitJob, "kubernetes/kubernetes", "pull-verify", prowapi.PendingState, alice),
+	}, nil, nil)
+	ja.Start()
+	handler := handleData(ja)
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	names := func(js []jobs.Job) []string {
+		names := []string{}
+		for _, j := range js {
+			names = append(names, j.ProwJob)
+		}
+		return names
+	}
+
+	filters := []struct {
+		query    string
+		expected []string
+	}{
+		{query: "", expected: []string{"a", "b", "c", "d", "e", "f"}},
+		{query: "type=presubmit", expected: []string{"a", "b", "c", "f"}},
+		{query: "repo=kubernetes/test-infra", expected: []string{"c"}},
+		{query: "job=pull-e2e&state=failure", expected: []string{"a", "c", "d"}},
+		{query: "type=presubmit&repo=kubernetes/kubernetes&job=pull-e2e&state=failure&pull=12345&author=alice", expected: []string{"a"}},
+		{query: "pull=54321", expected: []string{"b", "d"}},
+		{query: "author=Alice&state=pending", expected: []string{"f"}},
+		{query: "pull=12345&author=bob", expected: []string{}},
+	}
+	for _, f := range filters {
+		rr := get("/data.js?"+f.query, nil)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%q: expected status %d, got %d", f.query, http.StatusOK, rr.Code)
+			continue
+		}
+		var res []jobs.Job
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Errorf("%q: error unmarshaling jobs: %v", f.query, err)
+			continue
+		}
+		if actual := names(res); !reflect.DeepEqual(actual, f.expected) {
+			t.Errorf("%q: expected jobs %v, got %v", f.query, f.expected, actual)
+		}
+	}
+
+	rr := get("/data.js", nil)
+	if lastModified, err := http.ParseTime(rr.Header().Get("Last-Modified")); err != nil {
+		t.Errorf("expected the update time of the jobs in Last-Modified, got %q: %v", rr.Header().Get("Last-Modified"), err)
+	} else if updated := ja.LastUpdated().Truncate(time.Second); !lastModified.Equal(updated) {
+		t.Errorf("expected the jobs to be last modified at %v, got %v", updated, lastModified)
+	}
+
+	// Pages are ordered from the newest job to the oldest one, with jobs that
+	// started at the same time ordered by name.
+	var pages [][]string
+	token := ""
+	for i := 0; i < 5; i++ {
+		rr := get("/data.js?limit=2&continue="+token, http.Header{"Accept": {"application/json"}})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d for a page, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("expected JSON content, got %q", contentType)
+		}
+		var page struct {
+			Items    []jobs.Job `json:"items"`
+			Continue string     `json:"continue"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+			t.Fatalf("error unmarshaling page: %v", err)
+		}
+		pages = append(pages, names(page.Items))
+		if token = page.Continue; token == "" {
+			break
+		}
+	}
+	if expected := [][]string{{"a", "b"}, {"c", "d"}, {"e", "f"}}; !reflect.DeepEqual(pages, expected) {
+		t.Errorf("expected pages %v, got %v", expected, pages)
+	}
+
+	if rr := get("/data.js?var=allBuilds&state=pending", nil); rr.Body.String() != fmt.Sprintf("var allBuilds = %s;", get("/data.js?state=pending", nil).Body.String()) {
+		t.Errorf("expected the jobs to be assigned to the variable, got %s", rr.Body.String())
+	}
+	if rr := get("/data.js?var=allBuilds&state=pending", http.Header{"Accept": {"text/html, application/json;q=0.9"}}); strings.HasPrefix(rr.Body.String(), "var") {
+		t.Errorf("expected plain JSON when it is accepted, got %s", rr.Body.String())
+	}
+	for _, query := range []string{"pull=abc", "limit=0", "limit=two", "continue=invalid"} {
+		if rr := get("/data.js?"+query, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected status %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
+
+type fpjc struct {
+	pj      prowapi.ProwJob
+	created []prowapi.ProwJob
+}
 
 func (fc *fpjc) GetProwJob(name string) (prowapi.ProwJob, error) {
-	return prowapi.ProwJob(*fc), nil
+	if name != fc.pj.ObjectMeta.Name {
+		return prowapi.ProwJob{}, kube.NewNotFoundError(fmt.Errorf("prowjob %s not found", name))
+	}
+	return fc.pj, nil
+}
+
+func (fc *fpjc) CreateProwJob(pj prowapi.ProwJob) (prowapi.ProwJob, error) {
+	fc.created = append(fc.created, pj)
+	return pj, nil
 }
 
-// TestRerun just checks that the result can be unmarshaled properly, has an
-// updated status, and has equal spec.
 func TestRerun(t *testing.T) {
-	fc := fpjc(prowapi.ProwJob{
-		Spec: prowapi.ProwJobSpec{
-			Job:  "whoa",
-			Type: prowapi.PresubmitJob,
-			Refs: &prowapi.Refs{
-				Org:  "org",
-				Repo: "repo",
-				Pulls: []prowapi.Pull{
-					{Number: 1},
+	completed := metav1.Now()
+	pj := func(job string) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: "wowsuch"},
+			Spec: prowapi.ProwJobSpec{
+				Job:  job,
+				Type: prowapi.PresubmitJob,
+				Refs: &prowapi.Refs{
+					Org:  "org",
+					Repo: "repo",
+					Pulls: []prowapi.Pull{
+						{Number: 1},
+					},
 				},
 			},
+			Status: prowapi.ProwJobStatus{
+				State:          prowapi.FailureState,
+				Description:    "Job failed.",
+				URL:            "https://prow.k8s.io/log?job=whoa",
+				BuildID:        "1234",
+				CompletionTime: &completed,
+			},
+		}
+	}
+	cfg := func() *config.Config {
+		return &config.Config{
+			JobConfig: config.JobConfig{
+				Presubmits: map[string][]config.Presubmit{
+					"org/repo": {{
+						JobBase:      config.JobBase{Name: "whoa"},
+						RerunCommand: "/test whoa",
+					}},
+				},
+			},
+		}
+	}
+	testCases := []struct {
+		name        string
+		method      string
+		query       string
+		job         string
+		allowAnyone bool
+		reloaded    bool
+		code        int
+		body        string
+		created     bool
+	}{
+		{
+			name:   "GET serves the new ProwJob",
+			method: http.MethodGet,
+			job:    "whoa",
+			code:   http.StatusOK,
 		},
-		Status: prowapi.ProwJobStatus{
-			State: prowapi.PendingState,
+		{
+			name:        "POST creates the new ProwJob",
+			method:      http.MethodPost,
+			job:         "whoa",
+			allowAnyone: true,
+			code:        http.StatusOK,
+			created:     true,
+		},
+		{
+			name:   "POST is refused unless anyone is allowed to rerun",
+			method: http.MethodPost,
+			job:    "whoa",
+			code:   http.StatusForbidden,
+		},
+		{
+			name:        "stale job is not rerun",
+			method:      http.MethodPost,
+			job:         "renamed",
+			allowAnyone: true,
+			code:        http.StatusGone,
+		},
+		{
+			name:   "stale job is not served",
+			method: http.MethodGet,
+			job:    "renamed",
+			code:   http.StatusGone,
+		},
+		{
+			name:   "GitHub mode serves the rerun command",
+			method: http.MethodGet,
+			query:  "&mode=gh",
+			job:    "whoa",
+			code:   http.StatusOK,
+			body:   "/test whoa",
+		},
+		{
+			name:     "GitHub mode uses one config when it is reloaded",
+			method:   http.MethodGet,
+			query:    "&mode=gh",
+			job:      "whoa",
+			reloaded: true,
+			code:     http.StatusOK,
+			body:     "/test whoa",
+		},
+		{
+			name:   "other methods are not allowed",
+			method: http.MethodDelete,
+			job:    "whoa",
+			code:   http.StatusMethodNotAllowed,
 		},
-	})
-	handler := handleRerun(&fc)
-	req, err := http.NewRequest(http.MethodGet, "/rerun?prowjob=wowsuch", nil)
-	if err != nil {
-		t.Fatalf("Error making request: %v", err)
 	}
-	rr := httptest.NewRecorder()
-	handler.ServeHTTP(rr, req)
+	for _, tc := range testCases {
+		fc := &fpjc{pj: pj(tc.job)}
+		getter := cfg
+		if tc.reloaded {
+			// The job is gone from every config after the first one.
+			var calls int
+			getter = func() *config.Config {
+				calls++
+				if calls > 1 {
+					return &config.Config{}
+				}
+				return cfg()
+			}
+		}
+		handler := handleRerun(fc, getter, tc.allowAnyone)
+		req := httptest.NewRequest(tc.method, "/rerun?prowjob=wowsuch"+tc.query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d: %s", tc.name, tc.code, rr.Code, rr.Body.String())
+			continue
+		}
+		if tc.created != (len(fc.created) == 1) {
+			t.Errorf("%s: expected a ProwJob to be created: %t, created %d", tc.name, tc.created, len(fc.created))
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		if tc.body != "" {
+			if rr.Body.String() != tc.body {
+				t.Errorf("%s: expected body %q, got %q", tc.name, tc.body, rr.Body.String())
+			}
+			continue
+		}
+		var res prowapi.ProwJob
+		if err := yaml.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: error unmarshaling: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(res.Spec, fc.pj.Spec) {
+			t.Errorf("%s: expected the spec to be copied, got %v", tc.name, res.Spec)
+		}
+		if res.ObjectMeta.Name == "" || res.ObjectMeta.Name == fc.pj.ObjectMeta.Name {
+			t.Errorf("%s: expected a new name, got %q", tc.name, res.ObjectMeta.Name)
+		}
+		if res.Status.State != prowapi.TriggeredState {
+			t.Errorf("%s: wrong state, expected %q, got %q", tc.name, prowapi.TriggeredState, res.Status.State)
+		}
+		if res.Status.Description != "" || res.Status.URL != "" || res.Status.BuildID != "" || res.Status.CompletionTime != nil {
+			t.Errorf("%s: expected the status not to be copied, got %+v", tc.name, res.Status)
+		}
+		if tc.created && !reflect.DeepEqual(fc.created[0].Spec, res.Spec) {
+			t.Errorf("%s: expected the served ProwJob to be created, created %v", tc.name, fc.created[0])
+		}
+	}
+}
+
+func TestHandleProwJob(t *testing.T) {
+	fc := &fpjc{pj: prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "wowsuch"},
+		Spec: prowapi.ProwJobSpec{
+			Job:  "whoa",
+			Type: prowapi.PeriodicJob,
+			PodSpec: &kube.PodSpec{
+				InitContainers: []kube.Container{{
+					Name: "setup",
+					Env:  []kube.EnvVar{{Name: "GITHUB_TOKEN", Value: "init-secret"}},
+				}},
+				Containers: []kube.Container{{
+					Image: "alpine",
+					Env: []kube.EnvVar{
+						{Name: "DB_PASSWORD", Value: "hunter2"},
+						{Name: "API_TOKEN_FILE", Value: "token-secret"},
+						{Name: "IMAGE", Value: "alpine"},
+					},
+				}},
+			},
+		},
+		Status: prowapi.ProwJobStatus{State: prowapi.SuccessState},
+	}}
+	cfg := func() *config.Config {
+		return &config.Config{ProwConfig: config.ProwConfig{Deck: config.Deck{
+			RedactedEnv: []*regexp.Regexp{regexp.MustCompile("^(?:.*TOKEN.*)$"), regexp.MustCompile("^(?:.*PASSWORD.*)$")},
+		}}}
+	}
+	handler := handleProwJob(fc, cfg)
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/prowjob?prowjob=wowsuch")
 	if rr.Code != http.StatusOK {
-		t.Fatalf("Bad error code: %d", rr.Code)
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
 	}
-	resp := rr.Result()
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		t.Fatalf("Error reading response body: %v", err)
+	if contentType := rr.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected plain text, got %q", contentType)
+	}
+	body := rr.Body.String()
+	for _, secret := range []string{"init-secret", "hunter2", "token-secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("Expected %q to be redacted, got %s", secret, body)
+		}
 	}
 	var res prowapi.ProwJob
-	if err := yaml.Unmarshal(body, &res); err != nil {
+	if err := yaml.Unmarshal(rr.Body.Bytes(), &res); err != nil {
 		t.Fatalf("Error unmarshaling: %v", err)
 	}
-	if res.Spec.Job != "whoa" {
-		t.Errorf("Wrong job, expected \"whoa\", got \"%s\"", res.Spec.Job)
+	var env []string
+	for _, c := range append(res.Spec.PodSpec.InitContainers, res.Spec.PodSpec.Containers...) {
+		for _, e := range c.Env {
+			env = append(env, e.Name+"="+e.Value)
+		}
 	}
-	if res.Status.State != prowapi.TriggeredState {
-		t.Errorf("Wrong state, expected \"%v\", got \"%v\"", prowapi.TriggeredState, res.Status.State)
+	expected := []string{"GITHUB_TOKEN=[REDACTED]", "DB_PASSWORD=[REDACTED]", "API_TOKEN_FILE=[REDACTED]", "IMAGE=alpine"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected env %v, got %v", expected, env)
+	}
+	if fc.pj.Spec.PodSpec.Containers[0].Env[0].Value != "hunter2" {
+		t.Error("Expected the ProwJob of the client not to be modified")
+	}
+	// Fields are ordered by name, so the output is the same every time.
+	if again := get("/prowjob?prowjob=wowsuch").Body.String(); again != body {
+		t.Errorf("Expected the same output for the same ProwJob, got %s and %s", body, again)
+	}
+	if metadata, spec, status := strings.Index(body, "\nmetadata:"), strings.Index(body, "\nspec:"), strings.Index(body, "\nstatus:"); !(metadata < spec && spec < status) {
+		t.Errorf("Expected the fields to be ordered by name, got %s", body)
+	}
+
+	if rr := get("/prowjob?prowjob=unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d for an unknown ProwJob, got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := get("/prowjob"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d without a ProwJob, got %d", http.StatusBadRequest, rr.Code)
 	}
 }
 
@@ -315,6 +806,60 @@ func TestTide(t *testing.T) {
 	}
 }
 
+func TestTideQueue(t *testing.T) {
+	failed := time.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/queue" {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := json.Marshal(tide.Status{
+			Pools:  []tide.Pool{{Org: "o"}, {Org: "hidden"}},
+			Error:  "searching for blocking issues failed",
+			Failed: failed,
+		})
+		if err != nil {
+			t.Fatalf("Marshaling: %v", err)
+		}
+		fmt.Fprintf(w, string(b))
+	}))
+	defer s.Close()
+
+	ta := tideAgent{
+		log:          logrus.WithField("agent", "tide"),
+		path:         s.URL,
+		updatePeriod: func() time.Duration { return time.Minute },
+		hiddenRepos:  []string{"hidden"},
+	}
+	if err := ta.updateQueue(); err != nil {
+		t.Fatalf("Updating: %v", err)
+	}
+
+	handler := handleTideQueue(&ta)
+	req, err := http.NewRequest(http.MethodGet, "/tide-queue.js", nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Bad error code: %d", rr.Code)
+	}
+	var res tide.Status
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("Error unmarshaling: %v", err)
+	}
+	if len(res.Pools) != 1 || res.Pools[0].Org != "o" {
+		t.Errorf("Expected only the pool of org o, got %v", res.Pools)
+	}
+	if expected := "searching for blocking issues failed"; res.Error != expected {
+		t.Errorf("Expected the sync error %q, got %q", expected, res.Error)
+	}
+	if !res.Failed.Equal(failed) {
+		t.Errorf("Expected the sync to have failed at %v, got %v", failed, res.Failed)
+	}
+}
+
 func TestTideHistory(t *testing.T) {
 	testHist := map[string][]history.Record{
 		"o/r:b": {
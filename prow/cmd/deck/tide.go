@@ -54,6 +54,7 @@ type tideAgent struct {
 	sync.Mutex
 	pools   []tide.Pool
 	history map[string][]history.Record
+	queue   tide.Status
 }
 
 func (ta *tideAgent) start() {
@@ -61,6 +62,9 @@ func (ta *tideAgent) start() {
 	if err := ta.updatePools(); err != nil {
 		ta.log.WithError(err).Error("Updating pools the first time.")
 	}
+	if err := ta.updateQueue(); err != nil {
+		ta.log.WithError(err).Error("Updating queue the first time.")
+	}
 	startTimeHistory := time.Now()
 	if err := ta.updateHistory(); err != nil {
 		ta.log.WithError(err).Error("Updating history the first time.")
@@ -73,6 +77,9 @@ func (ta *tideAgent) start() {
 			if err := ta.updatePools(); err != nil {
 				ta.log.WithError(err).Error("Updating pools.")
 			}
+			if err := ta.updateQueue(); err != nil {
+				ta.log.WithError(err).Error("Updating queue.")
+			}
 		}
 	}()
 	go func() {
@@ -154,6 +161,20 @@ func (ta *tideAgent) updateHistory() error {
 	return nil
 }
 
+func (ta *tideAgent) updateQueue() error {
+	path := strings.TrimSuffix(ta.path, "/") + "/queue"
+	var queue tide.Status
+	if err := fetchTideData(ta.log, path, &queue); err != nil {
+		return err
+	}
+	queue.Pools = ta.filterHiddenPools(queue.Pools)
+
+	ta.Lock()
+	defer ta.Unlock()
+	ta.queue = queue
+	return nil
+}
+
 func (ta *tideAgent) filterHiddenPools(pools []tide.Pool) []tide.Pool {
 	if len(ta.hiddenRepos) == 0 {
 		return pools
@@ -125,6 +125,14 @@ func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, now ti
 		return fmt.Errorf("error listing prow jobs: %v", err)
 	}
 	latestJobs := pjutil.GetLatestProwJobs(jobs.Items, prowapi.PeriodicJob)
+	// Any incomplete run blocks a new one, not only the latest. This covers
+	// runs created outside of horologium, e.g. manual reruns from deck.
+	runningJobs := sets.NewString()
+	for _, j := range jobs.Items {
+		if j.Spec.Type == prowapi.PeriodicJob && !j.Complete() {
+			runningJobs.Insert(j.Spec.Job)
+		}
+	}
 
 	if err := cr.SyncConfig(cfg); err != nil {
 		logrus.WithError(err).Error("Error syncing cron jobs.")
@@ -143,6 +151,15 @@ func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, now ti
 			"previous-found": previousFound,
 		})
 
+		if runningJobs.Has(p.Name) {
+			logger.Debug("Previous run is still incomplete, not triggering a new run.")
+			continue
+		}
+		if previousFound && j.Status.CompletionTime != nil && now.Sub(j.Status.CompletionTime.Time) < p.GetMinimumInterval() {
+			logger.Debug("Previous run completed less than minimum_interval ago, not triggering a new run.")
+			continue
+		}
+
 		if p.Cron == "" {
 			shouldTrigger := j.Complete() && now.Sub(j.Status.StartTime.Time) > p.GetInterval()
 			logger = logger.WithField("should-trigger", shouldTrigger)
@@ -153,10 +170,22 @@ func sync(prowJobClient prowJobClient, cfg *config.Config, cr cronClient, now ti
 					errs = append(errs, err)
 				}
 			}
-		} else if cronTriggers.Has(p.Name) {
-			shouldTrigger := j.Complete()
+		} else {
+			// A periodic that has never run waits for its first scheduled
+			// occurrence. Otherwise, also catch up on an occurrence missed
+			// while the previous run was still going or horologium was down.
+			shouldTrigger := cronTriggers.Has(p.Name)
+			if previousFound {
+				nextRun, err := cron.NextRun(p.Cron, j.Status.StartTime.Time)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("periodic %s: %v", p.Name, err))
+					continue
+				}
+				shouldTrigger = j.Complete() && (shouldTrigger || !now.Before(nextRun))
+				logger = logger.WithField("next-run", nextRun)
+			}
 			logger = logger.WithField("should-trigger", shouldTrigger)
-			if !previousFound || shouldTrigger {
+			if shouldTrigger {
 				prowJob := pjutil.NewProwJob(pjutil.PeriodicSpec(p), p.Labels)
 				logger.WithFields(pjutil.ProwJobFields(&prowJob)).Info("Triggering new run of cron periodic.")
 				if _, err := prowJobClient.Create(&prowJob); err != nil {
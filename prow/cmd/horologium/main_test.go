@@ -241,6 +241,225 @@ func TestSyncCron(t *testing.T) {
 	}
 }
 
+// idleCron never has queued jobs, as if no scheduled time had passed
+// since horologium started.
+type idleCron struct{}
+
+func (ic *idleCron) SyncConfig(cfg *config.Config) error {
+	return nil
+}
+
+func (ic *idleCron) QueuedJobs() []string {
+	return nil
+}
+
+// Test that a cron periodic catches up on an occurrence that passed since
+// its last run, even when the cron agent did not queue it.
+func TestSyncCronNextRun(t *testing.T) {
+	now := time.Date(2019, 3, 2, 3, 0, 0, 0, time.UTC)
+	testcases := []struct {
+		testName    string
+		jobName     string
+		jobStart    time.Time
+		jobComplete bool
+		shouldStart bool
+	}{
+		{
+			testName:    "never run waits for the next occurrence",
+			shouldStart: false,
+		},
+		{
+			testName:    "occurrence passed since the last run",
+			jobName:     "j",
+			jobStart:    time.Date(2019, 3, 1, 2, 0, 0, 0, time.UTC),
+			jobComplete: true,
+			shouldStart: true,
+		},
+		{
+			testName:    "occurrence passed but the last run is still going",
+			jobName:     "j",
+			jobStart:    time.Date(2019, 3, 1, 2, 0, 0, 0, time.UTC),
+			jobComplete: false,
+			shouldStart: false,
+		},
+		{
+			testName:    "next occurrence not reached yet",
+			jobName:     "j",
+			jobStart:    time.Date(2019, 3, 2, 2, 0, 0, 0, time.UTC),
+			jobComplete: true,
+			shouldStart: false,
+		},
+	}
+	for _, tc := range testcases {
+		cfg := config.Config{
+			ProwConfig: config.ProwConfig{
+				ProwJobNamespace: "prowjobs",
+			},
+			JobConfig: config.JobConfig{
+				Periodics: []config.Periodic{{JobBase: config.JobBase{Name: "j"}, Cron: "0 2 * * *"}},
+			},
+		}
+
+		var jobs []runtime.Object
+		if tc.jobName != "" {
+			job := &prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "with-cron",
+					Namespace: "prowjobs",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Type: prowapi.PeriodicJob,
+					Job:  tc.jobName,
+				},
+				Status: prowapi.ProwJobStatus{
+					StartTime: metav1.NewTime(tc.jobStart),
+				},
+			}
+			if tc.jobComplete {
+				complete := metav1.NewTime(tc.jobStart.Add(time.Minute))
+				job.Status.CompletionTime = &complete
+			}
+			jobs = append(jobs, job)
+		}
+		fakeProwJobClient := fake.NewSimpleClientset(jobs...)
+		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, &idleCron{}, now); err != nil {
+			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
+		}
+
+		sawCreation := false
+		for _, action := range fakeProwJobClient.Fake.Actions() {
+			switch action.(type) {
+			case clienttesting.CreateActionImpl:
+				sawCreation = true
+			}
+		}
+		if tc.shouldStart != sawCreation {
+			t.Errorf("For case %s, expected start %t but got %t.", tc.testName, tc.shouldStart, sawCreation)
+		}
+	}
+}
+
+// Assumes there is one periodic job called "j" with an interval of one minute.
+func TestSyncMultipleRuns(t *testing.T) {
+	now := time.Now()
+	run := func(name string, startedAgo time.Duration, completedAgo *time.Duration) *prowapi.ProwJob {
+		job := &prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "prowjobs",
+			},
+			Spec: prowapi.ProwJobSpec{
+				Type: prowapi.PeriodicJob,
+				Job:  "j",
+			},
+			Status: prowapi.ProwJobStatus{
+				StartTime: metav1.NewTime(now.Add(-startedAgo)),
+			},
+		}
+		if completedAgo != nil {
+			complete := metav1.NewTime(now.Add(-*completedAgo))
+			job.Status.CompletionTime = &complete
+		}
+		return job
+	}
+	second := time.Second
+	tenMinutes := 10 * time.Minute
+
+	testcases := []struct {
+		testName        string
+		cron            bool
+		minimumInterval time.Duration
+		jobs            []runtime.Object
+
+		shouldStart bool
+	}{
+		{
+			testName: "older run still running blocks a new run",
+			jobs: []runtime.Object{
+				run("old", 2*time.Hour, nil),
+				run("new", time.Hour, &tenMinutes),
+			},
+			shouldStart: false,
+		},
+		{
+			testName: "older run still running blocks a new cron run",
+			cron:     true,
+			jobs: []runtime.Object{
+				run("old", 2*time.Hour, nil),
+				run("new", time.Hour, &tenMinutes),
+			},
+			shouldStart: false,
+		},
+		{
+			testName: "all runs complete",
+			jobs: []runtime.Object{
+				run("old", 2*time.Hour, &tenMinutes),
+				run("new", time.Hour, &tenMinutes),
+			},
+			shouldStart: true,
+		},
+		{
+			testName:        "previous run completed within minimum interval",
+			minimumInterval: time.Hour,
+			jobs: []runtime.Object{
+				run("new", time.Hour, &tenMinutes),
+			},
+			shouldStart: false,
+		},
+		{
+			testName:        "cron run within minimum interval",
+			cron:            true,
+			minimumInterval: time.Minute,
+			jobs: []runtime.Object{
+				run("new", time.Hour, &second),
+			},
+			shouldStart: false,
+		},
+		{
+			testName:        "previous run completed before minimum interval",
+			minimumInterval: 5 * time.Minute,
+			jobs: []runtime.Object{
+				run("new", time.Hour, &tenMinutes),
+			},
+			shouldStart: true,
+		},
+	}
+	for _, tc := range testcases {
+		periodic := config.Periodic{JobBase: config.JobBase{Name: "j"}}
+		if tc.cron {
+			periodic.Cron = "@every 1m"
+		} else {
+			periodic.SetInterval(time.Minute)
+		}
+		periodic.SetMinimumInterval(tc.minimumInterval)
+		cfg := config.Config{
+			ProwConfig: config.ProwConfig{
+				ProwJobNamespace: "prowjobs",
+			},
+			JobConfig: config.JobConfig{
+				Periodics: []config.Periodic{periodic},
+			},
+		}
+
+		fakeProwJobClient := fake.NewSimpleClientset(tc.jobs...)
+		fc := &fakeCron{}
+		if err := sync(fakeProwJobClient.ProwV1().ProwJobs(cfg.ProwJobNamespace), &cfg, fc, now); err != nil {
+			t.Fatalf("For case %s, didn't expect error: %v", tc.testName, err)
+		}
+
+		sawCreation := false
+		for _, action := range fakeProwJobClient.Fake.Actions() {
+			switch action.(type) {
+			case clienttesting.CreateActionImpl:
+				sawCreation = true
+			}
+		}
+		if tc.shouldStart != sawCreation {
+			t.Errorf("For case %s, expected start %t but got %t.", tc.testName, tc.shouldStart, sawCreation)
+		}
+	}
+}
+
 func TestFlags(t *testing.T) {
 	cases := []struct {
 		name     string
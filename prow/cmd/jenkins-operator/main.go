@@ -42,13 +42,16 @@ import (
 	"k8s.io/test-infra/prow/jenkins"
 	"k8s.io/test-infra/prow/logrusutil"
 	m "k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/pjutil"
 )
 
 type options struct {
 	configPath    string
 	jobConfigPath string
 	selector      string
-	totURL        string
+
+	totURL          string
+	snowflakeNodeID int64
 
 	jenkinsURL             string
 	jenkinsUserName        string
@@ -104,6 +107,7 @@ func gatherOptions() options {
 	fs.StringVar(&o.jobConfigPath, "job-config-path", "", "Path to prow job configs.")
 	fs.StringVar(&o.selector, "label-selector", labels.Everything().String(), "Label selector to be applied in prowjobs. See https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#label-selectors for constructing a label selector.")
 	fs.StringVar(&o.totURL, "tot-url", "", "Tot URL")
+	fs.Int64Var(&o.snowflakeNodeID, "snowflake-node-id", -1, "Node ID for build IDs vended without tot, between 0 and 1023. If negative, derived from the hostname.")
 
 	fs.StringVar(&o.jenkinsURL, "jenkins-url", "http://jenkins-proxy", "Jenkins URL")
 	fs.StringVar(&o.jenkinsUserName, "jenkins-user", "jenkins-trigger", "Jenkins username")
@@ -135,6 +139,12 @@ func main() {
 		logrus.WithError(err).Fatal("Error parsing label selector.")
 	}
 
+	if o.snowflakeNodeID >= 0 {
+		if err := pjutil.SetSnowflakeNodeID(o.snowflakeNodeID); err != nil {
+			logrus.WithError(err).Fatal("Error setting snowflake node ID.")
+		}
+	}
+
 	configAgent := &config.Agent{}
 	if err := configAgent.Start(o.configPath, o.jobConfigPath); err != nil {
 		logrus.WithError(err).Fatal("Error starting config agent.")
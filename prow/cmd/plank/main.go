@@ -25,6 +25,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/labels"
@@ -36,11 +37,14 @@ import (
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/metrics"
+	"k8s.io/test-infra/prow/pjutil"
 	"k8s.io/test-infra/prow/plank"
+	slackreporter "k8s.io/test-infra/prow/slack/reporter"
 )
 
 type options struct {
-	totURL string
+	totURL          string
+	snowflakeNodeID int64
 
 	configPath    string
 	jobConfigPath string
@@ -48,6 +52,8 @@ type options struct {
 	selector      string
 	skipReport    bool
 
+	statusCacheSize int
+
 	dryRun     bool
 	kubernetes prowflagutil.KubernetesOptions
 	github     prowflagutil.GitHubOptions
@@ -58,12 +64,14 @@ func gatherOptions() options {
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
 	fs.StringVar(&o.totURL, "tot-url", "", "Tot URL")
+	fs.Int64Var(&o.snowflakeNodeID, "snowflake-node-id", -1, "Node ID for build IDs vended without tot, between 0 and 1023. If negative, derived from the hostname.")
 
 	fs.StringVar(&o.configPath, "config-path", "/etc/config/config.yaml", "Path to config.yaml.")
 	fs.StringVar(&o.jobConfigPath, "job-config-path", "", "Path to prow job configs.")
 	fs.StringVar(&o.buildCluster, "build-cluster", "", "Path to file containing a YAML-marshalled kube.Cluster object. If empty, uses the local cluster.")
 	fs.StringVar(&o.selector, "label-selector", kube.EmptySelector, "Label selector to be applied in prowjobs. See https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#label-selectors for constructing a label selector.")
 	fs.BoolVar(&o.skipReport, "skip-report", false, "Whether or not to ignore report with githubClient")
+	fs.IntVar(&o.statusCacheSize, "status-cache-size", 0, "How many GitHub statuses to remember so that identical ones are not set again. 0 disables the cache.")
 
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Whether or not to make mutating API calls to GitHub.")
 	for _, group := range []flagutil.OptionGroup{&o.kubernetes, &o.github} {
@@ -104,6 +112,12 @@ func main() {
 	}
 	cfg := configAgent.Config
 
+	if o.snowflakeNodeID >= 0 {
+		if err := pjutil.SetSnowflakeNodeID(o.snowflakeNodeID); err != nil {
+			logrus.WithError(err).Fatal("Error setting snowflake node ID.")
+		}
+	}
+
 	secretAgent := &secret.Agent{}
 	if o.github.TokenPath != "" {
 		if err := secretAgent.Start([]string{o.github.TokenPath}); err != nil {
@@ -115,6 +129,9 @@ func main() {
 	if err != nil {
 		logrus.WithError(err).Fatal("Error getting GitHub client.")
 	}
+	if err := githubClient.CacheStatuses(o.statusCacheSize); err != nil {
+		logrus.WithError(err).Fatal("Error caching GitHub statuses.")
+	}
 
 	kubeClient, _, _, err := o.kubernetes.Client(cfg().ProwJobNamespace, o.dryRun)
 	if err != nil {
@@ -139,18 +156,30 @@ func main() {
 		}
 	}
 
+	kubeMetrics := kube.NewClientMetrics()
+	if err := kubeMetrics.Register(prometheus.DefaultRegisterer); err != nil {
+		logrus.WithError(err).Fatal("Error registering kube client metrics.")
+	}
+	kubeClient.SetMetrics(kubeMetrics)
+	for _, client := range pkcs {
+		client.SetMetrics(kubeMetrics)
+	}
+
 	c, err := plank.NewController(kubeClient, pkcs, githubClient, nil, cfg, o.totURL, o.selector, o.skipReport)
 	if err != nil {
 		logrus.WithError(err).Fatal("Error creating plank controller.")
 	}
+	if !o.dryRun {
+		c.AddReporter(slackreporter.NewReporter(cfg))
+	}
 
 	// Push metrics to the configured prometheus pushgateway endpoint.
 	pushGateway := cfg().PushGateway
 	if pushGateway.Endpoint != "" {
 		go metrics.PushMetrics("plank", pushGateway.Endpoint, pushGateway.Interval)
 	}
-	// serve prometheus metrics.
-	go serve()
+	// serve prometheus metrics and debugging endpoints.
+	go serve(c)
 	// gather metrics for the jobs handled by plank.
 	go gather(c)
 
@@ -173,10 +202,12 @@ func main() {
 	}
 }
 
-// serve starts a http server and serves prometheus metrics.
+// serve starts a http server and serves prometheus metrics and the
+// pending jobs of the controller.
 // Meant to be called inside a goroutine.
-func serve() {
+func serve(c *plank.Controller) {
 	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/debug/pending-jobs", c.PendingJobsHandler())
 	logrus.WithError(http.ListenAndServe(":8080", nil)).Fatal("ListenAndServe returned.")
 }
 
@@ -210,7 +210,7 @@ func (c *controller) clean() {
 		}
 		maxPodAge := c.config().Sinker.MaxPodAge
 		for _, pod := range pods.Items {
-			if _, ok := isFinished[pod.ObjectMeta.Name]; !ok {
+			if _, ok := isFinished[kube.ProwJobForPod(pod)]; !ok {
 				// prowjob is not marked as completed yet
 				// deleting the pod now will result in plank creating a brand new pod
 				continue
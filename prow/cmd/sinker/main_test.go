@@ -106,6 +106,20 @@ func TestClean(t *testing.T) {
 				StartTime: startTime(time.Now().Add(-maxPodAge).Add(-time.Second)),
 			},
 		},
+		&corev1api.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "old-succeeded-x7k2p",
+				Namespace: "ns",
+				Labels: map[string]string{
+					kube.CreatedByProw:  "true",
+					kube.ProwJobIDLabel: "old-succeeded",
+				},
+			},
+			Status: corev1api.PodStatus{
+				Phase:     corev1api.PodSucceeded,
+				StartTime: startTime(time.Now().Add(-maxPodAge).Add(-time.Second)),
+			},
+		},
 		&corev1api.Pod{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      "old-just-complete",
@@ -198,6 +212,7 @@ func TestClean(t *testing.T) {
 	deletedPods := sets.NewString(
 		"old-failed",
 		"old-succeeded",
+		"old-succeeded-x7k2p",
 		"old-pending-abort",
 	)
 	setComplete := func(d time.Duration) *metav1.Time {
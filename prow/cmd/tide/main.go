@@ -32,6 +32,7 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/config/secret"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/logrusutil"
 	"k8s.io/test-infra/prow/metrics"
 	"k8s.io/test-infra/prow/tide"
@@ -45,6 +46,7 @@ type options struct {
 
 	syncThrottle   int
 	statusThrottle int
+	etagCacheSize  int
 
 	dryRun     bool
 	runOnce    bool
@@ -75,6 +77,7 @@ func gatherOptions() options {
 	}
 	fs.IntVar(&o.syncThrottle, "sync-hourly-tokens", 800, "The maximum number of tokens per hour to be used by the sync controller.")
 	fs.IntVar(&o.statusThrottle, "status-hourly-tokens", 400, "The maximum number of tokens per hour to be used by the status controller.")
+	fs.IntVar(&o.etagCacheSize, "etag-cache-size", 0, "How many GitHub responses each controller remembers so that unchanged ones are requested conditionally. 0 disables the cache.")
 
 	fs.Parse(os.Args[1:])
 	return o
@@ -119,6 +122,11 @@ func main() {
 	// changing the context format or starting Tide on a new repo.
 	githubSync.Throttle(o.syncThrottle, 3*tokensPerIteration(o.syncThrottle, cfg().Tide.SyncPeriod))
 	githubStatus.Throttle(o.statusThrottle, o.statusThrottle/2)
+	for _, client := range []*github.Client{githubSync, githubStatus} {
+		if err := client.CacheETags(o.etagCacheSize); err != nil {
+			logrus.WithError(err).Fatal("Error caching GitHub responses.")
+		}
+	}
 
 	gitClient, err := o.github.GitClient(secretAgent, o.dryRun)
 	if err != nil {
@@ -135,6 +143,7 @@ func main() {
 	defer c.Shutdown()
 	http.Handle("/", c)
 	http.Handle("/history", c.History)
+	http.Handle("/queue", c.QueueHandler())
 	server := &http.Server{Addr: ":" + strconv.Itoa(o.port)}
 
 	// Push metrics to the configured prometheus pushgateway endpoint.
@@ -18,12 +18,23 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
 
+var configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "config_last_reload_success",
+	Help: "Whether the last attempt to reload the config succeeded (1) or failed (0).",
+})
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+}
+
 // Delta represents the before and after states of a Config change detected by the Agent.
 type Delta struct {
 	Before, After Config
@@ -35,8 +46,13 @@ type DeltaChan = chan<- Delta
 // Agent watches a path and automatically loads the config stored
 // therein.
 type Agent struct {
+	// Strict makes the agent reject configs with fields that are unknown
+	// or set twice, see LoadStrict. It must be set before Start.
+	Strict bool
+
 	mut           sync.RWMutex // do not export Lock, etc methods
 	c             *Config
+	lastErr       error
 	subscriptions []DeltaChan
 }
 
@@ -44,11 +60,9 @@ type Agent struct {
 // fails, Start will return the error and abort. Future load failures will log
 // the failure message but continue attempting to load.
 func (ca *Agent) Start(prowConfig, jobConfig string) error {
-	c, err := Load(prowConfig, jobConfig)
-	if err != nil {
+	if err := ca.reload(prowConfig, jobConfig); err != nil {
 		return err
 	}
-	ca.Set(c)
 	go func() {
 		var lastModTime time.Time
 		// Rarely, if two changes happen in the same second, mtime will
@@ -58,25 +72,22 @@ func (ca *Agent) Start(prowConfig, jobConfig string) error {
 		for range time.Tick(1 * time.Second) {
 			if skips < 600 {
 				// Check if the file changed to see if it needs to be re-read.
-				// os.Stat follows symbolic links, which is how ConfigMaps work.
-				prowStat, err := os.Stat(prowConfig)
+				recentModTime, err := latestModTime(prowConfig)
 				if err != nil {
 					logrus.WithField("prowConfig", prowConfig).WithError(err).Error("Error loading prow config.")
 					continue
 				}
 
-				recentModTime := prowStat.ModTime()
-
 				// TODO(krzyzacy): allow empty jobConfig till fully migrate config to subdirs
 				if jobConfig != "" {
-					jobConfigStat, err := os.Stat(jobConfig)
+					jobConfigModTime, err := latestModTime(jobConfig)
 					if err != nil {
 						logrus.WithField("jobConfig", jobConfig).WithError(err).Error("Error loading job configs.")
 						continue
 					}
 
-					if jobConfigStat.ModTime().After(recentModTime) {
-						recentModTime = jobConfigStat.ModTime()
+					if jobConfigModTime.After(recentModTime) {
+						recentModTime = jobConfigModTime
 					}
 				}
 
@@ -86,19 +97,66 @@ func (ca *Agent) Start(prowConfig, jobConfig string) error {
 				}
 				lastModTime = recentModTime
 			}
-			if c, err := Load(prowConfig, jobConfig); err != nil {
+			if err := ca.reload(prowConfig, jobConfig); err != nil {
 				logrus.WithField("prowConfig", prowConfig).
 					WithField("jobConfig", jobConfig).
-					WithError(err).Error("Error loading config.")
+					WithError(err).Error("Error loading config, keeping the last valid config.")
 			} else {
 				skips = 0
-				ca.Set(c)
 			}
 		}
 	}()
 	return nil
 }
 
+// latestModTime returns the latest modification time of the file or of the
+// directory tree at path. Adding or removing a file updates the modification
+// time of its directory, so changes of every kind are noticed. Symbolic links
+// are followed, which is how ConfigMaps work.
+func latestModTime(path string) (time.Time, error) {
+	root, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// reload loads the config and starts serving it if it is valid. If it is
+// not, the last valid config keeps being served and subscribers are not
+// notified.
+func (ca *Agent) reload(prowConfig, jobConfig string) error {
+	c, err := load(prowConfig, jobConfig, ca.Strict)
+	ca.mut.Lock()
+	ca.lastErr = err
+	ca.mut.Unlock()
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+	configReloadSuccess.Set(1)
+	ca.Set(c)
+	return nil
+}
+
+// LastReloadError returns the error from the most recent attempt to reload
+// the config, or nil if it succeeded. While it is set, Config returns the
+// last config that loaded successfully.
+func (ca *Agent) LastReloadError() error {
+	ca.mut.RLock()
+	defer ca.mut.RUnlock()
+	return ca.lastErr
+}
+
 // Subscribe registers the channel for messages on config reload.
 // The caller can expect a copy of the previous and current config
 // to be sent down the subscribed channel when a new configuration
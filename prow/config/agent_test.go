@@ -0,0 +1,255 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestAgentReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-agent")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	prowConfig := filepath.Join(dir, "config.yaml")
+
+	deltas := make(chan Delta, 10)
+	ca := &Agent{}
+	ca.Subscribe(deltas)
+
+	steps := []struct {
+		name     string
+		config   string
+		valid    bool
+		expected string
+	}{
+		{
+			name:     "initial good config",
+			config:   "log_level: info",
+			valid:    true,
+			expected: "info",
+		},
+		{
+			name:     "bad config keeps the last good one",
+			config:   "plank:\n  max_pod_evictions: -1\nlog_level: warn",
+			valid:    false,
+			expected: "info",
+		},
+		{
+			name:     "good config replaces the last good one",
+			config:   "log_level: debug",
+			valid:    true,
+			expected: "debug",
+		},
+	}
+
+	for _, step := range steps {
+		if err := ioutil.WriteFile(prowConfig, []byte(step.config), 0644); err != nil {
+			t.Fatalf("%s: failed to write config: %v", step.name, err)
+		}
+		err := ca.reload(prowConfig, "")
+		if step.valid != (err == nil) {
+			t.Errorf("%s: expected valid %t, got error: %v", step.name, step.valid, err)
+		}
+		if lastErr := ca.LastReloadError(); lastErr != err {
+			t.Errorf("%s: expected LastReloadError to be %v, got %v", step.name, err, lastErr)
+		}
+		if actual := ca.Config().LogLevel; actual != step.expected {
+			t.Errorf("%s: expected config with log level %q to be served, got %q", step.name, step.expected, actual)
+		}
+
+		var metric dto.Metric
+		if err := configReloadSuccess.Write(&metric); err != nil {
+			t.Fatalf("%s: failed to read metric: %v", step.name, err)
+		}
+		expectedGauge := 0.0
+		if step.valid {
+			expectedGauge = 1
+		}
+		if actual := metric.GetGauge().GetValue(); actual != expectedGauge {
+			t.Errorf("%s: expected config_last_reload_success to be %v, got %v", step.name, expectedGauge, actual)
+		}
+
+		if step.valid {
+			select {
+			case delta := <-deltas:
+				if delta.After.LogLevel != step.expected {
+					t.Errorf("%s: expected delta to a config with log level %q, got %q", step.name, step.expected, delta.After.LogLevel)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatalf("%s: expected subscriber to be notified", step.name)
+			}
+		}
+	}
+
+	select {
+	case delta := <-deltas:
+		t.Errorf("expected subscribers to be notified only on successful reloads, got extra delta to %q", delta.After.LogLevel)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestAgentReloadJobConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-agent")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	prowConfig := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(prowConfig, []byte("log_level: info"), 0644); err != nil {
+		t.Fatalf("failed to write prow config: %v", err)
+	}
+	jobConfig := filepath.Join(dir, "jobs")
+	write := func(name, content string) {
+		path := filepath.Join(jobConfig, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create job config dir: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write job config %s: %v", name, err)
+		}
+	}
+	jobNames := func(c *Config) []string {
+		var names []string
+		for _, p := range c.AllPresubmits(nil) {
+			names = append(names, p.Name)
+		}
+		for _, p := range c.AllPeriodics() {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+
+	write("org/presubmits.yaml", `
+presubmits:
+  org/repo:
+  - name: pull-unit
+    spec: {containers: [{image: alpine}]}
+`)
+	write("org/team/periodics.yaml", `
+periodics:
+- name: ci-e2e
+  interval: 1h
+  spec: {containers: [{image: alpine}]}
+`)
+	write("README.md", "not a job config")
+
+	ca := &Agent{}
+	if err := ca.reload(prowConfig, jobConfig); err != nil {
+		t.Fatalf("failed to load job config tree: %v", err)
+	}
+	if actual, expected := jobNames(ca.Config()), []string{"pull-unit", "ci-e2e"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected jobs %v from the job config tree, got %v", expected, actual)
+	}
+
+	write("other/duplicate.yaml", `
+presubmits:
+  org/repo:
+  - name: pull-unit
+    spec: {containers: [{image: alpine}]}
+`)
+	err = ca.reload(prowConfig, jobConfig)
+	if err == nil {
+		t.Fatal("expected duplicated jobs across files to be rejected")
+	}
+	for _, file := range []string{"presubmits.yaml", "duplicate.yaml"} {
+		if !strings.Contains(err.Error(), file) {
+			t.Errorf("expected error to name %s, got: %v", file, err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(jobConfig, "other/duplicate.yaml")); err != nil {
+		t.Fatalf("failed to remove job config: %v", err)
+	}
+	if err := os.Remove(filepath.Join(jobConfig, "org/team/periodics.yaml")); err != nil {
+		t.Fatalf("failed to remove job config: %v", err)
+	}
+	if err := ca.reload(prowConfig, jobConfig); err != nil {
+		t.Fatalf("failed to reload job config tree: %v", err)
+	}
+	if actual, expected := jobNames(ca.Config()), []string{"pull-unit"}; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected removed files to drop their jobs, leaving %v, got %v", expected, actual)
+	}
+}
+
+func TestLatestModTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-agent")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	nested := filepath.Join(dir, "nested")
+	if err := os.Mkdir(nested, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	file := filepath.Join(nested, "jobs.yaml")
+	if err := ioutil.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	backdate := func() {
+		for _, path := range []string{file, nested, dir} {
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				continue
+			}
+			if err := os.Chtimes(path, past, past); err != nil {
+				t.Fatalf("failed to backdate %s: %v", path, err)
+			}
+		}
+	}
+	check := func(name string, changed bool) {
+		actual, err := latestModTime(dir)
+		if err != nil {
+			t.Fatalf("%s: failed to get modification time: %v", name, err)
+		}
+		if changed != actual.After(past) {
+			t.Errorf("%s: expected change %t, got modification time %v for a tree last modified at %v", name, changed, actual, past)
+		}
+	}
+
+	backdate()
+	check("unchanged tree", false)
+
+	if err := os.Chtimes(file, time.Now(), time.Now()); err != nil {
+		t.Fatalf("failed to touch file: %v", err)
+	}
+	check("modified nested file", true)
+
+	backdate()
+	if err := ioutil.WriteFile(filepath.Join(nested, "more-jobs.yaml"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(nested, "more-jobs.yaml"), past, past); err != nil {
+		t.Fatalf("failed to backdate file: %v", err)
+	}
+	check("added nested file", true)
+
+	backdate()
+	if err := os.Remove(file); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	check("removed nested file", true)
+}
@@ -352,6 +352,30 @@ func TestBranchRequirements(t *testing.T) {
 			otherIfPresent:  []string{"run-if-changed", "not-always"},
 			otherOptional:   []string{"skip-report", "optional"},
 		},
+		{
+			name: "optional jobs are never required",
+			config: []Presubmit{
+				{
+					AlwaysRun: true,
+					Reporter:  Reporter{Context: "always-run"},
+				},
+				{
+					RegexpChangeMatcher: RegexpChangeMatcher{
+						RunIfChanged: "foo",
+					},
+					Reporter: Reporter{Context: "optional-run-if-changed"},
+					Optional: true,
+				},
+				{
+					Reporter: Reporter{Context: "optional-manual"},
+					Optional: true,
+				},
+			},
+			masterExpected: []string{"always-run"},
+			masterOptional: []string{"optional-run-if-changed", "optional-manual"},
+			otherExpected:  []string{"always-run"},
+			otherOptional:  []string{"optional-run-if-changed", "optional-manual"},
+		},
 	}
 
 	for _, tc := range cases {
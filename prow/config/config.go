@@ -74,6 +74,7 @@ type ProwConfig struct {
 	Orgs             map[string]org.Config `json:"orgs,omitempty"`
 	Gerrit           Gerrit                `json:"gerrit,omitempty"`
 	GithubReporter   GithubReporter        `json:"github_reporter,omitempty"`
+	SlackReporter    SlackReporter         `json:"slack_reporter,omitempty"`
 
 	// TODO: Move this out of the main config.
 	JenkinsOperators []JenkinsOperator `json:"jenkins_operators,omitempty"`
@@ -108,6 +109,76 @@ type ProwConfig struct {
 
 	// Pub/Sub Subscriptions that we want to listen to
 	PubSubSubscriptions PubsubSubscriptions `json:"pubsub_subscriptions,omitempty"`
+
+	// JobDefaults are applied to jobs that do not set the defaulted fields
+	// themselves.
+	JobDefaults JobDefaults `json:"defaults,omitempty"`
+}
+
+// JobDefaults configures values for job fields that are applied when
+// loading the config to jobs that do not set those fields explicitly.
+type JobDefaults struct {
+	// Repos configures defaults per org or org/repo. Defaults for an
+	// org/repo take precedence over those for its org.
+	Repos map[string]JobDefault `json:"repos,omitempty"`
+	// Default configures defaults for all jobs, overridden by Repos.
+	Default JobDefault `json:"default,omitempty"`
+}
+
+// JobDefault holds default values for job fields.
+type JobDefault struct {
+	// Agent that will take care of running the job.
+	Agent string `json:"agent,omitempty"`
+	// Cluster is the alias of the cluster to run the job in.
+	Cluster string `json:"cluster,omitempty"`
+	// TimeoutString compiles into Timeout at load time.
+	TimeoutString string `json:"timeout,omitempty"`
+	// Timeout is applied to decorated jobs that do not set a
+	// decoration timeout.
+	Timeout time.Duration `json:"-"`
+	// MaxConcurrency of the job, as for JobBase.
+	MaxConcurrency *int `json:"max_concurrency,omitempty"`
+	// SkipReport skips commenting and setting status on GitHub.
+	// Only applies to presubmits and postsubmits.
+	SkipReport *bool `json:"skip_report,omitempty"`
+}
+
+// merge returns the defaults with every field set in other overriding d.
+func (d JobDefault) merge(other JobDefault) JobDefault {
+	if other.Agent != "" {
+		d.Agent = other.Agent
+	}
+	if other.Cluster != "" {
+		d.Cluster = other.Cluster
+	}
+	if other.TimeoutString != "" {
+		d.TimeoutString = other.TimeoutString
+		d.Timeout = other.Timeout
+	}
+	if other.MaxConcurrency != nil {
+		d.MaxConcurrency = other.MaxConcurrency
+	}
+	if other.SkipReport != nil {
+		d.SkipReport = other.SkipReport
+	}
+	return d
+}
+
+// For returns the defaults for jobs in the given org and repo, with
+// org/repo defaults overriding org defaults overriding the global ones.
+// Pass an empty org for jobs that do not belong to a repo.
+func (d JobDefaults) For(org, repo string) JobDefault {
+	def := d.Default
+	if org == "" {
+		return def
+	}
+	if o, ok := d.Repos[org]; ok {
+		def = def.merge(o)
+	}
+	if r, ok := d.Repos[org+"/"+repo]; ok {
+		def = def.merge(r)
+	}
+	return def
 }
 
 // OwnersDirBlacklist is used to configure which directories to ignore when
@@ -190,6 +261,104 @@ type Plank struct {
 	// JobURLPrefix is the host and path prefix under
 	// which job details will be viewable
 	JobURLPrefix string `json:"job_url_prefix,omitempty"`
+	// DefaultMaxConcurrencyByType is the maximum concurrency applied to
+	// jobs of the given type that do not set max_concurrency themselves.
+	// 0 or a missing entry implies no limit.
+	DefaultMaxConcurrencyByType map[prowapi.ProwJobType]int `json:"default_max_concurrency_by_type,omitempty"`
+	// DefaultTimeoutByTypeStrings compiles into DefaultTimeoutByType at
+	// load time.
+	DefaultTimeoutByTypeStrings map[prowapi.ProwJobType]string `json:"default_timeout_by_type,omitempty"`
+	// DefaultTimeoutByType is the timeout applied to decorated jobs of the
+	// given type that do not set a timeout themselves. It takes precedence
+	// over the timeout of the default decoration config.
+	// Batch jobs are built from presubmits, which get the presubmit default
+	// when the config is loaded, so they inherit it. The batch default only
+	// applies to batch ProwJobs that carry no timeout of their own.
+	DefaultTimeoutByType map[prowapi.ProwJobType]time.Duration `json:"-"`
+	// MaxPodEvictions is how many times the pod of a job may be evicted
+	// and replaced before the job is given up on with an error. 0 implies
+	// no limit.
+	MaxPodEvictions int `json:"max_pod_evictions,omitempty"`
+	// MaxErrorRetries is how many times a job that runs into a retryable
+	// error, like a conflict when starting its pod or a pod pending timeout,
+	// is triggered again before it is given the ErrorState. 0 disables
+	// retries, in which case conflicts are simply retried on the next sync.
+	MaxErrorRetries int `json:"max_error_retries,omitempty"`
+	// MaxStartAttempts is how many times in a row plank tries to start the
+	// pod of a job that fails to start with an unexpected error, before the
+	// job is given the ErrorState with that error. 0 implies no limit.
+	MaxStartAttempts int `json:"max_start_attempts,omitempty"`
+	// RequireJobConfig makes plank give the ErrorState to triggered jobs
+	// that are no longer in the job config, instead of starting them from
+	// the pod spec they were created with.
+	RequireJobConfig bool `json:"require_job_config,omitempty"`
+	// MaxResourceRequests is the ceiling on the resources a job's containers
+	// may request. Jobs requesting more are rejected at load time, as their
+	// pods could never be scheduled. Missing entries imply no limit.
+	MaxResourceRequests v1.ResourceList `json:"max_resource_requests,omitempty"`
+	// FairScheduling makes jobs with distinct names take turns at the slots
+	// left under max_concurrency, favoring names with fewer pending jobs,
+	// instead of starting triggered jobs first-come, first-served. This keeps
+	// a job with many triggered instances from taking every slot.
+	FairScheduling bool `json:"fair_scheduling,omitempty"`
+	// MaxProwJobAgeString compiles into MaxProwJobAge at load time.
+	MaxProwJobAgeString string `json:"max_prowjob_age,omitempty"`
+	// MaxProwJobAge is how long after completion a ProwJob is deleted
+	// by the controller. Defaults to zero, which disables the cleanup.
+	MaxProwJobAge time.Duration `json:"-"`
+	// ExtraContainers are added to the pod of every job, next to the test
+	// container, for example to ship logs. They do not receive the job's
+	// environment variables.
+	ExtraContainers []v1.Container `json:"extra_containers,omitempty"`
+	// PodStateOverrides map pods in a phase, with a reason, to the state
+	// their job completes with, for pods that admission controllers or
+	// other tooling leave in unusual states. The first matching override
+	// applies. Pods that match none are handled by their phase as usual.
+	PodStateOverrides []PodStateOverride `json:"pod_state_overrides,omitempty"`
+	// SpreadPodsByJob makes the scheduler prefer to put the pods of a job
+	// on different nodes, so that losing a node fails fewer runs of a job.
+	SpreadPodsByJob bool `json:"spread_pods_by_job,omitempty"`
+	// PodActiveDeadline makes Kubernetes kill the pods of decorated jobs
+	// that outlive their timeout and grace period, by setting the
+	// activeDeadlineSeconds of the pods that do not set it themselves.
+	PodActiveDeadline bool `json:"pod_active_deadline,omitempty"`
+	// PodActiveDeadlineMarginString compiles into PodActiveDeadlineMargin
+	// at load time.
+	PodActiveDeadlineMarginString string `json:"pod_active_deadline_margin,omitempty"`
+	// PodActiveDeadlineMargin is added to the active deadline on top of the
+	// timeout and grace period, because the deadline counts from the start
+	// of the pod, including image pulls and init containers, while the
+	// timeout starts with the test container. Defaults to 10 minutes.
+	PodActiveDeadlineMargin time.Duration `json:"-"`
+	// UseGenerateName makes plank create pods with a name generated by the
+	// apiserver, prefixed with the name of their ProwJob, instead of the
+	// name of the ProwJob itself, so that a new pod for a job never
+	// conflicts with the previous one. The name is recorded in the status
+	// of the ProwJob.
+	UseGenerateName bool `json:"use_generate_name,omitempty"`
+	// JobSelector is a label selector that restricts the ProwJobs, and
+	// their pods, that plank lists and syncs. It is combined with the
+	// --label-selector flag, so that replicas can split up the jobs.
+	JobSelector string `json:"job_selector,omitempty"`
+	// BuildNumberEnvName is the name of the environment variable that
+	// holds the build number in the pods, for test frameworks that expect
+	// another name. Defaults to BUILD_NUMBER.
+	BuildNumberEnvName string `json:"build_number_env_name,omitempty"`
+	// BuildIDAttempts is how many times plank asks tot for the build ID
+	// of a pod before it fails to start the pod. Defaults to 10.
+	BuildIDAttempts int `json:"build_id_attempts,omitempty"`
+}
+
+// PodStateOverride maps pods in a phase with a reason to the state of their
+// job.
+type PodStateOverride struct {
+	// Phase is the phase of the pod.
+	Phase v1.PodPhase `json:"phase"`
+	// Reason is the reason of the pod's status. Empty matches any reason.
+	Reason string `json:"reason,omitempty"`
+	// State is the state the job completes with, one of success, failure
+	// or error.
+	State prowapi.ProwJobState `json:"state"`
 }
 
 // Gerrit is config for the gerrit controller.
@@ -228,6 +397,22 @@ type GithubReporter struct {
 	JobTypesToReport []prowapi.ProwJobType `json:"job_types_to_report,omitempty"`
 }
 
+// SlackReporter holds the config for reporting the completion of jobs that
+// opt in with slack_report to Slack.
+type SlackReporter struct {
+	// WebhookURL is the incoming webhook that reports are posted to.
+	// Reporting to Slack is disabled if it is unset.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// Channel overrides the channel of the webhook if set.
+	Channel string `json:"channel,omitempty"`
+	// JobTypesToReport limits the reports to these types of jobs.
+	// All types are reported if it is unset.
+	JobTypesToReport []prowapi.ProwJobType `json:"job_types_to_report,omitempty"`
+	// JobStatesToReport limits the reports to jobs that complete in these
+	// states. Defaults to failure and error.
+	JobStatesToReport []prowapi.ProwJobState `json:"job_states_to_report,omitempty"`
+}
+
 // Sinker is config for the sinker controller.
 type Sinker struct {
 	// ResyncPeriodString compiles into ResyncPeriod at load time.
@@ -286,6 +471,11 @@ type Deck struct {
 	TideUpdatePeriodString string `json:"tide_update_period,omitempty"`
 	// TideUpdatePeriod specifies how often Deck will fetch status from Tide. Defaults to 10s.
 	TideUpdatePeriod time.Duration `json:"-"`
+	// JobUpdatePeriodString compiles into JobUpdatePeriod at load time.
+	JobUpdatePeriodString string `json:"job_update_period,omitempty"`
+	// JobUpdatePeriod specifies how often Deck will list the ProwJobs it
+	// serves. Defaults to 30s.
+	JobUpdatePeriod time.Duration `json:"-"`
 	// HiddenRepos is a list of orgs and/or repos that should not be displayed by Deck.
 	HiddenRepos []string `json:"hidden_repos,omitempty"`
 	// ExternalAgentLogs ensures external agents can expose
@@ -293,6 +483,12 @@ type Deck struct {
 	ExternalAgentLogs []ExternalAgentLog `json:"external_agent_logs,omitempty"`
 	// Branding of the frontend
 	Branding *Branding `json:"branding,omitempty"`
+	// RedactedEnvStrings compiles into RedactedEnv at load time.
+	RedactedEnvStrings []string `json:"redacted_env,omitempty"`
+	// RedactedEnv matches the names of the environment variables whose
+	// values are redacted when Deck serves a ProwJob. Defaults to
+	// names containing TOKEN or PASSWORD.
+	RedactedEnv []*regexp.Regexp `json:"-"`
 }
 
 // ExternalAgentLog ensures an external agent like Jenkins can expose
@@ -331,31 +527,50 @@ type Branding struct {
 type PubsubSubscriptions map[string][]string
 
 // Load loads and parses the config at path.
-func Load(prowConfig, jobConfig string) (c *Config, err error) {
+func Load(prowConfig, jobConfig string) (*Config, error) {
+	return load(prowConfig, jobConfig, false)
+}
+
+// LoadStrict loads and parses the config at path like Load, but rejects
+// fields that are unknown or set twice in the same mapping, like a
+// misspelled max_concurrency, instead of ignoring them.
+func LoadStrict(prowConfig, jobConfig string) (*Config, error) {
+	return load(prowConfig, jobConfig, true)
+}
+
+func load(prowConfig, jobConfig string, strict bool) (c *Config, err error) {
 	// we never want config loading to take down the prow components
 	defer func() {
 		if r := recover(); r != nil {
 			c, err = nil, fmt.Errorf("panic loading config: %v", r)
 		}
 	}()
-	c, err = loadConfig(prowConfig, jobConfig)
+	c, err = loadConfig(prowConfig, jobConfig, strict)
 	if err != nil {
 		return nil, err
 	}
 	if err := c.finalizeJobConfig(); err != nil {
 		return nil, err
 	}
-	if err := c.validateComponentConfig(); err != nil {
-		return nil, err
-	}
-	if err := c.validateJobConfig(); err != nil {
+	if err := Validate(c); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+// Validate checks that a loaded config is consistent, rejecting for example
+// duplicated job names and kubernetes jobs without a spec. Load calls it;
+// it is exported so that changes to the config repo can be checked before
+// they merge.
+func Validate(c *Config) error {
+	if err := c.validateComponentConfig(); err != nil {
+		return err
+	}
+	return c.validateJobConfig()
+}
+
 // loadConfig loads one or multiple config files and returns a config object.
-func loadConfig(prowConfig, jobConfig string) (*Config, error) {
+func loadConfig(prowConfig, jobConfig string, strict bool) (*Config, error) {
 	stat, err := os.Stat(prowConfig)
 	if err != nil {
 		return nil, err
@@ -366,7 +581,7 @@ func loadConfig(prowConfig, jobConfig string) (*Config, error) {
 	}
 
 	var nc Config
-	if err := yamlToConfig(prowConfig, &nc); err != nil {
+	if err := yamlToConfig(prowConfig, &nc, strict); err != nil {
 		return nil, err
 	}
 	if err := parseProwConfig(&nc); err != nil {
@@ -387,7 +602,7 @@ func loadConfig(prowConfig, jobConfig string) (*Config, error) {
 	if !stat.IsDir() {
 		// still support a single file
 		var jc JobConfig
-		if err := yamlToConfig(jobConfig, &jc); err != nil {
+		if err := yamlToConfig(jobConfig, &jc, strict); err != nil {
 			return nil, err
 		}
 		if err := nc.mergeJobConfig(jc); err != nil {
@@ -431,7 +646,7 @@ func loadConfig(prowConfig, jobConfig string) (*Config, error) {
 		uniqueBasenames.Insert(base)
 
 		var subConfig JobConfig
-		if err := yamlToConfig(path, &subConfig); err != nil {
+		if err := yamlToConfig(path, &subConfig, strict); err != nil {
 			return err
 		}
 		return nc.mergeJobConfig(subConfig)
@@ -444,15 +659,25 @@ func loadConfig(prowConfig, jobConfig string) (*Config, error) {
 	return &nc, nil
 }
 
-// yamlToConfig converts a yaml file into a Config object
-func yamlToConfig(path string, nc interface{}) error {
+// yamlToConfig converts a yaml file into a Config object. If strict is set,
+// fields that are unknown or set twice are errors.
+func yamlToConfig(path string, nc interface{}, strict bool) error {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return fmt.Errorf("error reading %s: %v", path, err)
 	}
+	if strict {
+		if err := checkStrict(b, nc); err != nil {
+			return fmt.Errorf("error unmarshaling %s: %v", path, err)
+		}
+	}
 	if err := yaml.Unmarshal(b, nc); err != nil {
 		return fmt.Errorf("error unmarshaling %s: %v", path, err)
 	}
+	var explicit explicitJobConfig
+	if err := yaml.Unmarshal(b, &explicit); err != nil {
+		return fmt.Errorf("error unmarshaling %s: %v", path, err)
+	}
 	var jc *JobConfig
 	switch v := nc.(type) {
 	case *JobConfig:
@@ -461,34 +686,124 @@ func yamlToConfig(path string, nc interface{}) error {
 		jc = &v.JobConfig
 	}
 	for rep := range jc.Presubmits {
-		var fix func(*Presubmit)
-		fix = func(job *Presubmit) {
+		var fix func(*Presubmit, explicitJobFields)
+		fix = func(job *Presubmit, fields explicitJobFields) {
 			job.SourcePath = path
+			job.explicit = fields.set()
 		}
 		for i := range jc.Presubmits[rep] {
-			fix(&jc.Presubmits[rep][i])
+			fix(&jc.Presubmits[rep][i], explicit.Presubmits[rep][i])
 		}
 	}
 	for rep := range jc.Postsubmits {
-		var fix func(*Postsubmit)
-		fix = func(job *Postsubmit) {
+		var fix func(*Postsubmit, explicitJobFields)
+		fix = func(job *Postsubmit, fields explicitJobFields) {
 			job.SourcePath = path
+			job.explicit = fields.set()
 		}
 		for i := range jc.Postsubmits[rep] {
-			fix(&jc.Postsubmits[rep][i])
+			fix(&jc.Postsubmits[rep][i], explicit.Postsubmits[rep][i])
 		}
 	}
 
-	var fix func(*Periodic)
-	fix = func(job *Periodic) {
+	var fix func(*Periodic, explicitJobFields)
+	fix = func(job *Periodic, fields explicitJobFields) {
 		job.SourcePath = path
+		job.explicit = fields.set()
 	}
 	for i := range jc.Periodics {
-		fix(&jc.Periodics[i])
+		fix(&jc.Periodics[i], explicit.Periodics[i])
 	}
 	return nil
 }
 
+// explicitJobConfig mirrors JobConfig to record which of the job fields
+// whose zero value is meaningful are set in a config file, so that
+// JobDefaults are not applied over them.
+type explicitJobConfig struct {
+	Presubmits  map[string][]explicitJobFields `json:"presubmits,omitempty"`
+	Postsubmits map[string][]explicitJobFields `json:"postsubmits,omitempty"`
+	Periodics   []explicitJobFields            `json:"periodics,omitempty"`
+}
+
+type explicitJobFields struct {
+	MaxConcurrency *int  `json:"max_concurrency,omitempty"`
+	SkipReport     *bool `json:"skip_report,omitempty"`
+}
+
+func (f explicitJobFields) set() sets.String {
+	set := sets.NewString()
+	if f.MaxConcurrency != nil {
+		set.Insert("max_concurrency")
+	}
+	if f.SkipReport != nil {
+		set.Insert("skip_report")
+	}
+	return set
+}
+
+// applyJobBaseDefaults sets the fields of the job that it does not
+// set itself from the defaults.
+func applyJobBaseDefaults(base *JobBase, def JobDefault) {
+	if base.Agent == "" {
+		base.Agent = def.Agent
+	}
+	if base.Cluster == "" {
+		base.Cluster = def.Cluster
+	}
+	if def.MaxConcurrency != nil && !base.explicit.Has("max_concurrency") {
+		base.MaxConcurrency = *def.MaxConcurrency
+	}
+	if base.Decorate && def.Timeout != 0 {
+		if base.DecorationConfig == nil {
+			base.DecorationConfig = &prowapi.DecorationConfig{}
+		}
+		if base.DecorationConfig.Timeout == 0 {
+			base.DecorationConfig.Timeout = def.Timeout
+		}
+	}
+	base.explicit = nil
+}
+
+func applyReporterDefaults(base JobBase, reporter *Reporter, def JobDefault) {
+	if def.SkipReport != nil && !base.explicit.Has("skip_report") {
+		reporter.SkipReport = *def.SkipReport
+	}
+}
+
+// applyJobDefaults sets fields that jobs do not set themselves from the
+// defaults for their org and repo.
+func (c *Config) applyJobDefaults() {
+	for orgRepo, vs := range c.Presubmits {
+		org, repo := splitOrgRepo(orgRepo)
+		def := c.JobDefaults.For(org, repo)
+		for i := range vs {
+			applyReporterDefaults(vs[i].JobBase, &vs[i].Reporter, def)
+			applyJobBaseDefaults(&vs[i].JobBase, def)
+		}
+	}
+	for orgRepo, js := range c.Postsubmits {
+		org, repo := splitOrgRepo(orgRepo)
+		def := c.JobDefaults.For(org, repo)
+		for i := range js {
+			applyReporterDefaults(js[i].JobBase, &js[i].Reporter, def)
+			applyJobBaseDefaults(&js[i].JobBase, def)
+		}
+	}
+	def := c.JobDefaults.For("", "")
+	for i := range c.Periodics {
+		applyJobBaseDefaults(&c.Periodics[i].JobBase, def)
+	}
+}
+
+func splitOrgRepo(orgRepo string) (string, string) {
+	parts := strings.SplitN(orgRepo, "/", 2)
+	if len(parts) != 2 {
+		return orgRepo, ""
+	}
+	return parts[0], parts[1]
+}
+
 // mergeConfig merges two JobConfig together
 // It will try to merge:
 //	- Presubmits
@@ -536,24 +851,41 @@ func (c *Config) mergeJobConfig(jc JobConfig) error {
 
 func setPresubmitDecorationDefaults(c *Config, ps *Presubmit) {
 	if ps.Decorate {
-		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
+		ps.DecorationConfig = c.Plank.ApplyDecorationDefaults(ps.DecorationConfig, prowapi.PresubmitJob)
 	}
 }
 
 func setPostsubmitDecorationDefaults(c *Config, ps *Postsubmit) {
 	if ps.Decorate {
-		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
+		ps.DecorationConfig = c.Plank.ApplyDecorationDefaults(ps.DecorationConfig, prowapi.PostsubmitJob)
 	}
 }
 
 func setPeriodicDecorationDefaults(c *Config, ps *Periodic) {
 	if ps.Decorate {
-		ps.DecorationConfig = ps.DecorationConfig.ApplyDefault(c.Plank.DefaultDecorationConfig)
+		ps.DecorationConfig = c.Plank.ApplyDecorationDefaults(ps.DecorationConfig, prowapi.PeriodicJob)
 	}
 }
 
+// ApplyDecorationDefaults returns the decoration config of a job of the given
+// type with the default timeout for the type and then the default decoration
+// config applied.
+func (p Plank) ApplyDecorationDefaults(dc *prowapi.DecorationConfig, jobType prowapi.ProwJobType) *prowapi.DecorationConfig {
+	if timeout := p.DefaultTimeoutByType[jobType]; timeout != 0 && (dc == nil || dc.Timeout == 0) {
+		var withTimeout prowapi.DecorationConfig
+		if dc != nil {
+			withTimeout = *dc
+		}
+		withTimeout.Timeout = timeout
+		dc = &withTimeout
+	}
+	return dc.ApplyDefault(p.DefaultDecorationConfig)
+}
+
 // finalizeJobConfig mutates and fixes entries for jobspecs
 func (c *Config) finalizeJobConfig() error {
+	c.applyJobDefaults()
+
 	if c.decorationRequested() {
 		if c.Plank.DefaultDecorationConfig == nil {
 			return errors.New("no default decoration config provided for plank")
@@ -636,9 +968,9 @@ func validateJobBase(v JobBase, jobType prowapi.ProwJobType, podNamespace string
 	if !jobNameRegex.MatchString(v.Name) {
 		return fmt.Errorf("name: must match regex %q", jobNameRegex.String())
 	}
-	// Ensure max_concurrency is non-negative.
-	if v.MaxConcurrency < 0 {
-		return fmt.Errorf("max_concurrency: %d must be a non-negative number", v.MaxConcurrency)
+	// Ensure max_concurrency is non-negative or unlimited.
+	if v.MaxConcurrency < prowapi.UnlimitedConcurrency {
+		return fmt.Errorf("max_concurrency: %d must be a non-negative number or %d for no limit", v.MaxConcurrency, prowapi.UnlimitedConcurrency)
 	}
 	if err := validateAgent(v, podNamespace); err != nil {
 		return err
@@ -655,6 +987,14 @@ func validateJobBase(v JobBase, jobType prowapi.ProwJobType, podNamespace string
 	return validateDecoration(v.Spec.Containers[0], v.DecorationConfig)
 }
 
+// definedIn describes the files that duplicated jobs are defined in, if known.
+func definedIn(path, otherPath string) string {
+	if path == "" || otherPath == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (defined in %s and %s)", path, otherPath)
+}
+
 // validateJobConfig validates if all the jobspecs/presets are valid
 // if you are mutating the jobs, please add it to finalizeJobConfig above
 func (c *Config) validateJobConfig() error {
@@ -670,19 +1010,30 @@ func (c *Config) validateJobConfig() error {
 			repoJobName := orgRepoJobName{repo, job.Name}
 			for _, existingJob := range validPresubmits[repoJobName] {
 				if existingJob.Brancher.Intersects(job.Brancher) {
-					return fmt.Errorf("duplicated presubmit job: %s", job.Name)
+					return fmt.Errorf("duplicated presubmit job %s in %s%s", job.Name, repo, definedIn(existingJob.SourcePath, job.SourcePath))
 				}
 			}
 			validPresubmits[repoJobName] = append(validPresubmits[repoJobName], job)
 		}
 	}
 
-	for _, v := range c.AllPresubmits(nil) {
-		if err := validateJobBase(v.JobBase, prowapi.PresubmitJob, c.PodNamespace); err != nil {
-			return fmt.Errorf("invalid presubmit job %s: %v", v.Name, err)
+	for repo, jobs := range c.Presubmits {
+		for _, v := range jobs {
+			if err := validateJobBase(v.JobBase, prowapi.PresubmitJob, c.PodNamespace); err != nil {
+				return fmt.Errorf("invalid presubmit job %s in %s: %v", v.Name, repo, err)
+			}
+			if err := validateTriggering(v); err != nil {
+				return fmt.Errorf("invalid presubmit job %s in %s: %v", v.Name, repo, err)
+			}
+			if err := validateBrancher(v.Brancher); err != nil {
+				return fmt.Errorf("invalid presubmit job %s in %s: %v", v.Name, repo, err)
+			}
+			if err := validateResourceRequests(v.Spec, c.Plank.MaxResourceRequests); err != nil {
+				return fmt.Errorf("invalid presubmit job %s in %s: %v", v.Name, repo, err)
+			}
 		}
-		if err := validateTriggering(v); err != nil {
-			return err
+		if err := validateTriggerOverlap(jobs); err != nil {
+			return fmt.Errorf("invalid presubmits in %s: %v", repo, err)
 		}
 	}
 
@@ -694,30 +1045,41 @@ func (c *Config) validateJobConfig() error {
 			repoJobName := orgRepoJobName{repo, job.Name}
 			for _, existingJob := range validPostsubmits[repoJobName] {
 				if existingJob.Brancher.Intersects(job.Brancher) {
-					return fmt.Errorf("duplicated postsubmit job: %s", job.Name)
+					return fmt.Errorf("duplicated postsubmit job %s in %s%s", job.Name, repo, definedIn(existingJob.SourcePath, job.SourcePath))
 				}
 			}
 			validPostsubmits[repoJobName] = append(validPostsubmits[repoJobName], job)
 		}
 	}
 
-	for _, j := range c.AllPostsubmits(nil) {
-		if err := validateJobBase(j.JobBase, prowapi.PostsubmitJob, c.PodNamespace); err != nil {
-			return fmt.Errorf("invalid postsubmit job %s: %v", j.Name, err)
+	for repo, jobs := range c.Postsubmits {
+		for _, j := range jobs {
+			if err := validateJobBase(j.JobBase, prowapi.PostsubmitJob, c.PodNamespace); err != nil {
+				return fmt.Errorf("invalid postsubmit job %s in %s: %v", j.Name, repo, err)
+			}
+			if err := validateBrancher(j.Brancher); err != nil {
+				return fmt.Errorf("invalid postsubmit job %s in %s: %v", j.Name, repo, err)
+			}
+			if err := validateResourceRequests(j.Spec, c.Plank.MaxResourceRequests); err != nil {
+				return fmt.Errorf("invalid postsubmit job %s in %s: %v", j.Name, repo, err)
+			}
 		}
 	}
 
 	// validate no duplicated periodics
-	validPeriodics := sets.NewString()
+	validPeriodics := map[string]string{}
 	// Ensure that the periodic durations are valid and specs exist.
 	for _, p := range c.AllPeriodics() {
-		if validPeriodics.Has(p.Name) {
-			return fmt.Errorf("duplicated periodic job : %s", p.Name)
+		if sourcePath, ok := validPeriodics[p.Name]; ok {
+			return fmt.Errorf("duplicated periodic job %s%s", p.Name, definedIn(sourcePath, p.SourcePath))
 		}
-		validPeriodics.Insert(p.Name)
+		validPeriodics[p.Name] = p.SourcePath
 		if err := validateJobBase(p.JobBase, prowapi.PeriodicJob, c.PodNamespace); err != nil {
 			return fmt.Errorf("invalid periodic job %s: %v", p.Name, err)
 		}
+		if err := validateResourceRequests(p.Spec, c.Plank.MaxResourceRequests); err != nil {
+			return fmt.Errorf("invalid periodic job %s: %v", p.Name, err)
+		}
 	}
 	// Set the interval on the periodic jobs. It doesn't make sense to do this
 	// for child jobs.
@@ -737,11 +1099,35 @@ func (c *Config) validateJobConfig() error {
 			}
 			c.Periodics[j].interval = d
 		}
+		if p.MinimumInterval != "" {
+			d, err := time.ParseDuration(p.MinimumInterval)
+			if err != nil {
+				return fmt.Errorf("cannot parse minimum_interval for %s: %v", p.Name, err)
+			}
+			if d < 0 {
+				return fmt.Errorf("minimum_interval for %s must not be negative", p.Name)
+			}
+			c.Periodics[j].minimumInterval = d
+		}
 	}
 
 	return nil
 }
 
+func parseJobDefault(field string, def *JobDefault) error {
+	if def.TimeoutString != "" {
+		timeout, err := time.ParseDuration(def.TimeoutString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration for %s.timeout: %v", field, err)
+		}
+		def.Timeout = timeout
+	}
+	if def.MaxConcurrency != nil && *def.MaxConcurrency < prowapi.UnlimitedConcurrency {
+		return fmt.Errorf("%s has invalid max_concurrency (%d), it needs to be a non-negative number or %d for no limit", field, *def.MaxConcurrency, prowapi.UnlimitedConcurrency)
+	}
+	return nil
+}
+
 func parseProwConfig(c *Config) error {
 	if err := ValidateController(&c.Plank.Controller); err != nil {
 		return fmt.Errorf("validating plank config: %v", err)
@@ -757,6 +1143,97 @@ func parseProwConfig(c *Config) error {
 		c.Plank.PodPendingTimeout = podPendingTimeout
 	}
 
+	if err := parseJobDefault("defaults.default", &c.JobDefaults.Default); err != nil {
+		return err
+	}
+	for orgRepo, def := range c.JobDefaults.Repos {
+		if err := parseJobDefault(fmt.Sprintf("defaults.repos[%s]", orgRepo), &def); err != nil {
+			return err
+		}
+		c.JobDefaults.Repos[orgRepo] = def
+	}
+
+	if c.Plank.MaxPodEvictions < 0 {
+		return fmt.Errorf("plank has invalid max_pod_evictions (%d), it needs to be a non-negative number", c.Plank.MaxPodEvictions)
+	}
+
+	if c.Plank.MaxErrorRetries < 0 {
+		return fmt.Errorf("plank has invalid max_error_retries (%d), it needs to be a non-negative number", c.Plank.MaxErrorRetries)
+	}
+
+	if c.Plank.BuildIDAttempts < 0 {
+		return fmt.Errorf("plank has invalid build_id_attempts (%d), it needs to be a non-negative number", c.Plank.BuildIDAttempts)
+	}
+
+	if c.Plank.MaxStartAttempts < 0 {
+		return fmt.Errorf("plank has invalid max_start_attempts (%d), it needs to be a non-negative number", c.Plank.MaxStartAttempts)
+	}
+
+	if c.Plank.BuildNumberEnvName == "" {
+		c.Plank.BuildNumberEnvName = downwardapi.BuildNumberEnv
+	}
+
+	if _, err := labels.Parse(c.Plank.JobSelector); err != nil {
+		return fmt.Errorf("invalid plank.job_selector %q: %v", c.Plank.JobSelector, err)
+	}
+
+	if err := validateExtraContainers(c.Plank.ExtraContainers); err != nil {
+		return fmt.Errorf("plank has invalid extra_containers: %v", err)
+	}
+
+	for i, override := range c.Plank.PodStateOverrides {
+		if override.Phase == "" {
+			return fmt.Errorf("plank has invalid pod_state_overrides[%d], it needs a phase", i)
+		}
+		switch override.State {
+		case prowapi.SuccessState, prowapi.FailureState, prowapi.ErrorState:
+		default:
+			return fmt.Errorf("plank has invalid pod_state_overrides[%d] state %q, it needs to be one of %s, %s or %s", i, override.State, prowapi.SuccessState, prowapi.FailureState, prowapi.ErrorState)
+		}
+	}
+
+	if c.Plank.PodActiveDeadlineMarginString == "" {
+		c.Plank.PodActiveDeadlineMargin = 10 * time.Minute
+	} else {
+		margin, err := time.ParseDuration(c.Plank.PodActiveDeadlineMarginString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration for plank.pod_active_deadline_margin: %v", err)
+		}
+		if margin < 0 {
+			return fmt.Errorf("plank has invalid pod_active_deadline_margin (%v), it needs to be non-negative", margin)
+		}
+		c.Plank.PodActiveDeadlineMargin = margin
+	}
+
+	if c.Plank.MaxProwJobAgeString != "" {
+		maxProwJobAge, err := time.ParseDuration(c.Plank.MaxProwJobAgeString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration for plank.max_prowjob_age: %v", err)
+		}
+		c.Plank.MaxProwJobAge = maxProwJobAge
+	}
+
+	for jobType, max := range c.Plank.DefaultMaxConcurrencyByType {
+		if max < 0 {
+			return fmt.Errorf("plank has invalid default_max_concurrency_by_type for %s (%d), it needs to be a non-negative number", jobType, max)
+		}
+	}
+
+	c.Plank.DefaultTimeoutByType = nil
+	for jobType, timeoutString := range c.Plank.DefaultTimeoutByTypeStrings {
+		timeout, err := time.ParseDuration(timeoutString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration for plank.default_timeout_by_type.%s: %v", jobType, err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("plank.default_timeout_by_type.%s must be positive, got %s", jobType, timeoutString)
+		}
+		if c.Plank.DefaultTimeoutByType == nil {
+			c.Plank.DefaultTimeoutByType = map[prowapi.ProwJobType]time.Duration{}
+		}
+		c.Plank.DefaultTimeoutByType[jobType] = timeout
+	}
+
 	if c.Gerrit.TickIntervalString == "" {
 		c.Gerrit.TickInterval = time.Minute
 	} else {
@@ -784,6 +1261,22 @@ func parseProwConfig(c *Config) error {
 		}
 	}
 
+	if c.SlackReporter.WebhookURL != "" {
+		if u, err := url.Parse(c.SlackReporter.WebhookURL); err != nil || !u.IsAbs() {
+			return fmt.Errorf("slack_reporter has an invalid webhook_url %q", c.SlackReporter.WebhookURL)
+		}
+	}
+	if len(c.SlackReporter.JobStatesToReport) == 0 {
+		c.SlackReporter.JobStatesToReport = []prowapi.ProwJobState{prowapi.FailureState, prowapi.ErrorState}
+	}
+	for _, state := range c.SlackReporter.JobStatesToReport {
+		switch state {
+		case prowapi.SuccessState, prowapi.FailureState, prowapi.AbortedState, prowapi.ErrorState:
+		default:
+			return fmt.Errorf("slack_reporter has job_states_to_report %q, which is not a state that jobs complete in", state)
+		}
+	}
+
 	for i := range c.JenkinsOperators {
 		if err := ValidateController(&c.JenkinsOperators[i].Controller); err != nil {
 			return fmt.Errorf("validating jenkins_operators config: %v", err)
@@ -827,6 +1320,32 @@ func parseProwConfig(c *Config) error {
 		c.Deck.TideUpdatePeriod = period
 	}
 
+	if c.Deck.JobUpdatePeriodString == "" {
+		c.Deck.JobUpdatePeriod = 30 * time.Second
+	} else {
+		period, err := time.ParseDuration(c.Deck.JobUpdatePeriodString)
+		if err != nil {
+			return fmt.Errorf("cannot parse duration for deck.job_update_period: %v", err)
+		}
+		if period <= 0 {
+			return fmt.Errorf("deck.job_update_period must be positive, got %s", period)
+		}
+		c.Deck.JobUpdatePeriod = period
+	}
+
+	redactedEnv := c.Deck.RedactedEnvStrings
+	if len(redactedEnv) == 0 {
+		redactedEnv = []string{".*TOKEN.*", ".*PASSWORD.*"}
+	}
+	c.Deck.RedactedEnv = nil
+	for _, pattern := range redactedEnv {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return fmt.Errorf("cannot compile deck.redacted_env pattern %q: %v", pattern, err)
+		}
+		c.Deck.RedactedEnv = append(c.Deck.RedactedEnv, re)
+	}
+
 	if c.Deck.Spyglass.SizeLimit == 0 {
 		c.Deck.Spyglass.SizeLimit = 100e6
 	} else if c.Deck.Spyglass.SizeLimit <= 0 {
@@ -932,6 +1451,24 @@ func parseProwConfig(c *Config) error {
 		}
 	}
 
+	for name, templates := range c.Tide.MergeTemplate {
+		if templates.TitleTemplate != "" {
+			title, err := template.New("CommitTitle").Parse(templates.TitleTemplate)
+			if err != nil {
+				return fmt.Errorf("parsing the merge commit title template for %s: %v", name, err)
+			}
+			templates.Title = title
+		}
+		if templates.BodyTemplate != "" {
+			body, err := template.New("CommitBody").Parse(templates.BodyTemplate)
+			if err != nil {
+				return fmt.Errorf("parsing the merge commit body template for %s: %v", name, err)
+			}
+			templates.Body = body
+		}
+		c.Tide.MergeTemplate[name] = templates
+	}
+
 	for i, tq := range c.Tide.Queries {
 		if err := tq.Validate(); err != nil {
 			return fmt.Errorf("tide query (index %d) is invalid: %v", i, err)
@@ -1070,8 +1607,15 @@ func validatePodSpec(jobType prowapi.ProwJobType, spec *v1.PodSpec) error {
 		return nil
 	}
 
-	if len(spec.InitContainers) != 0 {
-		return errors.New("pod spec may not use init containers")
+	initContainerNames := sets.NewString(decorate.InitContainerNames()...)
+	for _, container := range spec.InitContainers {
+		if container.Name == "" {
+			return errors.New("init containers must have a name")
+		}
+		if initContainerNames.Has(container.Name) {
+			return fmt.Errorf("init container name %q is already used", container.Name)
+		}
+		initContainerNames.Insert(container.Name)
 	}
 
 	if n := len(spec.Containers); n != 1 {
@@ -1111,15 +1655,80 @@ func validatePodSpec(jobType prowapi.ProwJobType, spec *v1.PodSpec) error {
 	return nil
 }
 
+// validateExtraContainers checks that the containers to add to job pods are
+// named, and that their names differ from each other and from the containers
+// that every pod may already have.
+func validateExtraContainers(containers []v1.Container) error {
+	names := sets.NewString(kube.TestContainerName, decorate.SidecarContainerName)
+	for _, container := range containers {
+		if container.Name == "" {
+			return errors.New("containers must have a name")
+		}
+		if names.Has(container.Name) {
+			return fmt.Errorf("container name %q is already used", container.Name)
+		}
+		names.Insert(container.Name)
+	}
+	return nil
+}
+
+// validateResourceRequests ensures that the resources requested by the
+// containers of a pod spec do not exceed the configured ceiling.
+func validateResourceRequests(spec *v1.PodSpec, max v1.ResourceList) error {
+	if spec == nil || len(max) == 0 {
+		return nil
+	}
+	requested := v1.ResourceList{}
+	for _, container := range spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			total := requested[name]
+			total.Add(quantity)
+			requested[name] = total
+		}
+	}
+	for name, quantity := range requested {
+		ceiling, limited := max[name]
+		if limited && quantity.Cmp(ceiling) > 0 {
+			return fmt.Errorf("requests %s of %s, exceeding the maximum of %s", quantity.String(), name, ceiling.String())
+		}
+	}
+	return nil
+}
+
 func validateTriggering(job Presubmit) error {
 	if job.AlwaysRun && job.RunIfChanged != "" {
 		return fmt.Errorf("job %s is set to always run but also declares run_if_changed targets, which are mutually exclusive", job.Name)
 	}
 
+	if job.AlwaysRun && job.SkipIfOnlyChanged != "" {
+		return fmt.Errorf("job %s is set to always run but also declares skip_if_only_changed targets, which are mutually exclusive", job.Name)
+	}
+
 	if !job.SkipReport && job.Context == "" {
 		return fmt.Errorf("job %s is set to report but has no context configured", job.Name)
 	}
 
+	if (job.Trigger == "") != (job.RerunCommand == "") {
+		return fmt.Errorf("job %s must declare both trigger and rerun_command, or neither", job.Name)
+	}
+
+	return nil
+}
+
+// validateTriggerOverlap ensures that the rerun command of every presubmit
+// for a repo triggers no other presubmit that could run on the same branches,
+// so that users asking to rerun one job do not unknowingly rerun others.
+func validateTriggerOverlap(jobs []Presubmit) error {
+	for i, job := range jobs {
+		for j, other := range jobs {
+			if i == j || job.RerunCommand == "" || !job.Brancher.Intersects(other.Brancher) {
+				continue
+			}
+			if other.TriggerMatches(job.RerunCommand) {
+				return fmt.Errorf("rerun command %q of job %s also triggers job %s", job.RerunCommand, job.Name, other.Name)
+			}
+		}
+	}
 	return nil
 }
 
@@ -1232,18 +1841,24 @@ func SetPresubmitRegexes(js []Presubmit) error {
 	return nil
 }
 
+// branchRegex compiles branch patterns into a single regex that must match
+// the whole branch name, so that `master` does not match `my-master-branch`.
+func branchRegex(patterns []string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + strings.Join(patterns, `|`) + `)$`)
+}
+
 // setBrancherRegexes compiles and validates all the regular expressions for
 // the provided branch specifiers.
 func setBrancherRegexes(br Brancher) (Brancher, error) {
 	if len(br.Branches) > 0 {
-		if re, err := regexp.Compile(strings.Join(br.Branches, `|`)); err == nil {
+		if re, err := branchRegex(br.Branches); err == nil {
 			br.re = re
 		} else {
 			return br, fmt.Errorf("could not compile positive branch regex: %v", err)
 		}
 	}
 	if len(br.SkipBranches) > 0 {
-		if re, err := regexp.Compile(strings.Join(br.SkipBranches, `|`)); err == nil {
+		if re, err := branchRegex(br.SkipBranches); err == nil {
 			br.reSkip = re
 		} else {
 			return br, fmt.Errorf("could not compile negative branch regex: %v", err)
@@ -1252,6 +1867,24 @@ func setBrancherRegexes(br Brancher) (Brancher, error) {
 	return br, nil
 }
 
+// validateBrancher rejects branch filters where a branch is explicitly
+// listed but also skipped, which means the job can never run against it.
+func validateBrancher(br Brancher) error {
+	if len(br.Branches) == 0 || len(br.SkipBranches) == 0 {
+		return nil
+	}
+	reSkip, err := branchRegex(br.SkipBranches)
+	if err != nil {
+		return fmt.Errorf("could not compile negative branch regex: %v", err)
+	}
+	for _, branch := range br.Branches {
+		if reSkip.MatchString(branch) {
+			return fmt.Errorf("branch %q is also matched by skip_branches", branch)
+		}
+	}
+	return nil
+}
+
 func setChangeRegexes(cm RegexpChangeMatcher) (RegexpChangeMatcher, error) {
 	if cm.RunIfChanged != "" {
 		re, err := regexp.Compile(cm.RunIfChanged)
@@ -1260,6 +1893,13 @@ func setChangeRegexes(cm RegexpChangeMatcher) (RegexpChangeMatcher, error) {
 		}
 		cm.reChanges = re
 	}
+	if cm.SkipIfOnlyChanged != "" {
+		re, err := regexp.Compile(cm.SkipIfOnlyChanged)
+		if err != nil {
+			return cm, fmt.Errorf("could not compile skip_if_only_changed regex: %v", err)
+		}
+		cm.reSkipChanges = re
+	}
 	return cm, nil
 }
 
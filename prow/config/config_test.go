@@ -22,12 +22,16 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	buildv1alpha1 "github.com/knative/build/pkg/apis/build/v1alpha1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	prowjobv1 "k8s.io/test-infra/prow/apis/prowjobs/v1"
@@ -601,13 +605,40 @@ func TestValidatePodSpec(t *testing.T) {
 			pass: true,
 		},
 		{
-			name: "reject init containers",
+			name: "allow init containers",
+			spec: func(s *v1.PodSpec) {
+				s.InitContainers = []v1.Container{
+					{Name: "fetch-secrets"},
+					{Name: "setup-workspace"},
+				}
+			},
+			pass: true,
+		},
+		{
+			name: "reject unnamed init containers",
 			spec: func(s *v1.PodSpec) {
 				s.InitContainers = []v1.Container{
 					{},
 				}
 			},
 		},
+		{
+			name: "reject duplicate init container names",
+			spec: func(s *v1.PodSpec) {
+				s.InitContainers = []v1.Container{
+					{Name: "setup"},
+					{Name: "setup"},
+				}
+			},
+		},
+		{
+			name: "reject init container names used by decoration",
+			spec: func(s *v1.PodSpec) {
+				s.InitContainers = []v1.Container{
+					{Name: decorate.InitContainerNames()[0]},
+				}
+			},
+		},
 		{
 			name: "reject 0 containers",
 			spec: func(s *v1.PodSpec) {
@@ -827,6 +858,45 @@ func TestValidateLabels(t *testing.T) {
 				"whatever": "_private-is-rejected",
 			},
 		},
+		{
+			name: "accept grouping labels",
+			labels: map[string]string{
+				"release-blocking":    "true",
+				"testgrid.k8s.io/sig": "sig-node",
+			},
+			pass: true,
+		},
+		{
+			name: "reject label value with spaces",
+			labels: map[string]string{
+				"sig": "sig node",
+			},
+		},
+		{
+			name: "reject label key with invalid characters",
+			labels: map[string]string{
+				"sig:node": "true",
+			},
+		},
+		{
+			name: "accept label value of 63 characters",
+			labels: map[string]string{
+				"group": strings.Repeat("a", 63),
+			},
+			pass: true,
+		},
+		{
+			name: "reject label value longer than 63 characters",
+			labels: map[string]string{
+				"group": strings.Repeat("a", 64),
+			},
+		},
+		{
+			name: "reject label key name longer than 63 characters",
+			labels: map[string]string{
+				strings.Repeat("a", 64): "true",
+			},
+		},
 	}
 
 	for _, tc := range cases {
@@ -885,11 +955,22 @@ func TestValidateJobBase(t *testing.T) {
 			},
 			pass: true,
 		},
+		{
+			name: "unlimited concurrency",
+			base: JobBase{
+				Name:           "name",
+				MaxConcurrency: prowapi.UnlimitedConcurrency,
+				Agent:          ka,
+				Spec:           &goodSpec,
+				Namespace:      &ns,
+			},
+			pass: true,
+		},
 		{
 			name: "invalid concurrency",
 			base: JobBase{
 				Name:           "name",
-				MaxConcurrency: -1,
+				MaxConcurrency: -2,
 				Agent:          ka,
 				Spec:           &goodSpec,
 				Namespace:      &ns,
@@ -985,6 +1066,35 @@ func TestValidConfigLoading(t *testing.T) {
 			name:       "one config",
 			prowConfig: ``,
 		},
+		{
+			name: "plank default max concurrency by type",
+			prowConfig: `
+plank:
+  default_max_concurrency_by_type:
+    presubmit: 10
+    periodic: 2`,
+		},
+		{
+			name: "reject negative plank default max concurrency by type",
+			prowConfig: `
+plank:
+  default_max_concurrency_by_type:
+    presubmit: -1`,
+			expectError: true,
+		},
+		{
+			name: "plank job selector",
+			prowConfig: `
+plank:
+  job_selector: shard in (a, b)`,
+		},
+		{
+			name: "reject invalid plank job selector",
+			prowConfig: `
+plank:
+  job_selector: shard in a`,
+			expectError: true,
+		},
 		{
 			name:       "reject invalid kubernetes periodic",
 			prowConfig: ``,
@@ -1060,6 +1170,80 @@ periodics:
     - image: alpine`,
 			},
 		},
+		{
+			name:       "periodic with minimum interval",
+			prowConfig: ``,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  minimum_interval: 5m
+  agent: kubernetes
+  name: foo
+  spec:
+    containers:
+    - image: alpine`,
+			},
+		},
+		{
+			name:       "reject periodic with invalid minimum interval",
+			prowConfig: ``,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  minimum_interval: soon
+  agent: kubernetes
+  name: foo
+  spec:
+    containers:
+    - image: alpine`,
+			},
+			expectError: true,
+		},
+		{
+			name: "reject job requesting more than max resource requests",
+			prowConfig: `
+plank:
+  max_resource_requests:
+    cpu: "64"
+    memory: 256Gi`,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  agent: kubernetes
+  name: foo
+  spec:
+    containers:
+    - image: alpine
+      resources:
+        requests:
+          cpu: "1000"`,
+			},
+			expectError: true,
+		},
+		{
+			name: "job within max resource requests",
+			prowConfig: `
+plank:
+  max_resource_requests:
+    cpu: "64"`,
+			jobConfigs: []string{
+				`
+periodics:
+- interval: 10m
+  agent: kubernetes
+  name: foo
+  spec:
+    containers:
+    - image: alpine
+      resources:
+        requests:
+          cpu: "8"
+          memory: 1Ti`,
+			},
+		},
 		{
 			name:       "duplicated periodics",
 			prowConfig: ``,
@@ -1612,6 +1796,690 @@ periodics:
 	}
 }
 
+func TestJobDefaults(t *testing.T) {
+	prowConfig := `
+plank:
+  default_decoration_config:
+    timeout: 7200000000000 # 2h
+    utility_images:
+      clonerefs: "clonerefs:default"
+      initupload: "initupload:default"
+      entrypoint: "entrypoint:default"
+      sidecar: "sidecar:default"
+    gcs_configuration:
+      bucket: "default-bucket"
+      path_strategy: "legacy"
+      default_org: "kubernetes"
+      default_repo: "kubernetes"
+    gcs_credentials_secret: "default-service-account"
+defaults:
+  default:
+    cluster: global
+    timeout: 1h
+    max_concurrency: 1
+  repos:
+    org:
+      cluster: org
+      max_concurrency: 2
+      skip_report: true
+    org/repo:
+      max_concurrency: 3
+`
+	jobConfig := `
+presubmits:
+  org/repo:
+  - name: repo-presubmit
+    spec: {containers: [{image: alpine}]}
+  - name: explicit-zero-presubmit
+    max_concurrency: 0
+    skip_report: false
+    cluster: explicit
+    spec: {containers: [{image: alpine}]}
+  org/other:
+  - name: org-presubmit
+    decorate: true
+    spec: {containers: [{image: alpine, command: [test]}]}
+  - name: timeout-presubmit
+    decorate: true
+    decoration_config:
+      timeout: 60000000000 # 1m
+    spec: {containers: [{image: alpine, command: [test]}]}
+postsubmits:
+  other/repo:
+  - name: global-postsubmit
+    spec: {containers: [{image: alpine}]}
+periodics:
+- name: periodic
+  interval: 1h
+  spec: {containers: [{image: alpine}]}
+`
+	dir, err := ioutil.TempDir("", "jobDefaults")
+	if err != nil {
+		t.Fatalf("fail to make tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	prowConfigPath := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(prowConfigPath, []byte(prowConfig), 0666); err != nil {
+		t.Fatalf("fail to write prow config: %v", err)
+	}
+	jobConfigPath := filepath.Join(dir, "jobs.yaml")
+	if err := ioutil.WriteFile(jobConfigPath, []byte(jobConfig), 0666); err != nil {
+		t.Fatalf("fail to write job config: %v", err)
+	}
+	c, err := Load(prowConfigPath, jobConfigPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	type defaulted struct {
+		cluster        string
+		maxConcurrency int
+		skipReport     bool
+		timeout        time.Duration
+	}
+	actual := map[string]defaulted{}
+	for _, p := range c.AllPresubmits(nil) {
+		d := defaulted{cluster: p.Cluster, maxConcurrency: p.MaxConcurrency, skipReport: p.SkipReport}
+		if p.DecorationConfig != nil {
+			d.timeout = p.DecorationConfig.Timeout
+		}
+		actual[p.Name] = d
+	}
+	for _, p := range c.AllPostsubmits(nil) {
+		actual[p.Name] = defaulted{cluster: p.Cluster, maxConcurrency: p.MaxConcurrency, skipReport: p.SkipReport}
+	}
+	for _, p := range c.AllPeriodics() {
+		actual[p.Name] = defaulted{cluster: p.Cluster, maxConcurrency: p.MaxConcurrency}
+	}
+	expected := map[string]defaulted{
+		"repo-presubmit":          {cluster: "org", maxConcurrency: 3, skipReport: true},
+		"explicit-zero-presubmit": {cluster: "explicit", maxConcurrency: 0, skipReport: false},
+		"org-presubmit":           {cluster: "org", maxConcurrency: 2, skipReport: true, timeout: time.Hour},
+		"timeout-presubmit":       {cluster: "org", maxConcurrency: 2, skipReport: true, timeout: time.Minute},
+		"global-postsubmit":       {cluster: "global", maxConcurrency: 1},
+		"periodic":                {cluster: "global", maxConcurrency: 1},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected defaulted job fields: %s", diff.ObjectReflectDiff(expected, actual))
+	}
+}
+
+func TestJobDefaultsInvalid(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prowConfig string
+	}{
+		{
+			name: "unparseable timeout",
+			prowConfig: `
+defaults:
+  default:
+    timeout: forever`,
+		},
+		{
+			name: "negative max concurrency",
+			prowConfig: `
+defaults:
+  repos:
+    org/repo:
+      max_concurrency: -2`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+			if err := yaml.Unmarshal([]byte(tc.prowConfig), &c); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			if err := parseProwConfig(&c); err == nil {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestDefaultTimeoutByType(t *testing.T) {
+	prowConfig := `
+plank:
+  default_timeout_by_type:
+    presubmit: 30m
+    batch: 45m
+    periodic: 3h
+  default_decoration_config:
+    timeout: 7200000000000 # 2h
+    utility_images:
+      clonerefs: "clonerefs:default"
+      initupload: "initupload:default"
+      entrypoint: "entrypoint:default"
+      sidecar: "sidecar:default"
+    gcs_configuration:
+      bucket: "default-bucket"
+      path_strategy: "legacy"
+      default_org: "kubernetes"
+      default_repo: "kubernetes"
+    gcs_credentials_secret: "default-service-account"
+`
+	jobConfig := `
+presubmits:
+  org/repo:
+  - name: type-default-presubmit
+    decorate: true
+    spec: {containers: [{image: alpine, command: [test]}]}
+  - name: timeout-presubmit
+    decorate: true
+    decoration_config:
+      timeout: 60000000000 # 1m
+    spec: {containers: [{image: alpine, command: [test]}]}
+postsubmits:
+  org/repo:
+  - name: decoration-default-postsubmit
+    decorate: true
+    spec: {containers: [{image: alpine, command: [test]}]}
+periodics:
+- name: type-default-periodic
+  interval: 1h
+  decorate: true
+  spec: {containers: [{image: alpine, command: [test]}]}
+`
+	dir, err := ioutil.TempDir("", "defaultTimeoutByType")
+	if err != nil {
+		t.Fatalf("fail to make tempdir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	prowConfigPath := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(prowConfigPath, []byte(prowConfig), 0666); err != nil {
+		t.Fatalf("fail to write prow config: %v", err)
+	}
+	jobConfigPath := filepath.Join(dir, "jobs.yaml")
+	if err := ioutil.WriteFile(jobConfigPath, []byte(jobConfig), 0666); err != nil {
+		t.Fatalf("fail to write job config: %v", err)
+	}
+	c, err := Load(prowConfigPath, jobConfigPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	actual := map[string]time.Duration{}
+	for _, p := range c.AllPresubmits(nil) {
+		actual[p.Name] = p.DecorationConfig.Timeout
+	}
+	for _, p := range c.AllPostsubmits(nil) {
+		actual[p.Name] = p.DecorationConfig.Timeout
+	}
+	for _, p := range c.AllPeriodics() {
+		actual[p.Name] = p.DecorationConfig.Timeout
+	}
+	expected := map[string]time.Duration{
+		"type-default-presubmit":        30 * time.Minute,
+		"timeout-presubmit":             time.Minute,
+		"decoration-default-postsubmit": 2 * time.Hour,
+		"type-default-periodic":         3 * time.Hour,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected job timeouts: %s", diff.ObjectReflectDiff(expected, actual))
+	}
+
+	for _, invalid := range []string{"forever", "-1h", "0s"} {
+		var c Config
+		c.Plank.DefaultTimeoutByTypeStrings = map[prowapi.ProwJobType]string{prowapi.PresubmitJob: invalid}
+		if err := parseProwConfig(&c); err == nil {
+			t.Errorf("expected an error for default timeout %q, got none", invalid)
+		}
+	}
+}
+
+func TestDeckRedactedEnv(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prowConfig string
+		redacted   []string
+		kept       []string
+		valid      bool
+	}{
+		{
+			name:     "tokens and passwords are redacted by default",
+			redacted: []string{"GITHUB_TOKEN", "DB_PASSWORD"},
+			kept:     []string{"IMAGE", "github_token"},
+			valid:    true,
+		},
+		{
+			name: "configured patterns replace the defaults",
+			prowConfig: `
+deck:
+  redacted_env:
+  - .*_KEY`,
+			redacted: []string{"AWS_SECRET_KEY"},
+			kept:     []string{"GITHUB_TOKEN", "AWS_SECRET_KEY_FILE"},
+			valid:    true,
+		},
+		{
+			name: "invalid pattern",
+			prowConfig: `
+deck:
+  redacted_env:
+  - "("`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+			if err := yaml.Unmarshal([]byte(tc.prowConfig), &c); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			err := parseProwConfig(&c)
+			switch {
+			case err != nil && tc.valid:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !tc.valid:
+				t.Fatal("expected an error, got none")
+			case err != nil:
+				return
+			}
+			redacted := func(name string) bool {
+				for _, re := range c.Deck.RedactedEnv {
+					if re.MatchString(name) {
+						return true
+					}
+				}
+				return false
+			}
+			for _, name := range tc.redacted {
+				if !redacted(name) {
+					t.Errorf("expected %s to be redacted", name)
+				}
+			}
+			for _, name := range tc.kept {
+				if redacted(name) {
+					t.Errorf("expected %s not to be redacted", name)
+				}
+			}
+		})
+	}
+}
+
+func TestSlackReporterConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prowConfig string
+		expected   []prowapi.ProwJobState
+		valid      bool
+	}{
+		{
+			name:     "failures and errors are reported by default",
+			expected: []prowapi.ProwJobState{prowapi.FailureState, prowapi.ErrorState},
+			valid:    true,
+		},
+		{
+			name: "states to report",
+			prowConfig: `
+slack_reporter:
+  webhook_url: https://hooks.slack.com/services/x
+  job_states_to_report:
+  - success`,
+			expected: []prowapi.ProwJobState{prowapi.SuccessState},
+			valid:    true,
+		},
+		{
+			name: "relative webhook",
+			prowConfig: `
+slack_reporter:
+  webhook_url: /services/x`,
+		},
+		{
+			name: "state that jobs do not complete in",
+			prowConfig: `
+slack_reporter:
+  job_states_to_report:
+  - pending`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+			if err := yaml.Unmarshal([]byte(tc.prowConfig), &c); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			err := parseProwConfig(&c)
+			switch {
+			case err != nil && tc.valid:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !tc.valid:
+				t.Fatal("expected an error, got none")
+			}
+			if tc.valid && !reflect.DeepEqual(c.SlackReporter.JobStatesToReport, tc.expected) {
+				t.Errorf("expected states to report %v, got %v", tc.expected, c.SlackReporter.JobStatesToReport)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ns := "default"
+	job := func(name string) JobBase {
+		return JobBase{
+			Name:      name,
+			Agent:     string(prowapi.KubernetesAgent),
+			Namespace: &ns,
+			Spec:      &v1.PodSpec{Containers: []v1.Container{{Image: "alpine"}}},
+		}
+	}
+	presubmit := func(name string, branches ...string) Presubmit {
+		return Presubmit{
+			JobBase:  job(name),
+			Reporter: Reporter{Context: name},
+			Brancher: Brancher{Branches: branches},
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		config JobConfig
+		// maxResourceRequests is used as plank.max_resource_requests.
+		maxResourceRequests v1.ResourceList
+		// expectedErr is a substring of the expected error, if any.
+		expectedErr string
+	}{
+		{
+			name: "valid config",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo":  {presubmit("pull-e2e")},
+					"org/other": {presubmit("pull-e2e")},
+				},
+				Postsubmits: map[string][]Postsubmit{
+					"org/repo": {{JobBase: job("post-e2e")}},
+				},
+				Periodics: []Periodic{{JobBase: job("ci-e2e"), Cron: "@every 1h"}},
+			},
+		},
+		{
+			name: "same presubmit name on different branches is allowed",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {presubmit("pull-e2e", "master"), presubmit("pull-e2e", "release-1.0")},
+				},
+			},
+		},
+		{
+			name: "duplicate presubmit names in a repo",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {presubmit("pull-e2e"), presubmit("pull-e2e")},
+				},
+			},
+			expectedErr: "duplicated presubmit job pull-e2e in org/repo",
+		},
+		{
+			name: "duplicate postsubmit names in a repo",
+			config: JobConfig{
+				Postsubmits: map[string][]Postsubmit{
+					"org/repo": {{JobBase: job("post-e2e")}, {JobBase: job("post-e2e")}},
+				},
+			},
+			expectedErr: "duplicated postsubmit job post-e2e in org/repo",
+		},
+		{
+			name: "duplicate periodic names",
+			config: JobConfig{
+				Periodics: []Periodic{
+					{JobBase: job("ci-e2e"), Cron: "@every 1h"},
+					{JobBase: job("ci-e2e"), Cron: "@every 2h"},
+				},
+			},
+			expectedErr: "duplicated periodic job ci-e2e",
+		},
+		{
+			name: "presubmit whose branches are all skipped",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {func() Presubmit {
+						p := presubmit("pull-e2e", "release-1.0")
+						p.SkipBranches = []string{"release-.*"}
+						return p
+					}()},
+				},
+			},
+			expectedErr: `invalid presubmit job pull-e2e in org/repo: branch "release-1.0" is also matched by skip_branches`,
+		},
+		{
+			name: "presubmit skipping some of its branches",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {func() Presubmit {
+						p := presubmit("pull-e2e", "release-.*")
+						p.SkipBranches = []string{"release-1.0"}
+						return p
+					}()},
+				},
+			},
+		},
+		{
+			name: "postsubmit with the same branch and skip_branches",
+			config: JobConfig{
+				Postsubmits: map[string][]Postsubmit{
+					"org/repo": {{
+						JobBase:  job("post-e2e"),
+						Brancher: Brancher{Branches: []string{"master"}, SkipBranches: []string{"master"}},
+					}},
+				},
+			},
+			expectedErr: "invalid postsubmit job post-e2e in org/repo",
+		},
+		{
+			name: "presubmit requesting 1000 cpus",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {func() Presubmit {
+						p := presubmit("pull-e2e")
+						p.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+							v1.ResourceCPU: resource.MustParse("1000"),
+						}
+						return p
+					}()},
+				},
+			},
+			maxResourceRequests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("64")},
+			expectedErr:         "invalid presubmit job pull-e2e in org/repo: requests 1k of cpu, exceeding the maximum of 64",
+		},
+		{
+			name: "kubernetes presubmit without a spec",
+			config: JobConfig{
+				Presubmits: map[string][]Presubmit{
+					"org/repo": {func() Presubmit {
+						p := presubmit("pull-e2e")
+						p.Spec = nil
+						return p
+					}()},
+				},
+			},
+			expectedErr: "invalid presubmit job pull-e2e in org/repo",
+		},
+		{
+			name: "kubernetes postsubmit with an empty spec",
+			config: JobConfig{
+				Postsubmits: map[string][]Postsubmit{
+					"org/repo": {{JobBase: func() JobBase {
+						j := job("post-e2e")
+						j.Spec = &v1.PodSpec{}
+						return j
+					}()}},
+				},
+			},
+			expectedErr: "invalid postsubmit job post-e2e in org/repo",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{
+				JobConfig: tc.config,
+				ProwConfig: ProwConfig{
+					PodNamespace: ns,
+					Plank:        Plank{MaxResourceRequests: tc.maxResourceRequests},
+				},
+			}
+			for repo := range c.Presubmits {
+				if err := SetPresubmitRegexes(c.Presubmits[repo]); err != nil {
+					t.Fatalf("failed to set presubmit regexes: %v", err)
+				}
+			}
+			err := Validate(c)
+			switch {
+			case tc.expectedErr == "" && err != nil:
+				t.Errorf("expected no error, got: %v", err)
+			case tc.expectedErr != "" && err == nil:
+				t.Errorf("expected an error containing %q, got none", tc.expectedErr)
+			case tc.expectedErr != "" && !strings.Contains(err.Error(), tc.expectedErr):
+				t.Errorf("expected an error containing %q, got: %v", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateTriggering(t *testing.T) {
+	testCases := []struct {
+		name        string
+		presubmit   Presubmit
+		expectedErr bool
+	}{
+		{
+			name:      "optional job that always runs is valid",
+			presubmit: Presubmit{AlwaysRun: true, Optional: true, Reporter: Reporter{Context: "ctx"}},
+		},
+		{
+			name: "optional job that runs if changed is valid",
+			presubmit: Presubmit{
+				Optional:            true,
+				RegexpChangeMatcher: RegexpChangeMatcher{RunIfChanged: "foo"},
+				Reporter:            Reporter{Context: "ctx"},
+			},
+		},
+		{
+			name:      "optional job that does not report is valid",
+			presubmit: Presubmit{Optional: true, Reporter: Reporter{SkipReport: true}},
+		},
+		{
+			name: "optional job that always runs and runs if changed is invalid",
+			presubmit: Presubmit{
+				AlwaysRun:           true,
+				Optional:            true,
+				RegexpChangeMatcher: RegexpChangeMatcher{RunIfChanged: "foo"},
+				Reporter:            Reporter{Context: "ctx"},
+			},
+			expectedErr: true,
+		},
+		{
+			name:        "optional job that reports without a context is invalid",
+			presubmit:   Presubmit{Optional: true},
+			expectedErr: true,
+		},
+		{
+			name: "job with a trigger and a rerun command is valid",
+			presubmit: Presubmit{
+				Reporter:     Reporter{SkipReport: true},
+				Trigger:      `(?m)^/test (?:unit|pull-foo-unit)$`,
+				RerunCommand: "/test unit",
+			},
+		},
+		{
+			name: "job with a trigger but no rerun command is invalid",
+			presubmit: Presubmit{
+				Reporter: Reporter{SkipReport: true},
+				Trigger:  `(?m)^/test unit$`,
+			},
+			expectedErr: true,
+		},
+		{
+			name: "job with a rerun command but no trigger is invalid",
+			presubmit: Presubmit{
+				Reporter:     Reporter{SkipReport: true},
+				RerunCommand: "/test unit",
+			},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateTriggering(tc.presubmit)
+			if tc.expectedErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidateTriggerOverlap(t *testing.T) {
+	presubmit := func(name, trigger, rerunCommand string, branches ...string) Presubmit {
+		return Presubmit{
+			JobBase:      JobBase{Name: name},
+			Trigger:      trigger,
+			RerunCommand: rerunCommand,
+			Brancher:     Brancher{Branches: branches},
+		}
+	}
+	testCases := []struct {
+		name        string
+		presubmits  []Presubmit
+		expectedErr bool
+	}{
+		{
+			name: "default triggers do not overlap",
+			presubmits: []Presubmit{
+				presubmit("unit", DefaultTriggerFor("unit"), DefaultRerunCommandFor("unit")),
+				presubmit("unit-race", DefaultTriggerFor("unit-race"), DefaultRerunCommandFor("unit-race")),
+			},
+		},
+		{
+			name: "aliases that only trigger their own job do not overlap",
+			presubmits: []Presubmit{
+				presubmit("pull-foo-unit", `(?m)^/test (?:unit|pull-foo-unit)$`, "/test unit"),
+				presubmit("pull-foo-e2e", `(?m)^/test (?:e2e|pull-foo-e2e)$`, "/test e2e"),
+			},
+		},
+		{
+			name: "shared triggers that rerun commands do not match are allowed",
+			presubmits: []Presubmit{
+				presubmit("pull-foo-unit", `(?m)^/test (?:all|unit)$`, "/test unit"),
+				presubmit("pull-foo-e2e", `(?m)^/test (?:all|e2e)$`, "/test e2e"),
+			},
+		},
+		{
+			name: "rerun command that triggers another job overlaps",
+			presubmits: []Presubmit{
+				presubmit("pull-foo-unit", `(?m)^/test unit`, "/test unit"),
+				presubmit("pull-foo-unit-race", `(?m)^/test unit-race`, "/test unit-race"),
+			},
+			expectedErr: true,
+		},
+		{
+			name: "overlapping jobs on distinct branches are allowed",
+			presubmits: []Presubmit{
+				presubmit("pull-foo-unit", `(?m)^/test unit$`, "/test unit", "master"),
+				presubmit("pull-foo-unit-release", `(?m)^/test unit$`, "/test unit", "release"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := SetPresubmitRegexes(tc.presubmits); err != nil {
+				t.Fatalf("could not set regexes: %v", err)
+			}
+			err := validateTriggerOverlap(tc.presubmits)
+			if tc.expectedErr && err == nil {
+				t.Error("expected an error, got none")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			}
+		})
+	}
+}
+
 func TestBrancher_Intersects(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -1843,3 +2711,161 @@ github_reporter:
 		}
 	}
 }
+
+func TestValidateExtraContainers(t *testing.T) {
+	testCases := []struct {
+		name        string
+		containers  []v1.Container
+		expectedErr bool
+	}{
+		{
+			name: "no extra containers",
+		},
+		{
+			name:       "uniquely named containers",
+			containers: []v1.Container{{Name: "logger"}, {Name: "proxy"}},
+		},
+		{
+			name:        "unnamed container",
+			containers:  []v1.Container{{Image: "fluentd"}},
+			expectedErr: true,
+		},
+		{
+			name:        "container named like the test container",
+			containers:  []v1.Container{{Name: kube.TestContainerName}},
+			expectedErr: true,
+		},
+		{
+			name:        "container named like the decoration sidecar",
+			containers:  []v1.Container{{Name: "sidecar"}},
+			expectedErr: true,
+		},
+		{
+			name:        "containers with the same name",
+			containers:  []v1.Container{{Name: "logger"}, {Name: "logger"}},
+			expectedErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateExtraContainers(tc.containers)
+			if err != nil && !tc.expectedErr {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err == nil && tc.expectedErr {
+				t.Error("expected an error, got none")
+			}
+		})
+	}
+}
+
+func TestPodActiveDeadlineMargin(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prowConfig string
+		expected   time.Duration
+		valid      bool
+	}{
+		{
+			name:     "defaults to 10m",
+			expected: 10 * time.Minute,
+			valid:    true,
+		},
+		{
+			name: "configured margin",
+			prowConfig: `
+plank:
+  pod_active_deadline_margin: 30m`,
+			expected: 30 * time.Minute,
+			valid:    true,
+		},
+		{
+			name: "invalid margin",
+			prowConfig: `
+plank:
+  pod_active_deadline_margin: generous`,
+		},
+		{
+			name: "margin must not be negative",
+			prowConfig: `
+plank:
+  pod_active_deadline_margin: -1m`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+			if err := yaml.Unmarshal([]byte(tc.prowConfig), &c); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			err := parseProwConfig(&c)
+			switch {
+			case err != nil && tc.valid:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !tc.valid:
+				t.Fatal("expected an error, got none")
+			case err != nil:
+				return
+			}
+			if c.Plank.PodActiveDeadlineMargin != tc.expected {
+				t.Errorf("expected margin %v, got %v", tc.expected, c.Plank.PodActiveDeadlineMargin)
+			}
+		})
+	}
+}
+
+func TestDeckJobUpdatePeriod(t *testing.T) {
+	testCases := []struct {
+		name       string
+		prowConfig string
+		expected   time.Duration
+		valid      bool
+	}{
+		{
+			name:     "defaults to 30s",
+			expected: 30 * time.Second,
+			valid:    true,
+		},
+		{
+			name: "configured period",
+			prowConfig: `
+deck:
+  job_update_period: 1m`,
+			expected: time.Minute,
+			valid:    true,
+		},
+		{
+			name: "invalid period",
+			prowConfig: `
+deck:
+  job_update_period: often`,
+		},
+		{
+			name: "period must be positive",
+			prowConfig: `
+deck:
+  job_update_period: 0s`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var c Config
+			if err := yaml.Unmarshal([]byte(tc.prowConfig), &c); err != nil {
+				t.Fatalf("failed to unmarshal config: %v", err)
+			}
+			err := parseProwConfig(&c)
+			switch {
+			case err != nil && tc.valid:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && !tc.valid:
+				t.Fatal("expected an error, got none")
+			case err != nil:
+				return
+			}
+			if c.Deck.JobUpdatePeriod != tc.expected {
+				t.Errorf("expected period %v, got %v", tc.expected, c.Deck.JobUpdatePeriod)
+			}
+		})
+	}
+}
@@ -38,6 +38,9 @@ type Preset struct {
 	VolumeMounts []v1.VolumeMount  `json:"volumeMounts"`
 }
 
+// mergePreset adds the env, volumes and volume mounts of a preset to the
+// given containers and volumes if the preset matches the labels. Entries are
+// deep copied so that jobs never share state with the preset or each other.
 func mergePreset(preset Preset, labels map[string]string, containers []v1.Container, volumes *[]v1.Volume) error {
 	for l, v := range preset.Labels {
 		if v2, ok := labels[l]; !ok || v2 != v {
@@ -51,7 +54,7 @@ func mergePreset(preset Preset, labels map[string]string, containers []v1.Contai
 					return fmt.Errorf("env var duplicated in pod spec: %s", e1.Name)
 				}
 			}
-			containers[i].Env = append(containers[i].Env, e1)
+			containers[i].Env = append(containers[i].Env, *e1.DeepCopy())
 		}
 	}
 	for _, v1 := range preset.Volumes {
@@ -60,7 +63,7 @@ func mergePreset(preset Preset, labels map[string]string, containers []v1.Contai
 				return fmt.Errorf("volume duplicated in pod spec: %s", v1.Name)
 			}
 		}
-		*volumes = append(*volumes, v1)
+		*volumes = append(*volumes, *v1.DeepCopy())
 	}
 	for _, vm1 := range preset.VolumeMounts {
 		for i := range containers {
@@ -69,7 +72,7 @@ func mergePreset(preset Preset, labels map[string]string, containers []v1.Contai
 					return fmt.Errorf("volume mount duplicated in pod spec: %s", vm1.Name)
 				}
 			}
-			containers[i].VolumeMounts = append(containers[i].VolumeMounts, vm1)
+			containers[i].VolumeMounts = append(containers[i].VolumeMounts, *vm1.DeepCopy())
 		}
 	}
 	return nil
@@ -82,8 +85,12 @@ type JobBase struct {
 	Name string `json:"name"`
 	// Labels are added to prowjobs and pods created for this job.
 	Labels map[string]string `json:"labels,omitempty"`
-	// MaximumConcurrency of this job, 0 implies no limit.
+	// MaximumConcurrency of this job. 0 falls back to the default for the
+	// job type, -1 (prowapi.UnlimitedConcurrency) implies no limit at all.
 	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// ConcurrencyGroup of this job. Jobs sharing a group count towards
+	// the same MaxConcurrency limit. (Default: the job name)
+	ConcurrencyGroup string `json:"concurrency_group,omitempty"`
 	// Agent that will take care of running this job.
 	Agent string `json:"agent"`
 	// Cluster is the alias of the cluster to run this job in.
@@ -98,8 +105,14 @@ type JobBase struct {
 	// If this field is unspecified or false, a new pod will be created to replace
 	// the evicted one.
 	ErrorOnEviction bool `json:"error_on_eviction,omitempty"`
+	// SlackReport opts the job in to having its completion reported to
+	// the Slack channel configured for the slack reporter.
+	SlackReport bool `json:"slack_report,omitempty"`
 	// SourcePath contains the path where this job is defined
 	SourcePath string `json:"-"`
+	// explicit records the fields with meaningful zero values that are
+	// set in the job's config, so that JobDefaults do not override them.
+	explicit sets.String
 	// Spec is the Kubernetes pod spec used if Agent is kubernetes.
 	Spec *v1.PodSpec `json:"spec,omitempty"`
 	// BuildSpec is the Knative build spec used if Agent is knative-build.
@@ -129,6 +142,9 @@ type Presubmit struct {
 	// (Default: `/test <job name>`)
 	RerunCommand string `json:"rerun_command"`
 
+	// Tags for config entries
+	Tags []string `json:"tags,omitempty"`
+
 	Brancher
 
 	RegexpChangeMatcher
@@ -161,8 +177,12 @@ type Periodic struct {
 	Cron string `json:"cron"`
 	// Tags for config entries
 	Tags []string `json:"tags,omitempty"`
+	// MinimumInterval is the minimum time to wait after the previous run
+	// completes before starting a new one. Defaults to no delay.
+	MinimumInterval string `json:"minimum_interval,omitempty"`
 
-	interval time.Duration
+	interval        time.Duration
+	minimumInterval time.Duration
 }
 
 // SetInterval updates interval, the frequency duration it runs.
@@ -175,6 +195,18 @@ func (p *Periodic) GetInterval() time.Duration {
 	return p.interval
 }
 
+// SetMinimumInterval updates the minimum delay between the completion of
+// one run and the start of the next.
+func (p *Periodic) SetMinimumInterval(d time.Duration) {
+	p.minimumInterval = d
+}
+
+// GetMinimumInterval returns the minimum delay between the completion of
+// one run and the start of the next.
+func (p *Periodic) GetMinimumInterval() time.Duration {
+	return p.minimumInterval
+}
+
 // Brancher is for shared code between jobs that only run against certain
 // branches. An empty brancher runs against all branches.
 type Brancher struct {
@@ -192,8 +224,15 @@ type Brancher struct {
 type RegexpChangeMatcher struct {
 	// RunIfChanged defines a regex used to select which subset of file changes should trigger this job.
 	// If any file in the changeset matches this regex, the job will be triggered
-	RunIfChanged string         `json:"run_if_changed,omitempty"`
-	reChanges    *regexp.Regexp // from RunIfChanged
+	RunIfChanged string `json:"run_if_changed,omitempty"`
+	// SkipIfOnlyChanged defines a regex used to select which subset of file changes
+	// should not trigger this job. If every file in the changeset matches this regex,
+	// the job will not be triggered. If RunIfChanged is also set, the job is only
+	// triggered when both regexes agree that it should be.
+	SkipIfOnlyChanged string `json:"skip_if_only_changed,omitempty"`
+
+	reChanges     *regexp.Regexp // from RunIfChanged
+	reSkipChanges *regexp.Regexp // from SkipIfOnlyChanged
 }
 
 type Reporter struct {
@@ -208,8 +247,9 @@ func (br Brancher) RunsAgainstAllBranch() bool {
 	return len(br.SkipBranches) == 0 && len(br.Branches) == 0
 }
 
-// ShouldRun returns true if the input branch matches, given the whitelist/blacklist.
-func (br Brancher) ShouldRun(branch string) bool {
+// RunsAgainstBranch returns true if the input branch matches, given the
+// whitelist/blacklist. Patterns must match the whole branch name.
+func (br Brancher) RunsAgainstBranch(branch string) bool {
 	if br.RunsAgainstAllBranch() {
 		return true
 	}
@@ -252,7 +292,7 @@ func (br Brancher) Intersects(other Brancher) bool {
 
 // CouldRun determines if its possible for a set of changes to trigger this condition
 func (cm RegexpChangeMatcher) CouldRun() bool {
-	return cm.RunIfChanged != ""
+	return cm.RunIfChanged != "" || cm.SkipIfOnlyChanged != ""
 }
 
 // ShouldRun determines if we can know for certain that the job should run. We can either
@@ -261,6 +301,10 @@ func (cm RegexpChangeMatcher) CouldRun() bool {
 func (cm RegexpChangeMatcher) ShouldRun(changes ChangedFilesProvider) (determined bool, shouldRun bool, err error) {
 	if cm.CouldRun() {
 		changeList, err := changes()
+		if _, tooMany := err.(github.TooManyFilesError); tooMany {
+			// Not every change is known, so the job may be needed.
+			return true, true, nil
+		}
 		if err != nil {
 			return true, false, err
 		}
@@ -269,8 +313,16 @@ func (cm RegexpChangeMatcher) ShouldRun(changes ChangedFilesProvider) (determine
 	return false, false, nil
 }
 
-// RunsAgainstChanges returns true if any of the changed input paths match the run_if_changed regex.
+// RunsAgainstChanges returns true if any of the changed input paths match the
+// run_if_changed regex and not all of them match the skip_if_only_changed regex.
+// Either regex is ignored when it is unset.
 func (cm RegexpChangeMatcher) RunsAgainstChanges(changes []string) bool {
+	if cm.reSkipChanges != nil && cm.onlyChanged(changes) {
+		return false
+	}
+	if cm.reChanges == nil {
+		return true
+	}
 	for _, change := range changes {
 		if cm.reChanges.MatchString(change) {
 			return true
@@ -279,10 +331,21 @@ func (cm RegexpChangeMatcher) RunsAgainstChanges(changes []string) bool {
 	return false
 }
 
+// onlyChanged returns true if every changed path matches the
+// skip_if_only_changed regex.
+func (cm RegexpChangeMatcher) onlyChanged(changes []string) bool {
+	for _, change := range changes {
+		if !cm.reSkipChanges.MatchString(change) {
+			return false
+		}
+	}
+	return true
+}
+
 // CouldRun determines if the postsubmit could run against a specific
 // base ref
 func (ps Postsubmit) CouldRun(baseRef string) bool {
-	return ps.Brancher.ShouldRun(baseRef)
+	return ps.Brancher.RunsAgainstBranch(baseRef)
 }
 
 // ShouldRun determines if the postsubmit should run in response to a
@@ -303,7 +366,7 @@ func (ps Postsubmit) ShouldRun(baseRef string, changes ChangedFilesProvider) (bo
 // CouldRun determines if the presubmit could run against a specific
 // base ref
 func (ps Presubmit) CouldRun(baseRef string) bool {
-	return ps.Brancher.ShouldRun(baseRef)
+	return ps.Brancher.RunsAgainstBranch(baseRef)
 }
 
 // ShouldRun determines if the presubmit should run against a specific
@@ -349,7 +412,8 @@ func (ps Presubmit) ContextRequired() bool {
 	return !ps.Optional && !ps.SkipReport
 }
 
-// ChangedFilesProvider returns a slice of modified files.
+// ChangedFilesProvider returns a slice of modified files, or a
+// github.TooManyFilesError if not every modified file can be listed.
 type ChangedFilesProvider func() ([]string, error)
 
 type githubClient interface {
@@ -365,6 +429,9 @@ func NewGitHubDeferredChangedFilesProvider(client githubClient, org, repo string
 		// Fetch the changed files from github at most once.
 		if changedFiles == nil {
 			changes, err := client.GetPullRequestChanges(org, repo, num)
+			if _, tooMany := err.(github.TooManyFilesError); tooMany {
+				return nil, err
+			}
 			if err != nil {
 				return nil, fmt.Errorf("error getting pull request changes: %v", err)
 			}
@@ -412,7 +479,7 @@ func (c *JobConfig) RetestPresubmits(fullRepoName string, skipContexts, runConte
 			if skipContexts.Has(job.Context) {
 				continue
 			}
-			if job.AlwaysRun || job.RunIfChanged != "" || runContexts.Has(job.Context) {
+			if job.AlwaysRun || job.RegexpChangeMatcher.CouldRun() || runContexts.Has(job.Context) {
 				result = append(result, job)
 			}
 		}
@@ -432,6 +499,47 @@ func (c *JobConfig) GetPresubmit(repo, jobName string) *Presubmit {
 	return nil
 }
 
+// JobNotFoundError is returned for ProwJobs whose job is not in the job
+// config, for example because it was renamed after they were triggered.
+type JobNotFoundError struct {
+	Type prowapi.ProwJobType
+	Job  string
+}
+
+func (e JobNotFoundError) Error() string {
+	return fmt.Sprintf("no config for %s job %s", e.Type, e.Job)
+}
+
+// CheckJobExists returns a JobNotFoundError if the job of the ProwJob spec
+// is not configured for the repo it runs against, or as a periodic.
+func (c *JobConfig) CheckJobExists(spec prowapi.ProwJobSpec) error {
+	var repo string
+	if spec.Refs != nil {
+		repo = spec.Refs.Org + "/" + spec.Refs.Repo
+	}
+	switch spec.Type {
+	case prowapi.PresubmitJob, prowapi.BatchJob:
+		if c.GetPresubmit(repo, spec.Job) != nil {
+			return nil
+		}
+	case prowapi.PostsubmitJob:
+		for _, job := range c.AllPostsubmits([]string{repo}) {
+			if job.Name == spec.Job {
+				return nil
+			}
+		}
+	case prowapi.PeriodicJob:
+		for _, job := range c.AllPeriodics() {
+			if job.Name == spec.Job {
+				return nil
+			}
+		}
+	default:
+		return nil
+	}
+	return JobNotFoundError{Type: spec.Type, Job: spec.Job}
+}
+
 // SetPresubmits updates c.Presubmits to jobs, after compiling and validating their regexes.
 func (c *JobConfig) SetPresubmits(jobs map[string][]Presubmit) error {
 	nj := map[string][]Presubmit{}
@@ -524,5 +632,6 @@ func ClearCompiledRegexes(presubmits []Presubmit) {
 		presubmits[i].Brancher.re = nil
 		presubmits[i].Brancher.reSkip = nil
 		presubmits[i].RegexpChangeMatcher.reChanges = nil
+		presubmits[i].RegexpChangeMatcher.reSkipChanges = nil
 	}
 }
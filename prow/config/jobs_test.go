@@ -21,13 +21,18 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"reflect"
 	"regexp"
 	"testing"
 
 	buildapi "github.com/knative/build/pkg/apis/build/v1alpha1"
+	"k8s.io/apimachinery/pkg/util/diff"
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	coreapi "k8s.io/api/core/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/github"
 )
 
 var c *Config
@@ -42,13 +47,13 @@ func checkOverlapBrancher(b1, b2 Brancher) bool {
 	}
 
 	for _, run1 := range b1.Branches {
-		if b2.ShouldRun(run1) {
+		if b2.RunsAgainstBranch(run1) {
 			return true
 		}
 	}
 
 	for _, run2 := range b2.Branches {
-		if b1.ShouldRun(run2) {
+		if b1.RunsAgainstBranch(run2) {
 			return true
 		}
 	}
@@ -357,6 +362,125 @@ func TestListPresubmit(t *testing.T) {
 	}
 }
 
+func TestGetPresubmit(t *testing.T) {
+	c := &JobConfig{
+		Presubmits: map[string][]Presubmit{
+			"org/r1": {
+				{JobBase: JobBase{Name: "a"}},
+				{JobBase: JobBase{Name: "b"}},
+			},
+			"org/r2": {
+				{JobBase: JobBase{Name: "c"}},
+			},
+		},
+	}
+
+	var testcases = []struct {
+		name     string
+		repo     string
+		job      string
+		expected bool
+	}{
+		{
+			name:     "job in repo",
+			repo:     "org/r1",
+			job:      "b",
+			expected: true,
+		},
+		{
+			name: "job in another repo",
+			repo: "org/r1",
+			job:  "c",
+		},
+		{
+			name: "unknown repo",
+			repo: "org/r3",
+			job:  "a",
+		},
+	}
+
+	for _, tc := range testcases {
+		actual := c.GetPresubmit(tc.repo, tc.job)
+		switch {
+		case actual == nil && tc.expected:
+			t.Errorf("test %s - expected to find job %s in %s", tc.name, tc.job, tc.repo)
+		case actual != nil && !tc.expected:
+			t.Errorf("test %s - expected no job, got %s", tc.name, actual.Name)
+		case actual != nil && actual.Name != tc.job:
+			t.Errorf("test %s - expected job %s, got %s", tc.name, tc.job, actual.Name)
+		}
+	}
+}
+
+func TestCheckJobExists(t *testing.T) {
+	c := &JobConfig{
+		Presubmits: map[string][]Presubmit{
+			"org/repo": {{JobBase: JobBase{Name: "pre"}}},
+		},
+		Postsubmits: map[string][]Postsubmit{
+			"org/repo": {{JobBase: JobBase{Name: "post"}}},
+		},
+		Periodics: []Periodic{{JobBase: JobBase{Name: "periodic"}}},
+	}
+	refs := &prowapi.Refs{Org: "org", Repo: "repo"}
+	otherRefs := &prowapi.Refs{Org: "org", Repo: "other"}
+
+	var testcases = []struct {
+		name     string
+		spec     prowapi.ProwJobSpec
+		expected bool
+	}{
+		{
+			name:     "presubmit",
+			spec:     prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "pre", Refs: refs},
+			expected: true,
+		},
+		{
+			name:     "batch of a presubmit",
+			spec:     prowapi.ProwJobSpec{Type: prowapi.BatchJob, Job: "pre", Refs: refs},
+			expected: true,
+		},
+		{
+			name: "presubmit of another repo",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "pre", Refs: otherRefs},
+		},
+		{
+			name: "presubmit without refs",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "pre"},
+		},
+		{
+			name:     "postsubmit",
+			spec:     prowapi.ProwJobSpec{Type: prowapi.PostsubmitJob, Job: "post", Refs: refs},
+			expected: true,
+		},
+		{
+			name: "postsubmit run as a presubmit",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "post", Refs: refs},
+		},
+		{
+			name:     "periodic",
+			spec:     prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: "periodic"},
+			expected: true,
+		},
+		{
+			name: "renamed periodic",
+			spec: prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: "periodical"},
+		},
+	}
+
+	for _, tc := range testcases {
+		err := c.CheckJobExists(tc.spec)
+		if tc.expected && err != nil {
+			t.Errorf("test %s - expected the job to exist, got: %v", tc.name, err)
+		}
+		if !tc.expected {
+			if _, ok := err.(JobNotFoundError); !ok {
+				t.Errorf("test %s - expected a JobNotFoundError, got: %v", tc.name, err)
+			}
+		}
+	}
+}
+
 func TestListPostsubmit(t *testing.T) {
 	c := &Config{
 		JobConfig: JobConfig{
@@ -501,19 +625,118 @@ func TestRunAgainstBranch(t *testing.T) {
 
 	for _, job := range jobs {
 		if job.Name == "default" {
-			if !job.Brancher.ShouldRun("s") {
+			if !job.Brancher.RunsAgainstBranch("s") {
 				t.Errorf("Job %s should run branch s", job.Name)
 			}
-		} else if job.Brancher.ShouldRun("s") {
+		} else if job.Brancher.RunsAgainstBranch("s") {
 			t.Errorf("Job %s should not run branch s", job.Name)
 		}
 
-		if !job.Brancher.ShouldRun("r") {
+		if !job.Brancher.RunsAgainstBranch("r") {
 			t.Errorf("Job %s should run branch r", job.Name)
 		}
 	}
 }
 
+func TestBrancherRunsAgainstBranch(t *testing.T) {
+	testCases := []struct {
+		name     string
+		brancher Brancher
+		branch   string
+		expected bool
+	}{
+		{
+			name:     "no filters runs everywhere",
+			branch:   "anything",
+			expected: true,
+		},
+		{
+			name:     "exact branch match",
+			brancher: Brancher{Branches: []string{"master"}},
+			branch:   "master",
+			expected: true,
+		},
+		{
+			name:     "branch is anchored at the start",
+			brancher: Brancher{Branches: []string{"master"}},
+			branch:   "my-master",
+			expected: false,
+		},
+		{
+			name:     "branch is anchored at the end",
+			brancher: Brancher{Branches: []string{"master"}},
+			branch:   "master-branch",
+			expected: false,
+		},
+		{
+			name:     "branch is anchored on both sides",
+			brancher: Brancher{Branches: []string{"master"}},
+			branch:   "my-master-branch",
+			expected: false,
+		},
+		{
+			name:     "branch pattern matches",
+			brancher: Brancher{Branches: []string{"release-.*"}},
+			branch:   "release-1.14",
+			expected: true,
+		},
+		{
+			name:     "branch pattern does not match a prefixed branch",
+			brancher: Brancher{Branches: []string{"release-.*"}},
+			branch:   "dev-release-1.14",
+			expected: false,
+		},
+		{
+			name:     "any of several branches matches",
+			brancher: Brancher{Branches: []string{"master", "release-.*"}},
+			branch:   "release-1.14",
+			expected: true,
+		},
+		{
+			name:     "explicitly anchored patterns still work",
+			brancher: Brancher{Branches: []string{"^master$"}},
+			branch:   "master",
+			expected: true,
+		},
+		{
+			name:     "skipped branch",
+			brancher: Brancher{SkipBranches: []string{"master"}},
+			branch:   "master",
+			expected: false,
+		},
+		{
+			name:     "skip is anchored",
+			brancher: Brancher{SkipBranches: []string{"master"}},
+			branch:   "my-master-branch",
+			expected: true,
+		},
+		{
+			name:     "skip takes precedence over branches",
+			brancher: Brancher{Branches: []string{"release-.*"}, SkipBranches: []string{"release-1.0"}},
+			branch:   "release-1.0",
+			expected: false,
+		},
+		{
+			name:     "branches not skipped still run",
+			brancher: Brancher{Branches: []string{"release-.*"}, SkipBranches: []string{"release-1.0"}},
+			branch:   "release-1.1",
+			expected: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			br, err := setBrancherRegexes(tc.brancher)
+			if err != nil {
+				t.Fatalf("could not set regexes: %v", err)
+			}
+			if actual := br.RunsAgainstBranch(tc.branch); actual != tc.expected {
+				t.Errorf("expected RunsAgainstBranch(%q) to be %t, got %t", tc.branch, tc.expected, actual)
+			}
+		})
+	}
+}
+
 func TestValidPodNames(t *testing.T) {
 	for _, j := range c.AllPresubmits([]string{}) {
 		if !podRe.MatchString(j.Name) {
@@ -683,6 +906,73 @@ func TestMergePreset(t *testing.T) {
 			},
 			numVolMounts: 2,
 		},
+		{
+			name:      "conflicting env name",
+			jobLabels: map[string]string{"foo": "bar"},
+			pod:       &coreapi.PodSpec{Containers: []coreapi.Container{{Env: []coreapi.EnvVar{{Name: "baz"}}}}},
+			presets: []Preset{
+				{
+					Labels: map[string]string{"foo": "bar"},
+					Env:    []coreapi.EnvVar{{Name: "baz"}},
+				},
+			},
+			shouldError: true,
+		},
+		{
+			name:      "only one label of a preset matches",
+			jobLabels: map[string]string{"foo": "bar"},
+			pod:       &coreapi.PodSpec{Containers: []coreapi.Container{{}}},
+			buildSpec: &buildapi.BuildSpec{},
+			presets: []Preset{
+				{
+					Labels: map[string]string{"foo": "bar", "qux": "baz"},
+					Env:    []coreapi.EnvVar{{Name: "baz"}},
+				},
+			},
+		},
+		{
+			name:      "multiple matching presets are merged",
+			jobLabels: map[string]string{"foo": "bar", "qux": "baz"},
+			pod:       &coreapi.PodSpec{Containers: []coreapi.Container{{}, {}}},
+			buildSpec: &buildapi.BuildSpec{},
+			presets: []Preset{
+				{
+					Labels:       map[string]string{"foo": "bar"},
+					Env:          []coreapi.EnvVar{{Name: "foo"}},
+					VolumeMounts: []coreapi.VolumeMount{{Name: "foo"}},
+					Volumes:      []coreapi.Volume{{Name: "foo"}},
+				},
+				{
+					Labels:       map[string]string{"qux": "baz"},
+					Env:          []coreapi.EnvVar{{Name: "qux"}},
+					VolumeMounts: []coreapi.VolumeMount{{Name: "qux"}},
+					Volumes:      []coreapi.Volume{{Name: "qux"}},
+				},
+				{
+					Labels: map[string]string{"foo": "nope"},
+					Env:    []coreapi.EnvVar{{Name: "nope"}},
+				},
+			},
+			numEnv:       2,
+			numVol:       2,
+			numVolMounts: 2,
+		},
+		{
+			name:      "multiple matching presets with conflicting env names",
+			jobLabels: map[string]string{"foo": "bar", "qux": "baz"},
+			pod:       &coreapi.PodSpec{Containers: []coreapi.Container{{}}},
+			presets: []Preset{
+				{
+					Labels: map[string]string{"foo": "bar"},
+					Env:    []coreapi.EnvVar{{Name: "baz"}},
+				},
+				{
+					Labels: map[string]string{"qux": "baz"},
+					Env:    []coreapi.EnvVar{{Name: "baz"}},
+				},
+			},
+			shouldError: true,
+		},
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
@@ -720,6 +1010,50 @@ func TestMergePreset(t *testing.T) {
 	}
 }
 
+func TestMergePresetDoesNotShareState(t *testing.T) {
+	preset := Preset{
+		Labels: map[string]string{"foo": "bar"},
+		Env: []coreapi.EnvVar{{
+			Name:      "baz",
+			ValueFrom: &coreapi.EnvVarSource{SecretKeyRef: &coreapi.SecretKeySelector{Key: "key"}},
+		}},
+		Volumes: []coreapi.Volume{{
+			Name:         "baz",
+			VolumeSource: coreapi.VolumeSource{Secret: &coreapi.SecretVolumeSource{SecretName: "secret"}},
+		}},
+		VolumeMounts: []coreapi.VolumeMount{{Name: "baz", MountPath: "/baz"}},
+	}
+	original := Preset{
+		Labels:       map[string]string{"foo": "bar"},
+		Env:          []coreapi.EnvVar{*preset.Env[0].DeepCopy()},
+		Volumes:      []coreapi.Volume{*preset.Volumes[0].DeepCopy()},
+		VolumeMounts: []coreapi.VolumeMount{*preset.VolumeMounts[0].DeepCopy()},
+	}
+	labels := map[string]string{"foo": "bar"}
+
+	first := &coreapi.PodSpec{Containers: []coreapi.Container{{}}}
+	second := &coreapi.PodSpec{Containers: []coreapi.Container{{}}}
+	for _, spec := range []*coreapi.PodSpec{first, second} {
+		if err := resolvePresets("foo", labels, spec, nil, []Preset{preset}); err != nil {
+			t.Fatalf("unexpected error resolving presets: %v", err)
+		}
+	}
+
+	first.Containers[0].Env[0].ValueFrom.SecretKeyRef.Key = "changed"
+	first.Volumes[0].Secret.SecretName = "changed"
+	first.Containers[0].VolumeMounts[0].MountPath = "/changed"
+
+	if !reflect.DeepEqual(preset, original) {
+		t.Errorf("changing a job spec mutated the preset: %s", diff.ObjectReflectDiff(original, preset))
+	}
+	if actual := second.Containers[0].Env[0].ValueFrom.SecretKeyRef.Key; actual != "key" {
+		t.Errorf("changing one job spec mutated another's env: got key %q", actual)
+	}
+	if actual := second.Volumes[0].Secret.SecretName; actual != "secret" {
+		t.Errorf("changing one job spec mutated another's volume: got secret %q", actual)
+	}
+}
+
 func TestPresubmitShouldRun(t *testing.T) {
 	var testCases = []struct {
 		name        string
@@ -833,6 +1167,100 @@ func TestPresubmitShouldRun(t *testing.T) {
 			fileChanges: []string{"file"},
 			expectedRun: true,
 		},
+		{
+			name: "job with skip_if_only_changed when only matching files changed should not run",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "docs/foo.md"},
+			expectedRun: false,
+		},
+		{
+			name: "job with skip_if_only_changed when other files changed should run",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"README.md", "main.go"},
+			expectedRun: true,
+		},
+		{
+			name: "job with skip_if_only_changed and no changes should not run",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{},
+			expectedRun: false,
+		},
+		{
+			name: "job with both set should run when run_if_changed matches and not only skipped files changed",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					RunIfChanged:      `^pkg/`,
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"pkg/foo.go", "README.md"},
+			expectedRun: true,
+		},
+		{
+			name: "job with both set should not run when run_if_changed does not match",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					RunIfChanged:      `^pkg/`,
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"cmd/main.go", "README.md"},
+			expectedRun: false,
+		},
+		{
+			name: "job with both set should not run when only skipped files changed, even if run_if_changed matches",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					RunIfChanged:      `^pkg/`,
+					SkipIfOnlyChanged: `\.md$`,
+				},
+			},
+			ref:         "master",
+			fileChanges: []string{"pkg/README.md"},
+			expectedRun: false,
+		},
+		{
+			name: "job with run_if_changed runs when the PR changes too many files to list",
+			job: Presubmit{
+				Trigger:      `(?m)^/test (?:.*? )?foo(?: .*?)?$`,
+				RerunCommand: "/test foo",
+				RegexpChangeMatcher: RegexpChangeMatcher{
+					RunIfChanged: `^pkg/`,
+				},
+			},
+			ref:         "master",
+			fileError:   github.TooManyFilesError{Org: "org", Repo: "repo", Number: 1},
+			expectedRun: true,
+		},
 	}
 
 	for _, testCase := range testCases {
@@ -0,0 +1,200 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"k8s.io/test-infra/prow/errorutil"
+)
+
+// yamlNode is a YAML node whose mappings are keyed by yamlKeys, which know
+// the line they were found on, so that keys set twice are kept apart.
+type yamlNode struct {
+	mapping  map[yamlKey]*yamlNode
+	sequence []*yamlNode
+}
+
+type yamlKey struct {
+	name string
+	line int
+}
+
+var yamlLineRe = regexp.MustCompile(`^line (\d+):`)
+
+// yamlLine returns the line of the node decoded by unmarshal. The YAML
+// library only exposes lines in its errors, so the node is decoded into a
+// type that no YAML node fits, and the line is read from the error.
+func yamlLine(unmarshal func(interface{}) error) int {
+	var impossible []map[string]struct{}
+	err := unmarshal(&impossible)
+	if err == nil {
+		return 0
+	}
+	for _, msg := range strings.Split(err.Error(), "\n") {
+		if match := yamlLineRe.FindStringSubmatch(strings.TrimSpace(msg)); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return line
+		}
+	}
+	return 0
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (k *yamlKey) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name interface{}
+	if err := unmarshal(&name); err != nil {
+		return err
+	}
+	k.name = fmt.Sprint(name)
+	k.line = yamlLine(unmarshal)
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (n *yamlNode) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&n.mapping); err == nil {
+		return nil
+	}
+	n.mapping = nil
+	if err := unmarshal(&n.sequence); err == nil {
+		return nil
+	}
+	n.sequence = nil
+	var scalar interface{}
+	return unmarshal(&scalar)
+}
+
+// checkStrict returns an error listing the keys of the YAML document that
+// do not match a field of the type it is decoded into, and the keys that are
+// set twice in the same mapping. Fields are matched the way the JSON decoder
+// behind sigs.k8s.io/yaml matches them.
+func checkStrict(b []byte, into interface{}) error {
+	var root yamlNode
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return err
+	}
+	var errs []error
+	checkNode(&root, reflect.TypeOf(into), "", &errs)
+	return errorutil.NewAggregate(errs...)
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func checkNode(n *yamlNode, t reflect.Type, path string, errs *[]error) {
+	if n == nil {
+		// null
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		// the type decodes itself, so any field may be meaningful
+		return
+	}
+
+	switch {
+	case n.mapping != nil:
+		keys := make([]yamlKey, 0, len(n.mapping))
+		for key := range n.mapping {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i].line < keys[j].line })
+
+		seen := map[string]int{}
+		for _, key := range keys {
+			keyPath := key.name
+			if path != "" {
+				keyPath = path + "." + key.name
+			}
+			if line, set := seen[key.name]; set {
+				*errs = append(*errs, fmt.Errorf("line %d: %s is already set on line %d", key.line, keyPath, line))
+				continue
+			}
+			seen[key.name] = key.line
+
+			switch t.Kind() {
+			case reflect.Map:
+				checkNode(n.mapping[key], t.Elem(), keyPath, errs)
+			case reflect.Struct:
+				field, found := jsonField(t, key.name)
+				if !found {
+					*errs = append(*errs, fmt.Errorf("line %d: unknown field %s", key.line, keyPath))
+					continue
+				}
+				checkNode(n.mapping[key], field, keyPath, errs)
+			}
+		}
+	case n.sequence != nil:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return
+		}
+		for i, item := range n.sequence {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// jsonField returns the type of the field of the struct that the JSON
+// decoder would decode the key into, preferring an exact match over a case
+// insensitive one like the decoder does.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if field, found := jsonField(embedded, key); found {
+					return field, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f.Type, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = f.Type
+		}
+	}
+	return folded, folded != nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/test-infra/prow/errorutil"
+)
+
+func TestCheckStrict(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		config   string
+		into     interface{}
+		expected []string
+	}{
+		{
+			name: "valid config",
+			config: `
+plank:
+  max_error_retries: 2
+presubmits:
+  org/repo:
+  - name: job
+    max_concurrency: 5
+    spec:
+      containers:
+      - image: alpine
+        resources:
+          requests:
+            cpu: 1
+`,
+			into: &Config{},
+		},
+		{
+			name: "misspelled top-level field",
+			config: `
+presubmit:
+  org/repo: []
+`,
+			into:     &Config{},
+			expected: []string{"line 2: unknown field presubmit"},
+		},
+		{
+			name: "misspelled job field",
+			config: `
+presubmits:
+  org/repo:
+  - name: job
+  - name: other-job
+    max_concurency: 5
+`,
+			into:     &Config{},
+			expected: []string{"line 6: unknown field presubmits.org/repo[1].max_concurency"},
+		},
+		{
+			name: "misspelled fields in the pod spec and in the prow config",
+			config: `
+tide:
+  sync_periodd: 1m
+periodics:
+- name: job
+  spec:
+    containers:
+    - image: alpine
+      comand: [test]
+`,
+			into: &Config{},
+			expected: []string{
+				"line 3: unknown field tide.sync_periodd",
+				"line 9: unknown field periodics[0].spec.containers[0].comand",
+			},
+		},
+		{
+			name: "misspelled field of an embedded struct in a job config file",
+			config: `
+postsubmits:
+  org/repo:
+  - name: job
+    decoration_config:
+      timout: 1h
+`,
+			into:     &JobConfig{},
+			expected: []string{"line 6: unknown field postsubmits.org/repo[0].decoration_config.timout"},
+		},
+		{
+			name: "fields are matched case insensitively",
+			config: `
+periodics:
+- Name: job
+`,
+			into: &Config{},
+		},
+		{
+			name: "duplicate keys",
+			config: `
+presubmits:
+  org/repo:
+  - name: job
+    always_run: true
+    always_run: false
+presubmits: {}
+`,
+			into: &Config{},
+			expected: []string{
+				"line 6: presubmits.org/repo[0].always_run is already set on line 5",
+				"line 7: presubmits is already set on line 2",
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var actual []string
+			if err := checkStrict([]byte(testCase.config), testCase.into); err != nil {
+				agg, ok := err.(errorutil.Aggregate)
+				if !ok {
+					t.Fatalf("expected an aggregate error, got: %v", err)
+				}
+				actual = agg.Strings()
+			}
+			if !reflect.DeepEqual(actual, testCase.expected) {
+				t.Errorf("expected errors %q, got %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "strict")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	prowConfig := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(prowConfig, []byte("tide:\n  queries: []\n"), 0666); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	jobConfig := filepath.Join(dir, "jobs.yaml")
+	jobs := `
+periodics:
+- name: job
+  interval: 1h
+  max_concurency: 5
+  spec:
+    containers:
+    - image: alpine
+`
+	if err := ioutil.WriteFile(jobConfig, []byte(jobs), 0666); err != nil {
+		t.Fatalf("failed to write job config: %v", err)
+	}
+
+	if _, err := Load(prowConfig, jobConfig); err != nil {
+		t.Errorf("expected no error loading the config, got: %v", err)
+	}
+	if _, err := LoadStrict(prowConfig, jobConfig); err == nil {
+		t.Error("expected an error loading the config strictly, got none")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -81,6 +82,11 @@ type Tide struct {
 	// the default method of merge. Valid options are squash, rebase, and merge.
 	MergeType map[string]github.PullRequestMergeType `json:"merge_method,omitempty"`
 
+	// A key/value pair of an org/repo as the key and Go templates to override
+	// the default title and body of merge commits. The templates are executed
+	// on the merged PR.
+	MergeTemplate map[string]TideMergeCommitTemplate `json:"merge_commit_template,omitempty"`
+
 	// URL for tide status contexts.
 	// We can consider allowing this to be set separately for separate repos, or
 	// allowing it to be a template.
@@ -130,6 +136,26 @@ func (t *Tide) MergeMethod(org, repo string) github.PullRequestMergeType {
 	return v
 }
 
+// TideMergeCommitTemplate holds templates for the title and body of merge
+// commits. GitHub's default is used for templates that are not set.
+type TideMergeCommitTemplate struct {
+	TitleTemplate string `json:"title,omitempty"`
+	BodyTemplate  string `json:"body,omitempty"`
+
+	// Title and Body are compiled from the templates at load time.
+	Title *template.Template `json:"-"`
+	Body  *template.Template `json:"-"`
+}
+
+// MergeCommitTemplate returns the merge commit templates to use for a repo.
+// Templates for the repo take precedence over those for its org.
+func (t *Tide) MergeCommitTemplate(org, repo string) TideMergeCommitTemplate {
+	if v, ok := t.MergeTemplate[org+"/"+repo]; ok {
+		return v
+	}
+	return t.MergeTemplate[org]
+}
+
 // TideQuery is turned into a GitHub search query. See the docs for details:
 // https://help.github.com/articles/searching-issues-and-pull-requests/
 type TideQuery struct {
@@ -149,6 +149,60 @@ func TestMergeMethod(t *testing.T) {
 	}
 }
 
+func TestMergeCommitTemplate(t *testing.T) {
+	ti := &Tide{
+		MergeTemplate: map[string]TideMergeCommitTemplate{
+			"kubernetes":      {TitleTemplate: "org"},
+			"kubernetes/kops": {TitleTemplate: "repo"},
+		},
+	}
+	testCases := []struct {
+		org, repo string
+		expected  string
+	}{
+		{org: "kubernetes", repo: "kops", expected: "repo"},
+		{org: "kubernetes", repo: "kubernetes", expected: "org"},
+		{org: "helm", repo: "charts", expected: ""},
+	}
+	for _, tc := range testCases {
+		if actual := ti.MergeCommitTemplate(tc.org, tc.repo).TitleTemplate; actual != tc.expected {
+			t.Errorf("%s/%s: expected title template %q, got %q", tc.org, tc.repo, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseMergeCommitTemplate(t *testing.T) {
+	var c Config
+	c.Tide.MergeTemplate = map[string]TideMergeCommitTemplate{
+		"org/repo": {TitleTemplate: "{{ .Title }} (#{{ .Number }})"},
+	}
+	if err := parseProwConfig(&c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	templates := c.Tide.MergeCommitTemplate("org", "repo")
+	if templates.Title == nil || templates.Body != nil {
+		t.Fatalf("expected only the title template to be parsed, got %+v", templates)
+	}
+	var title strings.Builder
+	if err := templates.Title.Execute(&title, struct {
+		Title  string
+		Number int
+	}{"Fix it", 5}); err != nil {
+		t.Fatalf("unexpected error executing the title template: %v", err)
+	}
+	if expected := "Fix it (#5)"; title.String() != expected {
+		t.Errorf("expected title %q, got %q", expected, title.String())
+	}
+
+	c = Config{}
+	c.Tide.MergeTemplate = map[string]TideMergeCommitTemplate{
+		"org": {BodyTemplate: "{{ .Body"},
+	}
+	if err := parseProwConfig(&c); err == nil {
+		t.Error("expected an error for an invalid body template, got none")
+	}
+}
+
 func TestParseTideContextPolicyOptions(t *testing.T) {
 	yes := true
 	no := false
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	cron "gopkg.in/robfig/cron.v2" // using v2 api, doc at https://godoc.org/gopkg.in/robfig/cron.v2
@@ -149,7 +150,7 @@ func (c *Cron) addPeriodic(p config.Periodic) error {
 
 // addJob adds a cron entry for a job to cronAgent
 func (c *Cron) addJob(name, cron string) error {
-	id, err := c.cronAgent.AddFunc("TZ=UTC "+cron, func() {
+	id, err := c.cronAgent.AddFunc(inUTC(cron), func() {
 		c.lock.Lock()
 		defer c.lock.Unlock()
 
@@ -183,3 +184,19 @@ func (c *Cron) removeJob(name string) error {
 	c.logger.Infof("Removed previous cron job %s.", name)
 	return nil
 }
+
+// NextRun returns the first time after last at which the cron schedule
+// fires. Like the scheduled jobs, the schedule is evaluated in UTC.
+func NextRun(cronStr string, last time.Time) (time.Time, error) {
+	schedule, err := cron.Parse(inUTC(cronStr))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron string %s: %v", cronStr, err)
+	}
+	return schedule.Next(last), nil
+}
+
+// inUTC pins a cron string to UTC so schedules are not affected by the
+// local timezone or daylight saving time.
+func inUTC(cronStr string) string {
+	return "TZ=UTC " + cronStr
+}
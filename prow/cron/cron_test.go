@@ -18,6 +18,7 @@ package cron
 
 import (
 	"testing"
+	"time"
 
 	cron "gopkg.in/robfig/cron.v2"
 	"k8s.io/test-infra/prow/config"
@@ -200,3 +201,77 @@ func TestTrigger(t *testing.T) {
 		t.Error("should have triggered job 'periodic'")
 	}
 }
+
+func TestNextRun(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	testCases := []struct {
+		name     string
+		cron     string
+		last     time.Time
+		expected time.Time
+	}{
+		{
+			name:     "daily run moves to the next day",
+			cron:     "0 2 * * *",
+			last:     time.Date(2019, 3, 1, 2, 0, 0, 0, time.UTC),
+			expected: time.Date(2019, 3, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "late run crosses midnight",
+			cron:     "0 2 * * *",
+			last:     time.Date(2019, 3, 1, 23, 30, 0, 0, time.UTC),
+			expected: time.Date(2019, 3, 2, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "early run stays on the same day",
+			cron:     "0 2 * * *",
+			last:     time.Date(2019, 3, 1, 0, 30, 0, 0, time.UTC),
+			expected: time.Date(2019, 3, 1, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daily run crosses the end of the month and year",
+			cron:     "0 2 * * *",
+			last:     time.Date(2018, 12, 31, 2, 0, 0, 0, time.UTC),
+			expected: time.Date(2019, 1, 1, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekday run on friday moves to monday",
+			cron:     "0 9 * * 1-5",
+			last:     time.Date(2019, 3, 1, 9, 0, 0, 0, time.UTC), // Friday
+			expected: time.Date(2019, 3, 4, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekday run on tuesday moves to wednesday",
+			cron:     "0 9 * * 1-5",
+			last:     time.Date(2019, 3, 5, 9, 0, 0, 0, time.UTC), // Tuesday
+			expected: time.Date(2019, 3, 6, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "schedule is evaluated in UTC across a DST change",
+			cron:     "0 2 * * *",
+			last:     time.Date(2019, 3, 9, 21, 0, 0, 0, newYork), // 2019-03-10 02:00 UTC
+			expected: time.Date(2019, 3, 11, 2, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := NextRun(tc.cron, tc.last)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !actual.Equal(tc.expected) {
+				t.Errorf("expected next run at %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNextRunInvalid(t *testing.T) {
+	if _, err := NextRun("not a cron", time.Now()); err == nil {
+		t.Error("expected an error for an invalid cron string")
+	}
+}
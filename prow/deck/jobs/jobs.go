@@ -19,15 +19,20 @@ package jobs
 
 import (
 	"bytes"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/apimachinery/pkg/labels"
@@ -37,13 +42,24 @@ import (
 )
 
 const (
-	period = 30 * time.Second
+	// defaultPeriod is used when the config does not set how often the
+	// job list is updated.
+	defaultPeriod = 30 * time.Second
 )
 
 var (
 	errProwjobNotFound = errors.New("prowjob not found")
+
+	lastUpdate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "deck_job_list_last_update_time_seconds",
+		Help: "Time of the last successful update of the job list served by deck. Its difference to time() is how stale the list is.",
+	})
 )
 
+func init() {
+	prometheus.MustRegister(lastUpdate)
+}
+
 // Job holds information about a job prow is running/has run.
 // TODO(#5216): Remove this, and all associated machinery.
 type Job struct {
@@ -79,6 +95,8 @@ type PodLogClient interface {
 	GetContainerLog(pod, container string) ([]byte, error)
 	// GetLogTail returns the last n bytes of the pod log of the specified container
 	GetLogTail(pod, container string, n int64) ([]byte, error)
+	// FollowContainerLog streams the pod log of the specified container
+	FollowContainerLog(pod, container string) (io.ReadCloser, error)
 }
 
 // NewJobAgent is a JobAgent constructor.
@@ -92,45 +110,82 @@ func NewJobAgent(kc serviceClusterClient, plClients map[string]PodLogClient, cfg
 
 // JobAgent creates lists of jobs, updates their status and returns their run logs.
 type JobAgent struct {
-	kc        serviceClusterClient
-	pkcs      map[string]PodLogClient
-	config    config.Getter
+	kc     serviceClusterClient
+	pkcs   map[string]PodLogClient
+	config config.Getter
+	// snap is replaced as a whole by every successful update and never
+	// modified, so readers only hold mut to load it.
+	snap *snapshot
+	mut  sync.Mutex
+}
+
+// snapshot is the state of the jobs as of one update.
+type snapshot struct {
 	prowJobs  []prowapi.ProwJob
 	jobs      []Job
 	jobsMap   map[string]Job                        // pod name -> Job
 	jobsIDMap map[string]map[string]prowapi.ProwJob // job name -> id -> ProwJob
-	mut       sync.Mutex
+	updated   time.Time
 }
 
-// Start will start the job and periodically update it.
+// Start will start the job and periodically update it, as often as the
+// deck.job_update_period config says.
 func (ja *JobAgent) Start() {
+	start := time.Now()
 	ja.tryUpdate()
 	go func() {
-		t := time.Tick(period)
-		for range t {
+		for {
+			time.Sleep(time.Until(start.Add(ja.period())))
+			start = time.Now()
 			ja.tryUpdate()
 		}
 	}()
 }
 
-// Jobs returns a thread-safe snapshot of the current job state.
-func (ja *JobAgent) Jobs() []Job {
+func (ja *JobAgent) period() time.Duration {
+	if ja.config == nil {
+		return defaultPeriod
+	}
+	cfg := ja.config()
+	if cfg == nil || cfg.Deck.JobUpdatePeriod <= 0 {
+		return defaultPeriod
+	}
+	return cfg.Deck.JobUpdatePeriod
+}
+
+// current returns the latest snapshot, which is empty until the first
+// successful update.
+func (ja *JobAgent) current() *snapshot {
 	ja.mut.Lock()
 	defer ja.mut.Unlock()
-	res := make([]Job, len(ja.jobs))
-	copy(res, ja.jobs)
+	if ja.snap == nil {
+		return &snapshot{}
+	}
+	return ja.snap
+}
+
+// Jobs returns a thread-safe snapshot of the current job state.
+func (ja *JobAgent) Jobs() []Job {
+	jobs := ja.current().jobs
+	res := make([]Job, len(jobs))
+	copy(res, jobs)
 	return res
 }
 
 // ProwJobs returns a thread-safe snapshot of the current prow jobs.
 func (ja *JobAgent) ProwJobs() []prowapi.ProwJob {
-	ja.mut.Lock()
-	defer ja.mut.Unlock()
-	res := make([]prowapi.ProwJob, len(ja.prowJobs))
-	copy(res, ja.prowJobs)
+	prowJobs := ja.current().prowJobs
+	res := make([]prowapi.ProwJob, len(prowJobs))
+	copy(res, prowJobs)
 	return res
 }
 
+// LastUpdated returns when the jobs were last listed successfully, or the
+// zero time if they have not been listed yet.
+func (ja *JobAgent) LastUpdated() time.Time {
+	return ja.current().updated
+}
+
 var jobNameRE = regexp.MustCompile(`^([\w-]+)-(\d+)$`)
 
 // GetProwJob finds the corresponding Prowjob resource from the provided job name and build ID
@@ -139,12 +194,10 @@ func (ja *JobAgent) GetProwJob(job, id string) (prowapi.ProwJob, error) {
 		return prowapi.ProwJob{}, fmt.Errorf("Prow job agent doesn't exist (are you running locally?)")
 	}
 	var j prowapi.ProwJob
-	ja.mut.Lock()
-	idMap, ok := ja.jobsIDMap[job]
+	idMap, ok := ja.current().jobsIDMap[job]
 	if ok {
 		j, ok = idMap[id]
 	}
-	ja.mut.Unlock()
 	if !ok {
 		return prowapi.ProwJob{}, errProwjobNotFound
 	}
@@ -236,6 +289,23 @@ func (ja *JobAgent) GetJobLog(job, id string) ([]byte, error) {
 	return nil, fmt.Errorf("cannot get logs for prowjob %q with agent %q: the agent is missing from the prow config file", j.ObjectMeta.Name, j.Spec.Agent)
 }
 
+// FollowJobLog streams the log of the job while it runs. Only the logs of
+// kubernetes jobs can be followed. The caller must close the stream.
+func (ja *JobAgent) FollowJobLog(job, id string) (io.ReadCloser, error) {
+	j, err := ja.GetProwJob(job, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting prowjob: %v", err)
+	}
+	if j.Spec.Agent != prowapi.KubernetesAgent {
+		return nil, fmt.Errorf("cannot follow logs for prowjob %q with agent %q", j.ObjectMeta.Name, j.Spec.Agent)
+	}
+	client, ok := ja.pkcs[j.ClusterAlias()]
+	if !ok {
+		return nil, fmt.Errorf("cannot follow logs for prowjob %q with agent %q: unknown cluster alias %q", j.ObjectMeta.Name, j.Spec.Agent, j.ClusterAlias())
+	}
+	return client.FollowContainerLog(j.Status.PodName, kube.TestContainerName)
+}
+
 func (ja *JobAgent) tryUpdate() {
 	if err := ja.update(); err != nil {
 		logrus.WithError(err).Warning("Error updating job list.")
@@ -246,7 +316,97 @@ type byStartTime []Job
 
 func (a byStartTime) Len() int           { return len(a) }
 func (a byStartTime) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byStartTime) Less(i, j int) bool { return a[i].st.After(a[j].st) }
+func (a byStartTime) Less(i, j int) bool { return a[i].before(a[j]) }
+
+// before tells whether j comes before o in the job list, which is ordered
+// from the newest job to the oldest one. Jobs that started at the same time
+// are ordered by the name of their ProwJob, so that the order is stable
+// across updates.
+func (j Job) before(o Job) bool {
+	if !j.st.Equal(o.st) {
+		return j.st.After(o.st)
+	}
+	return j.ProwJob < o.ProwJob
+}
+
+// Filter selects jobs by their fields. Fields that are not set match any job.
+type Filter struct {
+	Type  string
+	Repo  string // org/repo
+	Job   string
+	State string
+	// Pull and Author match jobs that test a pull request with the number
+	// or by the author.
+	Pull   int
+	Author string
+}
+
+// Matches tells whether the job is selected by the filter.
+func (f Filter) Matches(j Job) bool {
+	if f.Type != "" && j.Type != f.Type {
+		return false
+	}
+	if f.Repo != "" && j.Refs.Org+"/"+j.Refs.Repo != f.Repo {
+		return false
+	}
+	if f.Job != "" && j.Job != f.Job {
+		return false
+	}
+	if f.State != "" && j.State != f.State {
+		return false
+	}
+	if f.Pull == 0 && f.Author == "" {
+		return true
+	}
+	for _, pull := range j.Refs.Pulls {
+		if (f.Pull == 0 || pull.Number == f.Pull) && (f.Author == "" || strings.EqualFold(pull.Author, f.Author)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Page returns up to limit of the jobs that come after the continuation
+// token, or all of them if limit is not positive, along with the token of the
+// next page. The token is empty for the last page. The jobs must be ordered
+// as Jobs returns them. Tokens are based on the start time of the last job of
+// the page, so pages stay stable while newer jobs are added.
+func Page(jobs []Job, limit int, token string) ([]Job, string, error) {
+	start := 0
+	if token != "" {
+		last, err := parseToken(token)
+		if err != nil {
+			return nil, "", err
+		}
+		start = sort.Search(len(jobs), func(i int) bool { return last.before(jobs[i]) })
+	}
+	jobs = jobs[start:]
+	if limit <= 0 || len(jobs) <= limit {
+		return jobs, "", nil
+	}
+	jobs = jobs[:limit]
+	last := jobs[limit-1]
+	next := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", last.st.UnixNano(), last.ProwJob)))
+	return jobs, next, nil
+}
+
+// parseToken returns a job that sorts where the job the token was created
+// for does.
+func parseToken(token string) (Job, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Job{}, fmt.Errorf("invalid continuation token %q: %v", token, err)
+	}
+	parts := strings.SplitN(string(b), "/", 2)
+	if len(parts) != 2 {
+		return Job{}, fmt.Errorf("invalid continuation token %q", token)
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Job{}, fmt.Errorf("invalid continuation token %q: %v", token, err)
+	}
+	return Job{ProwJob: parts[1], st: time.Unix(0, nanos)}, nil
+}
 
 func (ja *JobAgent) update() error {
 	pjs, err := ja.kc.ListProwJobs(kube.EmptySelector)
@@ -300,11 +460,16 @@ func (ja *JobAgent) update() error {
 	}
 	sort.Sort(byStartTime(njs))
 
+	snap := &snapshot{
+		prowJobs:  pjs,
+		jobs:      njs,
+		jobsMap:   njsMap,
+		jobsIDMap: njsIDMap,
+		updated:   time.Now(),
+	}
 	ja.mut.Lock()
-	defer ja.mut.Unlock()
-	ja.prowJobs = pjs
-	ja.jobs = njs
-	ja.jobsMap = njsMap
-	ja.jobsIDMap = njsIDMap
+	ja.snap = snap
+	ja.mut.Unlock()
+	lastUpdate.Set(float64(snap.updated.Unix()))
 	return nil
 }
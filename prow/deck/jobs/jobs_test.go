@@ -18,9 +18,17 @@ package jobs
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/kube"
 )
 
@@ -62,6 +70,14 @@ func (f fpkc) GetLogTail(pod, container string, n int64) ([]byte, error) {
 	return log[logLen-n:], nil
 }
 
+func (f fpkc) FollowContainerLog(pod, container string) (io.ReadCloser, error) {
+	log, err := f.GetContainerLog(pod, container)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(string(log))), nil
+}
+
 func TestGetLogTail(t *testing.T) {
 	kc := fkc{
 		prowapi.ProwJob{
@@ -150,6 +166,55 @@ func TestGetLog(t *testing.T) {
 	}
 }
 
+func TestFollowJobLog(t *testing.T) {
+	kc := fkc{
+		prowapi.ProwJob{
+			Spec: prowapi.ProwJobSpec{
+				Agent:   prowapi.KubernetesAgent,
+				Job:     "jib",
+				Cluster: "trusted",
+			},
+			Status: prowapi.ProwJobStatus{
+				PodName: "powowow",
+				BuildID: "123",
+			},
+		},
+		prowapi.ProwJob{
+			Spec: prowapi.ProwJobSpec{
+				Agent: prowapi.JenkinsAgent,
+				Job:   "jenkins",
+			},
+			Status: prowapi.ProwJobStatus{
+				BuildID: "123",
+			},
+		},
+	}
+	ja := &JobAgent{
+		kc:   kc,
+		pkcs: map[string]PodLogClient{kube.DefaultClusterAlias: fpkc("clusterA"), "trusted": fpkc("clusterB")},
+	}
+	if err := ja.update(); err != nil {
+		t.Fatalf("Updating: %v", err)
+	}
+	stream, err := ja.FollowJobLog("jib", "123")
+	if err != nil {
+		t.Fatalf("Failed to follow log: %v", err)
+	}
+	defer stream.Close()
+	if res, err := ioutil.ReadAll(stream); err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	} else if got, expect := string(res), "clusterB"; got != expect {
+		t.Errorf("Unexpected result following logs for job 'jib'. Expected %q, but got %q.", expect, got)
+	}
+
+	if _, err := ja.FollowJobLog("jenkins", "123"); err == nil {
+		t.Error("Expected an error following the logs of a jenkins job, got none.")
+	}
+	if _, err := ja.FollowJobLog("missing", "123"); err == nil {
+		t.Error("Expected an error following the logs of a missing job, got none.")
+	}
+}
+
 func TestProwJobs(t *testing.T) {
 	kc := fkc{
 		prowapi.ProwJob{
@@ -182,3 +247,151 @@ func TestProwJobs(t *testing.T) {
 		t.Errorf("Expected prowjob to have org %q, but got %q.", expect, got)
 	}
 }
+
+// flakyKc lists the prowjobs it is given, or fails with its error.
+type flakyKc struct {
+	fkc
+	lock sync.Mutex
+	pjs  []prowapi.ProwJob
+	err  error
+}
+
+func (f *flakyKc) set(pjs []prowapi.ProwJob, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.pjs, f.err = pjs, err
+}
+
+func (f *flakyKc) ListProwJobs(s string) ([]prowapi.ProwJob, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.pjs, f.err
+}
+
+// generation returns n prowjobs of the job gen-<g>.
+func generation(g, n int) []prowapi.ProwJob {
+	var pjs []prowapi.ProwJob
+	for i := 0; i < n; i++ {
+		pjs = append(pjs, prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("gen-%d-%d", g, i)},
+			Spec:       prowapi.ProwJobSpec{Job: fmt.Sprintf("gen-%d", g)},
+			Status:     prowapi.ProwJobStatus{BuildID: fmt.Sprintf("%d", i)},
+		})
+	}
+	return pjs
+}
+
+func TestPeriod(t *testing.T) {
+	configured := &config.Config{}
+	configured.Deck.JobUpdatePeriod = time.Minute
+	testCases := []struct {
+		name     string
+		config   config.Getter
+		expected time.Duration
+	}{
+		{
+			name:     "no config getter",
+			expected: defaultPeriod,
+		},
+		{
+			name:     "config getter without a config",
+			config:   (&config.Agent{}).Config,
+			expected: defaultPeriod,
+		},
+		{
+			name:     "period not configured",
+			config:   func() *config.Config { return &config.Config{} },
+			expected: defaultPeriod,
+		},
+		{
+			name:     "configured period",
+			config:   func() *config.Config { return configured },
+			expected: time.Minute,
+		},
+	}
+	for _, tc := range testCases {
+		ja := &JobAgent{config: tc.config}
+		if got := ja.period(); got != tc.expected {
+			t.Errorf("%s: expected period %v, got %v", tc.name, tc.expected, got)
+		}
+	}
+}
+
+func TestUpdateFailureKeepsSnapshot(t *testing.T) {
+	kc := &flakyKc{}
+	ja := &JobAgent{kc: kc}
+	if !ja.LastUpdated().IsZero() {
+		t.Errorf("Expected no update time before the first update, got %v.", ja.LastUpdated())
+	}
+
+	kc.set(generation(1, 2), nil)
+	if err := ja.update(); err != nil {
+		t.Fatalf("Updating: %v", err)
+	}
+	updated := ja.LastUpdated()
+	if updated.IsZero() {
+		t.Error("Expected an update time after updating, got none.")
+	}
+
+	kc.set(nil, fmt.Errorf("apiserver is down"))
+	if err := ja.update(); err == nil {
+		t.Error("Expected an error updating, got none.")
+	}
+	if expect, got := 2, len(ja.Jobs()); expect != got {
+		t.Errorf("Expected the previous %d jobs to still be served, got %d.", expect, got)
+	}
+	if _, err := ja.GetProwJob("gen-1", "1"); err != nil {
+		t.Errorf("Expected the previous prowjobs to still be served, got: %v", err)
+	}
+	if got := ja.LastUpdated(); !got.Equal(updated) {
+		t.Errorf("Expected the update time to stay %v, got %v.", updated, got)
+	}
+}
+
+func TestSnapshotConcurrentReads(t *testing.T) {
+	const generations, size = 50, 5
+	kc := &flakyKc{}
+	ja := &JobAgent{kc: kc}
+	kc.set(generation(0, size), nil)
+	if err := ja.update(); err != nil {
+		t.Fatalf("Updating: %v", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				jobs := ja.Jobs()
+				if len(jobs) != size {
+					t.Errorf("Expected %d jobs, got %d.", size, len(jobs))
+					return
+				}
+				for _, job := range jobs {
+					if job.Job != jobs[0].Job {
+						t.Errorf("Expected all jobs to be from the same update, got %s and %s.", jobs[0].Job, job.Job)
+						return
+					}
+				}
+			}
+		}()
+	}
+	for g := 1; g <= generations; g++ {
+		kc.set(generation(g, size), nil)
+		if err := ja.update(); err != nil {
+			t.Errorf("Updating: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if expect, got := fmt.Sprintf("gen-%d", generations), ja.Jobs()[0].Job; expect != got {
+		t.Errorf("Expected the jobs of the last update, got %s.", got)
+	}
+}
@@ -19,7 +19,6 @@ package flagutil
 import (
 	"flag"
 	"fmt"
-	"net/url"
 
 	"github.com/sirupsen/logrus"
 
@@ -49,7 +48,7 @@ func (o *GitHubOptions) AddFlagsWithoutDefaultGithubTokenPath(fs *flag.FlagSet)
 
 func (o *GitHubOptions) addFlags(wantDefaultGithubTokenPath bool, fs *flag.FlagSet) {
 	o.endpoint = NewStrings("https://api.github.com")
-	fs.Var(&o.endpoint, "github-endpoint", "GitHub's API endpoint (may differ for enterprise).")
+	fs.Var(&o.endpoint, "github-endpoint", "GitHub's API endpoint (https://github.example.com/api/v3 for GitHub Enterprise).")
 	defaultGithubTokenPath := ""
 	if wantDefaultGithubTokenPath {
 		defaultGithubTokenPath = "/etc/github/oauth"
@@ -61,8 +60,8 @@ func (o *GitHubOptions) addFlags(wantDefaultGithubTokenPath bool, fs *flag.FlagS
 // Validate validates GitHub options.
 func (o *GitHubOptions) Validate(dryRun bool) error {
 	for _, uri := range o.endpoint.Strings() {
-		if _, err := url.ParseRequestURI(uri); err != nil {
-			return fmt.Errorf("invalid -github-endpoint URI: %q", uri)
+		if err := github.ValidateEndpoint(uri); err != nil {
+			return fmt.Errorf("invalid -github-endpoint URI %q: %v", uri, err)
 		}
 	}
 
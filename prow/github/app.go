@@ -0,0 +1,240 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// appTokenRefreshMargin is how long before it expires an installation
+	// token is replaced, so that requests in flight do not outlive it.
+	appTokenRefreshMargin = 5 * time.Minute
+	// appJWTLifetime is how long the JWTs that authenticate as the app
+	// itself are valid. GitHub allows at most ten minutes.
+	appJWTLifetime = 10 * time.Minute
+	// appJWTClockSkew backdates the JWTs in case GitHub's clock is behind.
+	appJWTClockSkew = time.Minute
+
+	acceptMachineMan = "application/vnd.github.machine-man-preview+json"
+)
+
+// appAuth authenticates requests as the installations of a GitHub App.
+type appAuth struct {
+	id            string
+	getPrivateKey func() []byte
+
+	lock sync.Mutex
+	// installations maps normalized org logins to installation IDs.
+	installations map[string]int
+	tokens        map[int]InstallationToken
+}
+
+// NewAppClientWithFields creates a new fully operational GitHub client that
+// authenticates as a GitHub App instead of as a user. Requests are made with
+// the token of the installation of the app on the org they concern.
+// 'appID' is the ID of the GitHub App.
+// 'getPrivateKey' is a generator for the PEM encoded private key of the app.
+// 'bases' is a variadic slice of endpoints, as for NewClientWithFields.
+func NewAppClientWithFields(fields logrus.Fields, appID string, getPrivateKey func() []byte, bases ...string) *Client {
+	c := &Client{
+		logger: logrus.WithFields(fields).WithField("client", "github"),
+		time:   &standardTime{},
+		client: &http.Client{Timeout: maxRequestTime},
+		bases:  trimEndpoints(bases),
+		app:    &appAuth{id: appID, getPrivateKey: getPrivateKey},
+
+		memberships: membershipCache{ttl: defaultMembershipCacheTTL},
+	}
+	c.getToken = func() []byte {
+		// GraphQL queries do not say which org they concern.
+		token, err := c.installationToken("")
+		if err != nil {
+			c.logger.WithError(err).Error("Failed to get an installation token for a GraphQL query.")
+			return nil
+		}
+		return []byte(token)
+	}
+	c.gqlc = newGraphQLClient(c.getToken, bases)
+	return c
+}
+
+// NewAppClient creates a new fully operational GitHub client that
+// authenticates as a GitHub App.
+func NewAppClient(appID string, getPrivateKey func() []byte, bases ...string) *Client {
+	return NewAppClientWithFields(logrus.Fields{}, appID, getPrivateKey, bases...)
+}
+
+// authorization returns the Authorization header for a request to the path.
+func (c *Client) authorization(path string) (string, error) {
+	if c.app == nil {
+		if token := c.getToken(); len(token) > 0 {
+			return "Token " + string(token), nil
+		}
+		return "", nil
+	}
+	if path == "/app" || strings.HasPrefix(path, "/app/") {
+		// the app itself rather than one of its installations
+		token, err := c.app.jwt(c.time.Now())
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	token, err := c.installationToken(orgFromPath(path))
+	if err != nil {
+		return "", err
+	}
+	return "Token " + token, nil
+}
+
+// jwt returns a token that authenticates as the app itself.
+func (a *appAuth) jwt(now time.Time) (string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(a.getPrivateKey())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse the private key of the app: %v", err)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		IssuedAt:  now.Add(-appJWTClockSkew).Unix(),
+		ExpiresAt: now.Add(appJWTLifetime - appJWTClockSkew).Unix(),
+		Issuer:    a.id,
+	}).SignedString(key)
+}
+
+// orgFromPath returns the org of the repo or org that the request path
+// concerns, or "" if it concerns neither.
+func orgFromPath(path string) string {
+	parts := strings.Split(strings.SplitN(path, "?", 2)[0], "/")
+	if len(parts) < 3 || (parts[1] != "repos" && parts[1] != "orgs") {
+		return ""
+	}
+	return parts[2]
+}
+
+// installationToken returns a token for the installation of the app on the
+// org, reusing the last one until it is about to expire. Requests that do
+// not concern an org can only be made if the app has a single installation.
+func (c *Client) installationToken(org string) (string, error) {
+	c.app.lock.Lock()
+	defer c.app.lock.Unlock()
+	id, err := c.installationID(org)
+	if err != nil {
+		return "", err
+	}
+	if token, ok := c.app.tokens[id]; ok && c.time.Now().Add(appTokenRefreshMargin).Before(token.ExpiresAt) {
+		return token.Token, nil
+	}
+
+	// Requested directly so that dry run clients can authenticate as well.
+	path := fmt.Sprintf("/app/installations/%d/access_tokens", id)
+	resp, err := c.requestRetryPolicy(http.MethodPost, path, acceptMachineMan, nil, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("status code %d creating a token for installation %d, body: %s", resp.StatusCode, id, string(b))
+	}
+	var token InstallationToken
+	if err := json.Unmarshal(b, &token); err != nil {
+		return "", err
+	}
+	if c.app.tokens == nil {
+		c.app.tokens = map[int]InstallationToken{}
+	}
+	c.app.tokens[id] = token
+	return token.Token, nil
+}
+
+// installationID returns the ID of the installation of the app on the org,
+// listing the installations again if the org is not known yet.
+// Callers need to hold c.app.lock.
+func (c *Client) installationID(org string) (int, error) {
+	if id, ok := c.app.installationFor(org); ok {
+		return id, nil
+	}
+	var installations []AppInstallation
+	err := c.readPaginatedResults(
+		"/app/installations",
+		acceptMachineMan,
+		func() interface{} {
+			return &[]AppInstallation{}
+		},
+		func(obj interface{}) {
+			installations = append(installations, *(obj.(*[]AppInstallation))...)
+		},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the installations of the app: %v", err)
+	}
+	c.app.installations = map[string]int{}
+	for _, installation := range installations {
+		c.app.installations[NormLogin(installation.Account.Login)] = installation.ID
+	}
+	if id, ok := c.app.installationFor(org); ok {
+		return id, nil
+	}
+	if org == "" {
+		return 0, fmt.Errorf("the app has %d installations, so requests that do not concern an org cannot be authenticated", len(c.app.installations))
+	}
+	return 0, fmt.Errorf("the app is not installed on %s", org)
+}
+
+// installationFor returns the known installation on the org, or the only
+// installation for requests that do not concern an org.
+func (a *appAuth) installationFor(org string) (int, bool) {
+	if org == "" {
+		if len(a.installations) != 1 {
+			return 0, false
+		}
+		for _, id := range a.installations {
+			return id, true
+		}
+	}
+	id, ok := a.installations[NormLogin(org)]
+	return id, ok
+}
+
+// getAppData records the slug of the app as the bot name.
+// Not thread-safe - callers need to hold c.mut.
+func (c *Client) getAppData() error {
+	var app App
+	_, err := c.request(&request{
+		method:    http.MethodGet,
+		path:      "/app",
+		accept:    acceptMachineMan,
+		exitCodes: []int{200},
+	}, &app)
+	if err != nil {
+		return err
+	}
+	c.botName = app.Slug
+	return nil
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package github
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// appServer fakes the GitHub API for an app installed on org-a and org-b.
+type appServer struct {
+	t      *testing.T
+	key    *rsa.PrivateKey
+	tc     *testTime
+	tokens map[int]int // number of tokens created for each installation
+	// authorizations holds the Authorization header of the last request
+	// to the repos of each org.
+	authorizations map[string]string
+}
+
+func (s *appServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/app") {
+		// the claims are checked against the fake time below
+		parser := &jwt.Parser{SkipClaimsValidation: true}
+		token, err := parser.ParseWithClaims(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &jwt.StandardClaims{}, func(*jwt.Token) (interface{}, error) {
+			return &s.key.PublicKey, nil
+		})
+		if err != nil {
+			s.t.Errorf("%s %s: invalid JWT: %v", r.Method, r.URL.Path, err)
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		claims := token.Claims.(*jwt.StandardClaims)
+		if claims.Issuer != "42" {
+			s.t.Errorf("%s %s: expected the JWT to be issued by app 42, got %q", r.Method, r.URL.Path, claims.Issuer)
+		}
+		if now := s.tc.now.Unix(); now < claims.IssuedAt || now >= claims.ExpiresAt {
+			s.t.Errorf("%s %s: expected the JWT to be valid now, it is valid from %d to %d", r.Method, r.URL.Path, claims.IssuedAt, claims.ExpiresAt)
+		}
+	}
+
+	var id int
+	switch {
+	case r.URL.Path == "/app":
+		fmt.Fprint(w, `{"id": 42, "slug": "my-app", "name": "My App"}`)
+	case r.URL.Path == "/app/installations":
+		fmt.Fprint(w, `[{"id": 1, "account": {"login": "org-a"}}, {"id": 2, "account": {"login": "Org-B"}}]`)
+	case r.Method == http.MethodPost && sscanf(r.URL.Path, "/app/installations/%d/access_tokens", &id):
+		s.tokens[id]++
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(InstallationToken{
+			Token:     fmt.Sprintf("token-%d-%d", id, s.tokens[id]),
+			ExpiresAt: s.tc.now.Add(time.Hour),
+		})
+	case strings.HasPrefix(r.URL.Path, "/repos/"):
+		s.authorizations[strings.Split(r.URL.Path, "/")[2]] = r.Header.Get("Authorization")
+		fmt.Fprint(w, "[]")
+	default:
+		s.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		http.Error(w, "404 Not Found", http.StatusNotFound)
+	}
+}
+
+func sscanf(s, format string, args ...interface{}) bool {
+	n, err := fmt.Sscanf(s, format, args...)
+	return err == nil && n == len(args)
+}
+
+func getAppClient(t *testing.T) (*Client, *appServer, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate a key: %v", err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	s := &appServer{
+		t:              t,
+		key:            key,
+		tc:             &testTime{now: time.Now()},
+		tokens:         map[int]int{},
+		authorizations: map[string]string{},
+	}
+	ts := httptest.NewTLSServer(s)
+	c := getClient(ts.URL)
+	c.time = s.tc
+	c.app = &appAuth{id: "42", getPrivateKey: func() []byte { return pemKey }}
+	return c, s, ts.Close
+}
+
+func TestAppInstallationTokens(t *testing.T) {
+	c, s, done := getAppClient(t)
+	defer done()
+
+	steps := []struct {
+		name     string
+		org      string
+		advance  time.Duration
+		expected string
+	}{
+		{
+			name:     "first request creates a token",
+			org:      "org-a",
+			expected: "Token token-1-1",
+		},
+		{
+			name:     "other org uses the token of its own installation",
+			org:      "org-b",
+			expected: "Token token-2-1",
+		},
+		{
+			name:     "token is reused",
+			org:      "org-a",
+			advance:  30 * time.Minute,
+			expected: "Token token-1-1",
+		},
+		{
+			name:     "token is refreshed five minutes before it expires",
+			org:      "org-a",
+			advance:  26 * time.Minute,
+			expected: "Token token-1-2",
+		},
+		{
+			name:     "other org refreshes its own token",
+			org:      "org-b",
+			expected: "Token token-2-2",
+		},
+		{
+			name:     "refreshed token is reused",
+			org:      "org-a",
+			advance:  time.Minute,
+			expected: "Token token-1-2",
+		},
+	}
+	for _, step := range steps {
+		s.tc.now = s.tc.now.Add(step.advance)
+		if _, err := c.GetRepoLabels(step.org, "repo"); err != nil {
+			t.Fatalf("%s: didn't expect error: %v", step.name, err)
+		}
+		if actual := s.authorizations[step.org]; actual != step.expected {
+			t.Errorf("%s: expected authorization %q, got %q", step.name, step.expected, actual)
+		}
+	}
+
+	if _, err := c.GetRepoLabels("org-c", "repo"); err == nil {
+		t.Error("expected an error for an org without an installation, got none")
+	}
+	if _, err := c.authorization("/user"); err == nil {
+		t.Error("expected an error for a request without an org with two installations, got none")
+	}
+}
+
+func TestAppBotName(t *testing.T) {
+	c, _, done := getAppClient(t)
+	defer done()
+
+	botName, err := c.BotName()
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if botName != "my-app" {
+		t.Errorf("expected the slug of the app as the bot name, got %q", botName)
+	}
+}
+
+func TestOrgFromPath(t *testing.T) {
+	testCases := map[string]string{
+		"/repos/org/repo/issues/1":  "org",
+		"/orgs/org/members?page=2":  "org",
+		"/orgs/org":                 "org",
+		"/user":                     "",
+		"/teams/1/members":          "",
+		"/search/issues?q=org:org":  "",
+		"/repositories/1/issues/12": "",
+	}
+	for path, expected := range testCases {
+		if actual := orgFromPath(path); actual != expected {
+			t.Errorf("%s: expected org %q, got %q", path, expected, actual)
+		}
+	}
+}
@@ -33,7 +33,11 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/prometheus/client_golang/prometheus"
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
@@ -44,6 +48,7 @@ import (
 type timeClient interface {
 	Sleep(time.Duration)
 	Until(time.Time) time.Duration
+	Now() time.Time
 }
 
 type standardTime struct{}
@@ -54,6 +59,9 @@ func (s *standardTime) Sleep(d time.Duration) {
 func (s *standardTime) Until(t time.Time) time.Duration {
 	return time.Until(t)
 }
+func (s *standardTime) Now() time.Time {
+	return time.Now()
+}
 
 // Client interacts with the github api.
 type Client struct {
@@ -68,15 +76,82 @@ type Client struct {
 	fake     bool
 	throttle throttler
 	getToken func() []byte
+	// app is set when authenticating as a GitHub App, see NewAppClient.
+	app *appAuth
 
-	mut     sync.Mutex // protects botName and email
+	mut     sync.Mutex // protects botName, email and statuses
 	botName string
 	email   string
+	// statuses holds the last status set on each context, keyed by
+	// statusKey. Configure with Client.CacheStatuses()
+	statuses *lru.Cache
+	// etags holds the bodies of GET responses, keyed by etagKey, so that
+	// they can be requested conditionally. Configure with Client.CacheETags()
+	// It has a lock of its own as requests are made while holding mut.
+	etagLock sync.Mutex
+	etags    *lru.Cache
+
+	rateLimit rateLimit
+
+	memberships membershipCache
+}
+
+// defaultMembershipCacheTTL is how long clients reuse the answers of
+// IsMember and TeamHasMember by default.
+const defaultMembershipCacheTTL = 5 * time.Minute
+
+// membershipCache remembers whether users are members of orgs and teams.
+// Configure with Client.SetMembershipCacheTTL()
+type membershipCache struct {
+	lock    sync.Mutex
+	ttl     time.Duration // 0 disables the cache
+	entries map[membershipKey]membershipEntry
+}
+
+// membershipKey is a user in an org, or in a team if team is set.
+type membershipKey struct {
+	org  string
+	team int
+	user string
+}
+
+type membershipEntry struct {
+	member  bool
+	expires time.Time
+}
+
+// rateLimit tracks the API tokens GitHub reports as remaining.
+type rateLimit struct {
+	lock      sync.RWMutex
+	known     bool // whether GitHub has reported the remaining tokens yet
+	remaining int
+	floor     int
+}
+
+// ErrRateLimitLow is returned by non-essential requests, like pruning
+// comments or syncing repo labels, while the remaining API tokens are below
+// the floor set with Client.SetRateLimitFloor.
+var ErrRateLimitLow = errors.New("remaining GitHub API tokens are below the floor for non-essential requests")
+
+var rateLimitRemaining = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "github_ratelimit_remaining",
+	Help: "The number of GitHub API tokens remaining in the current rate limit window, as last reported by GitHub.",
+})
+
+var etagCacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "github_etag_cache_hits_total",
+	Help: "The number of GET requests answered from the ETag cache after GitHub reported them unchanged.",
+})
+
+func init() {
+	prometheus.MustRegister(rateLimitRemaining)
+	prometheus.MustRegister(etagCacheHits)
 }
 
 var (
 	maxRetries    = 8
 	max404Retries = 2
+	max5xxRetries = 4
 	maxSleepTime  = 2 * time.Minute
 	initialDelay  = 2 * time.Second
 	teamRe        = regexp.MustCompile(`^(.*)/(.*)$`)
@@ -197,6 +272,271 @@ func (c *Client) Throttle(hourlyTokens, burst int) {
 	c.throttle.throttle = throttle
 }
 
+// RateLimitRemaining returns the number of API tokens GitHub last reported
+// as remaining, or -1 if no response has reported it yet.
+func (c *Client) RateLimitRemaining() int {
+	c.rateLimit.lock.RLock()
+	defer c.rateLimit.lock.RUnlock()
+	if !c.rateLimit.known {
+		return -1
+	}
+	return c.rateLimit.remaining
+}
+
+// SetRateLimitFloor makes non-essential requests fail with ErrRateLimitLow
+// while fewer than floor API tokens remain, keeping the rest for essential
+// requests like CreateStatus. A floor of 0 disables the check.
+func (c *Client) SetRateLimitFloor(floor int) {
+	c.log("SetRateLimitFloor", floor)
+	c.rateLimit.lock.Lock()
+	defer c.rateLimit.lock.Unlock()
+	c.rateLimit.floor = floor
+}
+
+// statusKey identifies the context of a commit that a status is set on.
+type statusKey struct {
+	org, repo, sha, context string
+}
+
+// CacheStatuses makes CreateStatus skip a status that is identical to the
+// last one the client set on the same context, remembering the statuses of
+// up to size contexts. Statuses set by others are not seen, so use
+// CreateStatusForce to restore a status that may have been overwritten.
+// A size of 0 disables the cache.
+func (c *Client) CacheStatuses(size int) error {
+	c.log("CacheStatuses", size)
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	if size <= 0 {
+		c.statuses = nil
+		return nil
+	}
+	statuses, err := lru.New(size)
+	if err != nil {
+		return err
+	}
+	c.statuses = statuses
+	return nil
+}
+
+// statusCache returns the status cache, or nil if it is disabled.
+func (c *Client) statusCache() *lru.Cache {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return c.statuses
+}
+
+// etagKey identifies a GET request whose response is cached.
+type etagKey struct {
+	url, accept string
+}
+
+// etagEntry is a cached response and the ETag GitHub sent with it.
+type etagEntry struct {
+	etag   string
+	header http.Header
+	body   []byte
+}
+
+// etagBypass matches the paths of the endpoints whose ETags cannot be
+// trusted, so their responses are never cached: searches, and pull requests,
+// whose mergeability GitHub computes in the background without always
+// changing the ETag.
+var etagBypass = []*regexp.Regexp{
+	regexp.MustCompile(`/search/`),
+	regexp.MustCompile(`/pulls/\d+/?$`),
+}
+
+// CacheETags makes GET requests conditional on the ETag of the last
+// response to the same request, remembering the responses of up to size
+// requests. GitHub answers unchanged resources with a 304, which does not
+// count against the rate limit, and the cached response is returned
+// instead. A size of 0 disables the cache.
+func (c *Client) CacheETags(size int) error {
+	c.log("CacheETags", size)
+	c.etagLock.Lock()
+	defer c.etagLock.Unlock()
+	if size <= 0 {
+		c.etags = nil
+		return nil
+	}
+	etags, err := lru.New(size)
+	if err != nil {
+		return err
+	}
+	c.etags = etags
+	return nil
+}
+
+// etagCache returns the ETag cache, or nil if it is disabled.
+func (c *Client) etagCache() *lru.Cache {
+	c.etagLock.Lock()
+	defer c.etagLock.Unlock()
+	return c.etags
+}
+
+// cacheableETag returns whether GET responses from the path may be cached.
+func cacheableETag(path string) bool {
+	for _, re := range etagBypass {
+		if re.MatchString(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// useETagCache turns a 304 response to a request made with the cached ETag
+// into the cached response, and caches responses that carry an ETag.
+func useETagCache(cache *lru.Cache, key etagKey, cached *etagEntry, resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		etagCacheHits.Inc()
+		header := http.Header{}
+		for k, v := range cached.header {
+			header[k] = v
+		}
+		// keep the rate limit headers and such of the fresh response
+		for k, v := range resp.Header {
+			header[k] = v
+		}
+		resp.Status = "200 OK"
+		resp.StatusCode = http.StatusOK
+		resp.Header = header
+		resp.ContentLength = int64(len(cached.body))
+		resp.Body = ioutil.NopCloser(bytes.NewReader(cached.body))
+		return resp, nil
+	}
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		return resp, nil
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	cache.Add(key, &etagEntry{etag: etag, header: resp.Header, body: b})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return resp, nil
+}
+
+// SetMembershipCacheTTL sets how long the answers of IsMember and
+// TeamHasMember are reused before GitHub is asked again. A ttl of 0
+// disables the cache.
+func (c *Client) SetMembershipCacheTTL(ttl time.Duration) {
+	c.log("SetMembershipCacheTTL", ttl)
+	c.memberships.lock.Lock()
+	defer c.memberships.lock.Unlock()
+	c.memberships.ttl = ttl
+	c.memberships.entries = nil
+}
+
+// cachedMembership returns whether the user is a member, if that is known.
+func (c *Client) cachedMembership(key membershipKey) (member, known bool) {
+	c.memberships.lock.Lock()
+	defer c.memberships.lock.Unlock()
+	entry, ok := c.memberships.entries[key]
+	if !ok || !c.time.Now().Before(entry.expires) {
+		return false, false
+	}
+	return entry.member, true
+}
+
+// cacheMembership records whether the user is a member, and forgets the
+// memberships that expired.
+func (c *Client) cacheMembership(key membershipKey, member bool) {
+	c.memberships.lock.Lock()
+	defer c.memberships.lock.Unlock()
+	if c.memberships.ttl <= 0 {
+		return
+	}
+	now := c.time.Now()
+	if c.memberships.entries == nil {
+		c.memberships.entries = map[membershipKey]membershipEntry{}
+	}
+	for k, entry := range c.memberships.entries {
+		if !now.Before(entry.expires) {
+			delete(c.memberships.entries, k)
+		}
+	}
+	c.memberships.entries[key] = membershipEntry{member: member, expires: now.Add(c.memberships.ttl)}
+}
+
+// updateRateLimit records the remaining API tokens from the headers of a
+// response, if it has them.
+func (c *Client) updateRateLimit(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	c.rateLimit.lock.Lock()
+	defer c.rateLimit.lock.Unlock()
+	c.rateLimit.known = true
+	c.rateLimit.remaining = remaining
+	rateLimitRemaining.Set(float64(remaining))
+}
+
+// checkRateLimitFloor returns ErrRateLimitLow if a non-essential request
+// should not be made because too few API tokens remain.
+func (c *Client) checkRateLimitFloor() error {
+	c.rateLimit.lock.RLock()
+	defer c.rateLimit.lock.RUnlock()
+	if c.rateLimit.known && c.rateLimit.remaining < c.rateLimit.floor {
+		return ErrRateLimitLow
+	}
+	return nil
+}
+
+// enterpriseAPIPath is the path under which GitHub Enterprise serves its
+// REST API. Its GraphQL API is served under enterpriseGraphQLPath instead.
+const (
+	enterpriseAPIPath     = "/api/v3"
+	enterpriseGraphQLPath = "/api/graphql"
+)
+
+// ValidateEndpoint returns an error if the GitHub API endpoint is not an
+// absolute http or https URL.
+func ValidateEndpoint(endpoint string) error {
+	u, err := url.ParseRequestURI(endpoint)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https, not %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("host must be set")
+	}
+	return nil
+}
+
+// trimEndpoints removes trailing slashes from the endpoints, as request paths
+// are appended to them.
+func trimEndpoints(bases []string) []string {
+	var trimmed []string
+	for _, base := range bases {
+		trimmed = append(trimmed, strings.TrimRight(base, "/"))
+	}
+	return trimmed
+}
+
+// newGraphQLClient returns a client for the GraphQL API of GitHub Enterprise
+// if the first endpoint is a GitHub Enterprise REST API, and for the GraphQL
+// API of github.com otherwise.
+func newGraphQLClient(getToken func() []byte, bases []string) gqlClient {
+	httpClient := &http.Client{
+		Timeout:   maxRequestTime,
+		Transport: &oauth2.Transport{Source: newReloadingTokenSource(getToken)},
+	}
+	if len(bases) > 0 {
+		if u, err := url.Parse(strings.TrimRight(bases[0], "/")); err == nil && strings.HasSuffix(u.Path, enterpriseAPIPath) {
+			u.Path = strings.TrimSuffix(u.Path, enterpriseAPIPath) + enterpriseGraphQLPath
+			return githubql.NewEnterpriseClient(u.String(), httpClient)
+		}
+	}
+	return githubql.NewClient(httpClient)
+}
+
 // NewClientWithFields creates a new fully operational GitHub client. With
 // added logging fields.
 // 'getToken' is a generator for the GitHub access token to use.
@@ -204,18 +544,18 @@ func (c *Client) Throttle(hourlyTokens, burst int) {
 //   An endpoint is used when all preceding endpoints have returned a conn err.
 //   This should be used when using the ghproxy GitHub proxy cache to allow
 //   this client to bypass the cache if it is temporarily unavailable.
+//   GitHub Enterprise endpoints look like https://github.example.com/api/v3.
 func NewClientWithFields(fields logrus.Fields, getToken func() []byte, bases ...string) *Client {
 	return &Client{
-		logger: logrus.WithFields(fields).WithField("client", "github"),
-		time:   &standardTime{},
-		gqlc: githubql.NewClient(&http.Client{
-			Timeout:   maxRequestTime,
-			Transport: &oauth2.Transport{Source: newReloadingTokenSource(getToken)},
-		}),
+		logger:   logrus.WithFields(fields).WithField("client", "github"),
+		time:     &standardTime{},
+		gqlc:     newGraphQLClient(getToken, bases),
 		client:   &http.Client{Timeout: maxRequestTime},
-		bases:    bases,
+		bases:    trimEndpoints(bases),
 		getToken: getToken,
 		dry:      false,
+
+		memberships: membershipCache{ttl: defaultMembershipCacheTTL},
 	}
 }
 
@@ -232,18 +572,18 @@ func NewClient(getToken func() []byte, bases ...string) *Client {
 //   An endpoint is used when all preceding endpoints have returned a conn err.
 //   This should be used when using the ghproxy GitHub proxy cache to allow
 //   this client to bypass the cache if it is temporarily unavailable.
+//   GitHub Enterprise endpoints look like https://github.example.com/api/v3.
 func NewDryRunClientWithFields(fields logrus.Fields, getToken func() []byte, bases ...string) *Client {
 	return &Client{
-		logger: logrus.WithFields(fields).WithField("client", "github"),
-		time:   &standardTime{},
-		gqlc: githubql.NewClient(&http.Client{
-			Timeout:   maxRequestTime,
-			Transport: &oauth2.Transport{Source: newReloadingTokenSource(getToken)},
-		}),
+		logger:   logrus.WithFields(fields).WithField("client", "github"),
+		time:     &standardTime{},
+		gqlc:     newGraphQLClient(getToken, bases),
 		client:   &http.Client{Timeout: maxRequestTime},
-		bases:    bases,
+		bases:    trimEndpoints(bases),
 		getToken: getToken,
 		dry:      true,
+
+		memberships: membershipCache{ttl: defaultMembershipCacheTTL},
 	}
 }
 
@@ -286,6 +626,9 @@ type request struct {
 	accept      string
 	requestBody interface{}
 	exitCodes   []int
+	// notIdempotent requests, like creating a comment, are not resent after
+	// a server error, as GitHub may have acted on them anyway.
+	notIdempotent bool
 }
 
 type requestError struct {
@@ -334,7 +677,7 @@ func (c *Client) requestRaw(r *request) (int, []byte, error) {
 	if c.fake || (c.dry && r.method != http.MethodGet) {
 		return r.exitCodes[0], nil, nil
 	}
-	resp, err := c.requestRetry(r.method, r.path, r.accept, r.requestBody)
+	resp, err := c.requestRetryPolicy(r.method, r.path, r.accept, r.requestBody, !r.notIdempotent)
 	if err != nil {
 		return 0, nil, err
 	}
@@ -360,20 +703,36 @@ func (c *Client) requestRaw(r *request) (int, []byte, error) {
 	return resp.StatusCode, b, err
 }
 
-// Retry on transport failures. Retries on 500s, retries after sleep on
-// ratelimit exceeded, and retries 404s a couple times.
+// Retry on transport failures. Retries on 500s a few times, retries after
+// sleep on ratelimit exceeded, and retries 404s a couple times.
 // This function closes the response body iff it also returns an error.
 func (c *Client) requestRetry(method, path, accept string, body interface{}) (*http.Response, error) {
+	return c.requestRetryPolicy(method, path, accept, body, true)
+}
+
+// requestRetryPolicy is requestRetry, except that requests that are not
+// idempotent are not retried on 500s.
+func (c *Client) requestRetryPolicy(method, path, accept string, body interface{}, idempotent bool) (*http.Response, error) {
 	var hostIndex int
 	var resp *http.Response
 	var err error
 	backoff := initialDelay
+	authorization, err := c.authorization(path)
+	if err != nil {
+		return nil, err
+	}
 	for retries := 0; retries < maxRetries; retries++ {
 		if retries > 0 && resp != nil {
 			resp.Body.Close()
 		}
-		resp, err = c.doRequest(method, c.bases[hostIndex]+path, accept, body)
+		resp, err = c.doRequest(method, c.bases[hostIndex]+path, accept, authorization, body)
 		if err == nil {
+			// Searches have a smaller rate limit of their own, which says
+			// nothing about the tokens left for other requests. Running out
+			// of it is handled like running out of the others below.
+			if !strings.HasPrefix(path, searchPath) {
+				c.updateRateLimit(resp.Header)
+			}
 			if resp.StatusCode == 404 && retries < max404Retries {
 				// Retry 404s a couple times. Sometimes GitHub is inconsistent in
 				// the sense that they send us an event such as "PR opened" but an
@@ -428,15 +787,29 @@ func (c *Client) requestRetry(method, path, accept string, body interface{}) (*h
 					err = fmt.Errorf("is the account using at least one of the following oauth scopes?: %s", oauthScopes)
 					resp.Body.Close()
 					break
+				} else if isAbuseDetection(resp) {
+					// Abuse rate limited without being told how long to wait.
+					c.time.Sleep(backoff)
+					backoff *= 2
+				} else {
+					// Forbidden, retrying will not help.
+					break
 				}
 			} else if resp.StatusCode < 500 {
 				// Normal, happy case.
 				break
+			} else if !idempotent || retries >= max5xxRetries {
+				// GitHub may have acted on the request, or it keeps failing.
+				break
 			} else {
 				// Retry 500 after a break.
 				c.time.Sleep(backoff)
 				backoff *= 2
 			}
+		} else if !idempotent || retries >= max5xxRetries {
+			// GitHub may have received the request, or the connection keeps
+			// failing.
+			break
 		} else {
 			// Connection problem. Try a different host.
 			hostIndex = (hostIndex + 1) % len(c.bases)
@@ -447,7 +820,16 @@ func (c *Client) requestRetry(method, path, accept string, body interface{}) (*h
 	return resp, err
 }
 
-func (c *Client) doRequest(method, path, accept string, body interface{}) (*http.Response, error) {
+// isAbuseDetection returns whether the body of a 403 response says that the
+// request triggered GitHub's abuse detection. The body can still be read.
+func isAbuseDetection(resp *http.Response) bool {
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return err == nil && strings.Contains(string(b), "abuse detection")
+}
+
+func (c *Client) doRequest(method, path, accept, authorization string, body interface{}) (*http.Response, error) {
 	var buf io.Reader
 	if body != nil {
 		b, err := json.Marshal(body)
@@ -460,8 +842,8 @@ func (c *Client) doRequest(method, path, accept string, body interface{}) (*http
 	if err != nil {
 		return nil, err
 	}
-	if token := c.getToken(); len(token) > 0 {
-		req.Header.Set("Authorization", "Token "+string(token))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
 	}
 	if accept == acceptNone {
 		req.Header.Add("Accept", "application/vnd.github.v3+json")
@@ -473,11 +855,29 @@ func (c *Client) doRequest(method, path, accept string, body interface{}) (*http
 	// https://go-review.googlesource.com/#/c/3210/ fixed it for GET, but not
 	// for POST.
 	req.Close = true
-	return c.client.Do(req)
+
+	cache := c.etagCache()
+	if method != http.MethodGet || cache == nil || !cacheableETag(req.URL.Path) {
+		return c.client.Do(req)
+	}
+	key := etagKey{url: path, accept: accept}
+	var cached *etagEntry
+	if entry, ok := cache.Get(key); ok {
+		cached = entry.(*etagEntry)
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	return useETagCache(cache, key, cached, resp)
 }
 
 // Not thread-safe - callers need to hold c.mut.
 func (c *Client) getUserData() error {
+	if c.app != nil {
+		return c.getAppData()
+	}
 	var u User
 	_, err := c.request(&request{
 		method:    http.MethodGet,
@@ -487,6 +887,10 @@ func (c *Client) getUserData() error {
 	if err != nil {
 		return err
 	}
+	if c.botName != u.Login && c.statuses != nil {
+		// statuses set as another identity may since have been replaced
+		c.statuses.Purge()
+	}
 	c.botName = u.Login
 	// email needs to be publicly accessible via the profile
 	// of the current account. Read below for more info
@@ -495,7 +899,8 @@ func (c *Client) getUserData() error {
 	return nil
 }
 
-// BotName returns the login of the authenticated identity.
+// BotName returns the login of the authenticated identity, or the slug of
+// the app for clients that authenticate as a GitHub App.
 //
 // See https://developer.github.com/v3/users/#get-the-authenticated-user
 func (c *Client) BotName() (string, error) {
@@ -523,7 +928,8 @@ func (c *Client) Email() (string, error) {
 	return c.email, nil
 }
 
-// IsMember returns whether or not the user is a member of the org.
+// IsMember returns whether or not the user is a member of the org. Answers
+// are reused for a while, see Client.SetMembershipCacheTTL.
 //
 // See https://developer.github.com/v3/orgs/members/#check-membership
 func (c *Client) IsMember(org, user string) (bool, error) {
@@ -532,6 +938,10 @@ func (c *Client) IsMember(org, user string) (bool, error) {
 		// Make it possible to run a couple of plugins on personal repos.
 		return true, nil
 	}
+	key := membershipKey{org: org, user: user}
+	if member, known := c.cachedMembership(key); known {
+		return member, nil
+	}
 	code, err := c.request(&request{
 		method:    http.MethodGet,
 		path:      fmt.Sprintf("/orgs/%s/members/%s", org, user),
@@ -541,8 +951,10 @@ func (c *Client) IsMember(org, user string) (bool, error) {
 		return false, err
 	}
 	if code == 204 {
+		c.cacheMembership(key, true)
 		return true, nil
 	} else if code == 404 {
+		c.cacheMembership(key, false)
 		return false, nil
 	} else if code == 302 {
 		return false, fmt.Errorf("requester is not %s org member", org)
@@ -635,10 +1047,11 @@ func (c *Client) createHook(org string, repo *string, req HookRequest) (int, err
 	}
 	var ret Hook
 	_, err := c.request(&request{
-		method:      http.MethodPost,
-		path:        path,
-		exitCodes:   []int{201},
-		requestBody: &req,
+		method:        http.MethodPost,
+		path:          path,
+		exitCodes:     []int{201},
+		requestBody:   &req,
+		notIdempotent: true,
 	}, &ret)
 	if err != nil {
 		return 0, err
@@ -841,10 +1254,11 @@ func (c *Client) CreateComment(org, repo string, number int, comment string) err
 		Body: comment,
 	}
 	_, err := c.request(&request{
-		method:      http.MethodPost,
-		path:        fmt.Sprintf("/repos/%s/%s/issues/%d/comments", org, repo, number),
-		requestBody: &ic,
-		exitCodes:   []int{201},
+		method:        http.MethodPost,
+		path:          fmt.Sprintf("/repos/%s/%s/issues/%d/comments", org, repo, number),
+		requestBody:   &ic,
+		exitCodes:     []int{201},
+		notIdempotent: true,
 	}, nil)
 	return err
 }
@@ -913,7 +1327,11 @@ func (c *Client) CreateIssueReaction(org, repo string, id int, reaction string)
 
 // DeleteStaleComments iterates over comments on an issue/PR, deleting those which the 'isStale'
 // function identifies as stale. If 'comments' is nil, the comments will be fetched from GitHub.
+// Returns ErrRateLimitLow without deleting anything if the API tokens are running low.
 func (c *Client) DeleteStaleComments(org, repo string, number int, comments []IssueComment, isStale func(IssueComment) bool) error {
+	if err := c.checkRateLimitFloor(); err != nil {
+		return err
+	}
 	var err error
 	if comments == nil {
 		comments, err = c.ListIssueComments(org, repo, number)
@@ -931,6 +1349,67 @@ func (c *Client) DeleteStaleComments(org, repo string, number int, comments []Is
 	return nil
 }
 
+// maxCommentLength is the longest comment body that GitHub accepts.
+const maxCommentLength = 65536
+
+// truncatedCommentNotice ends the bodies that EditOrCreateComment truncated.
+const truncatedCommentNotice = "\n\n_This comment was truncated because it was too long._"
+
+// EditOrCreateComment makes the bot's newest comment on the issue or PR
+// that contains the marker, usually a hidden HTML comment like
+// <!-- my-plugin -->, have the body, or creates such a comment if the bot
+// has none. This keeps a single comment up to date instead of stacking
+// new ones. The marker is appended to the body if it does not contain it,
+// and bodies that GitHub would reject as too long are truncated.
+func (c *Client) EditOrCreateComment(org, repo string, number int, marker, body string) error {
+	c.log("EditOrCreateComment", org, repo, number, marker)
+	botName, err := c.BotName()
+	if err != nil {
+		return err
+	}
+	comments, err := c.ListIssueComments(org, repo, number)
+	if err != nil {
+		return err
+	}
+	body = markedComment(marker, body)
+
+	var existing *IssueComment
+	for i, comment := range comments {
+		if NormLogin(comment.User.Login) != NormLogin(botName) || !strings.Contains(comment.Body, marker) {
+			continue
+		}
+		if existing == nil || comment.ID > existing.ID {
+			existing = &comments[i]
+		}
+	}
+	if existing == nil {
+		return c.CreateComment(org, repo, number, body)
+	}
+	if existing.Body == body {
+		return nil
+	}
+	return c.EditComment(org, repo, existing.ID, body)
+}
+
+// markedComment returns the body with the marker, truncated to fit in a
+// comment if needed.
+func markedComment(marker, body string) string {
+	suffix := ""
+	if !strings.Contains(body, marker) {
+		suffix = "\n" + marker
+	}
+	if len(body)+len(suffix) <= maxCommentLength {
+		return body + suffix
+	}
+	// The marker may be cut off with the rest of the body.
+	suffix = truncatedCommentNotice + "\n" + marker
+	end := maxCommentLength - len(suffix)
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end] + suffix
+}
+
 // readPaginatedResults iterates over all objects in the paginated result indicated by the given url.
 //
 // newObj() should return a new slice of the expected type
@@ -980,11 +1459,28 @@ func (c *Client) readPaginatedResultsWithValues(path string, values url.Values,
 		if err != nil {
 			return fmt.Errorf("failed to parse 'next' link: %v", err)
 		}
-		pagedPath = u.RequestURI()
+		pagedPath = c.relativeRequestURI(u)
 	}
 	return nil
 }
 
+// relativeRequestURI returns the request URI of the API URL relative to the
+// endpoints, which only differs from its request URI for endpoints with a
+// path like the ones of GitHub Enterprise.
+func (c *Client) relativeRequestURI(u *url.URL) string {
+	uri := u.RequestURI()
+	for _, base := range c.bases {
+		b, err := url.Parse(base)
+		if err != nil || b.Path == "" {
+			continue
+		}
+		if strings.HasPrefix(uri, b.Path+"/") {
+			return strings.TrimPrefix(uri, b.Path)
+		}
+	}
+	return uri
+}
+
 // ListIssueComments returns all comments on an issue.
 //
 // Each page of results consumes one API token.
@@ -1137,7 +1633,24 @@ func (c *Client) UpdatePullRequest(org, repo string, number int, title, body *st
 	return err
 }
 
+// maxPullRequestFiles is the most files GitHub lists for a pull request.
+const maxPullRequestFiles = 3000
+
+// TooManyFilesError is returned by GetPullRequestChanges when a pull request
+// changes too many files for GitHub to list them all. Callers that decide
+// what to do from the changed files should assume that every file changed.
+type TooManyFilesError struct {
+	Org, Repo string
+	Number    int
+}
+
+func (e TooManyFilesError) Error() string {
+	return fmt.Sprintf("%s/%s#%d changes more than the %d files GitHub lists", e.Org, e.Repo, e.Number, maxPullRequestFiles)
+}
+
 // GetPullRequestChanges gets a list of files modified in a pull request.
+// If the pull request changes more files than GitHub lists, the files that
+// are listed are returned with a TooManyFilesError.
 //
 // See https://developer.github.com/v3/pulls/#list-pull-requests-files
 func (c *Client) GetPullRequestChanges(org, repo string, number int) ([]PullRequestChange, error) {
@@ -1160,6 +1673,9 @@ func (c *Client) GetPullRequestChanges(org, repo string, number int) ([]PullRequ
 	if err != nil {
 		return nil, err
 	}
+	if len(changes) >= maxPullRequestFiles {
+		return changes, TooManyFilesError{Org: org, Repo: repo, Number: number}
+	}
 	return changes, nil
 }
 
@@ -1224,13 +1740,75 @@ func (c *Client) ListReviews(org, repo string, number int) ([]Review, error) {
 // See https://developer.github.com/v3/repos/statuses/#create-a-status
 func (c *Client) CreateStatus(org, repo, SHA string, s Status) error {
 	c.log("CreateStatus", org, repo, SHA, s)
+	return c.createStatus(org, repo, SHA, s, false)
+}
+
+// CreateStatusForce creates or updates the status of a commit like
+// CreateStatus, even if the client last set an identical status on it.
+func (c *Client) CreateStatusForce(org, repo, SHA string, s Status) error {
+	c.log("CreateStatusForce", org, repo, SHA, s)
+	return c.createStatus(org, repo, SHA, s, true)
+}
+
+func (c *Client) createStatus(org, repo, SHA string, s Status, force bool) error {
+	s = sanitizeStatus(s)
+	cache := c.statusCache()
+	key := statusKey{org: org, repo: repo, sha: SHA, context: s.Context}
+	if cache != nil && !force {
+		if last, ok := cache.Get(key); ok && last.(Status) == s {
+			return nil
+		}
+	}
 	_, err := c.request(&request{
 		method:      http.MethodPost,
 		path:        fmt.Sprintf("/repos/%s/%s/statuses/%s", org, repo, SHA),
 		requestBody: &s,
 		exitCodes:   []int{201},
 	}, nil)
-	return err
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		cache.Add(key, s)
+	}
+	return nil
+}
+
+// maxStatusDescriptionLength is the most characters GitHub accepts in the
+// description of a status before answering with a 422.
+const maxStatusDescriptionLength = 140
+
+// sanitizeStatus makes the status acceptable to GitHub: the description is
+// put on one line and shortened, and a target URL that is not an absolute
+// URL is dropped.
+func sanitizeStatus(s Status) Status {
+	s.Description = sanitizeDescription(s.Description)
+	if s.TargetURL != "" {
+		if u, err := url.Parse(s.TargetURL); err != nil || !u.IsAbs() || u.Host == "" {
+			logrus.WithField("client", "github").WithField("context", s.Context).Warnf("Dropping invalid status target URL %q.", s.TargetURL)
+			s.TargetURL = ""
+		}
+	}
+	return s
+}
+
+// sanitizeDescription replaces line breaks and tabs with spaces, drops other
+// control characters, and cuts descriptions that are too long after their
+// beginning, without splitting characters.
+func sanitizeDescription(in string) string {
+	out := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, in)
+	if utf8.RuneCountInString(out) <= maxStatusDescriptionLength {
+		return out
+	}
+	return string([]rune(out)[:maxStatusDescriptionLength-1]) + "…"
 }
 
 // ListStatuses gets commit statuses for a given ref.
@@ -1239,11 +1817,16 @@ func (c *Client) CreateStatus(org, repo, SHA string, s Status) error {
 func (c *Client) ListStatuses(org, repo, ref string) ([]Status, error) {
 	c.log("ListStatuses", org, repo, ref)
 	var statuses []Status
-	_, err := c.request(&request{
-		method:    http.MethodGet,
-		path:      fmt.Sprintf("/repos/%s/%s/statuses/%s", org, repo, ref),
-		exitCodes: []int{200},
-	}, &statuses)
+	err := c.readPaginatedResults(
+		fmt.Sprintf("/repos/%s/%s/statuses/%s", org, repo, ref),
+		acceptNone,
+		func() interface{} {
+			return &[]Status{}
+		},
+		func(obj interface{}) {
+			statuses = append(statuses, *(obj.(*[]Status))...)
+		},
+	)
 	return statuses, err
 }
 
@@ -1342,6 +1925,32 @@ func (c *Client) GetBranches(org, repo string, onlyProtected bool) ([]Branch, er
 	return branches, nil
 }
 
+// GetBranchProtection returns the protections in place for org/repo=branch,
+// or nil if the branch is not protected.
+//
+// See https://developer.github.com/v3/repos/branches/#get-branch-protection
+func (c *Client) GetBranchProtection(org, repo, branch string) (*BranchProtection, error) {
+	c.log("GetBranchProtection", org, repo, branch)
+	code, body, err := c.requestRaw(&request{
+		accept:    "application/vnd.github.luke-cage-preview+json", // for required_approving_review_count
+		method:    http.MethodGet,
+		path:      fmt.Sprintf("/repos/%s/%s/branches/%s/protection", org, repo, branch),
+		exitCodes: []int{200, 404},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if code == 404 {
+		// not protected
+		return nil, nil
+	}
+	var bp BranchProtection
+	if err := json.Unmarshal(body, &bp); err != nil {
+		return nil, err
+	}
+	return &bp, nil
+}
+
 // RemoveBranchProtection unprotects org/repo=branch.
 //
 // See https://developer.github.com/v3/repos/branches/#remove-branch-protection
@@ -1371,10 +1980,14 @@ func (c *Client) UpdateBranchProtection(org, repo, branch string, config BranchP
 }
 
 // AddRepoLabel adds a defined label given org/repo
+// Returns ErrRateLimitLow if the API tokens are running low.
 //
 // See https://developer.github.com/v3/issues/labels/#create-a-label
 func (c *Client) AddRepoLabel(org, repo, label, description, color string) error {
 	c.log("AddRepoLabel", org, repo, label, description, color)
+	if err := c.checkRateLimitFloor(); err != nil {
+		return err
+	}
 	_, err := c.request(&request{
 		method:      http.MethodPost,
 		path:        fmt.Sprintf("/repos/%s/%s/labels", org, repo),
@@ -1386,13 +1999,17 @@ func (c *Client) AddRepoLabel(org, repo, label, description, color string) error
 }
 
 // UpdateRepoLabel updates a org/repo label to new name, description, and color
+// Returns ErrRateLimitLow if the API tokens are running low.
 //
 // See https://developer.github.com/v3/issues/labels/#update-a-label
 func (c *Client) UpdateRepoLabel(org, repo, label, newName, description, color string) error {
 	c.log("UpdateRepoLabel", org, repo, label, newName, color)
+	if err := c.checkRateLimitFloor(); err != nil {
+		return err
+	}
 	_, err := c.request(&request{
 		method:      http.MethodPatch,
-		path:        fmt.Sprintf("/repos/%s/%s/labels/%s", org, repo, label),
+		path:        fmt.Sprintf("/repos/%s/%s/labels/%s", org, repo, url.PathEscape(label)),
 		accept:      "application/vnd.github.symmetra-preview+json", // allow the description field -- https://developer.github.com/changes/2018-02-22-label-description-search-preview/
 		requestBody: Label{Name: newName, Description: description, Color: color},
 		exitCodes:   []int{200},
@@ -1401,14 +2018,18 @@ func (c *Client) UpdateRepoLabel(org, repo, label, newName, description, color s
 }
 
 // DeleteRepoLabel deletes a label in org/repo
+// Returns ErrRateLimitLow if the API tokens are running low.
 //
 // See https://developer.github.com/v3/issues/labels/#delete-a-label
 func (c *Client) DeleteRepoLabel(org, repo, label string) error {
 	c.log("DeleteRepoLabel", org, repo, label)
+	if err := c.checkRateLimitFloor(); err != nil {
+		return err
+	}
 	_, err := c.request(&request{
 		method:      http.MethodDelete,
 		accept:      "application/vnd.github.symmetra-preview+json", // allow the description field -- https://developer.github.com/changes/2018-02-22-label-description-search-preview/
-		path:        fmt.Sprintf("/repos/%s/%s/labels/%s", org, repo, label),
+		path:        fmt.Sprintf("/repos/%s/%s/labels/%s", org, repo, url.PathEscape(label)),
 		requestBody: Label{Name: label},
 		exitCodes:   []int{204},
 	}, nil)
@@ -1421,6 +2042,7 @@ func (c *Client) DeleteRepoLabel(org, repo, label string) error {
 func (c *Client) GetCombinedStatus(org, repo, ref string) (*CombinedStatus, error) {
 	c.log("GetCombinedStatus", org, repo, ref)
 	var combinedStatus CombinedStatus
+	seen := map[string]bool{}
 	err := c.readPaginatedResults(
 		fmt.Sprintf("/repos/%s/%s/commits/%s/status", org, repo, ref),
 		"",
@@ -1429,7 +2051,15 @@ func (c *Client) GetCombinedStatus(org, repo, ref string) (*CombinedStatus, erro
 		},
 		func(obj interface{}) {
 			cs := *(obj.(*CombinedStatus))
-			cs.Statuses = append(combinedStatus.Statuses, cs.Statuses...)
+			statuses := combinedStatus.Statuses
+			for _, status := range cs.Statuses {
+				// A status set while paging may show up on two pages.
+				if !seen[status.Context] {
+					seen[status.Context] = true
+					statuses = append(statuses, status)
+				}
+			}
+			cs.Statuses = statuses
 			combinedStatus = cs
 		},
 	)
@@ -1474,20 +2104,51 @@ func (c *Client) GetIssueLabels(org, repo string, number int) ([]Label, error) {
 	return c.getLabels(fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number))
 }
 
+// LabelNotFound is returned by AddLabel when GitHub refuses to add a label
+// that the repo does not have.
+type LabelNotFound struct {
+	Owner, Repo string
+	Number      int
+	Label       string
+}
+
+func (e *LabelNotFound) Error() string {
+	return fmt.Sprintf("label %q does not exist on %s/%s", e.Label, e.Owner, e.Repo)
+}
+
 // AddLabel adds label to org/repo#number, returning an error on a bad response code.
+// Returns a *LabelNotFound error if GitHub refuses to add a label that the
+// repo does not have.
 //
 // See https://developer.github.com/v3/issues/labels/#add-labels-to-an-issue
 func (c *Client) AddLabel(org, repo string, number int, label string) error {
 	c.log("AddLabel", org, repo, number, label)
-	_, err := c.request(&request{
+	code, _, err := c.requestRaw(&request{
 		method:      http.MethodPost,
 		path:        fmt.Sprintf("/repos/%s/%s/issues/%d/labels", org, repo, number),
 		requestBody: []string{label},
 		exitCodes:   []int{200},
-	}, nil)
+	})
+	if code == http.StatusUnprocessableEntity {
+		return &LabelNotFound{Owner: org, Repo: repo, Number: number, Label: label}
+	}
 	return err
 }
 
+// AddLabelOrCreate adds label to org/repo#number like AddLabel, first
+// creating the label on the repo with the given color if it does not exist.
+func (c *Client) AddLabelOrCreate(org, repo string, number int, label, color string) error {
+	c.log("AddLabelOrCreate", org, repo, number, label, color)
+	err := c.AddLabel(org, repo, number, label)
+	if _, missing := err.(*LabelNotFound); !missing {
+		return err
+	}
+	if err := c.AddRepoLabel(org, repo, label, "", color); err != nil {
+		return fmt.Errorf("failed to create label %q: %v", label, err)
+	}
+	return c.AddLabel(org, repo, number, label)
+}
+
 type githubError struct {
 	Message string `json:"message,omitempty"`
 }
@@ -1499,7 +2160,7 @@ func (c *Client) RemoveLabel(org, repo string, number int, label string) error {
 	c.log("RemoveLabel", org, repo, number, label)
 	code, body, err := c.requestRaw(&request{
 		method: http.MethodDelete,
-		path:   fmt.Sprintf("/repos/%s/%s/issues/%d/labels/%s", org, repo, number, label),
+		path:   fmt.Sprintf("/repos/%s/%s/issues/%d/labels/%s", org, repo, number, url.PathEscape(label)),
 		// GitHub sometimes returns 200 for this call, which is a bug on their end.
 		// Do not expect a 404 exit code and handle it separately because we need
 		// to introspect the request's response body.
@@ -1548,7 +2209,6 @@ func (m MissingUsers) Error() string {
 // See https://developer.github.com/v3/issues/assignees/#add-assignees-to-an-issue
 func (c *Client) AssignIssue(org, repo string, number int, logins []string) error {
 	c.log("AssignIssue", org, repo, number, logins)
-	assigned := make(map[string]bool)
 	var i Issue
 	_, err := c.request(&request{
 		method:      http.MethodPost,
@@ -1559,12 +2219,16 @@ func (c *Client) AssignIssue(org, repo string, number int, logins []string) erro
 	if err != nil {
 		return err
 	}
-	for _, assignee := range i.Assignees {
-		assigned[NormLogin(assignee.Login)] = true
-	}
+	return missingAssignees(logins, i)
+}
+
+// missingAssignees returns a MissingUsers error listing the logins that
+// are not assigned to the issue, if any. GitHub silently ignores logins
+// that cannot be assigned.
+func missingAssignees(logins []string, i Issue) error {
 	missing := MissingUsers{action: "assign"}
 	for _, login := range logins {
-		if !assigned[NormLogin(login)] {
+		if !i.IsAssignee(login) {
 			missing.Users = append(missing.Users, login)
 		}
 	}
@@ -1621,11 +2285,12 @@ func (c *Client) UnassignIssue(org, repo string, number int, logins []string) er
 func (c *Client) CreateReview(org, repo string, number int, r DraftReview) error {
 	c.log("CreateReview", org, repo, number, r)
 	_, err := c.request(&request{
-		method:      http.MethodPost,
-		path:        fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", org, repo, number),
-		accept:      "application/vnd.github.black-cat-preview+json",
-		requestBody: r,
-		exitCodes:   []int{200},
+		method:        http.MethodPost,
+		path:          fmt.Sprintf("/repos/%s/%s/pulls/%d/reviews", org, repo, number),
+		accept:        "application/vnd.github.black-cat-preview+json",
+		requestBody:   r,
+		exitCodes:     []int{200},
+		notIdempotent: true,
 	}, nil)
 	return err
 }
@@ -1758,6 +2423,38 @@ func (c *Client) UnrequestReview(org, repo string, number int, logins []string)
 	return nil
 }
 
+// CreateIssue opens an issue with the labels and assignees and returns its
+// number. Returns a MissingUsers error along with the number if some
+// assignees could not be assigned.
+//
+// See https://developer.github.com/v3/issues/#create-an-issue
+func (c *Client) CreateIssue(org, repo, title, body string, labels, assignees []string) (int, error) {
+	c.log("CreateIssue", org, repo, title)
+	data := struct {
+		Title     string   `json:"title,omitempty"`
+		Body      string   `json:"body,omitempty"`
+		Labels    []string `json:"labels,omitempty"`
+		Assignees []string `json:"assignees,omitempty"`
+	}{
+		Title:     title,
+		Body:      body,
+		Labels:    labels,
+		Assignees: assignees,
+	}
+	var i Issue
+	_, err := c.request(&request{
+		method:        http.MethodPost,
+		path:          fmt.Sprintf("/repos/%s/%s/issues", org, repo),
+		requestBody:   &data,
+		exitCodes:     []int{201},
+		notIdempotent: true,
+	}, &i)
+	if err != nil {
+		return 0, err
+	}
+	return i.Number, missingAssignees(assignees, i)
+}
+
 // CloseIssue closes the existing, open issue provided
 //
 // See https://developer.github.com/v3/issues/#edit-an-issue
@@ -1844,20 +2541,74 @@ func (c *Client) ReopenPR(org, repo string, number int) error {
 	return stateCannotBeChangedOrOriginalError(err)
 }
 
+// RefNotFound is returned by GetRef for refs that do not exist.
+type RefNotFound struct {
+	Org, Repo, Ref string
+}
+
+func (e *RefNotFound) Error() string {
+	return fmt.Sprintf("ref %s does not exist in %s/%s", e.Ref, e.Org, e.Repo)
+}
+
+// RefAlreadyExists is returned by CreateRef for refs that exist.
+type RefAlreadyExists struct {
+	Org, Repo, Ref string
+}
+
+func (e *RefAlreadyExists) Error() string {
+	return fmt.Sprintf("ref %s already exists in %s/%s", e.Ref, e.Org, e.Repo)
+}
+
 // GetRef returns the SHA of the given ref, such as "heads/master".
+// Returns a *RefNotFound error if the ref does not exist.
 //
 // See https://developer.github.com/v3/git/refs/#get-a-reference
 func (c *Client) GetRef(org, repo, ref string) (string, error) {
 	c.log("GetRef", org, repo, ref)
-	var res struct {
-		Object map[string]string `json:"object"`
-	}
-	_, err := c.request(&request{
+	code, b, err := c.requestRaw(&request{
 		method:    http.MethodGet,
 		path:      fmt.Sprintf("/repos/%s/%s/git/refs/%s", org, repo, ref),
 		exitCodes: []int{200},
-	}, &res)
-	return res.Object["sha"], err
+	})
+	if code == http.StatusNotFound {
+		return "", &RefNotFound{Org: org, Repo: repo, Ref: ref}
+	}
+	if err != nil {
+		return "", err
+	}
+	// GitHub lists the refs that start with the ref if none matches it
+	// exactly, so "heads/feature" may return "heads/feature-1".
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		return "", &RefNotFound{Org: org, Repo: repo, Ref: ref}
+	}
+	var res struct {
+		Object map[string]string `json:"object"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return "", err
+	}
+	return res.Object["sha"], nil
+}
+
+// CreateRef creates the given ref, such as "heads/my-branch", pointing at
+// the SHA. Returns a *RefAlreadyExists error if the ref exists.
+//
+// See https://developer.github.com/v3/git/refs/#create-a-reference
+func (c *Client) CreateRef(org, repo, ref, sha string) error {
+	c.log("CreateRef", org, repo, ref, sha)
+	code, _, err := c.requestRaw(&request{
+		method: http.MethodPost,
+		path:   fmt.Sprintf("/repos/%s/%s/git/refs", org, repo),
+		requestBody: map[string]string{
+			"ref": "refs/" + ref,
+			"sha": sha,
+		},
+		exitCodes: []int{201},
+	})
+	if code == http.StatusUnprocessableEntity {
+		return &RefAlreadyExists{Org: org, Repo: repo, Ref: ref}
+	}
+	return err
 }
 
 // DeleteRef deletes the given ref
@@ -1873,29 +2624,69 @@ func (c *Client) DeleteRef(org, repo, ref string) error {
 	return err
 }
 
+const (
+	// searchPath is the prefix of the paths of the search API.
+	searchPath = "/search/"
+	// maxSearchResults is how many results GitHub returns at most for a
+	// search.
+	maxSearchResults = 1000
+)
+
+// SearchResultsTruncated is returned by FindIssues, along with the results
+// that GitHub returned, when a search matched more results than GitHub
+// returns.
+type SearchResultsTruncated struct {
+	Query string
+	Total int
+}
+
+func (e *SearchResultsTruncated) Error() string {
+	return fmt.Sprintf("search %q matched %d results, but only the first %d are available", e.Query, e.Total, maxSearchResults)
+}
+
 // FindIssues uses the GitHub search API to find issues which match a particular query.
 //
 // Input query the same way you would into the website.
 // Order returned results with sort (usually "updated").
 // Control whether oldest/newest is first with asc.
+// Returns a *SearchResultsTruncated error with the first results if the
+// query matched more than GitHub returns.
 //
 // See https://help.github.com/articles/searching-issues-and-pull-requests/ for details.
 func (c *Client) FindIssues(query, sort string, asc bool) ([]Issue, error) {
 	c.log("FindIssues", query)
-	path := fmt.Sprintf("/search/issues?q=%s", url.QueryEscape(query))
+	values := url.Values{
+		"q":        []string{query},
+		"per_page": []string{"100"},
+	}
 	if sort != "" {
-		path += "&sort=" + url.QueryEscape(sort)
+		values.Set("sort", sort)
 		if asc {
-			path += "&order=asc"
+			values.Set("order", "asc")
 		}
 	}
-	var issSearchResult IssuesSearchResult
-	_, err := c.request(&request{
-		method:    http.MethodGet,
-		path:      path,
-		exitCodes: []int{200},
-	}, &issSearchResult)
-	return issSearchResult.Issues, err
+	var issues []Issue
+	var total int
+	err := c.readPaginatedResultsWithValues(
+		searchPath+"issues",
+		values,
+		acceptNone,
+		func() interface{} {
+			return &IssuesSearchResult{}
+		},
+		func(obj interface{}) {
+			result := obj.(*IssuesSearchResult)
+			total = result.Total
+			issues = append(issues, result.Issues...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if total > maxSearchResults {
+		return issues, &SearchResultsTruncated{Query: query, Total: total}
+	}
+	return issues, nil
 }
 
 // FileNotFound happens when github cannot find the file requested by GetFile().
@@ -2139,6 +2930,40 @@ func (c *Client) ListTeamMembers(id int, role string) ([]TeamMember, error) {
 	return teamMembers, nil
 }
 
+// TeamHasMember returns whether the user is an active member of the team.
+// Answers are reused for a while, see Client.SetMembershipCacheTTL.
+//
+// https://developer.github.com/v3/teams/members/#get-team-membership
+func (c *Client) TeamHasMember(id int, user string) (bool, error) {
+	c.log("TeamHasMember", id, user)
+	if c.fake {
+		return false, nil
+	}
+	key := membershipKey{team: id, user: user}
+	if member, known := c.cachedMembership(key); known {
+		return member, nil
+	}
+	code, b, err := c.requestRaw(&request{
+		method:    http.MethodGet,
+		path:      fmt.Sprintf("/teams/%d/memberships/%s", id, user),
+		exitCodes: []int{200, 404},
+	})
+	if err != nil {
+		return false, err
+	}
+	member := false
+	if code == 200 {
+		var tm TeamMembership
+		if err := json.Unmarshal(b, &tm); err != nil {
+			return false, err
+		}
+		// Invited users are pending until they accept the invitation.
+		member = tm.State == StateActive
+	}
+	c.cacheMembership(key, member)
+	return member, nil
+}
+
 // ListTeamInvitations gets a list of team members with pending invitations for the
 // given team id
 //
@@ -25,13 +25,17 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unicode/utf8"
 
+	dto "github.com/prometheus/client_model/go"
+	githubql "github.com/shurcooL/githubv4"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
@@ -46,6 +50,9 @@ func (tt *testTime) Sleep(d time.Duration) {
 func (tt *testTime) Until(t time.Time) time.Duration {
 	return t.Sub(tt.now)
 }
+func (tt *testTime) Now() time.Time {
+	return tt.now
+}
 
 func getClient(url string) *Client {
 	getToken := func() []byte {
@@ -107,6 +114,58 @@ func TestAbuseRateLimit(t *testing.T) {
 	}
 }
 
+func TestRateLimitRemaining(t *testing.T) {
+	remaining := "4000"
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if remaining != "" {
+			w.Header().Set("X-RateLimit-Remaining", remaining)
+		}
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		fmt.Fprint(w, "[]")
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	c.SetRateLimitFloor(1000)
+
+	if actual := c.RateLimitRemaining(); actual != -1 {
+		t.Errorf("Expected -1 before any request, got %d", actual)
+	}
+	if err := c.AddRepoLabel("org", "repo", "label", "", "ffffff"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if actual := c.RateLimitRemaining(); actual != 4000 {
+		t.Errorf("Expected 4000 remaining, got %d", actual)
+	}
+
+	remaining = ""
+	if _, err := c.GetRepoLabels("org", "repo"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if actual := c.RateLimitRemaining(); actual != 4000 {
+		t.Errorf("Expected a response without the header to keep 4000 remaining, got %d", actual)
+	}
+
+	remaining = "999"
+	if _, err := c.GetRepoLabels("org", "repo"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if actual := c.RateLimitRemaining(); actual != 999 {
+		t.Errorf("Expected 999 remaining, got %d", actual)
+	}
+	if err := c.AddRepoLabel("org", "repo", "label", "", "ffffff"); err != ErrRateLimitLow {
+		t.Errorf("Expected ErrRateLimitLow adding a label below the floor, got: %v", err)
+	}
+	if err := c.DeleteStaleComments("org", "repo", 1, nil, func(IssueComment) bool { return true }); err != ErrRateLimitLow {
+		t.Errorf("Expected ErrRateLimitLow pruning comments below the floor, got: %v", err)
+	}
+	if err := c.CreateStatus("org", "repo", "sha", Status{State: "success"}); err != nil {
+		t.Errorf("Expected statuses to be created below the floor, got: %v", err)
+	}
+}
+
 func TestRetry404(t *testing.T) {
 	tc := &testTime{now: time.Now()}
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -125,6 +184,154 @@ func TestRetry404(t *testing.T) {
 	}
 }
 
+func TestRetryPolicy(t *testing.T) {
+	type response struct {
+		code   int
+		header map[string]string
+		body   string
+		// hangUp closes the connection without a response.
+		hangUp bool
+	}
+	abuse := response{code: 403, body: `{"message": "You have triggered an abuse detection mechanism."}`}
+	var testCases = []struct {
+		name      string
+		responses []response // the last response repeats
+		call      func(c *Client) error
+		requests  int
+		err       bool
+	}{
+		{
+			name:      "GET is retried until it succeeds",
+			responses: []response{{code: 502}, {code: 503}, {code: 200, body: "[]"}},
+			call: func(c *Client) error {
+				_, err := c.ListStatuses("org", "repo", "ref")
+				return err
+			},
+			requests: 3,
+		},
+		{
+			name:      "GET is retried at most four times",
+			responses: []response{{code: 504}},
+			call: func(c *Client) error {
+				_, err := c.ListStatuses("org", "repo", "ref")
+				return err
+			},
+			requests: 5,
+			err:      true,
+		},
+		{
+			name:      "GET is retried at most four times after connection errors",
+			responses: []response{{hangUp: true}},
+			call: func(c *Client) error {
+				_, err := c.ListStatuses("org", "repo", "ref")
+				return err
+			},
+			requests: 5,
+			err:      true,
+		},
+		{
+			name:      "CreateComment is not resent after a connection error",
+			responses: []response{{hangUp: true}, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateComment("org", "repo", 1, "hello")
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:      "CreateStatus is retried",
+			responses: []response{{code: 500}, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateStatus("org", "repo", "sha", Status{})
+			},
+			requests: 2,
+		},
+		{
+			name:      "CreateComment is not retried",
+			responses: []response{{code: 502}, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateComment("org", "repo", 1, "hello")
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:      "abuse rate limit is retried after the indicated time",
+			responses: []response{{code: 403, header: map[string]string{"Retry-After": "1"}}, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateComment("org", "repo", 1, "hello")
+			},
+			requests: 2,
+		},
+		{
+			name:      "abuse detection without Retry-After is retried",
+			responses: []response{abuse, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateStatus("org", "repo", "sha", Status{})
+			},
+			requests: 2,
+		},
+		{
+			name:      "forbidden is not retried",
+			responses: []response{{code: 403, body: `{"message": "Must have admin rights to Repository."}`}},
+			call: func(c *Client) error {
+				return c.CreateStatus("org", "repo", "sha", Status{})
+			},
+			requests: 1,
+			err:      true,
+		},
+		{
+			name:      "unprocessable entity is not retried",
+			responses: []response{{code: 422}, {code: 201}},
+			call: func(c *Client) error {
+				return c.CreateStatus("org", "repo", "sha", Status{})
+			},
+			requests: 1,
+			err:      true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resp := testCase.responses[len(testCase.responses)-1]
+				if requests < len(testCase.responses) {
+					resp = testCase.responses[requests]
+				}
+				requests++
+				if resp.hangUp {
+					conn, _, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						t.Errorf("failed to hijack the connection: %v", err)
+						return
+					}
+					conn.Close()
+					return
+				}
+				for key, value := range resp.header {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(resp.code)
+				fmt.Fprint(w, resp.body)
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			c.time = &testTime{now: time.Now()}
+
+			err := testCase.call(c)
+			if err != nil && !testCase.err {
+				t.Errorf("expected no error, got: %v", err)
+			} else if err == nil && testCase.err {
+				t.Error("expected an error, got none")
+			}
+			if requests != testCase.requests {
+				t.Errorf("expected %d requests, got %d", testCase.requests, requests)
+			}
+		})
+	}
+}
+
 func TestRetryBase(t *testing.T) {
 	defer func(orig time.Duration) { initialDelay = orig }(initialDelay)
 	initialDelay = time.Microsecond
@@ -156,6 +363,73 @@ func TestRetryBase(t *testing.T) {
 	}
 }
 
+func TestEnterpriseEndpoint(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/graphql":
+			fmt.Fprint(w, `{"data": {"viewer": {"login": "k8s-ci-robot"}}}`)
+		case r.URL.Path == "/api/v3/repos/k8s/kuber/pulls/5":
+			fmt.Fprint(w, `{"number": 5}`)
+		case r.URL.Path == "/api/v3/repos/k8s/kuber/issues/5/comments" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+		case r.URL.Path == "/api/v3/repos/k8s/kuber/issues/5/comments" && r.URL.Query().Get("page") == "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/k8s/kuber/issues/5/comments?per_page=100&page=2>; rel="next"`, ts.URL))
+			fmt.Fprint(w, `[{"id": 1}]`)
+		case r.URL.Path == "/api/v3/repos/k8s/kuber/issues/5/comments":
+			fmt.Fprint(w, `[{"id": 2}]`)
+		default:
+			t.Errorf("Bad request: %s %s", r.Method, r.URL)
+			http.Error(w, "404 Not Found", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient(func() []byte { return []byte("token") }, ts.URL+"/api/v3/")
+
+	if pr, err := c.GetPullRequest("k8s", "kuber", 5); err != nil {
+		t.Errorf("Didn't expect error getting the PR: %v", err)
+	} else if pr.Number != 5 {
+		t.Errorf("Expected PR 5, got %d", pr.Number)
+	}
+	if comments, err := c.ListIssueComments("k8s", "kuber", 5); err != nil {
+		t.Errorf("Didn't expect error listing comments: %v", err)
+	} else if len(comments) != 2 {
+		t.Errorf("Expected comments from both pages, got %v", comments)
+	}
+	if err := c.CreateComment("k8s", "kuber", 5, "hello"); err != nil {
+		t.Errorf("Didn't expect error creating a comment: %v", err)
+	}
+	var q struct {
+		Viewer struct {
+			Login githubql.String
+		}
+	}
+	if err := c.Query(context.Background(), &q, nil); err != nil {
+		t.Errorf("Didn't expect error querying GraphQL: %v", err)
+	} else if q.Viewer.Login != "k8s-ci-robot" {
+		t.Errorf("Expected login k8s-ci-robot, got %q", q.Viewer.Login)
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	var testCases = []struct {
+		endpoint string
+		valid    bool
+	}{
+		{endpoint: "https://api.github.com", valid: true},
+		{endpoint: "https://github.example.com/api/v3/", valid: true},
+		{endpoint: "http://ghproxy", valid: true},
+		{endpoint: "api.github.com"},
+		{endpoint: "ftp://github.example.com/api/v3"},
+		{endpoint: "https:///api/v3"},
+	}
+	for _, testCase := range testCases {
+		if err := ValidateEndpoint(testCase.endpoint); (err == nil) != testCase.valid {
+			t.Errorf("%s: expected valid %t, got error: %v", testCase.endpoint, testCase.valid, err)
+		}
+	}
+}
+
 func TestBotName(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -202,6 +476,136 @@ func TestIsMember(t *testing.T) {
 	}
 }
 
+func TestIsMemberResponses(t *testing.T) {
+	testCases := []struct {
+		name           string
+		code           int
+		expectedMember bool
+		expectedErr    bool
+	}{
+		{
+			name:           "204 means a member",
+			code:           http.StatusNoContent,
+			expectedMember: true,
+		},
+		{
+			name: "404 means not a member",
+			code: http.StatusNotFound,
+		},
+		{
+			name:        "302 means the requester is not a member",
+			code:        http.StatusFound,
+			expectedErr: true,
+		},
+		{
+			name:        "other codes are errors",
+			code:        http.StatusForbidden,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.code == http.StatusFound {
+					w.Header().Set("Location", "/orgs/k8s/public_members/person")
+				}
+				w.WriteHeader(tc.code)
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			c.time = &testTime{now: time.Now()}
+			c.client.(*http.Client).CheckRedirect = func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+			member, err := c.IsMember("k8s", "person")
+			if err != nil && !tc.expectedErr {
+				t.Errorf("Didn't expect error: %v", err)
+			}
+			if err == nil && tc.expectedErr {
+				t.Error("Expected an error, got none")
+			}
+			if member != tc.expectedMember {
+				t.Errorf("Expected member %t, got %t", tc.expectedMember, member)
+			}
+		})
+	}
+}
+
+func TestMembershipCache(t *testing.T) {
+	requests := map[string]int{}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/orgs/k8s/members/member":
+			w.WriteHeader(http.StatusNoContent)
+		case "/teams/1/memberships/member":
+			fmt.Fprint(w, `{"role": "member", "state": "active"}`)
+		case "/teams/1/memberships/invitee":
+			fmt.Fprint(w, `{"role": "member", "state": "pending"}`)
+		default:
+			http.Error(w, "404 Not Found", http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	tt := &testTime{now: time.Now()}
+	c := getClient(ts.URL)
+	c.time = tt
+	c.SetMembershipCacheTTL(5 * time.Minute)
+
+	checks := []struct {
+		path           string
+		check          func() (bool, error)
+		expectedMember bool
+	}{
+		{
+			path:           "/orgs/k8s/members/member",
+			check:          func() (bool, error) { return c.IsMember("k8s", "member") },
+			expectedMember: true,
+		},
+		{
+			path:  "/orgs/k8s/members/stranger",
+			check: func() (bool, error) { return c.IsMember("k8s", "stranger") },
+		},
+		{
+			path:           "/teams/1/memberships/member",
+			check:          func() (bool, error) { return c.TeamHasMember(1, "member") },
+			expectedMember: true,
+		},
+		{
+			path:  "/teams/1/memberships/invitee",
+			check: func() (bool, error) { return c.TeamHasMember(1, "invitee") },
+		},
+		{
+			path:  "/teams/1/memberships/stranger",
+			check: func() (bool, error) { return c.TeamHasMember(1, "stranger") },
+		},
+	}
+	run := func(when string, expectRequests bool) {
+		for _, check := range checks {
+			before := requests[check.path]
+			member, err := check.check()
+			if err != nil {
+				t.Errorf("%s: %s: didn't expect error: %v", when, check.path, err)
+			}
+			if member != check.expectedMember {
+				t.Errorf("%s: %s: expected member %t, got %t", when, check.path, check.expectedMember, member)
+			}
+			// 404s are retried, so only check whether GitHub was asked
+			if requested := requests[check.path] > before; requested != expectRequests {
+				t.Errorf("%s: %s: expected a request to GitHub to be %t, got %t", when, check.path, expectRequests, requested)
+			}
+		}
+	}
+	run("first check", true)
+	tt.now = tt.now.Add(4 * time.Minute)
+	run("check before expiry", false)
+	tt.now = tt.now.Add(time.Minute)
+	run("check after expiry", true)
+
+	c.SetMembershipCacheTTL(0)
+	run("check without cache", true)
+}
+
 func TestCreateComment(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -229,6 +633,108 @@ func TestCreateComment(t *testing.T) {
 	}
 }
 
+func TestEditOrCreateComment(t *testing.T) {
+	const marker = "<!-- test-marker -->"
+	comment := func(id int, login, body string) IssueComment {
+		return IssueComment{ID: id, User: User{Login: login}, Body: body}
+	}
+	var testCases = []struct {
+		name     string
+		comments []IssueComment
+		// expected is the method and path of the request that changes the
+		// comments, if any.
+		expected string
+	}{
+		{
+			name:     "no comments",
+			expected: "POST /repos/k8s/kuber/issues/5/comments",
+		},
+		{
+			name: "only comments without the marker or by others",
+			comments: []IssueComment{
+				comment(1, "bot", "hi"),
+				comment(2, "human", "hi\n"+marker),
+			},
+			expected: "POST /repos/k8s/kuber/issues/5/comments",
+		},
+		{
+			name: "newest marked bot comment is edited",
+			comments: []IssueComment{
+				comment(7, "Bot", "older\n"+marker),
+				comment(3, "bot", "oldest\n"+marker),
+				comment(9, "bot", "unmarked"),
+			},
+			expected: "PATCH /repos/k8s/kuber/issues/comments/7",
+		},
+		{
+			name: "up to date comment is left alone",
+			comments: []IssueComment{
+				comment(3, "bot", "hello\n"+marker),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var changes []string
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && r.URL.Path == "/user":
+					fmt.Fprint(w, `{"login": "bot"}`)
+				case r.Method == http.MethodGet && r.URL.Path == "/repos/k8s/kuber/issues/5/comments":
+					b, err := json.Marshal(tc.comments)
+					if err != nil {
+						t.Fatalf("Didn't expect error: %v", err)
+					}
+					fmt.Fprint(w, string(b))
+				default:
+					changes = append(changes, r.Method+" "+r.URL.Path)
+					var ic IssueComment
+					if err := json.NewDecoder(r.Body).Decode(&ic); err != nil {
+						t.Errorf("Could not unmarshal request: %v", err)
+					} else if expected := "hello\n" + marker; ic.Body != expected {
+						t.Errorf("Expected body %q, got %q", expected, ic.Body)
+					}
+					if r.Method == http.MethodPost {
+						http.Error(w, "201 Created", http.StatusCreated)
+						return
+					}
+					fmt.Fprint(w, "{}")
+				}
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			if err := c.EditOrCreateComment("k8s", "kuber", 5, marker, "hello"); err != nil {
+				t.Errorf("Didn't expect error: %v", err)
+			}
+			var expected []string
+			if tc.expected != "" {
+				expected = []string{tc.expected}
+			}
+			if !reflect.DeepEqual(changes, expected) {
+				t.Errorf("Expected requests %v, got %v", expected, changes)
+			}
+		})
+	}
+}
+
+func TestMarkedComment(t *testing.T) {
+	const marker = "<!-- test-marker -->"
+	if actual, expected := markedComment(marker, marker+"\nhello"), marker+"\nhello"; actual != expected {
+		t.Errorf("Expected a marked body to be kept, got %q", actual)
+	}
+	long := strings.Repeat("é", maxCommentLength)
+	actual := markedComment(marker, long)
+	if len(actual) > maxCommentLength {
+		t.Errorf("Expected at most %d bytes, got %d", maxCommentLength, len(actual))
+	}
+	if !utf8.ValidString(actual) {
+		t.Error("Expected the body to be cut between characters")
+	}
+	if !strings.HasSuffix(actual, truncatedCommentNotice+"\n"+marker) {
+		t.Errorf("Expected the body to end with the notice and the marker, got %q", actual[len(actual)-100:])
+	}
+}
+
 func TestCreateCommentReaction(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -293,6 +799,44 @@ func TestGetPullRequest(t *testing.T) {
 	}
 }
 
+func TestGetPullRequestPayload(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+  "number": 12,
+  "state": "open",
+  "title": "Fix the flake",
+  "user": {"login": "bla"},
+  "labels": [
+    {"name": "lgtm", "color": "15dd18"},
+    {"name": "approved", "color": "0ffa16"}
+  ],
+  "base": {"ref": "master", "sha": "basesha"},
+  "head": {"ref": "fix", "sha": "headsha"},
+  "merged": false,
+  "mergeable": true,
+  "merge_commit_sha": "mergesha"
+}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	pr, err := c.GetPullRequest("k8s", "kuber", 12)
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if pr.Mergable == nil || !*pr.Mergable {
+		t.Errorf("Expected the PR to be mergeable, got %v", pr.Mergable)
+	}
+	if expected := []Label{{Name: "lgtm", Color: "15dd18"}, {Name: "approved", Color: "0ffa16"}}; !reflect.DeepEqual(pr.Labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, pr.Labels)
+	}
+	if pr.Base.SHA != "basesha" || pr.Head.SHA != "headsha" {
+		t.Errorf("Wrong base or head SHA: %s, %s", pr.Base.SHA, pr.Head.SHA)
+	}
+	if pr.MergeSHA == nil || *pr.MergeSHA != "mergesha" {
+		t.Errorf("Wrong merge SHA: %v", pr.MergeSHA)
+	}
+}
+
 func TestGetPullRequestChanges(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -321,6 +865,97 @@ func TestGetPullRequestChanges(t *testing.T) {
 	}
 }
 
+func TestGetPullRequestChangesPaginated(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		files       int
+		expectedErr bool
+	}{
+		{
+			name:  "changes over several pages are aggregated",
+			files: 250,
+		},
+		{
+			name:        "changes capped by GitHub are returned with an error",
+			files:       3000,
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/k8s/kuber/pulls/12/files" {
+					t.Errorf("Bad request path: %s", r.URL.Path)
+				}
+				perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+				if err != nil || perPage != 100 {
+					t.Errorf("Expected 100 results per page, got %q", r.URL.Query().Get("per_page"))
+					perPage = 100
+				}
+				page := 1
+				if r.URL.Query().Get("page") != "" {
+					page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+				}
+				var changes []PullRequestChange
+				for i := (page - 1) * perPage; i < page*perPage && i < testCase.files; i++ {
+					changes = append(changes, PullRequestChange{Filename: fmt.Sprintf("%d.txt", i)})
+				}
+				if page*perPage < testCase.files {
+					w.Header().Set("Link", fmt.Sprintf(`<https://%s%s?per_page=%d&page=%d>; rel="next"`, r.Host, r.URL.Path, perPage, page+1))
+				}
+				b, err := json.Marshal(&changes)
+				if err != nil {
+					t.Fatalf("Didn't expect error: %v", err)
+				}
+				fmt.Fprint(w, string(b))
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			cs, err := c.GetPullRequestChanges("k8s", "kuber", 12)
+			if _, tooMany := err.(TooManyFilesError); tooMany != testCase.expectedErr {
+				t.Errorf("Expected TooManyFilesError %t, got: %v", testCase.expectedErr, err)
+			}
+			if len(cs) != testCase.files {
+				t.Fatalf("Expected %d changes, got %d", testCase.files, len(cs))
+			}
+			for i, change := range cs {
+				if expected := fmt.Sprintf("%d.txt", i); change.Filename != expected {
+					t.Fatalf("Expected change %d to be %s, got %s", i, expected, change.Filename)
+				}
+			}
+		})
+	}
+}
+
+func TestListStatuses(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/k8s/kuber/statuses/abc" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		statuses := []Status{{Context: "first"}}
+		if r.URL.Query().Get("page") == "2" {
+			statuses = []Status{{Context: "second"}}
+		} else {
+			w.Header().Set("Link", fmt.Sprintf(`<https://%s%s?page=2>; rel="next"`, r.Host, r.URL.Path))
+		}
+		b, err := json.Marshal(&statuses)
+		if err != nil {
+			t.Fatalf("Didn't expect error: %v", err)
+		}
+		fmt.Fprint(w, string(b))
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	statuses, err := c.ListStatuses("k8s", "kuber", "abc")
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Context != "first" || statuses[1].Context != "second" {
+		t.Errorf("Wrong result: %#v", statuses)
+	}
+}
+
 func TestGetRef(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -341,75 +976,547 @@ func TestGetRef(t *testing.T) {
 	}
 }
 
+func TestGetRefNotFound(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/k8s/kuber/git/refs/heads/feature":
+			// GitHub lists partial matches if no ref matches exactly.
+			fmt.Fprint(w, `[{"ref": "refs/heads/feature-1", "object": {"sha":"abcde"}}]`)
+		case "/repos/k8s/kuber/git/refs/heads/missing":
+			http.Error(w, "404 Not Found", http.StatusNotFound)
+		default:
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	for _, ref := range []string{"heads/feature", "heads/missing"} {
+		SHA, err := c.GetRef("k8s", "kuber", ref)
+		if _, notFound := err.(*RefNotFound); !notFound {
+			t.Errorf("Expected a RefNotFound error for %s, got SHA %q and error %v", ref, SHA, err)
+		}
+	}
+}
+
+func TestCreateRef(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/git/refs" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("Could not unmarshal request: %v", err)
+		}
+		if body["sha"] != "abcde" {
+			t.Errorf("Wrong SHA: %s", body["sha"])
+		}
+		switch body["ref"] {
+		case "refs/heads/new":
+			http.Error(w, "201 Created", http.StatusCreated)
+		case "refs/heads/master":
+			http.Error(w, "422 Unprocessable Entity", http.StatusUnprocessableEntity)
+		default:
+			t.Errorf("Wrong ref: %s", body["ref"])
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CreateRef("k8s", "kuber", "heads/new", "abcde"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	err := c.CreateRef("k8s", "kuber", "heads/master", "abcde")
+	if _, exists := err.(*RefAlreadyExists); !exists {
+		t.Errorf("Expected a RefAlreadyExists error, got %v", err)
+	}
+}
+
 func TestDeleteRef(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
 			t.Errorf("Bad method: %s", r.Method)
 		}
-		if r.URL.Path != "/repos/k8s/kuber/git/refs/heads/my-feature" {
-			t.Errorf("Bad request path: %s", r.URL.Path)
+		if r.URL.Path != "/repos/k8s/kuber/git/refs/heads/my-feature" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		http.Error(w, "204 No Content", http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.DeleteRef("k8s", "kuber", "heads/my-feature"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestGetSingleCommit(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/octocat/Hello-World/commits/6dcb09b5b57875f334f61aebed695e2e4193db5e" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{
+			"commit": {
+			  "tree": {
+				"sha": "6dcb09b5b57875f334f61aebed695e2e4193db5e"
+			  }
+		        }
+		  }`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	commit, err := c.GetSingleCommit("octocat", "Hello-World", "6dcb09b5b57875f334f61aebed695e2e4193db5e")
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	} else if commit.Commit.Tree.SHA != "6dcb09b5b57875f334f61aebed695e2e4193db5e" {
+		t.Errorf("Wrong tree-hash: %s", commit.Commit.Tree.SHA)
+	}
+}
+
+func TestCreateStatus(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/statuses/abcdef" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var s Status
+		if err := json.Unmarshal(b, &s); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if s.Context != "c" {
+			t.Errorf("Wrong context: %s", s.Context)
+		}
+		http.Error(w, "201 Created", http.StatusCreated)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CreateStatus("k8s", "kuber", "abcdef", Status{
+		Context: "c",
+	}); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		name     string
+		details  MergeDetails
+		code     int
+		message  string
+		expected error
+	}{
+		{
+			name:    "merge",
+			details: MergeDetails{SHA: "abcdef", MergeMethod: string(MergeMerge), CommitTitle: "Merge #5", CommitMessage: "Fixes everything."},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "squash",
+			details: MergeDetails{SHA: "abcdef", MergeMethod: string(MergeSquash), CommitTitle: "Squash #5"},
+			code:    http.StatusOK,
+		},
+		{
+			name:    "rebase",
+			details: MergeDetails{SHA: "abcdef", MergeMethod: string(MergeRebase)},
+			code:    http.StatusOK,
+		},
+		{
+			name:     "head changed",
+			details:  MergeDetails{SHA: "abcdef"},
+			code:     http.StatusConflict,
+			message:  "Head branch was modified. Review and try the merge again.",
+			expected: ModifiedHeadError("Head branch was modified. Review and try the merge again."),
+		},
+		{
+			name:     "not mergeable",
+			details:  MergeDetails{SHA: "abcdef"},
+			code:     http.StatusMethodNotAllowed,
+			message:  "Pull Request is not mergeable",
+			expected: UnmergablePRError("Pull Request is not mergeable"),
+		},
+		{
+			name:     "base changed",
+			details:  MergeDetails{SHA: "abcdef"},
+			code:     http.StatusMethodNotAllowed,
+			message:  "Base branch was modified. Review and try the merge again.",
+			expected: UnmergablePRBaseChangedError("Base branch was modified. Review and try the merge again."),
+		},
+		{
+			name:     "unauthorized to push",
+			details:  MergeDetails{SHA: "abcdef"},
+			code:     http.StatusMethodNotAllowed,
+			message:  "You're not authorized to push to this branch.",
+			expected: UnauthorizedToPushError("You're not authorized to push to this branch."),
+		},
+		{
+			name:     "merge commits forbidden",
+			details:  MergeDetails{SHA: "abcdef", MergeMethod: string(MergeMerge)},
+			code:     http.StatusMethodNotAllowed,
+			message:  "Merge commits are not allowed on this repository.",
+			expected: MergeCommitsForbiddenError("Merge commits are not allowed on this repository."),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPut {
+					t.Errorf("Bad method: %s", r.Method)
+				}
+				if r.URL.Path != "/repos/k8s/kuber/pulls/5/merge" {
+					t.Errorf("Bad request path: %s", r.URL.Path)
+				}
+				b, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Fatalf("Could not read request body: %v", err)
+				}
+				var details MergeDetails
+				if err := json.Unmarshal(b, &details); err != nil {
+					t.Errorf("Could not unmarshal request: %v", err)
+				} else if details != tc.details {
+					t.Errorf("Expected merge details %+v, got %+v", tc.details, details)
+				}
+				w.WriteHeader(tc.code)
+				json.NewEncoder(w).Encode(map[string]string{"message": tc.message})
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			if err := c.Merge("k8s", "kuber", 5, tc.details); err != tc.expected {
+				t.Errorf("Expected error %#v, got %#v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestETagCache(t *testing.T) {
+	// the version of each resource, which is also its ETag
+	versions := map[string]string{}
+	var fullResponses, notModified int
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := versions[r.URL.Path]
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(5000-fullResponses-notModified))
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		fmt.Fprintf(w, `{"state": %q}`, etag)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CacheETags(2); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	hits := func() float64 {
+		var m dto.Metric
+		if err := etagCacheHits.Write(&m); err != nil {
+			t.Fatalf("Failed to read the cache hits: %v", err)
+		}
+		return m.GetCounter().GetValue()
+	}
+	initialHits := hits()
+
+	steps := []struct {
+		name                string
+		version             string
+		ref                 string
+		expectedState       string
+		expectedFull        int
+		expectedNotModified int
+	}{
+		{
+			name:          "first request is cached",
+			version:       "v1",
+			ref:           "a",
+			expectedState: "v1",
+			expectedFull:  1,
+		},
+		{
+			name:                "unchanged status is served from the cache",
+			version:             "v1",
+			ref:                 "a",
+			expectedState:       "v1",
+			expectedFull:        1,
+			expectedNotModified: 1,
+		},
+		{
+			name:                "changed status is fetched again",
+			version:             "v2",
+			ref:                 "a",
+			expectedState:       "v2",
+			expectedFull:        2,
+			expectedNotModified: 1,
+		},
+		{
+			name:                "new version is cached",
+			version:             "v2",
+			ref:                 "a",
+			expectedState:       "v2",
+			expectedFull:        2,
+			expectedNotModified: 2,
+		},
+		{
+			name:                "other refs are cached separately",
+			version:             "v1",
+			ref:                 "b",
+			expectedState:       "v1",
+			expectedFull:        3,
+			expectedNotModified: 2,
+		},
+		{
+			name:                "third ref evicts the least recently used",
+			version:             "v1",
+			ref:                 "c",
+			expectedState:       "v1",
+			expectedFull:        4,
+			expectedNotModified: 2,
+		},
+		{
+			name:                "evicted ref is fetched again",
+			version:             "v2",
+			ref:                 "a",
+			expectedState:       "v2",
+			expectedFull:        5,
+			expectedNotModified: 2,
+		},
+		{
+			name:                "fetched ref is cached again",
+			version:             "v2",
+			ref:                 "a",
+			expectedState:       "v2",
+			expectedFull:        5,
+			expectedNotModified: 3,
+		},
+	}
+	for _, step := range steps {
+		versions["/repos/k8s/kuber/commits/"+step.ref+"/status"] = step.version
+		combined, err := c.GetCombinedStatus("k8s", "kuber", step.ref)
+		if err != nil {
+			t.Fatalf("%s: didn't expect error: %v", step.name, err)
+		}
+		if combined.State != step.expectedState {
+			t.Errorf("%s: expected state %q, got %q", step.name, step.expectedState, combined.State)
+		}
+		if fullResponses != step.expectedFull || notModified != step.expectedNotModified {
+			t.Errorf("%s: expected %d full and %d not modified responses, got %d and %d", step.name, step.expectedFull, step.expectedNotModified, fullResponses, notModified)
+		}
+		if actual := hits() - initialHits; actual != float64(step.expectedNotModified) {
+			t.Errorf("%s: expected %d cache hits, got %v", step.name, step.expectedNotModified, actual)
+		}
+	}
+	// the last request was answered with a 304
+	if expected, actual := 5000-fullResponses-notModified+1, c.RateLimitRemaining(); actual != expected {
+		t.Errorf("expected the rate limit of the last response, %d, got %d", expected, actual)
+	}
+
+	versions["/repos/k8s/kuber/pulls/1"] = "v1"
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetPullRequest("k8s", "kuber", 1); err != nil {
+			t.Fatalf("didn't expect error: %v", err)
+		}
+	}
+	if notModified != 3 {
+		t.Errorf("expected pull requests to bypass the cache, got %d not modified responses", notModified-3)
+	}
+}
+
+func TestCacheableETag(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected bool
+	}{
+		{path: "/repos/k8s/kuber/commits/abcdef/status", expected: true},
+		{path: "/repos/k8s/kuber/pulls", expected: true},
+		{path: "/repos/k8s/kuber/pulls/1/files", expected: true},
+		{path: "/repos/k8s/kuber/pulls/1", expected: false},
+		{path: "/api/v3/repos/k8s/kuber/pulls/1", expected: false},
+		{path: "/search/issues", expected: false},
+	}
+	for _, tc := range testCases {
+		if actual := cacheableETag(tc.path); actual != tc.expected {
+			t.Errorf("%s: expected cacheable %t, got %t", tc.path, tc.expected, actual)
+		}
+	}
+}
+
+func TestCreateStatusSanitized(t *testing.T) {
+	var actual Status
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&actual); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		}
+		http.Error(w, "201 Created", http.StatusCreated)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+
+	testCases := []struct {
+		name     string
+		status   Status
+		expected Status
+	}{
+		{
+			name:     "valid status is not changed",
+			status:   Status{Context: "c", Description: "Job succeeded.", TargetURL: "https://prow.k8s.io/log?job=c"},
+			expected: Status{Context: "c", Description: "Job succeeded.", TargetURL: "https://prow.k8s.io/log?job=c"},
+		},
+		{
+			name:     "line breaks and control characters are removed",
+			status:   Status{Context: "c", Description: "Pod failed:\nexit\tcode 1\x00\x1b[0m"},
+			expected: Status{Context: "c", Description: "Pod failed: exit code 1[0m"},
+		},
+		{
+			name:     "long description is cut after its beginning",
+			status:   Status{Context: "c", Description: strings.Repeat("a", 100) + strings.Repeat("b", 100)},
+			expected: Status{Context: "c", Description: strings.Repeat("a", 100) + strings.Repeat("b", 39) + "…"},
+		},
+		{
+			name:     "relative target URL is dropped",
+			status:   Status{Context: "c", TargetURL: "/log?job=c"},
+			expected: Status{Context: "c"},
+		},
+		{
+			name:     "malformed target URL is dropped",
+			status:   Status{Context: "c", TargetURL: "https://prow.k8s.io/%zz"},
+			expected: Status{Context: "c"},
+		},
+	}
+	for _, tc := range testCases {
+		actual = Status{}
+		if err := c.CreateStatus("k8s", "kuber", "abcdef", tc.status); err != nil {
+			t.Errorf("%s: didn't expect error: %v", tc.name, err)
+		}
+		if actual != tc.expected {
+			t.Errorf("%s: expected status %+v, got %+v", tc.name, tc.expected, actual)
 		}
-		http.Error(w, "204 No Content", http.StatusNoContent)
-	}))
-	defer ts.Close()
-	c := getClient(ts.URL)
-	if err := c.DeleteRef("k8s", "kuber", "heads/my-feature"); err != nil {
-		t.Errorf("Didn't expect error: %v", err)
 	}
 }
 
-func TestGetSingleCommit(t *testing.T) {
-	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			t.Errorf("Bad method: %s", r.Method)
+func TestSanitizeDescription(t *testing.T) {
+	testCases := []struct {
+		name     string
+		in       string
+		expected string
+	}{
+		{
+			name:     "short multi-byte description is kept",
+			in:       strings.Repeat("日", maxStatusDescriptionLength),
+			expected: strings.Repeat("日", maxStatusDescriptionLength),
+		},
+		{
+			name:     "long multi-byte description is cut between characters",
+			in:       strings.Repeat("ü", maxStatusDescriptionLength+1),
+			expected: strings.Repeat("ü", maxStatusDescriptionLength-1) + "…",
+		},
+		{
+			name:     "emoji are not split",
+			in:       strings.Repeat("x", maxStatusDescriptionLength-2) + "🙈🙉🙊",
+			expected: strings.Repeat("x", maxStatusDescriptionLength-2) + "🙈…",
+		},
+	}
+	for _, tc := range testCases {
+		actual := sanitizeDescription(tc.in)
+		if actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, actual)
 		}
-		if r.URL.Path != "/repos/octocat/Hello-World/commits/6dcb09b5b57875f334f61aebed695e2e4193db5e" {
-			t.Errorf("Bad request path: %s", r.URL.Path)
+		if !utf8.ValidString(actual) || utf8.RuneCountInString(actual) > maxStatusDescriptionLength {
+			t.Errorf("%s: expected valid UTF-8 of at most %d characters, got %q", tc.name, maxStatusDescriptionLength, actual)
 		}
-		fmt.Fprint(w, `{
-			"commit": {
-			  "tree": {
-				"sha": "6dcb09b5b57875f334f61aebed695e2e4193db5e"
-			  }
-		        }
-		  }`)
-	}))
-	defer ts.Close()
-	c := getClient(ts.URL)
-	commit, err := c.GetSingleCommit("octocat", "Hello-World", "6dcb09b5b57875f334f61aebed695e2e4193db5e")
-	if err != nil {
-		t.Errorf("Didn't expect error: %v", err)
-	} else if commit.Commit.Tree.SHA != "6dcb09b5b57875f334f61aebed695e2e4193db5e" {
-		t.Errorf("Wrong tree-hash: %s", commit.Commit.Tree.SHA)
 	}
 }
 
-func TestCreateStatus(t *testing.T) {
+func TestCreateStatusCache(t *testing.T) {
+	var requests int
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			t.Errorf("Bad method: %s", r.Method)
-		}
-		if r.URL.Path != "/repos/k8s/kuber/statuses/abcdef" {
-			t.Errorf("Bad request path: %s", r.URL.Path)
-		}
-		b, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			t.Fatalf("Could not read request body: %v", err)
-		}
-		var s Status
-		if err := json.Unmarshal(b, &s); err != nil {
-			t.Errorf("Could not unmarshal request: %v", err)
-		} else if s.Context != "c" {
-			t.Errorf("Wrong context: %s", s.Context)
+		if r.URL.Path == "/user" {
+			fmt.Fprint(w, `{"login": "new-bot"}`)
+			return
 		}
+		requests++
 		http.Error(w, "201 Created", http.StatusCreated)
 	}))
 	defer ts.Close()
 	c := getClient(ts.URL)
-	if err := c.CreateStatus("k8s", "kuber", "abcdef", Status{
-		Context: "c",
-	}); err != nil {
-		t.Errorf("Didn't expect error: %v", err)
+	if err := c.CacheStatuses(2); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+
+	pending := Status{Context: "c", State: "pending", Description: "Job triggered."}
+	running := Status{Context: "c", State: "pending", Description: "Job running."}
+	steps := []struct {
+		name             string
+		do               func() error
+		expectedRequests int
+	}{
+		{
+			name:             "new status is set",
+			do:               func() error { return c.CreateStatus("k8s", "kuber", "abcdef", pending) },
+			expectedRequests: 1,
+		},
+		{
+			name:             "identical status is skipped",
+			do:               func() error { return c.CreateStatus("k8s", "kuber", "abcdef", pending) },
+			expectedRequests: 1,
+		},
+		{
+			name:             "changed description is set",
+			do:               func() error { return c.CreateStatus("k8s", "kuber", "abcdef", running) },
+			expectedRequests: 2,
+		},
+		{
+			name:             "identical status on another commit is set",
+			do:               func() error { return c.CreateStatus("k8s", "kuber", "123456", running) },
+			expectedRequests: 3,
+		},
+		{
+			name:             "forced identical status is set",
+			do:               func() error { return c.CreateStatusForce("k8s", "kuber", "abcdef", running) },
+			expectedRequests: 4,
+		},
+		{
+			name: "identical status is set after the bot name changes",
+			do: func() error {
+				if botName, err := c.BotName(); err != nil {
+					return err
+				} else if botName != "new-bot" {
+					t.Errorf("Expected bot name new-bot, got %s", botName)
+				}
+				return c.CreateStatus("k8s", "kuber", "abcdef", running)
+			},
+			expectedRequests: 5,
+		},
+		{
+			name: "identical status is set once evicted",
+			do: func() error {
+				if err := c.CreateStatus("k8s", "kuber", "abcdef", Status{Context: "d"}); err != nil {
+					return err
+				}
+				if err := c.CreateStatus("k8s", "kuber", "abcdef", Status{Context: "e"}); err != nil {
+					return err
+				}
+				return c.CreateStatus("k8s", "kuber", "abcdef", running)
+			},
+			expectedRequests: 8,
+		},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: didn't expect error: %v", step.name, err)
+		}
+		if requests != step.expectedRequests {
+			t.Errorf("%s: expected %d requests in total, got %d", step.name, step.expectedRequests, requests)
+		}
 	}
 }
 
@@ -525,6 +1632,90 @@ func TestRemoveLabelNotFound(t *testing.T) {
 	}
 }
 
+func TestRemoveLabelEscapesSlashes(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path := r.URL.EscapedPath(); path != "/repos/k8s/kuber/issues/5/labels/area%2Fkubelet" {
+			t.Errorf("Bad request path: %s", path)
+		}
+		http.Error(w, "204 No Content", http.StatusNoContent)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.RemoveLabel("k8s", "kuber", 5, "area/kubelet"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestAddLabelNotFound(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Validation Failed"}`, http.StatusUnprocessableEntity)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	err := c.AddLabel("k8s", "kuber", 5, "area/kubelet")
+	if _, ok := err.(*LabelNotFound); !ok {
+		t.Errorf("Expected a *LabelNotFound error, got: %v", err)
+	}
+}
+
+func TestAddLabelOrCreate(t *testing.T) {
+	testCases := []struct {
+		name             string
+		labelExists      bool
+		expectedRequests []string
+	}{
+		{
+			name:             "existing label is added",
+			labelExists:      true,
+			expectedRequests: []string{"POST /repos/k8s/kuber/issues/5/labels"},
+		},
+		{
+			name: "missing label is created and added",
+			expectedRequests: []string{
+				"POST /repos/k8s/kuber/issues/5/labels",
+				"POST /repos/k8s/kuber/labels",
+				"POST /repos/k8s/kuber/issues/5/labels",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			labelExists := tc.labelExists
+			var requests []string
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				switch r.URL.Path {
+				case "/repos/k8s/kuber/labels":
+					var label Label
+					if err := json.NewDecoder(r.Body).Decode(&label); err != nil {
+						t.Errorf("Could not unmarshal request: %v", err)
+					} else if label.Name != "area/kubelet" || label.Color != "0052cc" {
+						t.Errorf("Wrong label: %+v", label)
+					}
+					labelExists = true
+					w.WriteHeader(http.StatusCreated)
+				case "/repos/k8s/kuber/issues/5/labels":
+					if !labelExists {
+						http.Error(w, `{"message": "Validation Failed"}`, http.StatusUnprocessableEntity)
+						return
+					}
+					fmt.Fprint(w, `[{"name": "area/kubelet"}]`)
+				default:
+					t.Errorf("Bad request path: %s", r.URL.Path)
+				}
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			if err := c.AddLabelOrCreate("k8s", "kuber", 5, "area/kubelet", "0052cc"); err != nil {
+				t.Errorf("Didn't expect error: %v", err)
+			}
+			if !reflect.DeepEqual(requests, tc.expectedRequests) {
+				t.Errorf("Expected requests %v, got %v", tc.expectedRequests, requests)
+			}
+		})
+	}
+}
+
 func TestAssignIssue(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -743,6 +1934,51 @@ func TestListReviews(t *testing.T) {
 	}
 }
 
+func TestCreateReview(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/pulls/15/reviews" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("Could not read request body: %v", err)
+		}
+		var review map[string]interface{}
+		if err := json.Unmarshal(b, &review); err != nil {
+			t.Errorf("Could not unmarshal request: %v", err)
+		} else if review["body"] != "looks good" || review["event"] != "APPROVE" {
+			t.Errorf("Wrong review: %v", review)
+		}
+		fmt.Fprint(w, `{"id": 1, "state": "APPROVED"}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if err := c.CreateReview("k8s", "kuber", 15, DraftReview{Body: "looks good", Action: Approve}); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
+func TestReviewUnmarshal(t *testing.T) {
+	var reviews []Review
+	payload := `[
+	{"id": 1, "user": {"login": "alice"}, "body": "lgtm", "state": "APPROVED", "submitted_at": "2019-04-01T10:00:00Z"},
+	{"id": 2, "user": {"login": "bob"}, "state": "CHANGES_REQUESTED", "submitted_at": "2019-04-02T10:00:00Z"}
+]`
+	if err := json.Unmarshal([]byte(payload), &reviews); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	expected := []Review{
+		{ID: 1, User: User{Login: "alice"}, Body: "lgtm", State: ReviewStateApproved, SubmittedAt: time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)},
+		{ID: 2, User: User{Login: "bob"}, State: ReviewStateChangesRequested, SubmittedAt: time.Date(2019, 4, 2, 10, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(reviews, expected) {
+		t.Errorf("Expected reviews %+v, got %+v", expected, reviews)
+	}
+}
+
 func TestPrepareReviewersBody(t *testing.T) {
 	var tests = []struct {
 		name         string
@@ -903,6 +2139,54 @@ func TestUnrequestReview(t *testing.T) {
 	}
 }
 
+func TestCreateIssue(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/repos/k8s/kuber/issues" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		var data struct {
+			Title     string   `json:"title"`
+			Body      string   `json:"body"`
+			Labels    []string `json:"labels"`
+			Assignees []string `json:"assignees"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			t.Fatalf("Could not unmarshal request: %v", err)
+		}
+		if data.Title != "flaky job" || data.Body != "it failed" {
+			t.Errorf("Wrong title or body: %q, %q", data.Title, data.Body)
+		}
+		if expected := []string{"kind/flake", "priority/important-soon"}; !reflect.DeepEqual(data.Labels, expected) {
+			t.Errorf("Expected labels %v, got %v", expected, data.Labels)
+		}
+		w.WriteHeader(http.StatusCreated)
+		// GitHub silently drops assignees that cannot be assigned.
+		json.NewEncoder(w).Encode(Issue{
+			Number:    42,
+			Assignees: []User{{Login: "George"}},
+		})
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	number, err := c.CreateIssue("k8s", "kuber", "flaky job", "it failed", []string{"kind/flake", "priority/important-soon"}, []string{"george"})
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if number != 42 {
+		t.Errorf("Expected issue 42, got %d", number)
+	}
+	number, err = c.CreateIssue("k8s", "kuber", "flaky job", "it failed", []string{"kind/flake", "priority/important-soon"}, []string{"george", "stranger"})
+	if merr, ok := err.(MissingUsers); !ok || !reflect.DeepEqual(merr.Users, []string{"stranger"}) {
+		t.Errorf("Expected stranger to be missing, got %v", err)
+	}
+	if number != 42 {
+		t.Errorf("Expected issue 42 even if some assignees are missing, got %d", number)
+	}
+}
+
 func TestCloseIssue(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPatch {
@@ -1086,6 +2370,119 @@ func TestFindIssues(t *testing.T) {
 	}
 }
 
+func TestFindIssuesQueryEncoding(t *testing.T) {
+	queries := []string{
+		"repo:k8s/kuber is:open",
+		`repo:k8s/kuber label:"needs rebase"`,
+		"is:pr created:2019-01-01..2019-02-01 updated:<2019-03-01",
+		"org:k8s author:someone+else #5 & more",
+	}
+	for _, query := range queries {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			values, err := url.ParseQuery(r.URL.RawQuery)
+			if err != nil {
+				t.Errorf("%s: could not parse query: %v", query, err)
+			}
+			if actual := values.Get("q"); actual != query {
+				t.Errorf("expected query %q, got %q from %s", query, actual, r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"total_count": 0, "items": []}`)
+		}))
+		c := getClient(ts.URL)
+		if _, err := c.FindIssues(query, "", false); err != nil {
+			t.Errorf("%s: didn't expect error: %v", query, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestFindIssuesPaginated(t *testing.T) {
+	testCases := []struct {
+		name           string
+		total          int
+		expectedErr    bool
+		expectedIssues int
+	}{
+		{
+			name:           "all results are returned",
+			total:          150,
+			expectedIssues: 150,
+		},
+		{
+			name:           "results past the cap are reported",
+			total:          2500,
+			expectedErr:    true,
+			expectedIssues: 150,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page := func(from, to int) IssuesSearchResult {
+				result := IssuesSearchResult{Total: tc.total}
+				for i := from; i < to; i++ {
+					result.Issues = append(result.Issues, Issue{Number: i})
+				}
+				return result
+			}
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var result IssuesSearchResult
+				switch r.URL.Query().Get("page") {
+				case "":
+					if perPage := r.URL.Query().Get("per_page"); perPage != "100" {
+						t.Errorf("Expected 100 results per page, got %q", perPage)
+					}
+					result = page(0, 100)
+					w.Header().Set("Link", fmt.Sprintf(`<https://%s/search/issues?q=is%%3Aopen&per_page=100&page=2>; rel="next"`, r.Host))
+				case "2":
+					result = page(100, 150)
+				default:
+					t.Errorf("Bad request: %s", r.URL.RequestURI())
+				}
+				b, err := json.Marshal(result)
+				if err != nil {
+					t.Fatalf("Didn't expect error: %v", err)
+				}
+				fmt.Fprint(w, string(b))
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			issues, err := c.FindIssues("is:open", "", false)
+			if tc.expectedErr {
+				if truncated, ok := err.(*SearchResultsTruncated); !ok {
+					t.Errorf("Expected a *SearchResultsTruncated error, got: %v", err)
+				} else if truncated.Total != tc.total {
+					t.Errorf("Expected a total of %d, got %d", tc.total, truncated.Total)
+				}
+			} else if err != nil {
+				t.Errorf("Didn't expect error: %v", err)
+			}
+			if len(issues) != tc.expectedIssues {
+				t.Fatalf("Expected %d issues, got %d", tc.expectedIssues, len(issues))
+			}
+			for i, issue := range issues {
+				if issue.Number != i {
+					t.Errorf("Expected issue %d at index %d, got %d", i, i, issue.Number)
+				}
+			}
+		})
+	}
+}
+
+func TestFindIssuesRateLimit(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "29")
+		fmt.Fprint(w, `{"total_count": 0, "items": []}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	if _, err := c.FindIssues("is:open", "", false); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if remaining := c.RateLimitRemaining(); remaining != -1 {
+		t.Errorf("Expected the search rate limit not to count as the core one, got %d remaining", remaining)
+	}
+}
+
 func TestGetFile(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -1477,6 +2874,89 @@ func TestGetBranches(t *testing.T) {
 	}
 }
 
+func TestGetBranchProtection(t *testing.T) {
+	yes := true
+	cases := []struct {
+		name     string
+		code     int
+		body     string
+		expected *BranchProtectionRequest
+	}{
+		{
+			name: "protected",
+			code: http.StatusOK,
+			body: `{
+  "required_status_checks": {"strict": true, "contexts": ["unit", "lint"]},
+  "enforce_admins": {"enabled": true},
+  "required_pull_request_reviews": {
+    "dismissal_restrictions": {"users": [{"login": "bob"}], "teams": []},
+    "required_approving_review_count": 2
+  },
+  "restrictions": {"users": [], "teams": [{"slug": "movers"}, {"slug": "admins"}]}
+}`,
+			expected: &BranchProtectionRequest{
+				RequiredStatusChecks: &RequiredStatusChecks{
+					Strict:   true,
+					Contexts: []string{"lint", "unit"},
+				},
+				EnforceAdmins: &yes,
+				RequiredPullRequestReviews: &RequiredPullRequestReviews{
+					DismissalRestrictions: Restrictions{
+						Users: &[]string{"bob"},
+						Teams: &[]string{},
+					},
+					RequiredApprovingReviewCount: 2,
+				},
+				Restrictions: &Restrictions{
+					Users: &[]string{},
+					Teams: &[]string{"admins", "movers"},
+				},
+			},
+		},
+		{
+			name:     "minimally protected",
+			code:     http.StatusOK,
+			body:     `{"enforce_admins": {"enabled": false}}`,
+			expected: &BranchProtectionRequest{},
+		},
+		{
+			name: "not protected",
+			code: http.StatusNotFound,
+			body: `{"message": "Branch not protected"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					t.Errorf("Bad method: %s", r.Method)
+				}
+				if r.URL.Path != "/repos/org/repo/branches/master/protection" {
+					t.Errorf("Bad request path: %s", r.URL.Path)
+				}
+				w.WriteHeader(tc.code)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer ts.Close()
+			c := getClient(ts.URL)
+			c.time = &testTime{now: time.Now()}
+			bp, err := c.GetBranchProtection("org", "repo", "master")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var actual *BranchProtectionRequest
+			if bp != nil {
+				req := bp.Request()
+				actual = &req
+			}
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("expected protection %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
 func TestRemoveBranchProtection(t *testing.T) {
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
@@ -1718,3 +3198,52 @@ func TestCombinedStatus(t *testing.T) {
 		t.Errorf("Wrong review IDs: %v", combined.Statuses)
 	}
 }
+
+func TestCombinedStatusManyPages(t *testing.T) {
+	var first, second []Status
+	for i := 0; i < 100; i++ {
+		first = append(first, Status{Context: fmt.Sprintf("context-%d", i), State: "success"})
+	}
+	// a status set while paging moves the context on to the next page
+	second = append(second, Status{Context: "context-99", State: "failure"})
+	for i := 100; i < 150; i++ {
+		second = append(second, Status{Context: fmt.Sprintf("context-%d", i), State: "success"})
+	}
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var statuses []Status
+		switch r.URL.Path {
+		case "/repos/k8s/kuber/commits/SHA/status":
+			statuses = first
+			w.Header().Set("Link", fmt.Sprintf(`<https://%s/someotherpath>; rel="next"`, r.Host))
+		case "/someotherpath":
+			statuses = second
+		default:
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		b, err := json.Marshal(CombinedStatus{SHA: "SHA", State: "pending", Statuses: statuses})
+		if err != nil {
+			t.Fatalf("Didn't expect error: %v", err)
+		}
+		fmt.Fprint(w, string(b))
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	combined, err := c.GetCombinedStatus("k8s", "kuber", "SHA")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if combined.State != "pending" {
+		t.Errorf("Expected state pending, found %s", combined.State)
+	}
+	if len(combined.Statuses) != 150 {
+		t.Fatalf("Expected 150 statuses, found %d", len(combined.Statuses))
+	}
+	for i, status := range combined.Statuses {
+		if expected := fmt.Sprintf("context-%d", i); status.Context != expected {
+			t.Errorf("Expected status %d to have context %s, found %s", i, expected, status.Context)
+		}
+	}
+	if state := combined.Statuses[99].State; state != "success" {
+		t.Errorf("Expected the first status seen for context-99 to be kept, found state %s", state)
+	}
+}
@@ -19,6 +19,7 @@ package fakegithub
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/github"
@@ -81,17 +82,30 @@ type FakeClient struct {
 	// and values map SHA to content
 	RemoteFiles map[string]map[string]string
 
+	// A list of refs that got created via CreateRef
+	RefsCreated []struct{ Org, Repo, Ref, SHA string }
+
 	// A list of refs that got deleted via DeleteRef
 	RefsDeleted []struct{ Org, Repo, Ref string }
+
+	// Errors are returned by the methods named by their keys, for
+	// testing how the callers handle failures.
+	Errors map[string]error
 }
 
 // BotName returns authenticated login.
 func (f *FakeClient) BotName() (string, error) {
+	if err := f.Errors["BotName"]; err != nil {
+		return "", err
+	}
 	return botName, nil
 }
 
 // IsMember returns true if user is in org.
 func (f *FakeClient) IsMember(org, user string) (bool, error) {
+	if err := f.Errors["IsMember"]; err != nil {
+		return false, err
+	}
 	for _, m := range f.OrgMembers[org] {
 		if m == user {
 			return true, nil
@@ -102,27 +116,45 @@ func (f *FakeClient) IsMember(org, user string) (bool, error) {
 
 // ListIssueComments returns comments.
 func (f *FakeClient) ListIssueComments(owner, repo string, number int) ([]github.IssueComment, error) {
+	if err := f.Errors["ListIssueComments"]; err != nil {
+		return nil, err
+	}
 	return append([]github.IssueComment{}, f.IssueComments[number]...), nil
 }
 
 // ListPullRequestComments returns review comments.
 func (f *FakeClient) ListPullRequestComments(owner, repo string, number int) ([]github.ReviewComment, error) {
+	if err := f.Errors["ListPullRequestComments"]; err != nil {
+		return nil, err
+	}
 	return append([]github.ReviewComment{}, f.PullRequestComments[number]...), nil
 }
 
 // ListReviews returns reviews.
 func (f *FakeClient) ListReviews(owner, repo string, number int) ([]github.Review, error) {
+	if err := f.Errors["ListReviews"]; err != nil {
+		return nil, err
+	}
 	return append([]github.Review{}, f.Reviews[number]...), nil
 }
 
 // ListIssueEvents returns issue events
 func (f *FakeClient) ListIssueEvents(owner, repo string, number int) ([]github.ListedIssueEvent, error) {
+	if err := f.Errors["ListIssueEvents"]; err != nil {
+		return nil, err
+	}
 	return append([]github.ListedIssueEvent{}, f.IssueEvents[number]...), nil
 }
 
 // CreateComment adds a comment to a PR
 func (f *FakeClient) CreateComment(owner, repo string, number int, comment string) error {
+	if err := f.Errors["CreateComment"]; err != nil {
+		return err
+	}
 	f.IssueCommentsAdded = append(f.IssueCommentsAdded, fmt.Sprintf("%s/%s#%d:%s", owner, repo, number, comment))
+	if f.IssueComments == nil {
+		f.IssueComments = make(map[int][]github.IssueComment)
+	}
 	f.IssueComments[number] = append(f.IssueComments[number], github.IssueComment{
 		ID:   f.IssueCommentID,
 		Body: comment,
@@ -134,6 +166,12 @@ func (f *FakeClient) CreateComment(owner, repo string, number int, comment strin
 
 // CreateReview adds a review to a PR
 func (f *FakeClient) CreateReview(org, repo string, number int, r github.DraftReview) error {
+	if err := f.Errors["CreateReview"]; err != nil {
+		return err
+	}
+	if f.Reviews == nil {
+		f.Reviews = make(map[int][]github.Review)
+	}
 	f.Reviews[number] = append(f.Reviews[number], github.Review{
 		ID:   f.ReviewID,
 		User: github.User{Login: botName},
@@ -145,18 +183,27 @@ func (f *FakeClient) CreateReview(org, repo string, number int, r github.DraftRe
 
 // CreateCommentReaction adds emoji to a comment.
 func (f *FakeClient) CreateCommentReaction(org, repo string, ID int, reaction string) error {
+	if err := f.Errors["CreateCommentReaction"]; err != nil {
+		return err
+	}
 	f.CommentReactionsAdded = append(f.CommentReactionsAdded, fmt.Sprintf("%s/%s#%d:%s", org, repo, ID, reaction))
 	return nil
 }
 
 // CreateIssueReaction adds an emoji to an issue.
 func (f *FakeClient) CreateIssueReaction(org, repo string, ID int, reaction string) error {
+	if err := f.Errors["CreateIssueReaction"]; err != nil {
+		return err
+	}
 	f.IssueReactionsAdded = append(f.IssueReactionsAdded, fmt.Sprintf("%s/%s#%d:%s", org, repo, ID, reaction))
 	return nil
 }
 
 // DeleteComment deletes a comment.
 func (f *FakeClient) DeleteComment(owner, repo string, ID int) error {
+	if err := f.Errors["DeleteComment"]; err != nil {
+		return err
+	}
 	f.IssueCommentsDeleted = append(f.IssueCommentsDeleted, fmt.Sprintf("%s/%s#%d", owner, repo, ID))
 	for num, ics := range f.IssueComments {
 		for i, ic := range ics {
@@ -169,8 +216,48 @@ func (f *FakeClient) DeleteComment(owner, repo string, ID int) error {
 	return fmt.Errorf("could not find issue comment %d", ID)
 }
 
+// EditComment changes the body of a comment.
+func (f *FakeClient) EditComment(owner, repo string, ID int, comment string) error {
+	if err := f.Errors["EditComment"]; err != nil {
+		return err
+	}
+	for num, ics := range f.IssueComments {
+		for i, ic := range ics {
+			if ic.ID == ID {
+				f.IssueComments[num][i].Body = comment
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("could not find issue comment %d", ID)
+}
+
+// EditOrCreateComment edits the newest bot comment that contains the
+// marker, or creates one.
+func (f *FakeClient) EditOrCreateComment(owner, repo string, number int, marker, body string) error {
+	if err := f.Errors["EditOrCreateComment"]; err != nil {
+		return err
+	}
+	if !strings.Contains(body, marker) {
+		body += "\n" + marker
+	}
+	existing := -1
+	for _, ic := range f.IssueComments[number] {
+		if ic.User.Login == botName && strings.Contains(ic.Body, marker) && ic.ID > existing {
+			existing = ic.ID
+		}
+	}
+	if existing < 0 {
+		return f.CreateComment(owner, repo, number, body)
+	}
+	return f.EditComment(owner, repo, existing, body)
+}
+
 // DeleteStaleComments deletes comments flagged by isStale.
 func (f *FakeClient) DeleteStaleComments(org, repo string, number int, comments []github.IssueComment, isStale func(github.IssueComment) bool) error {
+	if err := f.Errors["DeleteStaleComments"]; err != nil {
+		return err
+	}
 	if comments == nil {
 		comments, _ = f.ListIssueComments(org, repo, number)
 	}
@@ -186,6 +273,9 @@ func (f *FakeClient) DeleteStaleComments(org, repo string, number int, comments
 
 // GetPullRequest returns details about the PR.
 func (f *FakeClient) GetPullRequest(owner, repo string, number int) (*github.PullRequest, error) {
+	if err := f.Errors["GetPullRequest"]; err != nil {
+		return nil, err
+	}
 	val, exists := f.PullRequests[number]
 	if !exists {
 		return nil, fmt.Errorf("Pull request number %d does not exit", number)
@@ -195,27 +285,51 @@ func (f *FakeClient) GetPullRequest(owner, repo string, number int) (*github.Pul
 
 // GetPullRequestChanges returns the file modifications in a PR.
 func (f *FakeClient) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	if err := f.Errors["GetPullRequestChanges"]; err != nil {
+		return nil, err
+	}
 	return f.PullRequestChanges[number], nil
 }
 
 // GetRef returns the hash of a ref.
 func (f *FakeClient) GetRef(owner, repo, ref string) (string, error) {
+	if err := f.Errors["GetRef"]; err != nil {
+		return "", err
+	}
 	return TestRef, nil
 }
 
+// CreateRef records the created ref.
+func (f *FakeClient) CreateRef(owner, repo, ref, sha string) error {
+	if err := f.Errors["CreateRef"]; err != nil {
+		return err
+	}
+	f.RefsCreated = append(f.RefsCreated, struct{ Org, Repo, Ref, SHA string }{Org: owner, Repo: repo, Ref: ref, SHA: sha})
+	return nil
+}
+
 // DeleteRef returns an error indicating if deletion of the given ref was successful
 func (f *FakeClient) DeleteRef(owner, repo, ref string) error {
+	if err := f.Errors["DeleteRef"]; err != nil {
+		return err
+	}
 	f.RefsDeleted = append(f.RefsDeleted, struct{ Org, Repo, Ref string }{Org: owner, Repo: repo, Ref: ref})
 	return nil
 }
 
 // GetSingleCommit returns a single commit.
 func (f *FakeClient) GetSingleCommit(org, repo, SHA string) (github.SingleCommit, error) {
+	if err := f.Errors["GetSingleCommit"]; err != nil {
+		return github.SingleCommit{}, err
+	}
 	return f.Commits[SHA], nil
 }
 
 // CreateStatus adds a status context to a commit.
 func (f *FakeClient) CreateStatus(owner, repo, SHA string, s github.Status) error {
+	if err := f.Errors["CreateStatus"]; err != nil {
+		return err
+	}
 	if f.CreatedStatuses == nil {
 		f.CreatedStatuses = make(map[string][]github.Status)
 	}
@@ -236,16 +350,25 @@ func (f *FakeClient) CreateStatus(owner, repo, SHA string, s github.Status) erro
 
 // ListStatuses returns individual status contexts on a commit.
 func (f *FakeClient) ListStatuses(org, repo, ref string) ([]github.Status, error) {
+	if err := f.Errors["ListStatuses"]; err != nil {
+		return nil, err
+	}
 	return f.CreatedStatuses[ref], nil
 }
 
 // GetCombinedStatus returns the overall status for a commit.
 func (f *FakeClient) GetCombinedStatus(owner, repo, ref string) (*github.CombinedStatus, error) {
+	if err := f.Errors["GetCombinedStatus"]; err != nil {
+		return nil, err
+	}
 	return f.CombinedStatuses[ref], nil
 }
 
 // GetRepoLabels gets labels in a repo.
 func (f *FakeClient) GetRepoLabels(owner, repo string) ([]github.Label, error) {
+	if err := f.Errors["GetRepoLabels"]; err != nil {
+		return nil, err
+	}
 	la := []github.Label{}
 	for _, l := range f.RepoLabelsExisting {
 		la = append(la, github.Label{Name: l})
@@ -255,6 +378,9 @@ func (f *FakeClient) GetRepoLabels(owner, repo string) ([]github.Label, error) {
 
 // GetIssueLabels gets labels on an issue
 func (f *FakeClient) GetIssueLabels(owner, repo string, number int) ([]github.Label, error) {
+	if err := f.Errors["GetIssueLabels"]; err != nil {
+		return nil, err
+	}
 	re := regexp.MustCompile(fmt.Sprintf(`^%s/%s#%d:(.*)$`, owner, repo, number))
 	la := []github.Label{}
 	allLabels := sets.NewString(f.IssueLabelsExisting...)
@@ -271,6 +397,9 @@ func (f *FakeClient) GetIssueLabels(owner, repo string, number int) ([]github.La
 
 // AddLabel adds a label
 func (f *FakeClient) AddLabel(owner, repo string, number int, label string) error {
+	if err := f.Errors["AddLabel"]; err != nil {
+		return err
+	}
 	labelString := fmt.Sprintf("%s/%s#%d:%s", owner, repo, number, label)
 	if sets.NewString(f.IssueLabelsAdded...).Has(labelString) {
 		return fmt.Errorf("cannot add %v to %s/%s/#%d", label, owner, repo, number)
@@ -285,11 +414,44 @@ func (f *FakeClient) AddLabel(owner, repo string, number int, label string) erro
 			return nil
 		}
 	}
-	return fmt.Errorf("cannot add %v to %s/%s/#%d", label, owner, repo, number)
+	return &github.LabelNotFound{Owner: owner, Repo: repo, Number: number, Label: label}
+}
+
+// AddLabelOrCreate adds a label, adding it to the repo labels first if it
+// is missing.
+func (f *FakeClient) AddLabelOrCreate(owner, repo string, number int, label, color string) error {
+	if err := f.Errors["AddLabelOrCreate"]; err != nil {
+		return err
+	}
+	err := f.AddLabel(owner, repo, number, label)
+	if _, missing := err.(*github.LabelNotFound); !missing {
+		return err
+	}
+	if err := f.AddRepoLabel(owner, repo, label, "", color); err != nil {
+		return err
+	}
+	return f.AddLabel(owner, repo, number, label)
+}
+
+// AddRepoLabel adds a label to the repo labels.
+func (f *FakeClient) AddRepoLabel(owner, repo, label, description, color string) error {
+	if err := f.Errors["AddRepoLabel"]; err != nil {
+		return err
+	}
+	for _, l := range f.RepoLabelsExisting {
+		if label == l {
+			return fmt.Errorf("label %s already exists on %s/%s", label, owner, repo)
+		}
+	}
+	f.RepoLabelsExisting = append(f.RepoLabelsExisting, label)
+	return nil
 }
 
 // RemoveLabel removes a label
 func (f *FakeClient) RemoveLabel(owner, repo string, number int, label string) error {
+	if err := f.Errors["RemoveLabel"]; err != nil {
+		return err
+	}
 	labelString := fmt.Sprintf("%s/%s#%d:%s", owner, repo, number, label)
 	if !sets.NewString(f.IssueLabelsRemoved...).Has(labelString) {
 		f.IssueLabelsRemoved = append(f.IssueLabelsRemoved, labelString)
@@ -300,11 +462,47 @@ func (f *FakeClient) RemoveLabel(owner, repo string, number int, label string) e
 
 // FindIssues returns f.Issues
 func (f *FakeClient) FindIssues(query, sort string, asc bool) ([]github.Issue, error) {
+	if err := f.Errors["FindIssues"]; err != nil {
+		return nil, err
+	}
 	return f.Issues, nil
 }
 
+// CreateIssue adds an issue to f.Issues and returns its number.
+func (f *FakeClient) CreateIssue(owner, repo, title, body string, labels, assignees []string) (int, error) {
+	if err := f.Errors["CreateIssue"]; err != nil {
+		return 0, err
+	}
+	number := 1
+	for _, issue := range f.Issues {
+		if issue.Number >= number {
+			number = issue.Number + 1
+		}
+	}
+	issue := github.Issue{Number: number, Title: title, Body: body, State: "open"}
+	for _, label := range labels {
+		issue.Labels = append(issue.Labels, github.Label{Name: label})
+	}
+	var m github.MissingUsers
+	for _, a := range assignees {
+		if a == "not-in-the-org" {
+			m.Users = append(m.Users, a)
+			continue
+		}
+		issue.Assignees = append(issue.Assignees, github.User{Login: a})
+	}
+	f.Issues = append(f.Issues, issue)
+	if m.Users == nil {
+		return number, nil
+	}
+	return number, m
+}
+
 // AssignIssue adds assignees.
 func (f *FakeClient) AssignIssue(owner, repo string, number int, assignees []string) error {
+	if err := f.Errors["AssignIssue"]; err != nil {
+		return err
+	}
 	var m github.MissingUsers
 	for _, a := range assignees {
 		if a == "not-in-the-org" {
@@ -321,6 +519,9 @@ func (f *FakeClient) AssignIssue(owner, repo string, number int, assignees []str
 
 // GetFile returns the bytes of the file.
 func (f *FakeClient) GetFile(org, repo, file, commit string) ([]byte, error) {
+	if err := f.Errors["GetFile"]; err != nil {
+		return nil, err
+	}
 	contents, ok := f.RemoteFiles[file]
 	if !ok {
 		return nil, fmt.Errorf("could not find file %s", file)
@@ -342,6 +543,9 @@ func (f *FakeClient) GetFile(org, repo, file, commit string) ([]byte, error) {
 
 // ListTeams return a list of fake teams that correspond to the fake team members returned by ListTeamMembers
 func (f *FakeClient) ListTeams(org string) ([]github.Team, error) {
+	if err := f.Errors["ListTeams"]; err != nil {
+		return nil, err
+	}
 	return []github.Team{
 		{
 			ID:   0,
@@ -356,6 +560,9 @@ func (f *FakeClient) ListTeams(org string) ([]github.Team, error) {
 
 // ListTeamMembers return a fake team with a single "sig-lead" Github teammember
 func (f *FakeClient) ListTeamMembers(teamID int, role string) ([]github.TeamMember, error) {
+	if err := f.Errors["ListTeamMembers"]; err != nil {
+		return nil, err
+	}
 	if role != github.RoleAll {
 		return nil, fmt.Errorf("unsupported role %v (only all supported)", role)
 	}
@@ -372,6 +579,9 @@ func (f *FakeClient) ListTeamMembers(teamID int, role string) ([]github.TeamMemb
 
 // IsCollaborator returns true if the user is a collaborator of the repo.
 func (f *FakeClient) IsCollaborator(org, repo, login string) (bool, error) {
+	if err := f.Errors["IsCollaborator"]; err != nil {
+		return false, err
+	}
 	normed := github.NormLogin(login)
 	for _, collab := range f.Collaborators {
 		if github.NormLogin(collab) == normed {
@@ -383,6 +593,9 @@ func (f *FakeClient) IsCollaborator(org, repo, login string) (bool, error) {
 
 // ListCollaborators lists the collaborators.
 func (f *FakeClient) ListCollaborators(org, repo string) ([]github.User, error) {
+	if err := f.Errors["ListCollaborators"]; err != nil {
+		return nil, err
+	}
 	result := make([]github.User, 0, len(f.Collaborators))
 	for _, login := range f.Collaborators {
 		result = append(result, github.User{Login: login})
@@ -392,12 +605,18 @@ func (f *FakeClient) ListCollaborators(org, repo string) ([]github.User, error)
 
 // ClearMilestone removes the milestone
 func (f *FakeClient) ClearMilestone(org, repo string, issueNum int) error {
+	if err := f.Errors["ClearMilestone"]; err != nil {
+		return err
+	}
 	f.Milestone = 0
 	return nil
 }
 
 // SetMilestone sets the milestone.
 func (f *FakeClient) SetMilestone(org, repo string, issueNum, milestoneNum int) error {
+	if err := f.Errors["SetMilestone"]; err != nil {
+		return err
+	}
 	if milestoneNum < 0 {
 		return fmt.Errorf("Milestone Numbers Cannot Be Negative")
 	}
@@ -407,6 +626,9 @@ func (f *FakeClient) SetMilestone(org, repo string, issueNum, milestoneNum int)
 
 // ListMilestones lists milestones.
 func (f *FakeClient) ListMilestones(org, repo string) ([]github.Milestone, error) {
+	if err := f.Errors["ListMilestones"]; err != nil {
+		return nil, err
+	}
 	milestones := []github.Milestone{}
 	for k, v := range f.MilestoneMap {
 		milestones = append(milestones, github.Milestone{Title: k, Number: v})
@@ -416,6 +638,9 @@ func (f *FakeClient) ListMilestones(org, repo string) ([]github.Milestone, error
 
 // ListPRCommits lists commits for a given PR.
 func (f *FakeClient) ListPRCommits(org, repo string, prNumber int) ([]github.RepositoryCommit, error) {
+	if err := f.Errors["ListPRCommits"]; err != nil {
+		return nil, err
+	}
 	k := fmt.Sprintf("%s/%s#%d", org, repo, prNumber)
 	return f.CommitMap[k], nil
 }
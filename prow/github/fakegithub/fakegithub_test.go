@@ -0,0 +1,109 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fakegithub
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+// TestMethodsMatchClient makes sure that the fake does not drift from the
+// real client, so that it satisfies the same interfaces.
+func TestMethodsMatchClient(t *testing.T) {
+	fake := reflect.TypeOf(&FakeClient{})
+	client := reflect.TypeOf(&github.Client{})
+	for i := 0; i < fake.NumMethod(); i++ {
+		method := fake.Method(i)
+		clientMethod, ok := client.MethodByName(method.Name)
+		if !ok {
+			t.Errorf("%s is not a method of the real client", method.Name)
+			continue
+		}
+		if !sameSignature(method.Type, clientMethod.Type) {
+			t.Errorf("%s has signature %v, but the real client has %v", method.Name, method.Type, clientMethod.Type)
+		}
+	}
+}
+
+// sameSignature compares the types of two methods, ignoring the receivers.
+func sameSignature(a, b reflect.Type) bool {
+	if a.NumIn() != b.NumIn() || a.NumOut() != b.NumOut() || a.IsVariadic() != b.IsVariadic() {
+		return false
+	}
+	for i := 1; i < a.NumIn(); i++ {
+		if a.In(i) != b.In(i) {
+			return false
+		}
+	}
+	for i := 0; i < a.NumOut(); i++ {
+		if a.Out(i) != b.Out(i) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestErrors(t *testing.T) {
+	broken := errors.New("injected")
+	f := &FakeClient{
+		Errors: map[string]error{
+			"CreateComment": broken,
+			"IsMember":      broken,
+		},
+	}
+	if err := f.CreateComment("org", "repo", 1, "hello"); err != broken {
+		t.Errorf("expected the injected error from CreateComment, got %v", err)
+	}
+	if len(f.IssueCommentsAdded) != 0 {
+		t.Errorf("expected no comment to be added, got %v", f.IssueCommentsAdded)
+	}
+	if member, err := f.IsMember("org", "user"); err != broken || member {
+		t.Errorf("expected the injected error from IsMember, got %t, %v", member, err)
+	}
+	if err := f.CreateStatus("org", "repo", "sha", github.Status{Context: "ci"}); err != nil {
+		t.Errorf("expected no error from CreateStatus, got %v", err)
+	}
+}
+
+func TestComments(t *testing.T) {
+	f := &FakeClient{}
+	for _, body := range []string{"first", "second"} {
+		if err := f.CreateComment("org", "repo", 1, body); err != nil {
+			t.Fatalf("unexpected error creating a comment: %v", err)
+		}
+	}
+	if err := f.EditComment("org", "repo", 1, "edited"); err != nil {
+		t.Fatalf("unexpected error editing a comment: %v", err)
+	}
+	if err := f.EditComment("org", "repo", 2, "missing"); err == nil {
+		t.Error("expected an error editing a missing comment, got none")
+	}
+	comments, err := f.ListIssueComments("org", "repo", 1)
+	if err != nil {
+		t.Fatalf("unexpected error listing comments: %v", err)
+	}
+	var bodies []string
+	for _, comment := range comments {
+		bodies = append(bodies, comment.Body)
+	}
+	if expected := []string{"first", "edited"}; !reflect.DeepEqual(bodies, expected) {
+		t.Errorf("expected comments %v, got %v", expected, bodies)
+	}
+}
@@ -70,17 +70,41 @@ func prowjobStateToGithubStatus(pjState prowapi.ProwJobState) (string, error) {
 const (
 	maxLen = 140 // https://developer.github.com/v3/repos/deployments/#parameters-2
 	elide  = " ... "
+	// optionalSuffix marks the status of a job that is not required for merge.
+	optionalSuffix = " (optional)"
+	// infraErrorPrefix marks the status of a job that could not run to
+	// completion because of the infrastructure, as opposed to failing tests.
+	infraErrorPrefix = "Infrastructure error: "
 )
 
 // truncate converts "really long messages" into "really ... messages".
+// Lengths are counted in characters, which are never split.
 func truncate(in string) string {
 	const (
 		half = (maxLen - len(elide)) / 2
 	)
-	if len(in) <= maxLen {
+	runes := []rune(in)
+	if len(runes) <= maxLen {
 		return in
 	}
-	return in[:half] + elide + in[len(in)-half:]
+	return string(runes[:half]) + elide + string(runes[len(runes)-half:])
+}
+
+// description returns the status description for the job, marking
+// infrastructure errors so that they can be told apart from test failures
+// and optional jobs so that they can be told apart from required ones.
+func description(pj prowapi.ProwJob) string {
+	in := pj.Status.Description
+	if pj.Status.State == prowapi.ErrorState {
+		in = infraErrorPrefix + in
+	}
+	if !pj.Spec.Optional {
+		return truncate(in)
+	}
+	if runes := []rune(in); len(runes)+len(optionalSuffix) > maxLen {
+		in = string(runes[:maxLen-len(optionalSuffix)-len(elide)]) + elide
+	}
+	return in + optionalSuffix
 }
 
 // reportStatus should be called on any prowjob status changes
@@ -97,7 +121,7 @@ func reportStatus(ghc GithubClient, pj prowapi.ProwJob) error {
 		}
 		if err := ghc.CreateStatus(refs.Org, refs.Repo, sha, github.Status{
 			State:       contextState,
-			Description: truncate(pj.Status.Description),
+			Description: description(pj),
 			Context:     pj.Spec.Context, // consider truncating this too
 			TargetURL:   pj.Status.URL,
 		}); err != nil {
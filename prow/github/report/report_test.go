@@ -21,6 +21,7 @@ import (
 	"k8s.io/test-infra/prow/plugins"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/github"
@@ -305,6 +306,7 @@ func TestReportStatus(t *testing.T) {
 
 		state            prowapi.ProwJobState
 		report           bool
+		optional         bool
 		desc             string // override default msg
 		pjType           prowapi.ProwJobType
 		expectedStatuses []string
@@ -359,6 +361,45 @@ func TestReportStatus(t *testing.T) {
 			desc:             shout(maxLen), // resulting string will exceed maxLen
 			expectedDesc:     truncate(shout(maxLen)),
 		},
+		{
+			name: "Failed optional presubmit job should set failure status marked as optional",
+
+			state:            prowapi.FailureState,
+			report:           true,
+			optional:         true,
+			pjType:           prowapi.PresubmitJob,
+			expectedStatuses: []string{"failure"},
+			expectedDesc:     defMsg + optionalSuffix,
+		},
+		{
+			name: "really long description of optional job is truncated but keeps the marker",
+
+			state:            prowapi.PendingState,
+			report:           true,
+			optional:         true,
+			pjType:           prowapi.PresubmitJob,
+			expectedStatuses: []string{"pending"},
+			desc:             shout(maxLen),
+			expectedDesc:     shout(maxLen)[:maxLen-len(optionalSuffix)-len(elide)] + elide + optionalSuffix,
+		},
+		{
+			name: "Errored presubmit job should set error status marked as an infrastructure error",
+
+			state:            prowapi.ErrorState,
+			report:           true,
+			pjType:           prowapi.PresubmitJob,
+			expectedStatuses: []string{"error"},
+			expectedDesc:     infraErrorPrefix + defMsg,
+		},
+		{
+			name: "Failed presubmit job should set failure status with the job's description",
+
+			state:            prowapi.FailureState,
+			report:           true,
+			pjType:           prowapi.PresubmitJob,
+			expectedStatuses: []string{"failure"},
+			expectedDesc:     defMsg,
+		},
 		{
 			name: "Successful postsubmit job with report true should set success status",
 
@@ -388,10 +429,11 @@ func TestReportStatus(t *testing.T) {
 					URL:         "http://mytest.com",
 				},
 				Spec: prowapi.ProwJobSpec{
-					Job:     "job-name",
-					Type:    tc.pjType,
-					Context: "parent",
-					Report:  tc.report,
+					Job:      "job-name",
+					Type:     tc.pjType,
+					Context:  "parent",
+					Report:   tc.report,
+					Optional: tc.optional,
 					Refs: &prowapi.Refs{
 						Org:  "k8s",
 						Repo: "test-infra",
@@ -480,11 +522,24 @@ func TestTruncate(t *testing.T) {
 			in:     big,
 			middle: elide,
 		},
+		{
+			name:   "multi-byte characters are counted once",
+			in:     strings.Repeat("ü", maxLen+1),
+			outLen: outLen,
+		},
+		{
+			name: "multi-byte characters within the limit are kept",
+			in:   strings.Repeat("日", maxLen),
+			out:  strings.Repeat("日", maxLen),
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			out := truncate(tc.in)
+			if !utf8.ValidString(out) {
+				t.Errorf("%q is not valid UTF-8", out)
+			}
 			exact := true
 			if tc.front != "" {
 				exact = false
@@ -506,8 +561,8 @@ func TestTruncate(t *testing.T) {
 			}
 			if tc.outLen > 0 {
 				exact = false
-				if len(out) != tc.outLen {
-					t.Errorf("%s len %d != expected %d", out, len(out), tc.outLen)
+				if n := utf8.RuneCountInString(out); n != tc.outLen {
+					t.Errorf("%s len %d != expected %d", out, n, tc.outLen)
 				}
 			}
 			if exact && out != tc.out {
@@ -19,6 +19,7 @@ package github
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -141,6 +142,7 @@ type Status struct {
 // CombinedStatus is the latest statuses for a ref.
 type CombinedStatus struct {
 	SHA      string   `json:"sha"`
+	State    string   `json:"state"`
 	Statuses []Status `json:"statuses"`
 }
 
@@ -153,6 +155,26 @@ type User struct {
 	HTMLURL string `json:"html_url"`
 }
 
+// App is a GitHub App.
+type App struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+// AppInstallation is an installation of a GitHub App on an org or user
+// account.
+type AppInstallation struct {
+	ID      int  `json:"id"`
+	Account User `json:"account"`
+}
+
+// InstallationToken is an access token for an installation of a GitHub App.
+type InstallationToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 // NormLogin normalizes GitHub login strings
 var NormLogin = strings.ToLower
 
@@ -214,6 +236,7 @@ type PullRequest struct {
 	Body               string            `json:"body"`
 	RequestedReviewers []User            `json:"requested_reviewers"`
 	Assignees          []User            `json:"assignees"`
+	Labels             []Label           `json:"labels"`
 	State              string            `json:"state"`
 	Merged             bool              `json:"merged"`
 	CreatedAt          time.Time         `json:"created_at,omitempty"`
@@ -310,6 +333,86 @@ func (r BranchProtectionRequest) String() string {
 	return string(bytes)
 }
 
+// BranchProtection represents the protections in place for a branch, as
+// GitHub reports them.
+// See also: https://developer.github.com/v3/repos/branches/#get-branch-protection
+type BranchProtection struct {
+	RequiredStatusChecks       *RequiredStatusChecks         `json:"required_status_checks"`
+	EnforceAdmins              EnforceAdmins                 `json:"enforce_admins"`
+	RequiredPullRequestReviews *PullRequestReviewsProtection `json:"required_pull_request_reviews"`
+	Restrictions               *RestrictionsProtection       `json:"restrictions"`
+}
+
+// EnforceAdmins specifies whether protections apply to admins too.
+type EnforceAdmins struct {
+	Enabled bool `json:"enabled"`
+}
+
+// PullRequestReviewsProtection is the review policy in place for a branch.
+type PullRequestReviewsProtection struct {
+	DismissalRestrictions        *RestrictionsProtection `json:"dismissal_restrictions,omitempty"`
+	DismissStaleReviews          bool                    `json:"dismiss_stale_reviews"`
+	RequireCodeOwnerReviews      bool                    `json:"require_code_owner_reviews"`
+	RequiredApprovingReviewCount int                     `json:"required_approving_review_count"`
+}
+
+// RestrictionsProtection lists the people and teams an activity is
+// restricted to on a branch.
+type RestrictionsProtection struct {
+	Users []User `json:"users"`
+	Teams []Team `json:"teams"`
+}
+
+// Request renders the protections into the request that configures them,
+// with lists sorted so that requests can be compared.
+func (bp BranchProtection) Request() BranchProtectionRequest {
+	var req BranchProtectionRequest
+	if bp.RequiredStatusChecks != nil {
+		contexts := append([]string{}, bp.RequiredStatusChecks.Contexts...)
+		sort.Strings(contexts)
+		req.RequiredStatusChecks = &RequiredStatusChecks{
+			Strict:   bp.RequiredStatusChecks.Strict,
+			Contexts: contexts,
+		}
+	}
+	if bp.EnforceAdmins.Enabled {
+		enabled := true
+		req.EnforceAdmins = &enabled
+	}
+	if reviews := bp.RequiredPullRequestReviews; reviews != nil {
+		req.RequiredPullRequestReviews = &RequiredPullRequestReviews{
+			DismissStaleReviews:          reviews.DismissStaleReviews,
+			RequireCodeOwnerReviews:      reviews.RequireCodeOwnerReviews,
+			RequiredApprovingReviewCount: reviews.RequiredApprovingReviewCount,
+		}
+		if reviews.DismissalRestrictions != nil {
+			req.RequiredPullRequestReviews.DismissalRestrictions = reviews.DismissalRestrictions.request()
+		}
+	}
+	if bp.Restrictions != nil {
+		restrictions := bp.Restrictions.request()
+		req.Restrictions = &restrictions
+	}
+	return req
+}
+
+func (r RestrictionsProtection) request() Restrictions {
+	users := []string{}
+	for _, user := range r.Users {
+		users = append(users, user.Login)
+	}
+	sort.Strings(users)
+	teams := []string{}
+	for _, team := range r.Teams {
+		teams = append(teams, team.Slug)
+	}
+	sort.Strings(teams)
+	return Restrictions{
+		Users: &users,
+		Teams: &teams,
+	}
+}
+
 // RequiredStatusChecks specifies which contexts must pass to merge.
 type RequiredStatusChecks struct {
 	Strict   bool     `json:"strict"` // PR must be up to date (include latest base branch commit).
@@ -576,9 +679,9 @@ const (
 	// ReviewActionSubmitted means the review was submitted.
 	ReviewActionSubmitted ReviewEventAction = "submitted"
 	// ReviewActionEdited means the review was edited.
-	ReviewActionEdited = "edited"
+	ReviewActionEdited ReviewEventAction = "edited"
 	// ReviewActionDismissed means the review was dismissed.
-	ReviewActionDismissed = "dismissed"
+	ReviewActionDismissed ReviewEventAction = "dismissed"
 )
 
 // ReviewEvent is what GitHub sends us when a PR review is changed.
@@ -598,10 +701,10 @@ type ReviewState string
 // Possible review states.
 const (
 	ReviewStateApproved         ReviewState = "APPROVED"
-	ReviewStateChangesRequested             = "CHANGES_REQUESTED"
-	ReviewStateCommented                    = "COMMENTED"
-	ReviewStateDismissed                    = "DISMISSED"
-	ReviewStatePending                      = "PENDING"
+	ReviewStateChangesRequested ReviewState = "CHANGES_REQUESTED"
+	ReviewStateCommented        ReviewState = "COMMENTED"
+	ReviewStateDismissed        ReviewState = "DISMISSED"
+	ReviewStatePending          ReviewState = "PENDING"
 )
 
 // Review describes a Pull Request review.
@@ -623,9 +726,9 @@ const (
 	// ReviewCommentActionCreated means the comment was created.
 	ReviewCommentActionCreated ReviewCommentEventAction = "created"
 	// ReviewCommentActionEdited means the comment was edited.
-	ReviewCommentActionEdited = "edited"
+	ReviewCommentActionEdited ReviewCommentEventAction = "edited"
 	// ReviewCommentActionDeleted means the comment was deleted.
-	ReviewCommentActionDeleted = "deleted"
+	ReviewCommentActionDeleted ReviewCommentEventAction = "deleted"
 )
 
 // ReviewCommentEvent is what GitHub sends us when a PR review comment is changed.
@@ -660,8 +763,8 @@ type ReviewAction string
 // Possible review actions. Leave Action blank for a pending review.
 const (
 	Approve        ReviewAction = "APPROVE"
-	RequestChanges              = "REQUEST_CHANGES"
-	Comment                     = "COMMENT"
+	RequestChanges ReviewAction = "REQUEST_CHANGES"
+	Comment        ReviewAction = "COMMENT"
 )
 
 // DraftReview is what we give GitHub when we want to make a PR Review. This is
@@ -700,6 +803,7 @@ const (
 type Team struct {
 	ID           int    `json:"id,omitempty"`
 	Name         string `json:"name"`
+	Slug         string `json:"slug,omitempty"` // Only present in responses
 	Description  string `json:"description,omitempty"`
 	Privacy      string `json:"privacy,omitempty"`
 	Parent       *Team  `json:"parent,omitempty"`         // Only present in responses
@@ -17,6 +17,9 @@ limitations under the License.
 package github
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 )
 
@@ -107,3 +110,114 @@ func TestUnmarshalClientError(t *testing.T) {
 		}
 	}
 }
+
+func loadPayload(t *testing.T, name string, event interface{}) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	if err := json.Unmarshal(b, event); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", name, err)
+	}
+}
+
+func TestReviewEventPayloads(t *testing.T) {
+	testCases := []struct {
+		payload string
+		action  ReviewEventAction
+		state   ReviewState
+	}{
+		{
+			payload: "pull_request_review_submitted.json",
+			action:  ReviewActionSubmitted,
+			state:   "approved",
+		},
+		{
+			payload: "pull_request_review_edited.json",
+			action:  ReviewActionEdited,
+			state:   "commented",
+		},
+		{
+			payload: "pull_request_review_dismissed.json",
+			action:  ReviewActionDismissed,
+			state:   "dismissed",
+		},
+	}
+	for _, tc := range testCases {
+		var re ReviewEvent
+		loadPayload(t, tc.payload, &re)
+		if re.Action != tc.action {
+			t.Errorf("%s: expected action %q, got %q", tc.payload, tc.action, re.Action)
+		}
+		if re.Review.State != tc.state {
+			t.Errorf("%s: expected state %q, got %q", tc.payload, tc.state, re.Review.State)
+		}
+		if re.Review.ID != 237895671 || re.Review.User.Login != "octocat" || re.Review.Body != "Looks great!" {
+			t.Errorf("%s: wrong review: %+v", tc.payload, re.Review)
+		}
+		if re.PullRequest.Number != 2 || re.PullRequest.Base.Repo.Owner.Login != "Codertocat" || re.PullRequest.Head.SHA != "ec26c3e57ca3a959ca5aad62de7213c562f8c821" {
+			t.Errorf("%s: wrong pull request: %+v", tc.payload, re.PullRequest)
+		}
+		if re.Repo.FullName != "Codertocat/Hello-World" {
+			t.Errorf("%s: expected repo Codertocat/Hello-World, got %q", tc.payload, re.Repo.FullName)
+		}
+	}
+}
+
+func TestReviewCommentEventPayloads(t *testing.T) {
+	testCases := []struct {
+		payload string
+		action  ReviewCommentEventAction
+	}{
+		{
+			payload: "pull_request_review_comment_created.json",
+			action:  ReviewCommentActionCreated,
+		},
+		{
+			payload: "pull_request_review_comment_edited.json",
+			action:  ReviewCommentActionEdited,
+		},
+		{
+			payload: "pull_request_review_comment_deleted.json",
+			action:  ReviewCommentActionDeleted,
+		},
+	}
+	for _, tc := range testCases {
+		var rce ReviewCommentEvent
+		loadPayload(t, tc.payload, &rce)
+		if rce.Action != tc.action {
+			t.Errorf("%s: expected action %q, got %q", tc.payload, tc.action, rce.Action)
+		}
+		c := rce.Comment
+		if c.ID != 284312630 || c.ReviewID != 237895671 || c.User.Login != "octocat" || c.Path != "README.md" {
+			t.Errorf("%s: wrong comment: %+v", tc.payload, c)
+		}
+		if c.Position == nil || *c.Position != 1 {
+			t.Errorf("%s: expected position 1, got %v", tc.payload, c.Position)
+		}
+		if rce.PullRequest.Number != 2 || rce.Repo.Name != "Hello-World" {
+			t.Errorf("%s: wrong pull request %d in %s", tc.payload, rce.PullRequest.Number, rce.Repo.FullName)
+		}
+	}
+}
+
+func TestStatusEventPayload(t *testing.T) {
+	var se StatusEvent
+	loadPayload(t, "status.json", &se)
+	expected := StatusEvent{
+		SHA:         "6113728f27ae82c7b1a177c8d03f9e96e0adf246",
+		State:       StatusSuccess,
+		Description: "Job succeeded.",
+		TargetURL:   "https://prow.example.com/view/gcs/bucket/logs/ci-job/1",
+		ID:          6805126730,
+		Name:        "Codertocat/Hello-World",
+		Context:     "ci-job",
+	}
+	if se.Sender.Login != "Codertocat" || se.Repo.FullName != "Codertocat/Hello-World" {
+		t.Errorf("wrong sender %q or repo %q", se.Sender.Login, se.Repo.FullName)
+	}
+	se.Sender, se.Repo = User{}, Repo{}
+	if se != expected {
+		t.Errorf("expected %+v, got %+v", expected, se)
+	}
+}
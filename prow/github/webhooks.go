@@ -18,6 +18,7 @@ package github
 
 import (
 	"io/ioutil"
+	"mime"
 	"net/http"
 
 	"github.com/sirupsen/logrus"
@@ -56,8 +57,9 @@ func ValidateWebhook(w http.ResponseWriter, r *http.Request, hmacSecret []byte)
 		responseHTTPError(w, http.StatusForbidden, "403 Forbidden: Missing X-Hub-Signature")
 		return "", "", nil, false, http.StatusForbidden
 	}
-	contentType := r.Header.Get("content-type")
-	if contentType != "application/json" {
+	// GitHub Enterprise may add parameters like a charset to the content type.
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("content-type"))
+	if err != nil || contentType != "application/json" {
 		responseHTTPError(w, http.StatusBadRequest, "400 Bad Request: Hook only accepts content-type: application/json - please reconfigure this hook on GitHub")
 		return "", "", nil, false, http.StatusBadRequest
 	}
@@ -17,6 +17,8 @@ limitations under the License.
 package hook
 
 import (
+	"runtime/debug"
+
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/test-infra/prow/github"
@@ -49,6 +51,14 @@ var (
 	}
 )
 
+// recoverPanic logs a panic in a plugin handler instead of letting it take
+// down hook along with the handlers of every other plugin.
+func recoverPanic(l *logrus.Entry) {
+	if r := recover(); r != nil {
+		l.WithField("panic", r).Errorf("Plugin handler panicked: %s", debug.Stack())
+	}
+}
+
 func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 	defer s.wg.Done()
 	l = l.WithFields(logrus.Fields{
@@ -64,6 +74,7 @@ func (s *Server) handleReviewEvent(l *logrus.Entry, re github.ReviewEvent) {
 		s.wg.Add(1)
 		go func(p string, h plugins.ReviewEventHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				re.Repo.Owner.Login,
@@ -115,6 +126,7 @@ func (s *Server) handleReviewCommentEvent(l *logrus.Entry, rce github.ReviewComm
 		s.wg.Add(1)
 		go func(p string, h plugins.ReviewCommentEventHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				rce.Repo.Owner.Login,
@@ -165,6 +177,7 @@ func (s *Server) handlePullRequestEvent(l *logrus.Entry, pr github.PullRequestEv
 		s.wg.Add(1)
 		go func(p string, h plugins.PullRequestHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				pr.Repo.Owner.Login,
@@ -216,6 +229,7 @@ func (s *Server) handlePushEvent(l *logrus.Entry, pe github.PushEvent) {
 		s.wg.Add(1)
 		go func(p string, h plugins.PushEventHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			if err := h(agent, pe); err != nil {
 				agent.Logger.WithError(err).Error("Error handling PushEvent.")
@@ -238,6 +252,7 @@ func (s *Server) handleIssueEvent(l *logrus.Entry, i github.IssueEvent) {
 		s.wg.Add(1)
 		go func(p string, h plugins.IssueHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				i.Repo.Owner.Login,
@@ -290,6 +305,7 @@ func (s *Server) handleIssueCommentEvent(l *logrus.Entry, ic github.IssueComment
 		s.wg.Add(1)
 		go func(p string, h plugins.IssueCommentHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				ic.Repo.Owner.Login,
@@ -341,6 +357,7 @@ func (s *Server) handleStatusEvent(l *logrus.Entry, se github.StatusEvent) {
 		s.wg.Add(1)
 		go func(p string, h plugins.StatusEventHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			if err := h(agent, se); err != nil {
 				agent.Logger.WithError(err).Error("Error handling StatusEvent.")
@@ -369,6 +386,7 @@ func (s *Server) handleGenericComment(l *logrus.Entry, ce *github.GenericComment
 		s.wg.Add(1)
 		go func(p string, h plugins.GenericCommentHandler) {
 			defer s.wg.Done()
+			defer recoverPanic(l.WithField("plugin", p))
 			agent := plugins.NewAgent(s.ConfigAgent, s.Plugins, s.ClientAgent, l.WithField("plugin", p))
 			agent.InitializeCommentPruner(
 				ce.Repo.Owner.Login,
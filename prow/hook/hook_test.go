@@ -83,3 +83,99 @@ func TestHook(t *testing.T) {
 		t.Error("Plugin not called after one second.")
 	}
 }
+
+// TestHookReviewEvent ensures that pull_request_review webhooks reach the
+// plugins that handle ReviewEvents.
+func TestHookReviewEvent(t *testing.T) {
+	reviews := make(chan github.ReviewEvent, 1)
+	secret := []byte("123abc")
+	payload := []byte(`{
+	"action": "submitted",
+	"review": {"id": 1, "user": {"login": "alice"}, "body": "", "state": "approved"},
+	"pull_request": {"number": 5, "base": {"repo": {"owner": {"login": "foo"}, "name": "bar"}}},
+	"repository": {"owner": {"login": "foo"}, "name": "bar", "full_name": "foo/bar"}
+}`)
+	plugins.RegisterReviewEventHandler(
+		"review-baz",
+		func(pc plugins.Agent, re github.ReviewEvent) error {
+			reviews <- re
+			return nil
+		},
+		nil,
+	)
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{Plugins: map[string][]string{"foo/bar": {"review-baz"}}})
+	s := httptest.NewServer(&Server{
+		ClientAgent:    &plugins.ClientAgent{},
+		Plugins:        pa,
+		ConfigAgent:    &config.Agent{},
+		Metrics:        NewMetrics(),
+		TokenGenerator: func() []byte { return secret },
+	})
+	defer s.Close()
+	if err := phony.SendHook(s.URL, "pull_request_review", payload, secret); err != nil {
+		t.Fatalf("Error sending hook: %v", err)
+	}
+	select {
+	case re := <-reviews:
+		if re.Action != github.ReviewActionSubmitted {
+			t.Errorf("Expected action %s, got %s", github.ReviewActionSubmitted, re.Action)
+		}
+		if re.Review.User.Login != "alice" || re.Review.State != "approved" {
+			t.Errorf("Wrong review: %+v", re.Review)
+		}
+		if re.PullRequest.Number != 5 {
+			t.Errorf("Expected pull request 5, got %d", re.PullRequest.Number)
+		}
+	case <-time.After(time.Second):
+		t.Error("Plugin not called after one second.")
+	}
+}
+
+// TestHookPluginPanic ensures that a panicking plugin neither takes down hook
+// nor keeps the other plugins from handling the event.
+func TestHookPluginPanic(t *testing.T) {
+	called := make(chan bool, 1)
+	secret := []byte("123abc")
+	payload := []byte(`{
+	"sha": "abcdef",
+	"state": "success",
+	"context": "ci-job",
+	"repository": {"owner": {"login": "foo"}, "name": "bar", "full_name": "foo/bar"}
+}`)
+	plugins.RegisterStatusEventHandler(
+		"status-panic",
+		func(pc plugins.Agent, se github.StatusEvent) error {
+			panic("oops")
+		},
+		nil,
+	)
+	plugins.RegisterStatusEventHandler(
+		"status-baz",
+		func(pc plugins.Agent, se github.StatusEvent) error {
+			called <- true
+			return nil
+		},
+		nil,
+	)
+	pa := &plugins.ConfigAgent{}
+	pa.Set(&plugins.Configuration{Plugins: map[string][]string{"foo/bar": {"status-panic", "status-baz"}}})
+	server := &Server{
+		ClientAgent:    &plugins.ClientAgent{},
+		Plugins:        pa,
+		ConfigAgent:    &config.Agent{},
+		Metrics:        NewMetrics(),
+		TokenGenerator: func() []byte { return secret },
+	}
+	s := httptest.NewServer(server)
+	defer s.Close()
+	if err := phony.SendHook(s.URL, "status", payload, secret); err != nil {
+		t.Fatalf("Error sending hook: %v", err)
+	}
+	select {
+	case <-called: // All good.
+	case <-time.After(time.Second):
+		t.Error("Plugin not called after one second.")
+	}
+	server.GracefulShutdown()
+}
@@ -139,6 +139,34 @@ func TestServeHTTPErrors(t *testing.T) {
 			Body: body,
 			Code: http.StatusOK,
 		},
+		{
+			name: "Good, from GitHub Enterprise",
+
+			Method: http.MethodPost,
+			Header: map[string]string{
+				"X-GitHub-Event":              "ping",
+				"X-GitHub-Delivery":           "I am unique",
+				"X-GitHub-Enterprise-Host":    "github.example.com",
+				"X-GitHub-Enterprise-Version": "2.16.0",
+				"X-Hub-Signature":             hmac,
+				"content-type":                "application/json; charset=utf-8",
+			},
+			Body: body,
+			Code: http.StatusOK,
+		},
+		{
+			name: "Form content type",
+
+			Method: http.MethodPost,
+			Header: map[string]string{
+				"X-GitHub-Event":    "ping",
+				"X-GitHub-Delivery": "I am unique",
+				"X-Hub-Signature":   hmac,
+				"content-type":      "application/x-www-form-urlencoded",
+			},
+			Body: body,
+			Code: http.StatusBadRequest,
+		},
 		{
 			name: "Good, again",
 
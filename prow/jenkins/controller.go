@@ -22,7 +22,6 @@ import (
 	"strconv"
 	"sync"
 
-	"github.com/bwmarrin/snowflake"
 	"github.com/sirupsen/logrus"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	prowv1 "k8s.io/test-infra/prow/client/clientset/versioned/typed/prowjobs/v1"
@@ -71,7 +70,6 @@ type Controller struct {
 	ghc           githubClient
 	log           *logrus.Entry
 	cfg           config.Getter
-	node          *snowflake.Node
 	totURL        string
 	// selector that will be applied on prowjobs.
 	selector string
@@ -88,10 +86,6 @@ type Controller struct {
 
 // NewController creates a new Controller from the provided clients.
 func NewController(prowJobClient prowv1.ProwJobInterface, jc *Client, ghc *github.Client, logger *logrus.Entry, cfg config.Getter, totURL, selector string) (*Controller, error) {
-	n, err := snowflake.NewNode(1)
-	if err != nil {
-		return nil, err
-	}
 	if logger == nil {
 		logger = logrus.NewEntry(logrus.StandardLogger())
 	}
@@ -102,7 +96,6 @@ func NewController(prowJobClient prowv1.ProwJobInterface, jc *Client, ghc *githu
 		log:           logger,
 		cfg:           cfg,
 		selector:      selector,
-		node:          n,
 		totURL:        totURL,
 		pendingJobs:   make(map[string]int),
 	}, nil
@@ -129,11 +122,17 @@ func (c *Controller) config() config.Controller {
 }
 
 // canExecuteConcurrently checks whether the provided ProwJob can
-// be executed concurrently.
+// be executed concurrently. Jobs with UnlimitedConcurrency are not
+// held back by the global limit either.
 func (c *Controller) canExecuteConcurrently(pj *prowapi.ProwJob) bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if pj.Spec.MaxConcurrency == prowapi.UnlimitedConcurrency {
+		c.pendingJobs[pj.Spec.Job]++
+		return true
+	}
+
 	if max := c.config().MaxConcurrency; max > 0 {
 		var running int
 		for _, num := range c.pendingJobs {
@@ -444,8 +443,5 @@ func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, reports chan<- prowapi
 }
 
 func (c *Controller) getBuildID(name string) (string, error) {
-	if c.totURL == "" {
-		return c.node.Generate().String(), nil
-	}
 	return pjutil.GetBuildID(name, c.totURL)
 }
@@ -18,6 +18,7 @@ package kube
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -25,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -32,6 +34,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 
@@ -47,11 +50,25 @@ const (
 	retryDelay       = 2 * time.Second
 	requestTimeout   = time.Minute
 
+	// defaultRequestTimeout bounds requests for a single object,
+	// including any retries.
+	defaultRequestTimeout = 10 * time.Second
+	// defaultListTimeout bounds requests for a collection of objects,
+	// including any retries.
+	defaultListTimeout = 30 * time.Second
+	// defaultLogTimeout bounds reads of pod logs, which can be large,
+	// including any retries.
+	defaultLogTimeout = 5 * time.Minute
+
 	// EmptySelector selects everything
 	EmptySelector = ""
 
 	// DefaultClusterAlias specifies the default cluster key to schedule jobs.
 	DefaultClusterAlias = "default"
+
+	// maxConfigMapSize is the largest amount of data the apiserver will
+	// accept in a single configmap.
+	maxConfigMapSize = 1024 * 1024
 )
 
 // newClient is used to allow mocking out the behavior of 'NewClient' while testing.
@@ -76,6 +93,61 @@ type Client struct {
 
 	hiddenReposProvider func() []string
 	hiddenOnly          bool
+
+	// ctx bounds every request made by the client. Requests are
+	// additionally bound by objectTimeout or listTimeout.
+	ctx           context.Context
+	objectTimeout time.Duration
+	listTimeout   time.Duration
+
+	// If metrics is non-nil, record the latency and failures of all requests.
+	metrics *ClientMetrics
+}
+
+// SetMetrics makes the client record metrics about its requests.
+// NOTE: This function is not thread safe and should be called before the client is in use.
+func (c *Client) SetMetrics(m *ClientMetrics) {
+	c.metrics = m
+}
+
+// SetTimeouts overrides how long requests for a single object and for
+// a collection of objects may take, including retries. A zero duration
+// restores the respective default.
+// NOTE: This function is not thread safe and should be called before the client is in use.
+func (c *Client) SetTimeouts(object, list time.Duration) {
+	c.objectTimeout = object
+	c.listTimeout = list
+}
+
+// WithContext returns a copy of the client whose requests are bound
+// to the provided context.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	nc := *c
+	nc.ctx = ctx
+	return &nc
+}
+
+// requestContext returns a context for a single request of the given kind and
+// the function that releases it.
+func (c *Client) requestContext(r *request) (context.Context, context.CancelFunc) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := c.objectTimeout
+	if timeout == 0 {
+		timeout = defaultRequestTimeout
+	}
+	if r.list {
+		timeout = c.listTimeout
+		if timeout == 0 {
+			timeout = defaultListTimeout
+		}
+	}
+	if r.log {
+		timeout = defaultLogTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
 }
 
 // SetHiddenReposProvider takes a continuation that fetches a list of orgs and repos for
@@ -146,12 +218,57 @@ func NewNotFoundError(e error) NotFoundError {
 	return NotFoundError{e: e}
 }
 
+// StatusError happens when the apiserver returns an unsuccessful http
+// status that has no more specific error.
+type StatusError struct {
+	Code int
+	e    error
+}
+
+func (e StatusError) Error() string {
+	return e.e.Error()
+}
+
+// NewStatusError returns an error for the status code with the embedded
+// inner error
+func NewStatusError(code int, e error) StatusError {
+	return StatusError{Code: code, e: e}
+}
+
+// IsTransient tells whether a request that failed with the error may succeed
+// if it is made again. Conflicts, timeouts and server errors are transient.
+// Unprocessable and bad requests, and errors the apiserver did not return,
+// are not.
+func IsTransient(err error) bool {
+	switch err := err.(type) {
+	case ConflictError:
+		return true
+	case StatusError:
+		return err.Code >= 500 || err.Code == http.StatusRequestTimeout || err.Code == http.StatusTooManyRequests
+	case net.Error:
+		// Also covers context.DeadlineExceeded.
+		return err.Timeout()
+	}
+	return false
+}
+
 type request struct {
 	method      string
 	path        string
 	deckPath    string
 	query       map[string]string
 	requestBody interface{}
+	// accept overrides the media types accepted in the response.
+	accept string
+	// list marks requests for a collection of objects, which
+	// are allowed more time to complete.
+	list bool
+	// log marks reads of pod logs, which can be large and are
+	// allowed more time to complete.
+	log bool
+	// stream marks requests whose response body is read for as long
+	// as the caller wants.
+	stream bool
 }
 
 func (c *Client) request(r *request, ret interface{}) error {
@@ -167,38 +284,87 @@ func (c *Client) request(r *request, ret interface{}) error {
 	return nil
 }
 
-func (c *Client) retry(r *request) (*http.Response, error) {
+func (c *Client) retry(ctx context.Context, r *request) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 	backoff := retryDelay
 	for retries := 0; retries < maxRetries; retries++ {
-		resp, err = c.doRequest(r.method, r.deckPath, r.path, r.query, r.requestBody)
+		start := time.Now()
+		resp, err = c.doRequest(ctx, c.httpClient(r.stream || r.log), r.method, r.deckPath, r.path, r.accept, r.query, r.requestBody)
 		if err == nil {
-			if resp.StatusCode < 500 {
+			c.measure(r, start, resp.StatusCode)
+			// The last response is returned as is, so that its status
+			// can be reported.
+			if resp.StatusCode < 500 || retries == maxRetries-1 {
 				break
 			}
 			resp.Body.Close()
 		}
 
-		time.Sleep(backoff)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
 		backoff *= 2
 	}
 	return resp, err
 }
 
+// measure records metrics about the provided request and response code.
+func (c *Client) measure(r *request, start time.Time, code int) {
+	if c.metrics == nil {
+		return
+	}
+	verb := r.method
+	if verb == "" {
+		verb = http.MethodGet
+	}
+	resource := resourceFromPath(r.path)
+	c.metrics.RequestLatency.WithLabelValues(verb, resource).Observe(time.Since(start).Seconds())
+	if code < 200 || code > 299 {
+		c.metrics.RequestErrors.WithLabelValues(verb, resource, strconv.Itoa(code)).Inc()
+	}
+}
+
+// resourceFromPath extracts the kind of resource requested from an
+// apiserver path like /api/v1/namespaces/ns/pods/name/log, which yields
+// "pods".
+func resourceFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if part == "namespaces" && i+2 < len(parts) {
+			return parts[i+2]
+		}
+	}
+	return "unknown"
+}
+
 // Retry on transport failures. Does not retry on 500s.
+// Streams are long-lived so they are only bound by the client's
+// context, neither by the request timeouts nor by the timeout of
+// the http client.
 func (c *Client) requestRetryStream(r *request) (io.ReadCloser, error) {
 	if c.fake && r.deckPath == "" {
 		return nil, nil
 	}
-	resp, err := c.retry(r)
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	resp, err := c.retry(ctx, r)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 409 {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+	}
+	if resp.StatusCode == 404 {
+		return nil, NewNotFoundError(fmt.Errorf("body cannot be streamed"))
+	} else if resp.StatusCode == 409 {
 		return nil, NewConflictError(fmt.Errorf("body cannot be streamed"))
 	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("response has status \"%s\"", resp.Status)
+		return nil, NewStatusError(resp.StatusCode, fmt.Errorf("response has status \"%s\"", resp.Status))
 	}
 	return resp.Body, nil
 }
@@ -208,8 +374,13 @@ func (c *Client) requestRetry(r *request) ([]byte, error) {
 	if c.fake && r.deckPath == "" {
 		return []byte("{}"), nil
 	}
-	resp, err := c.retry(r)
+	ctx, cancel := c.requestContext(r)
+	defer cancel()
+	resp, err := c.retry(ctx, r)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, err
 	}
 
@@ -227,12 +398,25 @@ func (c *Client) requestRetry(r *request) ([]byte, error) {
 	} else if resp.StatusCode == 404 {
 		return nil, NewNotFoundError(fmt.Errorf("body: %s", string(rb)))
 	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return nil, fmt.Errorf("response has status \"%s\" and body \"%s\"", resp.Status, string(rb))
+		return nil, NewStatusError(resp.StatusCode, fmt.Errorf("response has status \"%s\" and body \"%s\"", resp.Status, string(rb)))
 	}
 	return rb, nil
 }
 
-func (c *Client) doRequest(method, deckPath, urlPath string, query map[string]string, body interface{}) (*http.Response, error) {
+// httpClient returns the http client to send a request with. Its timeout
+// covers reading the whole response body, so streams and logs, which are
+// bound by their context instead, are sent through a copy of the client
+// without it.
+func (c *Client) httpClient(long bool) *http.Client {
+	if !long || c.client.Timeout == 0 {
+		return c.client
+	}
+	nc := *c.client
+	nc.Timeout = 0
+	return &nc
+}
+
+func (c *Client) doRequest(ctx context.Context, client *http.Client, method, deckPath, urlPath, accept string, query map[string]string, body interface{}) (*http.Response, error) {
 	url := c.baseURL + urlPath
 	if c.deckURL != "" && deckPath != "" {
 		url = c.deckURL + deckPath
@@ -249,6 +433,7 @@ func (c *Client) doRequest(method, deckPath, urlPath string, query map[string]st
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
@@ -257,6 +442,9 @@ func (c *Client) doRequest(method, deckPath, urlPath string, query map[string]st
 	} else {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
 
 	q := req.URL.Query()
 	for k, v := range query {
@@ -264,7 +452,7 @@ func (c *Client) doRequest(method, deckPath, urlPath string, query map[string]st
 	}
 	req.URL.RawQuery = q.Encode()
 
-	return c.client.Do(req)
+	return client.Do(req)
 }
 
 // NewFakeClient creates a client that doesn't do anything. If you provide a
@@ -442,18 +630,44 @@ func (c *Client) ListPods(selector string) ([]Pod, error) {
 	err := c.request(&request{
 		path:  fmt.Sprintf("/api/v1/namespaces/%s/pods", c.namespace),
 		query: map[string]string{"labelSelector": selector},
+		list:  true,
 	}, &pl)
 	return pl.Items, err
 }
 
+// acceptMetadataList asks the apiserver to list objects with their metadata
+// only, falling back to full objects on apiservers that cannot.
+const acceptMetadataList = "application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1beta1, application/json"
+
+// CountPods returns the number of pods in the client's specified namespace
+// with all of the given labels. Only the metadata of the pods is listed,
+// which is much cheaper than ListPods on busy clusters.
+func (c *Client) CountPods(selector map[string]string) (int, error) {
+	labelSelector := labels.SelectorFromSet(labels.Set(selector)).String()
+	c.log("CountPods", labelSelector)
+	var pl struct {
+		Items []struct{} `json:"items"`
+	}
+	err := c.request(&request{
+		path:   fmt.Sprintf("/api/v1/namespaces/%s/pods", c.namespace),
+		query:  map[string]string{"labelSelector": labelSelector},
+		accept: acceptMetadataList,
+		list:   true,
+	}, &pl)
+	return len(pl.Items), err
+}
+
 // DeletePod deletes the pod at name in the client's specified namespace.
+// A GracePeriodSeconds of zero in opts removes the pod immediately instead
+// of waiting for it to terminate gracefully.
 //
-// Analogous to kubectl delete pod --namespace=client.namespace
-func (c *Client) DeletePod(name string) error {
+// Analogous to kubectl delete pod --grace-period=N --namespace=client.namespace
+func (c *Client) DeletePod(name string, opts DeleteOptions) error {
 	c.log("DeletePod", name)
 	return c.request(&request{
-		method: http.MethodDelete,
-		path:   fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", c.namespace, name),
+		method:      http.MethodDelete,
+		path:        fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", c.namespace, name),
+		requestBody: &opts,
 	}, nil)
 }
 
@@ -528,6 +742,7 @@ func (c *Client) ListProwJobs(selector string) ([]prowapi.ProwJob, error) {
 		path:     fmt.Sprintf("/apis/prow.k8s.io/v1/namespaces/%s/prowjobs", c.namespace),
 		deckPath: "/prowjobs.js",
 		query:    map[string]string{"labelSelector": selector},
+		list:     true,
 	}, &jl)
 	if err == nil {
 		hidden := c.getHiddenRepos()
@@ -588,6 +803,7 @@ func (c *Client) GetLog(pod string) ([]byte, error) {
 	c.log("GetLog", pod)
 	return c.requestRetry(&request{
 		path: fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", c.namespace, pod),
+		log:  true,
 	})
 }
 
@@ -604,6 +820,23 @@ func (c *Client) GetLogTail(pod, container string, n int64) ([]byte, error) {
 			"container":  container,
 			"limitBytes": strconv.FormatInt(n, 10),
 		},
+		log: true,
+	})
+}
+
+// GetLogTailLines returns the last n lines of the log of the specified container in the specified pod,
+// in the client's specified namespace.
+//
+// Analogous to kubectl logs pod --tail n -c container --namespace=client.namespace
+func (c *Client) GetLogTailLines(pod, container string, n int) ([]byte, error) {
+	c.log("GetLogTailLines", pod, n)
+	return c.requestRetry(&request{
+		path: fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", c.namespace, pod),
+		query: map[string]string{
+			"tailLines": strconv.Itoa(n),
+			"container": container,
+		},
+		log: true,
 	})
 }
 
@@ -615,14 +848,61 @@ func (c *Client) GetContainerLog(pod, container string) ([]byte, error) {
 	return c.requestRetry(&request{
 		path:  fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", c.namespace, pod),
 		query: map[string]string{"container": container},
+		log:   true,
 	})
 }
 
+// FollowContainerLog streams the log of a container in the specified pod, in
+// the client's specified namespace, until the container stops or the stream
+// is closed. The caller must close the stream.
+//
+// Analogous to kubectl logs pod -c container --follow --namespace=client.namespace
+func (c *Client) FollowContainerLog(pod, container string) (io.ReadCloser, error) {
+	c.log("FollowContainerLog", pod)
+	return c.requestRetryStream(&request{
+		path:   fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/log", c.namespace, pod),
+		query:  map[string]string{"container": container, "follow": "true"},
+		stream: true,
+	})
+}
+
+// validateConfigMapSize ensures that the data held in the configmap fits
+// within the limit enforced by the apiserver so we can fail early with a
+// clear message instead of an opaque 422.
+func validateConfigMapSize(cm ConfigMap) error {
+	var size int
+	for key, value := range cm.Data {
+		size += len(key) + len(value)
+	}
+	for key, value := range cm.BinaryData {
+		size += len(key) + len(value)
+	}
+	if size > maxConfigMapSize {
+		return fmt.Errorf("configmap %q is too large: %d bytes exceeds the %d byte limit", cm.Name, size, maxConfigMapSize)
+	}
+	return nil
+}
+
+// GetSecret returns the secret at name in the client's specified namespace.
+//
+// Analogous to kubectl get secret/NAME --namespace=client.namespace
+func (c *Client) GetSecret(name string) (Secret, error) {
+	c.log("GetSecret", name)
+	var retSecret Secret
+	err := c.request(&request{
+		path: fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", c.namespace, name),
+	}, &retSecret)
+	return retSecret, err
+}
+
 // CreateConfigMap creates a configmap, in the client's specified namespace.
 //
 // Analogous to kubectl create configmap --namespace=client.namespace
 func (c *Client) CreateConfigMap(content ConfigMap) (ConfigMap, error) {
 	c.log("CreateConfigMap")
+	if err := validateConfigMapSize(content); err != nil {
+		return ConfigMap{}, err
+	}
 	var retConfigMap ConfigMap
 	err := c.request(&request{
 		method:      http.MethodPost,
@@ -657,6 +937,9 @@ func (c *Client) GetConfigMap(name, namespace string) (ConfigMap, error) {
 // Returns the content returned by the apiserver
 func (c *Client) ReplaceConfigMap(name string, config ConfigMap) (ConfigMap, error) {
 	c.log("ReplaceConfigMap", name)
+	if err := validateConfigMapSize(config); err != nil {
+		return ConfigMap{}, err
+	}
 	namespace := c.namespace
 	if config.Namespace != "" {
 		namespace = config.Namespace
@@ -670,3 +953,21 @@ func (c *Client) ReplaceConfigMap(name string, config ConfigMap) (ConfigMap, err
 
 	return retConfigMap, err
 }
+
+// ApplyConfigMap replaces the configmap named config.Name, creating it
+// if it does not exist yet.
+//
+// Analogous to kubectl apply configmap
+//
+// If config.Namespace is empty, the client's specified namespace is used.
+func (c *Client) ApplyConfigMap(config ConfigMap) (ConfigMap, error) {
+	c.log("ApplyConfigMap", config.Name)
+	cm, err := c.ReplaceConfigMap(config.Name, config)
+	if _, isNotFound := err.(NotFoundError); !isNotFound {
+		return cm, err
+	}
+	if config.Namespace != "" && config.Namespace != c.namespace {
+		return c.Namespace(config.Namespace).CreateConfigMap(config)
+	}
+	return c.CreateConfigMap(config)
+}
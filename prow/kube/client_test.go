@@ -19,11 +19,14 @@ package kube
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"math/rand"
@@ -33,10 +36,15 @@ import (
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"k8s.io/api/core/v1"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 )
 
 func getClient(url string) *Client {
@@ -65,6 +73,91 @@ func TestNamespace(t *testing.T) {
 	}
 }
 
+func TestNamespacedRequestPaths(t *testing.T) {
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, "{}")
+	}))
+	defer ts.Close()
+	base := getClient(ts.URL)
+	prowJobClient := base.Namespace("prowjobs")
+	podClient := base.Namespace("test-pods")
+
+	testCases := []struct {
+		name      string
+		call      func() error
+		namespace string
+	}{
+		{
+			name:      "ListProwJobs",
+			call:      func() error { _, err := prowJobClient.ListProwJobs(""); return err },
+			namespace: "prowjobs",
+		},
+		{
+			name:      "CreateProwJob",
+			call:      func() error { _, err := prowJobClient.CreateProwJob(prowapi.ProwJob{}); return err },
+			namespace: "prowjobs",
+		},
+		{
+			name:      "GetProwJob",
+			call:      func() error { _, err := prowJobClient.GetProwJob("pj"); return err },
+			namespace: "prowjobs",
+		},
+		{
+			name:      "ReplaceProwJob",
+			call:      func() error { _, err := prowJobClient.ReplaceProwJob("pj", prowapi.ProwJob{}); return err },
+			namespace: "prowjobs",
+		},
+		{
+			name:      "DeleteProwJob",
+			call:      func() error { return prowJobClient.DeleteProwJob("pj") },
+			namespace: "prowjobs",
+		},
+		{
+			name:      "ListPods",
+			call:      func() error { _, err := podClient.ListPods(""); return err },
+			namespace: "test-pods",
+		},
+		{
+			name:      "CreatePod",
+			call:      func() error { _, err := podClient.CreatePod(v1.Pod{}); return err },
+			namespace: "test-pods",
+		},
+		{
+			name:      "GetPod",
+			call:      func() error { _, err := podClient.GetPod("po"); return err },
+			namespace: "test-pods",
+		},
+		{
+			name:      "DeletePod",
+			call:      func() error { return podClient.DeletePod("po", DeleteOptions{}) },
+			namespace: "test-pods",
+		},
+		{
+			name:      "GetLog",
+			call:      func() error { _, err := podClient.GetLog("po"); return err },
+			namespace: "test-pods",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			paths = nil
+			if err := tc.call(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(paths) != 1 {
+				t.Fatalf("expected one request, got %v", paths)
+			}
+			prefix := fmt.Sprintf("/namespaces/%s/", tc.namespace)
+			if !strings.Contains(paths[0], prefix) {
+				t.Errorf("expected request path %q to be in namespace %q", paths[0], tc.namespace)
+			}
+		})
+	}
+}
+
 func TestSetHiddenReposProviderGet(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -193,6 +286,33 @@ func TestListPods(t *testing.T) {
 	}
 }
 
+func TestCountPods(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/api/v1/namespaces/ns/pods" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		if selector := r.URL.Query().Get("labelSelector"); selector != "created-by-prow=true,prow.k8s.io/job=foo" {
+			t.Errorf("Bad label selector: %s", selector)
+		}
+		if accept := r.Header.Get("Accept"); !strings.Contains(accept, "as=PartialObjectMetadataList") {
+			t.Errorf("Expected only metadata to be requested, got Accept: %s", accept)
+		}
+		fmt.Fprint(w, `{"kind": "PartialObjectMetadataList", "items": [{"metadata": {"name": "a"}}, {"metadata": {"name": "b"}}, {"metadata": {"name": "c"}}]}`)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	n, err := c.CountPods(map[string]string{"prow.k8s.io/job": "foo", CreatedByProw: "true"})
+	if err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected three pods, got %d", n)
+	}
+}
+
 func TestDeletePod(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodDelete {
@@ -201,15 +321,43 @@ func TestDeletePod(t *testing.T) {
 		if r.URL.Path != "/api/v1/namespaces/ns/pods/po" {
 			t.Errorf("Bad request path: %s", r.URL.Path)
 		}
+		var opts DeleteOptions
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			t.Errorf("Could not decode request body: %v", err)
+		}
+		if opts.GracePeriodSeconds != nil {
+			t.Errorf("Expected the default grace period, got %d", *opts.GracePeriodSeconds)
+		}
 	}))
 	defer ts.Close()
 	c := getClient(ts.URL)
-	err := c.DeletePod("po")
+	err := c.DeletePod("po", DeleteOptions{})
 	if err != nil {
 		t.Errorf("Didn't expect error: %v", err)
 	}
 }
 
+func TestDeletePodGracePeriod(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Could not read request body: %v", err)
+		}
+		if !strings.Contains(string(body), `"gracePeriodSeconds":0`) {
+			t.Errorf("Expected a zero gracePeriodSeconds in the request body, got %s", body)
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	var gracePeriod int64
+	if err := c.DeletePod("po", DeleteOptions{GracePeriodSeconds: &gracePeriod}); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+}
+
 func TestGetPod(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -288,6 +436,113 @@ func TestGetLogTail(t *testing.T) {
 	}
 }
 
+func TestGetLogTailLines(t *testing.T) {
+	const log = "first line\nsecond line\nthird line\n"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/api/v1/namespaces/ns/pods/testpod/log" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		if container := r.URL.Query().Get("container"); container != "test" {
+			t.Errorf("Bad container: %s", container)
+		}
+		tailLines, err := strconv.Atoi(r.URL.Query().Get("tailLines"))
+		if err != nil {
+			t.Fatalf("Invalid tail lines: %v", err)
+		}
+		lines := strings.SplitAfter(log, "\n")
+		lines = lines[:len(lines)-1]
+		if tailLines < len(lines) {
+			lines = lines[len(lines)-tailLines:]
+		}
+		fmt.Fprint(w, strings.Join(lines, ""))
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	testCases := []struct {
+		name     string
+		lines    int
+		expected string
+	}{
+		{
+			name:     "Get last line of pod log",
+			lines:    1,
+			expected: "third line\n",
+		},
+		{
+			name:     "Get last two lines of pod log",
+			lines:    2,
+			expected: "second line\nthird line\n",
+		},
+		{
+			name:     "Get more lines than the pod log has",
+			lines:    10,
+			expected: log,
+		},
+	}
+	for _, tc := range testCases {
+		actual, err := c.GetLogTailLines("testpod", "test", tc.lines)
+		if err != nil {
+			t.Errorf("%s didn't expect error: %v", tc.name, err)
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("%s expected log %q, got log %q", tc.name, tc.expected, string(actual))
+		}
+	}
+}
+
+func TestFollowContainerLog(t *testing.T) {
+	next := make(chan string)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/ns/pods/testpod/log" {
+			http.NotFound(w, r)
+			return
+		}
+		if follow := r.URL.Query().Get("follow"); follow != "true" {
+			t.Errorf("Expected the log to be followed, got follow=%q", follow)
+		}
+		if container := r.URL.Query().Get("container"); container != "test" {
+			t.Errorf("Bad container: %s", container)
+		}
+		w.(http.Flusher).Flush()
+		for line := range next {
+			fmt.Fprint(w, line)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+
+	stream, err := c.FollowContainerLog("testpod", "test")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	defer stream.Close()
+	buf := make([]byte, 64)
+	for _, line := range []string{"first line\n", "second line\n"} {
+		next <- line
+		n, err := stream.Read(buf)
+		if err != nil {
+			t.Fatalf("Didn't expect error reading %q: %v", line, err)
+		}
+		if string(buf[:n]) != line {
+			t.Errorf("Expected to read %q as soon as it is written, got %q", line, string(buf[:n]))
+		}
+	}
+	close(next)
+	if n, err := stream.Read(buf); err != io.EOF {
+		t.Errorf("Expected the stream to end with the log, got %q, %v", string(buf[:n]), err)
+	}
+
+	if _, err := c.FollowContainerLog("missing", "test"); err == nil {
+		t.Error("Expected an error for a missing pod, got none")
+	} else if _, isNotFound := err.(NotFoundError); !isNotFound {
+		t.Errorf("Expected a NotFoundError for a missing pod, got %v", err)
+	}
+}
+
 func TestCreatePod(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -345,6 +600,97 @@ func TestGetNotFound(t *testing.T) {
 	}
 }
 
+func TestGetStatusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad pod", http.StatusBadRequest)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	_, err := c.CreatePod(v1.Pod{})
+	if statusErr, ok := err.(StatusError); !ok {
+		t.Errorf("Expected a status error, got: %v", err)
+	} else if statusErr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, got %d", http.StatusBadRequest, statusErr.Code)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "conflict",
+			err:       NewConflictError(fmt.Errorf("already exists")),
+			transient: true,
+		},
+		{
+			name:      "server error",
+			err:       NewStatusError(http.StatusInternalServerError, fmt.Errorf("oops")),
+			transient: true,
+		},
+		{
+			name:      "unavailable",
+			err:       NewStatusError(http.StatusServiceUnavailable, fmt.Errorf("oops")),
+			transient: true,
+		},
+		{
+			name:      "request timeout",
+			err:       NewStatusError(http.StatusRequestTimeout, fmt.Errorf("slow")),
+			transient: true,
+		},
+		{
+			name:      "too many requests",
+			err:       NewStatusError(http.StatusTooManyRequests, fmt.Errorf("slow down")),
+			transient: true,
+		},
+		{
+			name:      "deadline exceeded",
+			err:       context.DeadlineExceeded,
+			transient: true,
+		},
+		{
+			name:      "network timeout",
+			err:       &net.DNSError{Err: "timeout", IsTimeout: true},
+			transient: true,
+		},
+		{
+			name: "unprocessable",
+			err:  NewUnprocessableEntityError(fmt.Errorf("invalid")),
+		},
+		{
+			name: "bad request",
+			err:  NewStatusError(http.StatusBadRequest, fmt.Errorf("invalid")),
+		},
+		{
+			name: "forbidden",
+			err:  NewStatusError(http.StatusForbidden, fmt.Errorf("no")),
+		},
+		{
+			name: "not found",
+			err:  NewNotFoundError(fmt.Errorf("gone")),
+		},
+		{
+			name: "cancelled",
+			err:  context.Canceled,
+		},
+		{
+			name: "other network error",
+			err:  &net.DNSError{Err: "no such host"},
+		},
+		{
+			name: "unknown error",
+			err:  fmt.Errorf("unknown"),
+		},
+	}
+	for _, tc := range testCases {
+		if actual := IsTransient(tc.err); actual != tc.transient {
+			t.Errorf("%s: expected transient %t, got %t", tc.name, tc.transient, actual)
+		}
+	}
+}
+
 func TestCreateConfigMap(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
@@ -379,6 +725,247 @@ func TestReplaceConfigMap(t *testing.T) {
 	}
 }
 
+func TestConfigMapTooLarge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Didn't expect a request, got %s %s", r.Method, r.URL.Path)
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	cm := ConfigMap{
+		ObjectMeta: ObjectMeta{Name: "config"},
+		Data:       map[string]string{"config.yaml": strings.Repeat("a", maxConfigMapSize)},
+	}
+	if _, err := c.CreateConfigMap(cm); err == nil {
+		t.Error("Expected an error creating a configmap that is too large but got none")
+	}
+	if _, err := c.ReplaceConfigMap("config", cm); err == nil {
+		t.Error("Expected an error replacing a configmap that is too large but got none")
+	}
+}
+
+func TestApplyConfigMap(t *testing.T) {
+	testCases := []struct {
+		name            string
+		exists          bool
+		expectedMethods []string
+	}{
+		{
+			name:            "existing configmap is replaced",
+			exists:          true,
+			expectedMethods: []string{http.MethodPut},
+		},
+		{
+			name:            "missing configmap is created",
+			exists:          false,
+			expectedMethods: []string{http.MethodPut, http.MethodPost},
+		},
+	}
+	for _, tc := range testCases {
+		var methods []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			methods = append(methods, r.Method)
+			switch r.Method {
+			case http.MethodPut:
+				if r.URL.Path != "/api/v1/namespaces/ns/configmaps/config" {
+					t.Errorf("%s: bad request path: %s", tc.name, r.URL.Path)
+				}
+				if !tc.exists {
+					http.NotFound(w, r)
+					return
+				}
+			case http.MethodPost:
+				if r.URL.Path != "/api/v1/namespaces/ns/configmaps" {
+					t.Errorf("%s: bad request path: %s", tc.name, r.URL.Path)
+				}
+			default:
+				t.Errorf("%s: bad method: %s", tc.name, r.Method)
+			}
+			fmt.Fprint(w, `{"metadata": {"name": "config"}}`)
+		}))
+		c := getClient(ts.URL)
+		cm, err := c.ApplyConfigMap(ConfigMap{ObjectMeta: ObjectMeta{Name: "config"}})
+		ts.Close()
+		if err != nil {
+			t.Errorf("%s: didn't expect error: %v", tc.name, err)
+			continue
+		}
+		if cm.Name != "config" {
+			t.Errorf("%s: wrong name: %s", tc.name, cm.Name)
+		}
+		if !reflect.DeepEqual(methods, tc.expectedMethods) {
+			t.Errorf("%s: expected requests %v, got %v", tc.name, tc.expectedMethods, methods)
+		}
+	}
+}
+
+func TestFollowContainerLogPastClientTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintln(w, "line")
+			w.(http.Flusher).Flush()
+			time.Sleep(timeout)
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	// NewClient bounds the http client by requestTimeout, which is
+	// shortened here.
+	c.client.Timeout = timeout
+
+	stream, err := c.FollowContainerLog("testpod", "test")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	defer stream.Close()
+	start := time.Now()
+	b, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Didn't expect error reading the stream after %v: %v", time.Since(start), err)
+	}
+	if expected := "line\nline\nline\n"; string(b) != expected {
+		t.Errorf("Expected to read %q, got %q", expected, string(b))
+	}
+
+	c.client = &http.Client{Transport: &http.Transport{}, Timeout: requestTimeout}
+	if sc := c.httpClient(true); sc.Timeout != 0 || sc.Transport != c.client.Transport {
+		t.Errorf("Expected streams to use the transport of the client without a timeout, got timeout %v", sc.Timeout)
+	}
+	if oc := c.httpClient(false); oc != c.client {
+		t.Error("Expected other requests to use the client as is")
+	}
+}
+
+func TestRequestTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("Request to %s was not cancelled", r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	c.SetTimeouts(50*time.Millisecond, 100*time.Millisecond)
+
+	if _, err := c.GetPod("po"); err != context.DeadlineExceeded {
+		t.Errorf("Expected GetPod to exceed its deadline, got: %v", err)
+	}
+	start := time.Now()
+	if _, err := c.ListPods(EmptySelector); err != context.DeadlineExceeded {
+		t.Errorf("Expected ListPods to exceed its deadline, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected ListPods to use the list timeout, but it returned after %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.WithContext(ctx).GetProwJob("pj"); err != context.Canceled {
+		t.Errorf("Expected GetProwJob to be cancelled, got: %v", err)
+	}
+}
+
+func TestLogTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The log takes longer to read than the object, list and http
+		// client timeouts.
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, "log")
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	c.client.Timeout = 100 * time.Millisecond
+	c.SetTimeouts(50*time.Millisecond, 100*time.Millisecond)
+
+	if log, err := c.GetLog("po"); err != nil {
+		t.Errorf("Expected GetLog to be allowed more time, got: %v", err)
+	} else if string(log) != "log" {
+		t.Errorf("Expected the log, got %q", string(log))
+	}
+	if _, err := c.GetContainerLog("po", "test"); err != nil {
+		t.Errorf("Expected GetContainerLog to be allowed more time, got: %v", err)
+	}
+	if _, err := c.GetLogTail("po", "test", 10); err != nil {
+		t.Errorf("Expected GetLogTail to be allowed more time, got: %v", err)
+	}
+	if _, err := c.GetLogTailLines("po", "test", 10); err != nil {
+		t.Errorf("Expected GetLogTailLines to be allowed more time, got: %v", err)
+	}
+}
+
+func TestClientMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/namespaces/ns/pods/missing":
+			http.NotFound(w, r)
+		case "/apis/prow.k8s.io/v1/namespaces/ns/prowjobs/pj":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	metrics := NewClientMetrics()
+	registry := prometheus.NewRegistry()
+	if err := metrics.Register(registry); err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+	c.SetMetrics(metrics)
+
+	if _, err := c.GetPod("po"); err != nil {
+		t.Errorf("Didn't expect error: %v", err)
+	}
+	if _, err := c.GetPod("missing"); err == nil {
+		t.Error("Expected an error getting a missing pod")
+	}
+	if _, err := c.ReplaceProwJob("pj", prowapi.ProwJob{}); err == nil {
+		t.Error("Expected an error replacing a conflicting prowjob")
+	}
+
+	for _, tc := range []struct {
+		labels   []string
+		expected float64
+	}{
+		{labels: []string{http.MethodGet, "pods", "404"}, expected: 1},
+		{labels: []string{http.MethodPut, "prowjobs", "409"}, expected: 1},
+		{labels: []string{http.MethodGet, "pods", "200"}, expected: 0},
+	} {
+		var m dto.Metric
+		if err := metrics.RequestErrors.WithLabelValues(tc.labels...).Write(&m); err != nil {
+			t.Fatalf("Failed to read metric: %v", err)
+		}
+		if got := m.GetCounter().GetValue(); got != tc.expected {
+			t.Errorf("Expected %v errors for %v, got %v", tc.expected, tc.labels, got)
+		}
+	}
+
+	var m dto.Metric
+	if err := metrics.RequestLatency.WithLabelValues(http.MethodGet, "pods").(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("Expected 2 latency samples for pods, got %d", got)
+	}
+}
+
+func TestResourceFromPath(t *testing.T) {
+	testCases := map[string]string{
+		"/api/v1/namespaces/ns/pods":                     "pods",
+		"/api/v1/namespaces/ns/pods/po/log":              "pods",
+		"/apis/prow.k8s.io/v1/namespaces/ns/prowjobs/pj": "prowjobs",
+		"/api/v1/namespaces/ns/configmaps/config":        "configmaps",
+		"/apis/prow.k8s.io/v1/namespaces/ns":             "unknown",
+		"":                                               "unknown",
+	}
+	for path, expected := range testCases {
+		if got := resourceFromPath(path); got != expected {
+			t.Errorf("For path %q expected resource %q, got %q", path, expected, got)
+		}
+	}
+}
+
 // TestNewClient messes around with certs and keys and such to just make sure
 // that our cert handling is done properly. We create root and client keys,
 // then server and client certificates, then ensure that the client can talk
@@ -67,3 +67,46 @@ func GatherProwJobMetrics(pjs []prowapi.ProwJob) {
 		}
 	}
 }
+
+// ClientMetrics is a set of metrics gathered by the kube client.
+// The metrics are not registered by default; binaries that want to
+// expose them should call Register with their registry.
+type ClientMetrics struct {
+	RequestLatency *prometheus.HistogramVec
+	RequestErrors  *prometheus.CounterVec
+}
+
+// NewClientMetrics creates a new set of kube client metrics.
+func NewClientMetrics() *ClientMetrics {
+	return &ClientMetrics{
+		RequestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "kube_client_request_latency_seconds",
+			Help:    "Time for a request to roundtrip between prow and the Kubernetes apiserver.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{
+			// http verb of the request
+			"verb",
+			// kind of resource requested: pods, prowjobs, etc
+			"resource",
+		}),
+		RequestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kube_client_request_errors",
+			Help: "Number of requests to the Kubernetes apiserver that did not return a 2xx response.",
+		}, []string{
+			// http verb of the request
+			"verb",
+			// kind of resource requested: pods, prowjobs, etc
+			"resource",
+			// http status code of the response
+			"code",
+		}),
+	}
+}
+
+// Register registers the client metrics with the provided registry.
+func (m *ClientMetrics) Register(registry prometheus.Registerer) error {
+	if err := registry.Register(m.RequestLatency); err != nil {
+		return err
+	}
+	return registry.Register(m.RequestErrors)
+}
@@ -48,3 +48,13 @@ const (
 	// carries the PR number associated with the job, eg 321.
 	PullLabel = "prow.k8s.io/refs.pull"
 )
+
+// ProwJobForPod returns the name of the ProwJob that the pod was created
+// for. Pods are named after their ProwJob unless their names are generated,
+// in which case only the ProwJobIDLabel ties them to it.
+func ProwJobForPod(pod Pod) string {
+	if id := pod.ObjectMeta.Labels[ProwJobIDLabel]; id != "" {
+		return id
+	}
+	return pod.ObjectMeta.Name
+}
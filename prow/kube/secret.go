@@ -0,0 +1,106 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type secretGetter interface {
+	GetSecret(name string) (Secret, error)
+}
+
+// SecretAgent polls a key of a secret in the cluster so that rotations
+// of the secret are picked up without restarting.
+type SecretAgent struct {
+	sync.RWMutex
+	value []byte
+
+	stop chan struct{}
+}
+
+// Start loads the value of key in the named secret and starts a goroutine
+// that reloads it every interval. If the first load fails, Start returns the
+// error. Future load failures will log the failure but keep the last value.
+func (a *SecretAgent) Start(client secretGetter, name, key string, interval time.Duration) error {
+	value, err := loadSecretKey(client, name, key)
+	if err != nil {
+		return err
+	}
+	a.setValue(value)
+	a.stop = make(chan struct{})
+
+	go func() {
+		logger := logrus.WithFields(logrus.Fields{"secret": name, "key": key})
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stop:
+				return
+			case <-ticker.C:
+				value, err := loadSecretKey(client, name, key)
+				if err != nil {
+					logger.WithError(err).Error("Error loading secret.")
+					continue
+				}
+				a.setValue(value)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops reloading the secret.
+func (a *SecretAgent) Stop() {
+	close(a.stop)
+}
+
+func loadSecretKey(client secretGetter, name, key string) ([]byte, error) {
+	secret, err := client.GetSecret(name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %q: %v", name, err)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %q has no key %q", name, key)
+	}
+	return value, nil
+}
+
+func (a *SecretAgent) setValue(value []byte) {
+	a.Lock()
+	defer a.Unlock()
+	a.value = value
+}
+
+// GetSecret returns the latest value of the secret.
+func (a *SecretAgent) GetSecret() []byte {
+	a.RLock()
+	defer a.RUnlock()
+	return a.value
+}
+
+// GetTokenGenerator returns a function that gets the latest value of the
+// secret, suitable for passing to the GitHub client.
+func (a *SecretAgent) GetTokenGenerator() func() []byte {
+	return a.GetSecret
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestGetSecret(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			t.Errorf("Bad method: %s", r.Method)
+		}
+		if r.URL.Path != "/api/v1/namespaces/ns/secrets/oauth" {
+			t.Errorf("Bad request path: %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"metadata": {"name": "oauth"}, "data": {"token": %q}}`, base64.StdEncoding.EncodeToString([]byte("abcd")))
+	}))
+	defer ts.Close()
+	c := getClient(ts.URL)
+	secret, err := c.GetSecret("oauth")
+	if err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	if got := string(secret.Data["token"]); got != "abcd" {
+		t.Errorf("Expected token %q, got %q", "abcd", got)
+	}
+}
+
+func TestSecretAgentRotation(t *testing.T) {
+	var lock sync.Mutex
+	token := "first"
+	kubeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		fmt.Fprintf(w, `{"data": {"token": %q}}`, base64.StdEncoding.EncodeToString([]byte(token)))
+	}))
+	defer kubeServer.Close()
+
+	var headers []string
+	ghServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		headers = append(headers, r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ghServer.Close()
+
+	agent := &SecretAgent{}
+	if err := agent.Start(getClient(kubeServer.URL), "oauth", "token", 10*time.Millisecond); err != nil {
+		t.Fatalf("Failed to start secret agent: %v", err)
+	}
+	defer agent.Stop()
+	ghc := github.NewClient(agent.GetTokenGenerator(), ghServer.URL)
+
+	if _, err := ghc.GetPullRequest("org", "repo", 1); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+
+	lock.Lock()
+	token = "second"
+	lock.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for string(agent.GetSecret()) != "second" {
+		if time.Now().After(deadline) {
+			t.Fatal("Secret agent did not pick up the rotated secret")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := ghc.GetPullRequest("org", "repo", 1); err != nil {
+		t.Fatalf("Didn't expect error: %v", err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{"Token first", "Token second"}
+	if len(headers) != len(expected) {
+		t.Fatalf("Expected %d requests to GitHub, got %d", len(expected), len(headers))
+	}
+	for i := range expected {
+		if headers[i] != expected[i] {
+			t.Errorf("Request %d: expected Authorization header %q, got %q", i, expected[i], headers[i])
+		}
+	}
+}
+
+func TestSecretAgentMissingKey(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data": {}}`)
+	}))
+	defer ts.Close()
+	agent := &SecretAgent{}
+	if err := agent.Start(getClient(ts.URL), "oauth", "token", time.Hour); err == nil {
+		agent.Stop()
+		t.Error("Expected an error starting the agent on a secret without the key")
+	}
+}
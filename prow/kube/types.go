@@ -49,7 +49,8 @@ const (
 
 // PodStatus constants
 const (
-	Evicted = "Evicted"
+	Evicted          = "Evicted"
+	DeadlineExceeded = "DeadlineExceeded"
 )
 
 // Container is a kubernetes v1 Container
@@ -84,3 +85,6 @@ type ConfigMap = v1.ConfigMap
 
 // Secret is a kubernetes v1 secret
 type Secret = v1.Secret
+
+// DeleteOptions is a kubernetes v1 DeleteOptions
+type DeleteOptions = metav1.DeleteOptions
@@ -110,6 +110,7 @@ func PresubmitSpec(p config.Presubmit, refs prowapi.Refs) prowapi.ProwJobSpec {
 	pjs.Type = prowapi.PresubmitJob
 	pjs.Context = p.Context
 	pjs.Report = !p.SkipReport
+	pjs.Optional = p.Optional
 	pjs.RerunCommand = p.RerunCommand
 	pjs.Refs = completePrimaryRefs(refs, p.JobBase)
 
@@ -151,12 +152,14 @@ func specFromJobBase(jb config.JobBase) prowapi.ProwJobSpec {
 		namespace = *jb.Namespace
 	}
 	return prowapi.ProwJobSpec{
-		Job:             jb.Name,
-		Agent:           prowapi.ProwJobAgent(jb.Agent),
-		Cluster:         jb.Cluster,
-		Namespace:       namespace,
-		MaxConcurrency:  jb.MaxConcurrency,
-		ErrorOnEviction: jb.ErrorOnEviction,
+		Job:              jb.Name,
+		Agent:            prowapi.ProwJobAgent(jb.Agent),
+		Cluster:          jb.Cluster,
+		Namespace:        namespace,
+		MaxConcurrency:   jb.MaxConcurrency,
+		ConcurrencyGroup: jb.ConcurrencyGroup,
+		ErrorOnEviction:  jb.ErrorOnEviction,
+		SlackReport:      jb.SlackReport,
 
 		ExtraRefs:        jb.ExtraRefs,
 		DecorationConfig: jb.DecorationConfig,
@@ -179,13 +182,17 @@ func completePrimaryRefs(refs prowapi.Refs, jb config.JobBase) *prowapi.Refs {
 
 // PartitionActive separates the provided prowjobs into pending and triggered
 // and returns them inside channels so that they can be consumed in parallel
-// by different goroutines. Complete prowjobs are filtered out. Controller
+// by different goroutines. Complete prowjobs are filtered out, including
+// those with a completion time whose state was not updated. Controller
 // loops need to handle pending jobs first so they can conform to maximum
 // concurrency requirements that different jobs may have.
 func PartitionActive(pjs []prowapi.ProwJob) (pending, triggered chan prowapi.ProwJob) {
 	// Size channels correctly.
 	pendingCount, triggeredCount := 0, 0
 	for _, pj := range pjs {
+		if pj.Complete() {
+			continue
+		}
 		switch pj.Status.State {
 		case prowapi.PendingState:
 			pendingCount++
@@ -198,6 +205,9 @@ func PartitionActive(pjs []prowapi.ProwJob) (pending, triggered chan prowapi.Pro
 
 	// Partition the jobs into the two separate channels.
 	for _, pj := range pjs {
+		if pj.Complete() {
+			continue
+		}
 		switch pj.Status.State {
 		case prowapi.PendingState:
 			pending <- pj
@@ -211,21 +221,35 @@ func PartitionActive(pjs []prowapi.ProwJob) (pending, triggered chan prowapi.Pro
 }
 
 // GetLatestProwJobs filters through the provided prowjobs and returns
-// a map of jobType jobs to their latest prowjobs.
+// a map of jobType jobs to their latest prowjobs. An empty jobType
+// matches prowjobs of any type.
 func GetLatestProwJobs(pjs []prowapi.ProwJob, jobType prowapi.ProwJobType) map[string]prowapi.ProwJob {
 	latestJobs := make(map[string]prowapi.ProwJob)
 	for _, j := range pjs {
-		if j.Spec.Type != jobType {
+		if jobType != "" && j.Spec.Type != jobType {
 			continue
 		}
 		name := j.Spec.Job
-		if j.Status.StartTime.After(latestJobs[name].Status.StartTime.Time) {
+		if latest, ok := latestJobs[name]; !ok || newer(j, latest) {
 			latestJobs[name] = j
 		}
 	}
 	return latestJobs
 }
 
+// newer tells whether a started after b. Jobs that started at the same time
+// are ordered by their creation and then by name, so that the latest job
+// does not depend on the order in which the jobs are listed.
+func newer(a, b prowapi.ProwJob) bool {
+	if !a.Status.StartTime.Equal(&b.Status.StartTime) {
+		return a.Status.StartTime.After(b.Status.StartTime.Time)
+	}
+	if !a.ObjectMeta.CreationTimestamp.Equal(&b.ObjectMeta.CreationTimestamp) {
+		return a.ObjectMeta.CreationTimestamp.After(b.ObjectMeta.CreationTimestamp.Time)
+	}
+	return a.ObjectMeta.Name > b.ObjectMeta.Name
+}
+
 // ProwJobFields extracts logrus fields from a prowjob useful for logging.
 func ProwJobFields(pj *prowapi.ProwJob) logrus.Fields {
 	fields := make(logrus.Fields)
@@ -235,10 +259,12 @@ func ProwJobFields(pj *prowapi.ProwJob) logrus.Fields {
 	if len(pj.ObjectMeta.Labels[github.EventGUID]) > 0 {
 		fields[github.EventGUID] = pj.ObjectMeta.Labels[github.EventGUID]
 	}
-	if pj.Spec.Refs != nil && len(pj.Spec.Refs.Pulls) == 1 {
-		fields[github.PrLogField] = pj.Spec.Refs.Pulls[0].Number
-		fields[github.RepoLogField] = pj.Spec.Refs.Repo
+	if pj.Spec.Refs != nil {
 		fields[github.OrgLogField] = pj.Spec.Refs.Org
+		fields[github.RepoLogField] = pj.Spec.Refs.Repo
+		if len(pj.Spec.Refs.Pulls) == 1 {
+			fields[github.PrLogField] = pj.Spec.Refs.Pulls[0].Number
+		}
 	}
 	return fields
 }
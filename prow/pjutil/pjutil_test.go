@@ -171,6 +171,18 @@ func TestPresubmitSpec(t *testing.T) {
 				Report: true,
 			},
 		},
+		{
+			name: "optional jobs are marked as optional",
+			p: config.Presubmit{
+				Optional: true,
+			},
+			expected: prowapi.ProwJobSpec{
+				Type:     prowapi.PresubmitJob,
+				Refs:     &prowapi.Refs{},
+				Report:   true,
+				Optional: true,
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -252,6 +264,103 @@ func TestBatchSpec(t *testing.T) {
 	}
 }
 
+// TestSpecBuilders makes sure that every builder carries all the fields of
+// the job base into the spec the same way.
+func TestSpecBuilders(t *testing.T) {
+	namespace := "test-pods"
+	podSpec := &kube.PodSpec{Containers: []kube.Container{{Image: "alpine"}}}
+	decorationConfig := &prowapi.DecorationConfig{Timeout: time.Hour}
+	extraRefs := []prowapi.Refs{{Org: "org", Repo: "tools", BaseRef: "master"}}
+	jobBase := config.JobBase{
+		Name:             "job",
+		Labels:           map[string]string{"label": "only-on-the-prowjob"},
+		MaxConcurrency:   2,
+		ConcurrencyGroup: "group",
+		Agent:            string(prowapi.KubernetesAgent),
+		Cluster:          "build",
+		Namespace:        &namespace,
+		ErrorOnEviction:  true,
+		SlackReport:      true,
+		Spec:             podSpec,
+		UtilityConfig: config.UtilityConfig{
+			Decorate:         true,
+			PathAlias:        "k8s.io/repo",
+			SkipSubmodules:   true,
+			ExtraRefs:        extraRefs,
+			DecorationConfig: decorationConfig,
+		},
+	}
+	refs := prowapi.Refs{Org: "org", Repo: "repo", BaseRef: "master", BaseSHA: "abcdef", Pulls: []prowapi.Pull{{Number: 5, SHA: "123456"}}}
+	expectedRefs := refs
+	expectedRefs.PathAlias = "k8s.io/repo"
+	expectedRefs.SkipSubmodules = true
+	base := prowapi.ProwJobSpec{
+		Job:              "job",
+		Agent:            prowapi.KubernetesAgent,
+		Cluster:          "build",
+		Namespace:        "test-pods",
+		MaxConcurrency:   2,
+		ConcurrencyGroup: "group",
+		ErrorOnEviction:  true,
+		SlackReport:      true,
+		ExtraRefs:        extraRefs,
+		DecorationConfig: decorationConfig,
+		PodSpec:          podSpec,
+	}
+
+	presubmit := config.Presubmit{
+		JobBase:      jobBase,
+		Optional:     true,
+		RerunCommand: "/test job",
+		Reporter:     config.Reporter{Context: "ci/job"},
+	}
+	postsubmit := config.Postsubmit{
+		JobBase:  jobBase,
+		Reporter: config.Reporter{Context: "ci/job", SkipReport: true},
+	}
+	periodic := config.Periodic{JobBase: jobBase, Interval: "1h"}
+
+	expectedPresubmit := base
+	expectedPresubmit.Type = prowapi.PresubmitJob
+	expectedPresubmit.Refs = &expectedRefs
+	expectedPresubmit.Context = "ci/job"
+	expectedPresubmit.Report = true
+	expectedPresubmit.Optional = true
+	expectedPresubmit.RerunCommand = "/test job"
+
+	expectedPostsubmit := base
+	expectedPostsubmit.Type = prowapi.PostsubmitJob
+	expectedPostsubmit.Refs = &expectedRefs
+	expectedPostsubmit.Context = "ci/job"
+
+	expectedBatch := base
+	expectedBatch.Type = prowapi.BatchJob
+	expectedBatch.Refs = &expectedRefs
+	expectedBatch.Context = "ci/job"
+
+	expectedPeriodic := base
+	expectedPeriodic.Type = prowapi.PeriodicJob
+
+	testCases := []struct {
+		name     string
+		actual   prowapi.ProwJobSpec
+		expected prowapi.ProwJobSpec
+	}{
+		{name: "presubmit", actual: PresubmitSpec(presubmit, refs), expected: expectedPresubmit},
+		{name: "postsubmit", actual: PostsubmitSpec(postsubmit, refs), expected: expectedPostsubmit},
+		{name: "batch", actual: BatchSpec(presubmit, refs), expected: expectedBatch},
+		{name: "periodic", actual: PeriodicSpec(periodic), expected: expectedPeriodic},
+	}
+	for _, tc := range testCases {
+		if !equality.Semantic.DeepEqual(tc.actual, tc.expected) {
+			t.Errorf("%s: unexpected spec: %s", tc.name, diff.ObjectReflectDiff(tc.expected, tc.actual))
+		}
+	}
+	if refs.PathAlias != "" {
+		t.Error("building the specs modified the refs of the caller")
+	}
+}
+
 func TestPartitionActive(t *testing.T) {
 	tests := []struct {
 		pjs []prowapi.ProwJob
@@ -426,6 +535,81 @@ func TestGetLatestProwJobs(t *testing.T) {
 	}
 }
 
+func TestPartitionActiveSkipsComplete(t *testing.T) {
+	completed := metav1.Now()
+	pjs := []prowapi.ProwJob{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "pending"},
+			Status:     prowapi.ProwJobStatus{State: prowapi.PendingState},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "completed-pending"},
+			Status:     prowapi.ProwJobStatus{State: prowapi.PendingState, CompletionTime: &completed},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "completed-triggered"},
+			Status:     prowapi.ProwJobStatus{State: prowapi.TriggeredState, CompletionTime: &completed},
+		},
+	}
+	pendingCh, triggeredCh := PartitionActive(pjs)
+	var pending []string
+	for pj := range pendingCh {
+		pending = append(pending, pj.ObjectMeta.Name)
+	}
+	if expected := []string{"pending"}; !reflect.DeepEqual(pending, expected) {
+		t.Errorf("expected pending jobs %v, got %v", expected, pending)
+	}
+	for pj := range triggeredCh {
+		t.Errorf("expected no triggered jobs, got %s", pj.ObjectMeta.Name)
+	}
+}
+
+func TestGetLatestProwJobsTies(t *testing.T) {
+	start := metav1.Date(2019, time.May, 1, 12, 0, 0, 0, time.UTC)
+	job := func(name string, startTime, creationTime metav1.Time) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: creationTime},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: "ci-job"},
+			Status:     prowapi.ProwJobStatus{StartTime: startTime},
+		}
+	}
+	later := metav1.NewTime(start.Add(time.Minute))
+	testCases := []struct {
+		name     string
+		pjs      []prowapi.ProwJob
+		expected string
+	}{
+		{
+			name:     "later start time wins",
+			pjs:      []prowapi.ProwJob{job("b", later, start), job("a", start, later)},
+			expected: "b",
+		},
+		{
+			name:     "same start time, later creation wins",
+			pjs:      []prowapi.ProwJob{job("b", start, start), job("a", start, later)},
+			expected: "a",
+		},
+		{
+			name:     "same start and creation time, name decides",
+			pjs:      []prowapi.ProwJob{job("a", start, start), job("b", start, start)},
+			expected: "b",
+		},
+		{
+			name:     "job without a start time is still found",
+			pjs:      []prowapi.ProwJob{job("a", metav1.Time{}, metav1.Time{})},
+			expected: "a",
+		},
+	}
+	for _, tc := range testCases {
+		for _, pjs := range [][]prowapi.ProwJob{tc.pjs, {tc.pjs[len(tc.pjs)-1], tc.pjs[0]}} {
+			latest, ok := GetLatestProwJobs(pjs, prowapi.PeriodicJob)["ci-job"]
+			if !ok || latest.ObjectMeta.Name != tc.expected {
+				t.Errorf("%s: expected %q as the latest job, got %q", tc.name, tc.expected, latest.ObjectMeta.Name)
+			}
+		}
+	}
+}
+
 func TestNewProwJob(t *testing.T) {
 	var testCases = []struct {
 		name           string
@@ -18,11 +18,15 @@ package pjutil
 
 import (
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"strings"
 	"time"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
@@ -30,8 +34,12 @@ import (
 	"k8s.io/test-infra/prow/pod-utils/downwardapi"
 
 	"github.com/bwmarrin/snowflake"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// maxSnowflakeNodeID is the largest node ID the snowflake library accepts.
+const maxSnowflakeNodeID = 1023
+
 var (
 	node  *snowflake.Node
 	sleep = time.Sleep
@@ -39,12 +47,47 @@ var (
 
 func init() {
 	var err error
-	node, err = snowflake.NewNode(1)
+	node, err = snowflake.NewNode(SnowflakeNodeID(hostIdentity()))
 	if err != nil {
 		log.Fatalf("failed to register snowflake node: %v", err)
 	}
 }
 
+// SnowflakeNodeID derives a snowflake node ID from the identity of a host,
+// like its hostname, so that replicas running on distinct pods or hosts vend
+// distinct build IDs without coordinating.
+func SnowflakeNodeID(identity string) int64 {
+	h := fnv.New32a()
+	h.Write([]byte(identity))
+	return int64(h.Sum32() % (maxSnowflakeNodeID + 1))
+}
+
+// SetSnowflakeNodeID overrides the node ID derived from the identity of the
+// host for build IDs vended without tot.
+func SetSnowflakeNodeID(id int64) error {
+	n, err := snowflake.NewNode(id)
+	if err != nil {
+		return err
+	}
+	node = n
+	return nil
+}
+
+// hostIdentity returns the hostname, which is the pod name in Kubernetes,
+// falling back to the addresses of the host if it is not known.
+func hostIdentity() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	var addrs []string
+	if ifaceAddrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range ifaceAddrs {
+			addrs = append(addrs, addr.String())
+		}
+	}
+	return strings.Join(addrs, ",")
+}
+
 // PresubmitToJobSpec generates a downwardapi.JobSpec out of a Presubmit.
 // Useful for figuring out GCS paths when parsing jobs out
 // of a prow config.
@@ -75,9 +118,20 @@ func PeriodicToJobSpec(periodic config.Periodic) *downwardapi.JobSpec {
 	}
 }
 
+// DefaultBuildIDAttempts is how many times GetBuildID asks tot for a
+// build ID before it gives up.
+const DefaultBuildIDAttempts = 10
+
 // GetBuildID calls out to `tot` in order
 // to vend build identifier for the job
 func GetBuildID(name, totURL string) (string, error) {
+	return GetBuildIDWithAttempts(name, totURL, DefaultBuildIDAttempts)
+}
+
+// GetBuildIDWithAttempts is like GetBuildID, but asks tot up to the given
+// number of times, backing off exponentially with jitter between attempts
+// so that replicas do not retry in lockstep.
+func GetBuildIDWithAttempts(name, totURL string, attempts int) (string, error) {
 	if totURL == "" {
 		return node.Generate().String(), nil
 	}
@@ -88,27 +142,33 @@ func GetBuildID(name, totURL string) (string, error) {
 	}
 	url.Path = path.Join(url.Path, "vend", name)
 	sleepDuration := 100 * time.Millisecond
-	for retries := 0; retries < 10; retries++ {
+	for retries := 0; retries < attempts; retries++ {
 		if retries > 0 {
-			sleep(sleepDuration)
+			sleep(wait.Jitter(sleepDuration, 1.0))
 			sleepDuration = sleepDuration * 2
 		}
-		var resp *http.Response
-		resp, err = http.Get(url.String())
-		if err != nil {
-			continue
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			err = fmt.Errorf("got unexpected response from tot: %v", resp.Status)
-			continue
-		}
-		var buf []byte
-		buf, err = ioutil.ReadAll(resp.Body)
+		var buildID string
+		buildID, err = vendBuildID(url.String())
 		if err == nil {
-			return string(buf), nil
+			return buildID, nil
 		}
-		return "", err
 	}
 	return "", err
 }
+
+// vendBuildID makes one request for a build ID to tot.
+func vendBuildID(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("got unexpected response from tot: %v", resp.Status)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
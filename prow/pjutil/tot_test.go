@@ -106,3 +106,82 @@ func TestGetBuildID(t *testing.T) {
 		totServ.Close()
 	}
 }
+
+func TestGetBuildIDWithAttempts(t *testing.T) {
+	var slept []time.Duration
+	oldSleep := sleep
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = oldSleep }()
+
+	var testCases = []struct {
+		name        string
+		attempts    int
+		expected    string
+		expectedErr bool
+	}{
+		{
+			name:     "tot recovers in time",
+			attempts: 3,
+			expected: "42",
+		},
+		{
+			name:        "out of attempts",
+			attempts:    2,
+			expectedErr: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		slept = nil
+		totServ := parrotServer([]int{500, 503, 200}, []string{"boo", "boo", "42"})
+
+		actual, actualErr := GetBuildIDWithAttempts("dummy", totServ.URL, testCase.attempts)
+		if testCase.expectedErr && actualErr == nil {
+			t.Errorf("%s: expected an error but got none", testCase.name)
+		} else if !testCase.expectedErr && actualErr != nil {
+			t.Errorf("%s: expected no error but got one: %v", testCase.name, actualErr)
+		} else if !testCase.expectedErr && actual != testCase.expected {
+			t.Errorf("%s: expected response %v but got: %v", testCase.name, testCase.expected, actual)
+		}
+		if len(slept) != testCase.attempts-1 {
+			t.Errorf("%s: expected to back off %d times, got %v", testCase.name, testCase.attempts-1, slept)
+		}
+		backoff := 100 * time.Millisecond
+		for i, d := range slept {
+			if d < backoff || d > 2*backoff {
+				t.Errorf("%s: expected backoff %d to be between %v and %v, got %v", testCase.name, i, backoff, 2*backoff, d)
+			}
+			backoff *= 2
+		}
+
+		totServ.Close()
+	}
+}
+
+func TestSnowflakeNodeID(t *testing.T) {
+	identities := []string{"", "plank-5f7c9d8b4-x2x7q", "plank-5f7c9d8b4-k8j2m", "10.0.0.1", "10.0.0.2"}
+	for _, identity := range identities {
+		id := SnowflakeNodeID(identity)
+		if id < 0 || id > maxSnowflakeNodeID {
+			t.Errorf("%q: node ID %d is outside of [0, %d]", identity, id, maxSnowflakeNodeID)
+		}
+		if again := SnowflakeNodeID(identity); again != id {
+			t.Errorf("%q: expected stable node ID %d, got %d", identity, id, again)
+		}
+	}
+	if SnowflakeNodeID(identities[1]) == SnowflakeNodeID(identities[2]) {
+		t.Errorf("expected distinct pods to derive distinct node IDs")
+	}
+}
+
+func TestSetSnowflakeNodeID(t *testing.T) {
+	oldNode := node
+	defer func() { node = oldNode }()
+
+	if err := SetSnowflakeNodeID(maxSnowflakeNodeID); err != nil {
+		t.Errorf("expected no error for node ID %d, got: %v", maxSnowflakeNodeID, err)
+	}
+	if err := SetSnowflakeNodeID(maxSnowflakeNodeID + 1); err == nil {
+		t.Errorf("expected an error for node ID %d", maxSnowflakeNodeID+1)
+	}
+}
@@ -17,7 +17,12 @@ limitations under the License.
 package plank
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +30,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	coreapi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
@@ -34,10 +40,18 @@ import (
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pjutil"
 	"k8s.io/test-infra/prow/pod-utils/decorate"
+	"k8s.io/test-infra/prow/pod-utils/downwardapi"
 )
 
 const (
 	testInfra = "https://github.com/kubernetes/test-infra/issues"
+
+	// syncTimeout bounds the time a single sync may spend talking to
+	// the apiservers so that one stuck request cannot wedge the loop.
+	syncTimeout = 15 * time.Minute
+	// reportTimeout bounds the time the reporters may spend on the jobs
+	// of a single sync, including waiting to retry rate limited reports.
+	reportTimeout = 2 * time.Minute
 )
 
 type kubeClient interface {
@@ -45,10 +59,25 @@ type kubeClient interface {
 	GetProwJob(string) (prowapi.ProwJob, error)
 	ListProwJobs(string) ([]prowapi.ProwJob, error)
 	ReplaceProwJob(string, prowapi.ProwJob) (prowapi.ProwJob, error)
+	DeleteProwJob(string) error
 
 	CreatePod(v1.Pod) (coreapi.Pod, error)
 	ListPods(string) ([]coreapi.Pod, error)
-	DeletePod(string) error
+	DeletePod(string, kube.DeleteOptions) error
+}
+
+// contextualKubeClient is implemented by kube clients that can bind
+// their requests to a context.
+type contextualKubeClient interface {
+	WithContext(context.Context) *kube.Client
+}
+
+// withContext returns a copy of kc bound to ctx, if kc supports it.
+func withContext(ctx context.Context, kc kubeClient) kubeClient {
+	if cc, ok := kc.(contextualKubeClient); ok {
+		return cc.WithContext(ctx)
+	}
+	return kc
 }
 
 // GitHubClient contains the methods used by plank on k8s.io/test-infra/prow/github.Client
@@ -65,7 +94,7 @@ type GitHubClient interface {
 }
 
 // TODO: Dry this out
-type syncFn func(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error
+type syncFn func(log *logrus.Entry, pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error
 
 // Controller manages ProwJobs.
 type Controller struct {
@@ -78,17 +107,36 @@ type Controller struct {
 	// selector that will be applied on prowjobs and pods.
 	selector string
 
+	// syncLock serializes Sync with the calls outside of it, such as
+	// SyncOne and RequeueJob, that rebuild pendingJobs and queue as well,
+	// and with AbortJobsForPull, which replaces the jobs Sync works on.
+	syncLock sync.Mutex
+
 	lock sync.RWMutex
 	// pendingJobs is a short-lived cache that helps in limiting
 	// the maximum concurrency of jobs.
 	pendingJobs map[string]int
+	// queue holds the positions in line of the triggered jobs that
+	// wait for a free slot of their concurrency key in this sync.
+	queue map[string]int
 
 	pjLock sync.RWMutex
 	// shared across the controller and a goroutine that gathers metrics.
 	pjs []prowapi.ProwJob
+	// snapshot is recorded at the end of every sync.
+	snapshot Metrics
 
 	// if skip report job results to github
 	skipReport bool
+	// reporters are registered in addition to the GitHub reporter.
+	reporters []Reporter
+}
+
+// Reporter reports the state of the ProwJobs that plank synced, for example
+// as GitHub statuses or as messages to a chat. Reporters stop waiting, for
+// example to retry a report, once the context is done.
+type Reporter interface {
+	Report(ctx context.Context, pj prowapi.ProwJob) error
 }
 
 // NewController creates a new Controller from the provided clients.
@@ -114,11 +162,20 @@ func NewController(kc *kube.Client, pkcs map[string]*kube.Client, ghc GitHubClie
 }
 
 // canExecuteConcurrently checks whether the provided ProwJob can
-// be executed concurrently.
+// be executed concurrently. Jobs with UnlimitedConcurrency are not
+// held back by the global limit either.
 func (c *Controller) canExecuteConcurrently(pj *prowapi.ProwJob) bool {
+	key := concurrencyKey(pj)
+	maxConcurrency := c.maxConcurrency(pj)
+
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if maxConcurrency == prowapi.UnlimitedConcurrency {
+		c.pendingJobs[key]++
+		return true
+	}
+
 	if max := c.config().Plank.MaxConcurrency; max > 0 {
 		var running int
 		for _, num := range c.pendingJobs {
@@ -130,34 +187,156 @@ func (c *Controller) canExecuteConcurrently(pj *prowapi.ProwJob) bool {
 		}
 	}
 
-	if pj.Spec.MaxConcurrency == 0 {
-		c.pendingJobs[pj.Spec.Job]++
+	if maxConcurrency == 0 {
+		c.pendingJobs[key]++
 		return true
 	}
 
-	numPending := c.pendingJobs[pj.Spec.Job]
-	if numPending >= pj.Spec.MaxConcurrency {
-		c.log.WithFields(pjutil.ProwJobFields(pj)).Debugf("Not starting another instance of %s, already %d running.", pj.Spec.Job, numPending)
+	numPending := c.pendingJobs[key]
+	if numPending >= maxConcurrency {
+		c.log.WithFields(pjutil.ProwJobFields(pj)).Debugf("Not starting another instance of %s, already %d running.", key, numPending)
 		return false
 	}
-	c.pendingJobs[pj.Spec.Job]++
+	c.pendingJobs[key]++
 	return true
 }
 
+// maxConcurrency returns how many instances of the ProwJob's
+// concurrency key may run at once. The job's own limit takes
+// precedence, 0 falls back to the default for its type. The result is
+// 0 if only the global limit applies, or UnlimitedConcurrency if
+// not even that does.
+func (c *Controller) maxConcurrency(pj *prowapi.ProwJob) int {
+	if pj.Spec.MaxConcurrency != 0 {
+		return pj.Spec.MaxConcurrency
+	}
+	return c.config().Plank.DefaultMaxConcurrencyByType[pj.Spec.Type]
+}
+
+// queueJobs lines up the triggered jobs of each concurrency key in the
+// order they were triggered, after the slots that are free now. It must
+// be called once the pending jobs are counted.
+func (c *Controller) queueJobs(pjs []prowapi.ProwJob) {
+	var triggered []prowapi.ProwJob
+	for _, pj := range pjs {
+		if pj.Status.State == prowapi.TriggeredState {
+			triggered = append(triggered, pj)
+		}
+	}
+	sort.SliceStable(triggered, func(i, j int) bool {
+		a, b := triggered[i].Status.StartTime, triggered[j].Status.StartTime
+		if !a.Equal(&b) {
+			return a.Before(&b)
+		}
+		return triggered[i].ObjectMeta.Name < triggered[j].ObjectMeta.Name
+	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.queue = make(map[string]int)
+	lined := map[string]int{}
+	for i := range triggered {
+		pj := &triggered[i]
+		key := concurrencyKey(pj)
+		lined[key]++
+		c.queue[pj.ObjectMeta.Name] = lined[key] - (c.maxConcurrency(pj) - c.pendingJobs[key])
+	}
+}
+
+// setQueuePosition records the position in line of a job that waits for
+// a free slot of its concurrency key in its description.
+func (s *syncer) setQueuePosition(pj prowapi.ProwJob) error {
+	max := s.maxConcurrency(&pj)
+	s.lock.RLock()
+	position, queued := s.queue[pj.ObjectMeta.Name]
+	full := s.pendingJobs[concurrencyKey(&pj)] >= max
+	s.lock.RUnlock()
+	if !queued || max <= 0 || !full {
+		// The job waits for the limit on all jobs.
+		return nil
+	}
+	if position < 1 {
+		// Jobs further back in line took the free slots first.
+		position = 1
+	}
+	description := fmt.Sprintf("Waiting for a free slot, %s in line.", ordinal(position))
+	if pj.Status.Description == description {
+		return nil
+	}
+	pj.Status.Description = description
+	_, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+	return err
+}
+
+// ordinal formats a positive number as 1st, 2nd, 3rd, 4th and so on.
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// concurrencyKey returns the identifier under which pending
+// instances of the ProwJob are counted: its concurrency group
+// if one is set, otherwise the job name.
+func concurrencyKey(pj *prowapi.ProwJob) string {
+	if pj.Spec.ConcurrencyGroup != "" {
+		return pj.Spec.ConcurrencyGroup
+	}
+	return pj.Spec.Job
+}
+
+// resetPendingJobs forgets the pending jobs counted so far.
+func (c *Controller) resetPendingJobs() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pendingJobs = make(map[string]int)
+}
+
+// PendingJobsHandler serves, as JSON, how many pending jobs the controller
+// counts towards max_concurrency for each job name or concurrency group.
+// The counts are rebuilt on every sync, so they may be partial during one.
+func (c *Controller) PendingJobsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		c.lock.RLock()
+		b, err := json.Marshal(c.pendingJobs)
+		c.lock.RUnlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+}
+
 // incrementNumPendingJobs increments the amount of
 // pending ProwJobs for the given job identifier
-func (c *Controller) incrementNumPendingJobs(job string) {
+func (c *Controller) incrementNumPendingJobs(pj *prowapi.ProwJob) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.pendingJobs[job]++
+	c.pendingJobs[concurrencyKey(pj)]++
 }
 
 // setPreviousReportState sets the github key for PrevReportStates
 // to current state. This is a work-around for plank -> crier
 // migration to become seamless.
-func (c *Controller) setPreviousReportState(pj prowapi.ProwJob) error {
+func (s *syncer) setPreviousReportState(pj prowapi.ProwJob) error {
 	// fetch latest before replace
-	latestPJ, err := c.kc.GetProwJob(pj.ObjectMeta.Name)
+	latestPJ, err := s.kc.GetProwJob(pj.ObjectMeta.Name)
 	if err != nil {
 		return err
 	}
@@ -166,43 +345,95 @@ func (c *Controller) setPreviousReportState(pj prowapi.ProwJob) error {
 		latestPJ.Status.PrevReportStates = map[string]prowapi.ProwJobState{}
 	}
 	latestPJ.Status.PrevReportStates[reporter.GithubReporterName] = latestPJ.Status.State
-	_, err = c.kc.ReplaceProwJob(latestPJ.ObjectMeta.Name, latestPJ)
+	_, err = s.kc.ReplaceProwJob(latestPJ.ObjectMeta.Name, latestPJ)
 	return err
 }
 
+// syncer syncs ProwJobs for the controller with copies of its clients
+// that are bound to the context of one call, such as a single Sync, so
+// that calls never change the clients of one another.
+type syncer struct {
+	*Controller
+	ctx  context.Context
+	kc   kubeClient
+	pkcs map[string]kubeClient
+}
+
+// bind returns a syncer whose clients are bound to ctx.
+func (c *Controller) bind(ctx context.Context) *syncer {
+	s := &syncer{
+		Controller: c,
+		ctx:        ctx,
+		kc:         withContext(ctx, c.kc),
+		pkcs:       make(map[string]kubeClient, len(c.pkcs)),
+	}
+	for alias, client := range c.pkcs {
+		s.pkcs[alias] = withContext(ctx, client)
+	}
+	return s
+}
+
+// jobSelector returns the label selector for the jobs that plank syncs,
+// from its flags and its config.
+func (c *Controller) jobSelector() string {
+	var selectors []string
+	for _, selector := range []string{c.selector, c.config().Plank.JobSelector} {
+		if len(selector) > 0 {
+			selectors = append(selectors, selector)
+		}
+	}
+	return strings.Join(selectors, ",")
+}
+
+// podSelector returns the label selector for the pods that plank created.
+func (c *Controller) podSelector() string {
+	selector := fmt.Sprintf("%s=true", kube.CreatedByProw)
+	if jobSelector := c.jobSelector(); len(jobSelector) > 0 {
+		selector = strings.Join([]string{jobSelector, selector}, ",")
+	}
+	return selector
+}
+
 // Sync does one sync iteration.
 func (c *Controller) Sync() error {
-	pjs, err := c.kc.ListProwJobs(c.selector)
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	s := c.bind(ctx)
+
+	pjs, err := s.kc.ListProwJobs(c.jobSelector())
 	if err != nil {
 		return fmt.Errorf("error listing prow jobs: %v", err)
 	}
-	selector := fmt.Sprintf("%s=true", kube.CreatedByProw)
-	if len(c.selector) > 0 {
-		selector = strings.Join([]string{c.selector, selector}, ",")
-	}
+	selector := c.podSelector()
 
 	pm := map[string]kube.Pod{}
-	for alias, client := range c.pkcs {
+	for alias, client := range s.pkcs {
 		pods, err := client.ListPods(selector)
 		if err != nil {
 			return fmt.Errorf("error listing pods in cluster %q: %v", alias, err)
 		}
 		for _, pod := range pods {
-			pm[pod.ObjectMeta.Name] = pod
+			addPod(pm, pod)
 		}
 	}
 	// TODO: Replace the following filtering with a field selector once CRDs support field selectors.
 	// https://github.com/kubernetes/kubernetes/issues/53459
 	var k8sJobs []prowapi.ProwJob
 	for _, pj := range pjs {
-		if pj.Spec.Agent == prowapi.KubernetesAgent {
+		if pj.Spec.Agent == prowapi.KubernetesAgent && !pj.Status.Paused {
 			k8sJobs = append(k8sJobs, pj)
 		}
 	}
 	pjs = k8sJobs
 
 	var syncErrs []error
-	if err := c.terminateDupes(pjs, pm); err != nil {
+	pjs, err = s.reapOldProwJobs(pjs)
+	if err != nil {
+		syncErrs = append(syncErrs, err)
+	}
+	if err := s.terminateDupes(pjs, pm); err != nil {
 		syncErrs = append(syncErrs, err)
 	}
 
@@ -212,19 +443,23 @@ func (c *Controller) Sync() error {
 	c.pjLock.Unlock()
 
 	pendingCh, triggeredCh := pjutil.PartitionActive(pjs)
+	if c.config().Plank.FairScheduling {
+		triggeredCh = fairlyOrdered(pjs, triggeredCh)
+	}
 	errCh := make(chan error, len(pjs))
 	reportCh := make(chan prowapi.ProwJob, len(pjs))
 
 	// Reinstantiate on every resync of the controller instead of trying
 	// to keep this in sync with the state of the world.
-	c.pendingJobs = make(map[string]int)
+	c.resetPendingJobs()
 	// Sync pending jobs first so we can determine what is the maximum
 	// number of new jobs we can trigger when syncing the non-pendings.
 	maxSyncRoutines := c.config().Plank.MaxGoroutines
 	c.log.Debugf("Handling %d pending prowjobs", len(pendingCh))
-	syncProwJobs(c.log, c.syncPendingJob, maxSyncRoutines, pendingCh, reportCh, errCh, pm)
+	syncProwJobs(c.log, s.syncPendingJob, maxSyncRoutines, pendingCh, reportCh, errCh, pm)
+	c.queueJobs(pjs)
 	c.log.Debugf("Handling %d triggered prowjobs", len(triggeredCh))
-	syncProwJobs(c.log, c.syncTriggeredJob, maxSyncRoutines, triggeredCh, reportCh, errCh, pm)
+	syncProwJobs(c.log, s.syncTriggeredJob, maxSyncRoutines, triggeredCh, reportCh, errCh, pm)
 
 	close(errCh)
 	close(reportCh)
@@ -233,29 +468,297 @@ func (c *Controller) Sync() error {
 		syncErrs = append(syncErrs, err)
 	}
 
-	var reportErrs []error
-	if !c.skipReport {
-		reportTemplate := c.config().Plank.ReportTemplate
-		reportTypes := c.config().GithubReporter.JobTypesToReport
-		for report := range reportCh {
-			if err := reportlib.Report(c.ghc, reportTemplate, report, reportTypes); err != nil {
-				reportErrs = append(reportErrs, err)
-				c.log.WithFields(pjutil.ProwJobFields(&report)).WithError(err).Warn("Failed to report ProwJob status")
-			}
+	reportErrs := s.reportJobs(reportCh)
+	c.recordSnapshot(pjs)
 
-			// plank is not retrying on errors, so we just set the current state as reported
-			if err := c.setPreviousReportState(report); err != nil {
-				c.log.WithFields(pjutil.ProwJobFields(&report)).WithError(err).Error("Failed to patch PrevReportStates")
-			}
+	if len(syncErrs) == 0 && len(reportErrs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("errors syncing: %v, errors reporting: %v", syncErrs, reportErrs)
+}
+
+// SyncOne reconciles the single ProwJob with the given name, as Sync would,
+// and returns the state the job ends up in. It is meant for tests and for
+// operators who need to act on one job without waiting for a full resync.
+func (c *Controller) SyncOne(name string) (prowapi.ProwJobState, error) {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	s := c.bind(ctx)
+
+	pj, err := s.kc.GetProwJob(name)
+	if err != nil {
+		return "", fmt.Errorf("error getting prow job %s: %v", name, err)
+	}
+	if pj.Spec.Agent != prowapi.KubernetesAgent {
+		return "", fmt.Errorf("prow job %s has agent %q, not %q", name, pj.Spec.Agent, prowapi.KubernetesAgent)
+	}
+	if pj.Status.Paused {
+		return pj.Status.State, nil
+	}
+
+	var sync syncFn
+	switch pj.Status.State {
+	case prowapi.PendingState:
+		sync = s.syncPendingJob
+	case prowapi.TriggeredState:
+		sync = s.syncTriggeredJob
+	default:
+		return pj.Status.State, nil
+	}
+
+	client, ok := s.pkcs[pj.ClusterAlias()]
+	if !ok {
+		return "", fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
+	}
+	pods, err := client.ListPods(c.podSelector())
+	if err != nil {
+		return "", fmt.Errorf("error listing pods in cluster %q: %v", pj.ClusterAlias(), err)
+	}
+	pm := map[string]kube.Pod{}
+	for _, pod := range pods {
+		addPod(pm, pod)
+	}
+
+	// Count the pending jobs so that triggering this one respects the
+	// concurrency limits.
+	pjs, err := s.kc.ListProwJobs(c.jobSelector())
+	if err != nil {
+		return "", fmt.Errorf("error listing prow jobs: %v", err)
+	}
+	var active []prowapi.ProwJob
+	for _, other := range pjs {
+		if other.Spec.Agent == prowapi.KubernetesAgent && !other.Status.Paused {
+			active = append(active, other)
+		}
+	}
+	c.resetPendingJobs()
+	for i := range active {
+		if active[i].Status.State == prowapi.PendingState && active[i].ObjectMeta.Name != name {
+			c.incrementNumPendingJobs(&active[i])
+		}
+	}
+	c.queueJobs(active)
+
+	reportCh := make(chan prowapi.ProwJob, 1)
+	log := c.log.WithFields(pjutil.ProwJobFields(&pj))
+	syncErr := sync(log, pj, pm, reportCh)
+	close(reportCh)
+	if reportErrs := s.reportJobs(reportCh); len(reportErrs) > 0 && syncErr == nil {
+		syncErr = fmt.Errorf("errors reporting: %v", reportErrs)
+	}
+
+	pj, err = s.kc.GetProwJob(name)
+	if err != nil {
+		return "", fmt.Errorf("error getting prow job %s: %v", name, err)
+	}
+	return pj.Status.State, syncErr
+}
+
+// RequeueJob syncs the triggered ProwJobs of the job with the given name
+// right away, as Sync would, so that those that can be started are started
+// without waiting for the next resync. Other jobs are left to Sync.
+func (c *Controller) RequeueJob(job string) error {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	s := c.bind(ctx)
+
+	pjs, err := s.kc.ListProwJobs(c.jobSelector())
+	if err != nil {
+		return fmt.Errorf("error listing prow jobs: %v", err)
+	}
+	var active, requeued []prowapi.ProwJob
+	for _, pj := range pjs {
+		if pj.Spec.Agent != prowapi.KubernetesAgent || pj.Status.Paused {
+			continue
+		}
+		active = append(active, pj)
+		if pj.Spec.Job == job && pj.Status.State == prowapi.TriggeredState {
+			requeued = append(requeued, pj)
+		}
+	}
+	if len(requeued) == 0 {
+		return nil
+	}
+
+	selector := c.podSelector()
+	pm := map[string]kube.Pod{}
+	for alias, client := range s.pkcs {
+		pods, err := client.ListPods(selector)
+		if err != nil {
+			return fmt.Errorf("error listing pods in cluster %q: %v", alias, err)
+		}
+		for _, pod := range pods {
+			addPod(pm, pod)
+		}
+	}
+
+	// Count the pending jobs so that the requeued ones respect the
+	// concurrency limits.
+	c.resetPendingJobs()
+	for i := range active {
+		if active[i].Status.State == prowapi.PendingState {
+			c.incrementNumPendingJobs(&active[i])
 		}
 	}
+	c.queueJobs(active)
 
+	triggeredCh := make(chan prowapi.ProwJob, len(requeued))
+	for _, pj := range requeued {
+		triggeredCh <- pj
+	}
+	close(triggeredCh)
+	errCh := make(chan error, len(requeued))
+	reportCh := make(chan prowapi.ProwJob, len(requeued))
+	c.log.WithField("job", job).Infof("Requeueing %d triggered prowjobs", len(requeued))
+	syncProwJobs(c.log, s.syncTriggeredJob, c.config().Plank.MaxGoroutines, triggeredCh, reportCh, errCh, pm)
+	close(errCh)
+	close(reportCh)
+
+	var syncErrs []error
+	for err := range errCh {
+		syncErrs = append(syncErrs, err)
+	}
+	reportErrs := s.reportJobs(reportCh)
 	if len(syncErrs) == 0 && len(reportErrs) == 0 {
 		return nil
 	}
 	return fmt.Errorf("errors syncing: %v, errors reporting: %v", syncErrs, reportErrs)
 }
 
+// AbortJobsForPull aborts the presubmit and batch ProwJobs of the pull
+// request that have not completed yet and deletes their pods. It is meant
+// to be called when the pull request is closed, so that its jobs stop
+// taking up capacity. Batches that test other pull requests as well are
+// left running for those.
+func (c *Controller) AbortJobsForPull(org, repo string, number int) error {
+	c.syncLock.Lock()
+	defer c.syncLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	s := c.bind(ctx)
+
+	pjs, err := s.kc.ListProwJobs(c.jobSelector())
+	if err != nil {
+		return fmt.Errorf("error listing prow jobs: %v", err)
+	}
+	var toAbort []prowapi.ProwJob
+	for _, pj := range pjs {
+		if pj.Spec.Agent == prowapi.KubernetesAgent && !pj.Complete() && forPull(pj, org, repo, number) {
+			toAbort = append(toAbort, pj)
+		}
+	}
+	if len(toAbort) == 0 {
+		return nil
+	}
+
+	selector := c.podSelector()
+	pm := map[string]kube.Pod{}
+	for alias, client := range s.pkcs {
+		pods, err := client.ListPods(selector)
+		if err != nil {
+			return fmt.Errorf("error listing pods in cluster %q: %v", alias, err)
+		}
+		for _, pod := range pods {
+			addPod(pm, pod)
+		}
+	}
+
+	var errs []error
+	for _, pj := range toAbort {
+		log := c.log.WithFields(pjutil.ProwJobFields(&pj))
+		if pod, exists := pm[pj.ObjectMeta.Name]; exists {
+			if client, ok := s.pkcs[pj.ClusterAlias()]; !ok {
+				log.Errorf("Unknown cluster alias %q.", pj.ClusterAlias())
+			} else if err := client.DeletePod(pod.ObjectMeta.Name, kube.DeleteOptions{}); err != nil {
+				log.WithError(err).Warn("Cannot delete pod")
+			}
+		}
+		pj.SetComplete()
+		prevState := pj.Status.State
+		pj.Status.State = prowapi.AbortedState
+		pj.Status.Description = "Pull request was closed."
+		log.WithField("from", prevState).
+			WithField("to", pj.Status.State).Info("Transitioning states.")
+		npj, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		recordCompletion(prevState, npj)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors aborting jobs of %s/%s#%d: %v", org, repo, number, errs)
+	}
+	return nil
+}
+
+// forPull tells whether the job is a presubmit or batch job that tests the
+// pull request only.
+func forPull(pj prowapi.ProwJob, org, repo string, number int) bool {
+	if pj.Spec.Type != prowapi.PresubmitJob && pj.Spec.Type != prowapi.BatchJob {
+		return false
+	}
+	refs := pj.Spec.Refs
+	if refs == nil || refs.Org != org || refs.Repo != repo || len(refs.Pulls) > 1 {
+		return false
+	}
+	for _, pull := range refs.Pulls {
+		if pull.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// AddReporter registers a reporter that every synced ProwJob is reported to
+// in addition to GitHub. Reporters must be added before syncing starts.
+func (c *Controller) AddReporter(r Reporter) {
+	c.reporters = append(c.reporters, r)
+}
+
+// githubReporter reports ProwJobs as GitHub statuses and comments.
+type githubReporter struct {
+	s *syncer
+}
+
+func (r githubReporter) Report(ctx context.Context, pj prowapi.ProwJob) error {
+	err := reportlib.Report(r.s.ghc, r.s.config().Plank.ReportTemplate, pj, r.s.config().GithubReporter.JobTypesToReport)
+
+	// plank is not retrying on errors, so we just set the current state as reported
+	if err := r.s.setPreviousReportState(pj); err != nil {
+		r.s.log.WithFields(pjutil.ProwJobFields(&pj)).WithError(err).Error("Failed to patch PrevReportStates")
+	}
+	return err
+}
+
+// reportJobs fans the given ProwJobs out to GitHub, unless reporting to it
+// is disabled, and to the registered reporters, and returns the errors
+// encountered.
+func (s *syncer) reportJobs(reportCh <-chan prowapi.ProwJob) []error {
+	var reporters []Reporter
+	if !s.skipReport {
+		reporters = append(reporters, githubReporter{s: s})
+	}
+	reporters = append(reporters, s.reporters...)
+
+	ctx, cancel := context.WithTimeout(s.ctx, reportTimeout)
+	defer cancel()
+	var reportErrs []error
+	for report := range reportCh {
+		for _, r := range reporters {
+			if err := r.Report(ctx, report); err != nil {
+				reportErrs = append(reportErrs, err)
+				s.log.WithFields(pjutil.ProwJobFields(&report)).WithError(err).Warn("Failed to report ProwJob status")
+			}
+		}
+	}
+	return reportErrs
+}
+
 // SyncMetrics records metrics for the cached prowjobs.
 func (c *Controller) SyncMetrics() {
 	c.pjLock.RLock()
@@ -263,17 +766,54 @@ func (c *Controller) SyncMetrics() {
 	kube.GatherProwJobMetrics(c.pjs)
 }
 
+// reapOldProwJobs deletes ProwJobs that completed longer than
+// MaxProwJobAge ago and returns the ones that are left. Incomplete
+// jobs are never deleted, nor is the latest run of each periodic
+// so that horologium can keep scheduling it.
+func (s *syncer) reapOldProwJobs(pjs []prowapi.ProwJob) ([]prowapi.ProwJob, error) {
+	maxAge := s.config().Plank.MaxProwJobAge
+	if maxAge == 0 {
+		return pjs, nil
+	}
+	latestPeriodics := pjutil.GetLatestProwJobs(pjs, prowapi.PeriodicJob)
+	var kept []prowapi.ProwJob
+	var errs []error
+	for _, pj := range pjs {
+		if !pj.Complete() || time.Since(pj.Status.CompletionTime.Time) <= maxAge {
+			kept = append(kept, pj)
+			continue
+		}
+		if pj.Spec.Type == prowapi.PeriodicJob && latestPeriodics[pj.Spec.Job].ObjectMeta.Name == pj.ObjectMeta.Name {
+			kept = append(kept, pj)
+			continue
+		}
+		if err := s.kc.DeleteProwJob(pj.ObjectMeta.Name); err != nil {
+			s.log.WithFields(pjutil.ProwJobFields(&pj)).WithError(err).Warn("Failed to delete old ProwJob.")
+			errs = append(errs, err)
+			kept = append(kept, pj)
+			continue
+		}
+		s.log.WithFields(pjutil.ProwJobFields(&pj)).Info("Deleted old ProwJob.")
+	}
+	if len(errs) > 0 {
+		return kept, fmt.Errorf("errors deleting old prowjobs: %v", errs)
+	}
+	return kept, nil
+}
+
 // terminateDupes aborts presubmits that have a newer version. It modifies pjs
 // in-place when it aborts.
 // TODO: Dry this out - need to ensure we can abstract children cancellation first.
-func (c *Controller) terminateDupes(pjs []prowapi.ProwJob, pm map[string]coreapi.Pod) error {
-	// "job org/repo#number" -> newest job
+func (s *syncer) terminateDupes(pjs []prowapi.ProwJob, pm map[string]coreapi.Pod) error {
+	// "type job org/repo#number" -> newest job
+	// The type is part of the key so that jobs of different types that share
+	// a name are never considered duplicates of each other.
 	dupes := make(map[string]int)
 	for i, pj := range pjs {
 		if pj.Complete() || pj.Spec.Type != prowapi.PresubmitJob {
 			continue
 		}
-		n := fmt.Sprintf("%s %s/%s#%d", pj.Spec.Job, pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.Pulls[0].Number)
+		n := fmt.Sprintf("%s %s %s/%s#%d", pj.Spec.Type, pj.Spec.Job, pj.Spec.Refs.Org, pj.Spec.Refs.Repo, pj.Spec.Refs.Pulls[0].Number)
 		prev, ok := dupes[n]
 		if !ok {
 			dupes[n] = i
@@ -287,30 +827,80 @@ func (c *Controller) terminateDupes(pjs []prowapi.ProwJob, pm map[string]coreapi
 		toCancel := pjs[cancelIndex]
 		// Allow aborting presubmit jobs for commits that have been superseded by
 		// newer commits in Github pull requests.
-		if c.config().Plank.AllowCancellations {
+		if s.config().Plank.AllowCancellations {
 			if pod, exists := pm[toCancel.ObjectMeta.Name]; exists {
-				if client, ok := c.pkcs[toCancel.ClusterAlias()]; !ok {
-					c.log.WithFields(pjutil.ProwJobFields(&toCancel)).Errorf("Unknown cluster alias %q.", toCancel.ClusterAlias())
-				} else if err := client.DeletePod(pod.ObjectMeta.Name); err != nil {
-					c.log.WithError(err).WithFields(pjutil.ProwJobFields(&toCancel)).Warn("Cannot delete pod")
+				if client, ok := s.pkcs[toCancel.ClusterAlias()]; !ok {
+					s.log.WithFields(pjutil.ProwJobFields(&toCancel)).Errorf("Unknown cluster alias %q.", toCancel.ClusterAlias())
+				} else if err := client.DeletePod(pod.ObjectMeta.Name, kube.DeleteOptions{}); err != nil {
+					s.log.WithError(err).WithFields(pjutil.ProwJobFields(&toCancel)).Warn("Cannot delete pod")
 				}
 			}
 		}
 		toCancel.SetComplete()
 		prevState := toCancel.Status.State
 		toCancel.Status.State = prowapi.AbortedState
-		c.log.WithFields(pjutil.ProwJobFields(&toCancel)).
+		s.log.WithFields(pjutil.ProwJobFields(&toCancel)).
 			WithField("from", prevState).
 			WithField("to", toCancel.Status.State).Info("Transitioning states.")
-		npj, err := c.kc.ReplaceProwJob(toCancel.ObjectMeta.Name, toCancel)
+		npj, err := s.kc.ReplaceProwJob(toCancel.ObjectMeta.Name, toCancel)
 		if err != nil {
 			return err
 		}
+		recordCompletion(prevState, npj)
 		pjs[cancelIndex] = npj
 	}
 	return nil
 }
 
+// fairlyOrdered reorders the triggered jobs so that jobs with distinct names
+// take turns: every next job is the oldest one of the name with the fewest
+// pending and already ordered jobs. Starting triggered jobs in that order
+// shares the slots left under the global max concurrency between job names.
+func fairlyOrdered(pjs []prowapi.ProwJob, triggered chan prowapi.ProwJob) chan prowapi.ProwJob {
+	counts := map[string]int{}
+	for _, pj := range pjs {
+		if pj.Status.State == prowapi.PendingState {
+			counts[pj.Spec.Job]++
+		}
+	}
+
+	byName := map[string][]prowapi.ProwJob{}
+	var names []string
+	total := 0
+	for pj := range triggered {
+		if _, seen := byName[pj.Spec.Job]; !seen {
+			names = append(names, pj.Spec.Job)
+		}
+		byName[pj.Spec.Job] = append(byName[pj.Spec.Job], pj)
+		total++
+	}
+	for _, name := range names {
+		jobs := byName[name]
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].CreationTimestamp.Before(&jobs[j].CreationTimestamp)
+		})
+	}
+	sort.Strings(names)
+
+	ordered := make(chan prowapi.ProwJob, total)
+	for i := 0; i < total; i++ {
+		next := ""
+		for _, name := range names {
+			if len(byName[name]) == 0 {
+				continue
+			}
+			if next == "" || counts[name] < counts[next] {
+				next = name
+			}
+		}
+		ordered <- byName[next][0]
+		byName[next] = byName[next][1:]
+		counts[next]++
+	}
+	close(ordered)
+	return ordered
+}
+
 // TODO: Dry this out
 func syncProwJobs(
 	l *logrus.Entry,
@@ -332,7 +922,7 @@ func syncProwJobs(
 		go func() {
 			defer wg.Done()
 			for pj := range jobs {
-				if err := syncFn(pj, pm, reports); err != nil {
+				if err := syncFn(l.WithFields(pjutil.ProwJobFields(&pj)), pj, pm, reports); err != nil {
 					syncErrors <- err
 				}
 			}
@@ -341,42 +931,54 @@ func syncProwJobs(
 	wg.Wait()
 }
 
-func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
+func (s *syncer) syncPendingJob(log *logrus.Entry, pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
 	// Record last known state so we can log state transitions.
 	prevState := pj.Status.State
 
 	pod, podExists := pm[pj.ObjectMeta.Name]
 	if !podExists {
-		c.incrementNumPendingJobs(pj.Spec.Job)
+		s.incrementNumPendingJobs(&pj)
 		// Pod is missing. This can happen in case the previous pod was deleted manually or by
 		// a rescheduler. Start a new pod.
-		id, pn, err := c.startPod(pj)
+		disappeared := pj.Status.PodRunning
+		id, pn, err := s.startPod(pj)
 		if err != nil {
-			_, isUnprocessable := err.(kube.UnprocessableEntityError)
-			if !isUnprocessable {
-				return fmt.Errorf("error starting pod: %v", err)
+			if err := s.startPodFailed(log, &pj, err); err != nil {
+				return s.recordStartPodError(log, pj, err)
 			}
-			pj.Status.State = prowapi.ErrorState
-			pj.SetComplete()
-			pj.Status.Description = "Job cannot be processed."
-			c.log.WithFields(pjutil.ProwJobFields(&pj)).WithError(err).Warning("Unprocessable pod.")
 		} else {
 			pj.Status.BuildID = id
 			pj.Status.PodName = pn
-			c.log.WithFields(pjutil.ProwJobFields(&pj)).Info("Pod is missing, starting a new pod")
+			pj.Status.PodRunning = false
+			if disappeared {
+				// The pod was running, so it was removed from under the job,
+				// for example by a node drain. Report that the job restarts.
+				log.Warn("Pod disappeared after it started running, starting a new pod")
+				pj.Status.Description = "Pod disappeared while running, restarting."
+			} else {
+				log.Info("Pod is missing, starting a new pod")
+			}
 		}
+	} else if state, overridden := podStateOverride(s.config().Plank.PodStateOverrides, pod); overridden {
+		// The operator decided how pods like this one end the job.
+		pj.SetComplete()
+		pj.Status.State = state
+		pj.Status.Description = completedDescription(state, pod)
 	} else {
 		switch pod.Status.Phase {
 		case coreapi.PodUnknown:
-			c.incrementNumPendingJobs(pj.Spec.Job)
+			s.incrementNumPendingJobs(&pj)
 			// Pod is in Unknown state. This can happen if there is a problem with
 			// the node. Delete the old pod, we'll start a new one next loop.
-			c.log.WithFields(pjutil.ProwJobFields(&pj)).Info("Pod is in unknown state, deleting & restarting pod")
-			client, ok := c.pkcs[pj.ClusterAlias()]
+			log.Info("Pod is in unknown state, deleting & restarting pod")
+			client, ok := s.pkcs[pj.ClusterAlias()]
 			if !ok {
 				return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
 			}
-			return client.DeletePod(pj.ObjectMeta.Name)
+			if err := client.DeletePod(pod.ObjectMeta.Name, forceDelete()); err != nil {
+				return err
+			}
+			pj.Status.PodRunning = false
 
 		case coreapi.PodSucceeded:
 			// Pod succeeded. Update ProwJob, talk to GitHub, and start next jobs.
@@ -394,55 +996,149 @@ func (c *Controller) syncPendingJob(pj prowapi.ProwJob, pm map[string]coreapi.Po
 					pj.Status.Description = "Job pod was evicted by the cluster."
 					break
 				}
+				pj.Status.PodEvictions++
+				if max := s.config().Plank.MaxPodEvictions; max > 0 && pj.Status.PodEvictions >= max {
+					// The job keeps getting evicted, give up on it.
+					pj.SetComplete()
+					pj.Status.State = prowapi.ErrorState
+					pj.Status.Description = fmt.Sprintf("Job pod was evicted by the cluster %d times.", pj.Status.PodEvictions)
+					break
+				}
 				// ErrorOnEviction is disabled. Delete the pod now and recreate it in
 				// the next resync.
-				c.incrementNumPendingJobs(pj.Spec.Job)
-				client, ok := c.pkcs[pj.ClusterAlias()]
+				s.incrementNumPendingJobs(&pj)
+				client, ok := s.pkcs[pj.ClusterAlias()]
 				if !ok {
 					return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
 				}
-				return client.DeletePod(pj.ObjectMeta.Name)
+				if err := client.DeletePod(pod.ObjectMeta.Name, forceDelete()); err != nil {
+					return err
+				}
+				pj.Status.PodRunning = false
+				pj.Status.Description = "Pod evicted, retrying."
+				break
 			}
 			// Pod failed. Update ProwJob, talk to GitHub.
 			pj.SetComplete()
 			pj.Status.State = prowapi.FailureState
 			pj.Status.Description = "Job failed."
+			if pod.Status.Reason == kube.DeadlineExceeded {
+				// The kubelet killed the pod at its active deadline.
+				pj.Status.Description = "Job timed out."
+			}
 
 		case coreapi.PodPending:
-			maxPodPending := c.config().Plank.PodPendingTimeout
+			maxPodPending := s.config().Plank.PodPendingTimeout
 			if pod.Status.StartTime.IsZero() || time.Since(pod.Status.StartTime.Time) < maxPodPending {
-				// Pod is running. Do nothing.
-				c.incrementNumPendingJobs(pj.Spec.Job)
-				return nil
+				// Pod is starting. Only record whether it can be scheduled.
+				s.incrementNumPendingJobs(&pj)
+				return s.setUnschedulableReason(log, pj, unschedulableReason(pod))
 			}
 
 			// Pod is stuck in pending state longer than maxPodPending
-			// abort the job, and talk to Github
+			// retry or abort the job, and talk to Github
+			if s.retryOnError(&pj, "Pod pending timeout.") {
+				client, ok := s.pkcs[pj.ClusterAlias()]
+				if !ok {
+					return fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
+				}
+				if err := client.DeletePod(pod.ObjectMeta.Name, forceDelete()); err != nil {
+					return err
+				}
+				break
+			}
 			pj.SetComplete()
 			pj.Status.State = prowapi.ErrorState
 			pj.Status.Description = "Pod pending timeout."
 
 		default:
-			// Pod is running. Do nothing.
-			c.incrementNumPendingJobs(pj.Spec.Job)
-			return nil
+			// Pod is running. Only record that it ran.
+			s.incrementNumPendingJobs(&pj)
+			if !pj.Status.PodRunning {
+				pj.Status.PodRunning = true
+				pj.Status.UnschedulableReason = ""
+				_, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+				return err
+			}
+			return s.setUnschedulableReason(log, pj, "")
 		}
 	}
 
-	pj.Status.URL = pjutil.JobURL(c.config().Plank, pj, c.log)
-
-	reports <- pj
+	pj.Status.UnschedulableReason = ""
+	pj.Status.URL = pjutil.JobURL(s.config().Plank, pj, log)
 
 	if prevState != pj.Status.State {
-		c.log.WithFields(pjutil.ProwJobFields(&pj)).
-			WithField("from", prevState).
+		log.WithField("from", prevState).
 			WithField("to", pj.Status.State).Info("Transitioning states.")
 	}
-	_, err := c.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+	if _, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj); err != nil {
+		return err
+	}
+	// Only report what was saved, or the next sync reports it again.
+	reports <- pj
+	recordCompletion(prevState, pj)
+	return nil
+}
+
+// podStateOverride returns the state that the first override matching the
+// phase and reason of the pod sets the job to, if any does.
+func podStateOverride(overrides []config.PodStateOverride, pod coreapi.Pod) (prowapi.ProwJobState, bool) {
+	for _, override := range overrides {
+		if override.Phase == pod.Status.Phase && (override.Reason == "" || override.Reason == pod.Status.Reason) {
+			return override.State, true
+		}
+	}
+	return "", false
+}
+
+// completedDescription describes a job that completed in the given state
+// because of an override for its pod.
+func completedDescription(state prowapi.ProwJobState, pod coreapi.Pod) string {
+	switch state {
+	case prowapi.SuccessState:
+		return "Job succeeded."
+	case prowapi.FailureState:
+		return "Job failed."
+	}
+	if pod.Status.Reason == "" {
+		return fmt.Sprintf("Job pod ended in phase %s.", pod.Status.Phase)
+	}
+	return fmt.Sprintf("Job pod ended in phase %s with reason %s.", pod.Status.Phase, pod.Status.Reason)
+}
+
+// unschedulableReason returns why the pod cannot be scheduled according to
+// its PodScheduled condition, or an empty string if nothing prevents it.
+func unschedulableReason(pod coreapi.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != coreapi.PodScheduled || condition.Status != coreapi.ConditionFalse {
+			continue
+		}
+		if condition.Message != "" {
+			return condition.Message
+		}
+		if condition.Reason != "" {
+			return condition.Reason
+		}
+		return coreapi.PodReasonUnschedulable
+	}
+	return ""
+}
+
+// setUnschedulableReason records why the pod of the pending job cannot be
+// scheduled, updating the job only when that changed.
+func (s *syncer) setUnschedulableReason(log *logrus.Entry, pj prowapi.ProwJob, reason string) error {
+	if pj.Status.UnschedulableReason == reason {
+		return nil
+	}
+	if reason != "" {
+		log.WithField("reason", reason).Info("Pod cannot be scheduled.")
+	}
+	pj.Status.UnschedulableReason = reason
+	_, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
 	return err
 }
 
-func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
+func (s *syncer) syncTriggeredJob(log *logrus.Entry, pj prowapi.ProwJob, pm map[string]coreapi.Pod, reports chan<- prowapi.ProwJob) error {
 	// Record last known state so we can log state transitions.
 	prevState := pj.Status.State
 
@@ -454,24 +1150,31 @@ func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.
 	// and rerun the prowjob update.
 	if !podExists {
 		// Do not start more jobs than specified.
-		if !c.canExecuteConcurrently(&pj) {
-			return nil
+		if !s.canExecuteConcurrently(&pj) {
+			return s.setQueuePosition(pj)
 		}
 		// We haven't started the pod yet. Do so.
 		var err error
-		id, pn, err = c.startPod(pj)
+		id, pn, err = s.startPod(pj)
+		if _, conflict := err.(kube.ConflictError); conflict {
+			// The pod may have been created after the pods were listed.
+			if existing, found := s.findPod(pj); found {
+				log.Info("Pod already exists, adopting it.")
+				id, pn, err = getPodBuildID(log, &existing), existing.ObjectMeta.Name, nil
+			}
+		}
 		if err != nil {
-			_, isUnprocessable := err.(kube.UnprocessableEntityError)
-			if !isUnprocessable {
-				return fmt.Errorf("error starting pod: %v", err)
+			if err := s.startPodFailed(log, &pj, err); err != nil {
+				return s.recordStartPodError(log, pj, err)
+			}
+			if pj.Status.State == prowapi.TriggeredState {
+				// The job is retried, there is no pod to record yet.
+				_, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+				return err
 			}
-			pj.Status.State = prowapi.ErrorState
-			pj.SetComplete()
-			pj.Status.Description = "Job cannot be processed."
-			logrus.WithField("job", pj.Spec.Job).WithError(err).Warning("Unprocessable pod.")
 		}
 	} else {
-		id = getPodBuildID(&pod)
+		id = getPodBuildID(log, &pod)
 		pn = pod.ObjectMeta.Name
 	}
 
@@ -480,23 +1183,155 @@ func (c *Controller) syncTriggeredJob(pj prowapi.ProwJob, pm map[string]coreapi.
 		pj.Status.BuildID = id
 		pj.Status.State = prowapi.PendingState
 		pj.Status.PodName = pn
+		pj.Status.StartFailures = 0
 		pj.Status.Description = "Job triggered."
-		pj.Status.URL = pjutil.JobURL(c.config().Plank, pj, c.log)
+		pj.Status.URL = pjutil.JobURL(s.config().Plank, pj, log)
 	}
-	reports <- pj
 	if prevState != pj.Status.State {
-		c.log.WithFields(pjutil.ProwJobFields(&pj)).
-			WithField("from", prevState).
+		log.WithField("from", prevState).
 			WithField("to", pj.Status.State).Info("Transitioning states.")
 	}
-	_, err := c.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj)
+	if _, err := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj); err != nil {
+		return err
+	}
+	// Only report what was saved, or the next sync reports it again.
+	reports <- pj
+	recordCompletion(prevState, pj)
+	return nil
+}
+
+// findPod looks up the pod of the job in its cluster, for pods created by
+// a previous sync that did not get to update the job.
+func (s *syncer) findPod(pj prowapi.ProwJob) (coreapi.Pod, bool) {
+	client, ok := s.pkcs[pj.ClusterAlias()]
+	if !ok {
+		return coreapi.Pod{}, false
+	}
+	pods, err := client.ListPods(s.podSelector())
+	if err != nil {
+		return coreapi.Pod{}, false
+	}
+	for _, pod := range pods {
+		if kube.ProwJobForPod(pod) == pj.ObjectMeta.Name {
+			return pod, true
+		}
+	}
+	return coreapi.Pod{}, false
+}
+
+// startPodFailed updates the job after its pod could not be started. Pods
+// that are unprocessable, rejected by the apiserver or missing will never
+// start, so the job is given the ErrorState. Transient errors, as classified
+// by kube.IsTransient, are retried while the job has retries left. An error
+// is returned if the job should just be synced again, which for other errors
+// is only done for the first max_start_attempts.
+func (c *Controller) startPodFailed(log *logrus.Entry, pj *prowapi.ProwJob, err error) error {
+	description := "Job cannot be processed."
+	switch err.(type) {
+	case kube.UnprocessableEntityError:
+		log.WithError(err).Warning("Unprocessable pod.")
+	case config.JobNotFoundError:
+		log.WithError(err).Warning("Job is no longer configured.")
+		description = fmt.Sprintf("No config for job %s.", pj.Spec.Job)
+	case invalidDecorationError:
+		log.WithError(err).Warning("Job has an invalid decoration config.")
+		description = "Job has an invalid decoration config."
+	default:
+		if err == errNoPodSpec {
+			log.Warning("Job has no pod spec.")
+			description = "Job has no pod spec to run."
+			break
+		}
+		if kube.IsTransient(err) && c.config().Plank.MaxErrorRetries > 0 {
+			if c.retryOnError(pj, "Pod could not be started.") {
+				log.WithError(err).Info("Transient error starting pod, retrying.")
+				return nil
+			}
+			log.WithError(err).Warning("Transient error starting pod, out of retries.")
+			break
+		}
+		if statusErr, ok := err.(kube.StatusError); ok && (statusErr.Code == http.StatusBadRequest || statusErr.Code == http.StatusUnprocessableEntity) {
+			// The pod itself is invalid. Other client errors, such as a
+			// pod that exceeds a resource quota, may go away.
+			log.WithError(err).Warning("Pod was rejected.")
+			description = fmt.Sprintf("Pod was rejected: %v", err)
+			break
+		}
+		pj.Status.StartFailures++
+		if max := c.config().Plank.MaxStartAttempts; max == 0 || pj.Status.StartFailures < max {
+			return err
+		}
+		log.WithError(err).Warningf("Pod could not be started %d times, giving up.", pj.Status.StartFailures)
+		description = fmt.Sprintf("Pod could not be started: %v", err)
+	}
+	pj.Status.State = prowapi.ErrorState
+	pj.SetComplete()
+	pj.Status.Description = description
+	return nil
+}
+
+// retryOnError resets a job that ran into a retryable error to the
+// TriggeredState so that a new pod is started for it, if it has retries
+// left. It returns false if the job should be given the ErrorState instead.
+func (c *Controller) retryOnError(pj *prowapi.ProwJob, description string) bool {
+	max := c.config().Plank.MaxErrorRetries
+	if pj.Status.ErrorRetries >= max {
+		return false
+	}
+	pj.Status.ErrorRetries++
+	pj.Status.State = prowapi.TriggeredState
+	pj.Status.Description = fmt.Sprintf("%s Retrying (%d/%d).", description, pj.Status.ErrorRetries, max)
+	return true
+}
+
+// recordStartPodError stores the reason a pod could not be started in the
+// description of the ProwJob, leaving its state untouched, so that users can
+// see why the job is still waiting. The description is overwritten as soon
+// as the pod starts.
+func (s *syncer) recordStartPodError(log *logrus.Entry, pj prowapi.ProwJob, podErr error) error {
+	err := fmt.Errorf("error starting pod: %v", podErr)
+	pj.Status.Description = fmt.Sprintf("Waiting: %v", err)
+	if _, replaceErr := s.kc.ReplaceProwJob(pj.ObjectMeta.Name, pj); replaceErr != nil {
+		log.WithError(replaceErr).Warning("Failed to record pod start error.")
+	}
 	return err
 }
 
+// errNoPodSpec is returned by startPod for jobs without a pod spec. Config
+// validation rejects such kubernetes jobs, but ProwJobs can also be created
+// by hand.
+var errNoPodSpec = errors.New("job has no pod spec")
+
+// invalidDecorationError is returned by startPod for jobs whose decoration
+// config is incomplete even with the default decoration config applied.
+type invalidDecorationError struct {
+	err error
+}
+
+func (e invalidDecorationError) Error() string {
+	return fmt.Sprintf("invalid decoration config: %v", e.err)
+}
+
 // TODO: No need to return the pod name since we already have the
 // prowjob in the call site.
-func (c *Controller) startPod(pj prowapi.ProwJob) (string, string, error) {
-	buildID, err := c.getBuildID(pj.Spec.Job)
+func (s *syncer) startPod(pj prowapi.ProwJob) (string, string, error) {
+	if pj.Spec.PodSpec == nil {
+		return "", "", errNoPodSpec
+	}
+	if pj.Spec.DecorationConfig != nil {
+		// Jobs from the config have the defaults applied already, but
+		// ProwJobs created by other means may only carry their overrides.
+		pj.Spec.DecorationConfig = s.config().Plank.ApplyDecorationDefaults(pj.Spec.DecorationConfig, pj.Spec.Type)
+		if err := pj.Spec.DecorationConfig.Validate(); err != nil {
+			return "", "", invalidDecorationError{err: err}
+		}
+	}
+	if s.config().Plank.RequireJobConfig {
+		if err := s.config().CheckJobExists(pj.Spec); err != nil {
+			return "", "", err
+		}
+	}
+	buildID, err := s.getBuildID(pj.Spec.Job)
 	if err != nil {
 		return "", "", fmt.Errorf("error getting build ID: %v", err)
 	}
@@ -505,8 +1340,24 @@ func (c *Controller) startPod(pj prowapi.ProwJob) (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
+	// Extra containers go after the test container, which has to stay first.
+	pod.Spec.Containers = append(pod.Spec.Containers, s.config().Plank.ExtraContainers...)
+	if s.config().Plank.SpreadPodsByJob {
+		spreadByJob(pod)
+	}
+	if s.config().Plank.PodActiveDeadline {
+		setActiveDeadline(pj, pod, s.config().Plank.PodActiveDeadlineMargin)
+	}
+	if name := s.config().Plank.BuildNumberEnvName; name != "" && name != downwardapi.BuildNumberEnv {
+		renameBuildNumberEnv(pod, name)
+	}
 
-	client, ok := c.pkcs[pj.ClusterAlias()]
+	if s.config().Plank.UseGenerateName {
+		pod.ObjectMeta.GenerateName = pj.ObjectMeta.Name + "-"
+		pod.ObjectMeta.Name = ""
+	}
+
+	client, ok := s.pkcs[pj.ClusterAlias()]
 	if !ok {
 		return "", "", fmt.Errorf("unknown cluster alias %q", pj.ClusterAlias())
 	}
@@ -517,16 +1368,105 @@ func (c *Controller) startPod(pj prowapi.ProwJob) (string, string, error) {
 	return buildID, actual.ObjectMeta.Name, nil
 }
 
+// addPod adds the pod to the map of pods by the name of their ProwJob. A job
+// with a generated pod name can have a new pod while its previous one is
+// still being deleted, in which case the new pod is kept.
+func addPod(pm map[string]coreapi.Pod, pod coreapi.Pod) {
+	name := kube.ProwJobForPod(pod)
+	if existing, ok := pm[name]; ok && existing.ObjectMeta.DeletionTimestamp == nil && pod.ObjectMeta.DeletionTimestamp != nil {
+		return
+	}
+	pm[name] = pod
+}
+
+// setActiveDeadline sets the active deadline of the pod of a decorated job
+// to its timeout plus its grace period plus the margin for starting the
+// pod, so that the pod utilities get to abort the job before the kubelet
+// kills the pod.
+func setActiveDeadline(pj prowapi.ProwJob, pod *coreapi.Pod, margin time.Duration) {
+	dc := pj.Spec.DecorationConfig
+	if dc == nil || dc.Timeout == 0 || pod.Spec.ActiveDeadlineSeconds != nil {
+		return
+	}
+	// round up to whole seconds
+	deadline := int64((dc.Timeout + dc.GracePeriod + margin + time.Second - 1) / time.Second)
+	pod.Spec.ActiveDeadlineSeconds = &deadline
+}
+
+// renameBuildNumberEnv gives the build number variable in the containers
+// of the pod the name, or drops it from containers that set the name
+// already, like BUILD_ID.
+func renameBuildNumberEnv(pod *coreapi.Pod, name string) {
+	for _, containers := range [][]coreapi.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			var env, renamed []coreapi.EnvVar
+			taken := false
+			for _, e := range containers[i].Env {
+				switch e.Name {
+				case downwardapi.BuildNumberEnv:
+					e.Name = name
+					renamed = append(renamed, e)
+					continue
+				case name:
+					taken = true
+				}
+				env = append(env, e)
+			}
+			if !taken {
+				env = append(env, renamed...)
+			}
+			containers[i].Env = env
+		}
+	}
+}
+
+// spreadByJob adds a preferred anti-affinity to the pod for nodes that run
+// pods of the same job, keeping any affinity that the job asks for.
+func spreadByJob(pod *coreapi.Pod) {
+	job, ok := pod.ObjectMeta.Labels[kube.ProwJobAnnotation]
+	if !ok {
+		// the job name is not a valid label value
+		return
+	}
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &coreapi.Affinity{}
+	}
+	if pod.Spec.Affinity.PodAntiAffinity == nil {
+		pod.Spec.Affinity.PodAntiAffinity = &coreapi.PodAntiAffinity{}
+	}
+	antiAffinity := pod.Spec.Affinity.PodAntiAffinity
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, coreapi.WeightedPodAffinityTerm{
+		Weight: 100,
+		PodAffinityTerm: coreapi.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{kube.ProwJobAnnotation: job},
+			},
+			TopologyKey: "kubernetes.io/hostname",
+		},
+	})
+}
+
+// forceDelete returns options that remove a pod without waiting for it to
+// terminate gracefully, so that its replacement can start right away.
+func forceDelete() kube.DeleteOptions {
+	var gracePeriod int64
+	return kube.DeleteOptions{GracePeriodSeconds: &gracePeriod}
+}
+
 func (c *Controller) getBuildID(name string) (string, error) {
-	return pjutil.GetBuildID(name, c.totURL)
+	attempts := c.config().Plank.BuildIDAttempts
+	if attempts == 0 {
+		attempts = pjutil.DefaultBuildIDAttempts
+	}
+	return pjutil.GetBuildIDWithAttempts(name, c.totURL, attempts)
 }
 
-func getPodBuildID(pod *coreapi.Pod) string {
+func getPodBuildID(log *logrus.Entry, pod *coreapi.Pod) string {
 	for _, env := range pod.Spec.Containers[0].Env {
 		if env.Name == "BUILD_ID" {
 			return env.Value
 		}
 	}
-	logrus.Warningf("BUILD_ID was not found in pod %q: streaming logs from deck will not work", pod.ObjectMeta.Name)
+	log.Warningf("BUILD_ID was not found in pod %q: streaming logs from deck will not work", pod.ObjectMeta.Name)
 	return ""
 }
@@ -17,23 +17,30 @@ limitations under the License.
 package plank
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 	"text/template"
 	"time"
 
+	dto "github.com/prometheus/client_model/go"
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
 	"k8s.io/test-infra/prow/github/reporter"
 	"k8s.io/test-infra/prow/kube"
 	"k8s.io/test-infra/prow/pjutil"
@@ -104,7 +111,9 @@ type fkc struct {
 	prowjobs    []prowapi.ProwJob
 	pods        []kube.Pod
 	deletedPods []kube.Pod
-	err         error
+	// deleteOptions holds the options passed for each of deletedPods.
+	deleteOptions []kube.DeleteOptions
+	err           error
 }
 
 func (f *fkc) CreateProwJob(pj prowapi.ProwJob) (prowapi.ProwJob, error) {
@@ -129,7 +138,20 @@ func (f *fkc) GetProwJob(name string) (prowapi.ProwJob, error) {
 func (f *fkc) ListProwJobs(selector string) ([]prowapi.ProwJob, error) {
 	f.Lock()
 	defer f.Unlock()
-	return f.prowjobs, nil
+	if selector == kube.EmptySelector {
+		return f.prowjobs, nil
+	}
+	sel, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	var pjs []prowapi.ProwJob
+	for _, pj := range f.prowjobs {
+		if sel.Matches(labels.Set(pj.ObjectMeta.Labels)) {
+			pjs = append(pjs, pj)
+		}
+	}
+	return pjs, nil
 }
 
 func (f *fkc) ReplaceProwJob(name string, job prowapi.ProwJob) (prowapi.ProwJob, error) {
@@ -144,12 +166,28 @@ func (f *fkc) ReplaceProwJob(name string, job prowapi.ProwJob) (prowapi.ProwJob,
 	return prowapi.ProwJob{}, fmt.Errorf("did not find prowjob %s", name)
 }
 
+func (f *fkc) DeleteProwJob(name string) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.prowjobs {
+		if f.prowjobs[i].ObjectMeta.Name == name {
+			f.prowjobs = append(f.prowjobs[:i], f.prowjobs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("did not find prowjob %s", name)
+}
+
 func (f *fkc) CreatePod(pod kube.Pod) (kube.Pod, error) {
 	f.Lock()
 	defer f.Unlock()
 	if f.err != nil {
 		return kube.Pod{}, f.err
 	}
+	if pod.ObjectMeta.GenerateName != "" {
+		// like the apiserver, assign a name
+		pod.ObjectMeta.Name = fmt.Sprintf("%s%05d", pod.ObjectMeta.GenerateName, len(f.pods))
+	}
 	f.pods = append(f.pods, pod)
 	return pod, nil
 }
@@ -160,12 +198,13 @@ func (f *fkc) ListPods(selector string) ([]kube.Pod, error) {
 	return f.pods, nil
 }
 
-func (f *fkc) DeletePod(name string) error {
+func (f *fkc) DeletePod(name string, opts kube.DeleteOptions) error {
 	f.Lock()
 	defer f.Unlock()
 	for i := range f.pods {
 		if f.pods[i].ObjectMeta.Name == name {
 			f.deletedPods = append(f.deletedPods, f.pods[i])
+			f.deleteOptions = append(f.deleteOptions, opts)
 			f.pods = append(f.pods[:i], f.pods[i+1:]...)
 			return nil
 		}
@@ -173,30 +212,6 @@ func (f *fkc) DeletePod(name string) error {
 	return fmt.Errorf("did not find pod %s", name)
 }
 
-type fghc struct {
-	sync.Mutex
-	changes []github.PullRequestChange
-	err     error
-}
-
-func (f *fghc) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
-	f.Lock()
-	defer f.Unlock()
-	return f.changes, f.err
-}
-
-func (f *fghc) BotName() (string, error)                                  { return "bot", nil }
-func (f *fghc) CreateStatus(org, repo, ref string, s github.Status) error { return nil }
-func (f *fghc) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
-	return nil, nil
-}
-func (f *fghc) ListIssueComments(org, repo string, number int) ([]github.IssueComment, error) {
-	return nil, nil
-}
-func (f *fghc) CreateComment(org, repo string, number int, comment string) error { return nil }
-func (f *fghc) DeleteComment(org, repo string, ID int) error                     { return nil }
-func (f *fghc) EditComment(org, repo string, ID int, comment string) error       { return nil }
-
 func TestTerminateDupes(t *testing.T) {
 	now := time.Now()
 	nowFn := func() *metav1.Time {
@@ -354,6 +369,36 @@ func TestTerminateDupes(t *testing.T) {
 				"old": {},
 			},
 		},
+		{
+			name: "jobs of different types sharing a name are not duplicates",
+
+			pjs: []prowapi.ProwJob{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "newest_presubmit"},
+					Spec: prowapi.ProwJobSpec{
+						Type: prowapi.PresubmitJob,
+						Job:  "j1",
+						Refs: &prowapi.Refs{Pulls: []prowapi.Pull{{}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						StartTime: metav1.NewTime(now.Add(-time.Minute)),
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "old_batch"},
+					Spec: prowapi.ProwJobSpec{
+						Type: prowapi.BatchJob,
+						Job:  "j1",
+						Refs: &prowapi.Refs{Pulls: []prowapi.Pull{{}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						StartTime: metav1.NewTime(now.Add(-time.Hour)),
+					},
+				},
+			},
+
+			terminatedPJs: map[string]struct{}{},
+		},
 	}
 
 	for _, tc := range testcases {
@@ -380,7 +425,7 @@ func TestTerminateDupes(t *testing.T) {
 			config: fca.Config,
 		}
 
-		if err := c.terminateDupes(fkc.prowjobs, tc.pm); err != nil {
+		if err := c.bind(context.Background()).terminateDupes(fkc.prowjobs, tc.pm); err != nil {
 			t.Fatalf("Error terminating dupes: %v", err)
 		}
 
@@ -397,6 +442,11 @@ func TestTerminateDupes(t *testing.T) {
 				t.Errorf("expected prowjob %q to be terminated, got %+v", terminatedName, fkc.prowjobs)
 			}
 		}
+		for _, pj := range fkc.prowjobs {
+			if _, expected := tc.terminatedPJs[pj.ObjectMeta.Name]; !expected && pj.Status.State == prowapi.AbortedState {
+				t.Errorf("%s: expected prowjob %q not to be terminated", tc.name, pj.ObjectMeta.Name)
+			}
+		}
 		for terminatedName := range tc.terminatedPods {
 			terminated := false
 			for _, deleted := range fkc.deletedPods {
@@ -412,6 +462,93 @@ func TestTerminateDupes(t *testing.T) {
 	}
 }
 
+func TestReapOldProwJobs(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(-d))
+		return &t
+	}
+	pjs := []prowapi.ProwJob{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-complete"},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "j1"},
+			Status: prowapi.ProwJobStatus{
+				State:          prowapi.SuccessState,
+				StartTime:      *ago(50 * time.Hour),
+				CompletionTime: ago(49 * time.Hour),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "recent-complete"},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "j1"},
+			Status: prowapi.ProwJobStatus{
+				State:          prowapi.FailureState,
+				StartTime:      *ago(50 * time.Hour),
+				CompletionTime: ago(time.Hour),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-incomplete"},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PresubmitJob, Job: "j1"},
+			Status: prowapi.ProwJobStatus{
+				State:     prowapi.PendingState,
+				StartTime: *ago(50 * time.Hour),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old-complete-periodic"},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: "p1"},
+			Status: prowapi.ProwJobStatus{
+				State:          prowapi.SuccessState,
+				StartTime:      *ago(72 * time.Hour),
+				CompletionTime: ago(71 * time.Hour),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "latest-old-complete-periodic"},
+			Spec:       prowapi.ProwJobSpec{Type: prowapi.PeriodicJob, Job: "p1"},
+			Status: prowapi.ProwJobStatus{
+				State:          prowapi.SuccessState,
+				StartTime:      *ago(50 * time.Hour),
+				CompletionTime: ago(49 * time.Hour),
+			},
+		},
+	}
+	fc := &fkc{prowjobs: append([]prowapi.ProwJob{}, pjs...)}
+	fca := newFakeConfigAgent(t, 0)
+	fca.c.Plank.MaxProwJobAge = 48 * time.Hour
+	c := Controller{
+		kc:     fc,
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: fca.Config,
+	}
+
+	kept, err := c.bind(context.Background()).reapOldProwJobs(pjs)
+	if err != nil {
+		t.Fatalf("Unexpected error reaping prowjobs: %v", err)
+	}
+	expected := []string{"recent-complete", "old-incomplete", "latest-old-complete-periodic"}
+	var keptNames, remainingNames []string
+	for _, pj := range kept {
+		keptNames = append(keptNames, pj.ObjectMeta.Name)
+	}
+	for _, pj := range fc.prowjobs {
+		remainingNames = append(remainingNames, pj.ObjectMeta.Name)
+	}
+	if !reflect.DeepEqual(keptNames, expected) {
+		t.Errorf("Expected to keep %v, got %v", expected, keptNames)
+	}
+	if !reflect.DeepEqual(remainingNames, expected) {
+		t.Errorf("Expected %v to remain in the cluster, got %v", expected, remainingNames)
+	}
+
+	fca.c.Plank.MaxProwJobAge = 0
+	fc.prowjobs = append([]prowapi.ProwJob{}, pjs...)
+	if kept, err := c.bind(context.Background()).reapOldProwJobs(pjs); err != nil || len(kept) != len(pjs) || len(fc.prowjobs) != len(pjs) {
+		t.Errorf("Expected no prowjobs to be reaped when max_prowjob_age is unset, kept %d and %d remain (err: %v)", len(kept), len(fc.prowjobs), err)
+	}
+}
+
 func handleTot(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "42")
 }
@@ -420,11 +557,13 @@ func TestSyncTriggeredJobs(t *testing.T) {
 	var testcases = []struct {
 		name string
 
-		pj             prowapi.ProwJob
-		pendingJobs    map[string]int
-		maxConcurrency int
-		pods           map[string][]kube.Pod
-		podErr         error
+		pj               prowapi.ProwJob
+		pendingJobs      map[string]int
+		maxConcurrency   int
+		pods             map[string][]kube.Pod
+		podErr           error
+		maxErrorRetries  int
+		requireJobConfig bool
 
 		expectedState         prowapi.ProwJobState
 		expectedPodHasName    bool
@@ -435,6 +574,8 @@ func TestSyncTriggeredJobs(t *testing.T) {
 		expectPrevReportState map[string]prowapi.ProwJobState
 		expectedURL           string
 		expectedBuildID       string
+		expectedDescription   string
+		expectedErrorRetries  int
 		expectError           bool
 	}{
 		{
@@ -449,14 +590,16 @@ func TestSyncTriggeredJobs(t *testing.T) {
 					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
 				},
 				Status: prowapi.ProwJobStatus{
-					State: prowapi.TriggeredState,
+					State:       prowapi.TriggeredState,
+					Description: "Waiting: error starting pod: no way jose",
 				},
 			},
-			pods:               map[string][]kube.Pod{"default": {}},
-			expectedState:      prowapi.PendingState,
-			expectedPodHasName: true,
-			expectedNumPods:    map[string]int{"default": 1},
-			expectedReport:     true,
+			pods:                map[string][]kube.Pod{"default": {}},
+			expectedState:       prowapi.PendingState,
+			expectedPodHasName:  true,
+			expectedNumPods:     map[string]int{"default": 1},
+			expectedReport:      true,
+			expectedDescription: "Job triggered.",
 			expectPrevReportState: map[string]prowapi.ProwJobState{
 				reporter.GithubReporterName: prowapi.PendingState,
 			},
@@ -630,6 +773,27 @@ func TestSyncTriggeredJobs(t *testing.T) {
 				reporter.GithubReporterName: prowapi.ErrorState,
 			},
 		},
+		{
+			name: "periodic without a pod spec",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:  "boop",
+					Type: prowapi.PeriodicJob,
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods:                map[string][]kube.Pod{"default": {}},
+			expectedState:       prowapi.ErrorState,
+			expectedNumPods:     map[string]int{"default": 0},
+			expectedComplete:    true,
+			expectedReport:      true,
+			expectedDescription: "Job has no pod spec to run.",
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.ErrorState,
+			},
+		},
 		{
 			name: "conflict error starting pod",
 			pj: prowapi.ProwJob{
@@ -642,9 +806,11 @@ func TestSyncTriggeredJobs(t *testing.T) {
 					State: prowapi.TriggeredState,
 				},
 			},
-			podErr:        kube.NewConflictError(errors.New("no way jose")),
-			expectedState: prowapi.TriggeredState,
-			expectError:   true,
+			pods:                map[string][]kube.Pod{"default": {}},
+			podErr:              kube.NewConflictError(errors.New("no way jose")),
+			expectedState:       prowapi.TriggeredState,
+			expectedDescription: "Waiting: error starting pod: no way jose",
+			expectError:         true,
 		},
 		{
 			name: "unknown error starting pod",
@@ -658,9 +824,140 @@ func TestSyncTriggeredJobs(t *testing.T) {
 					State: prowapi.TriggeredState,
 				},
 			},
-			podErr:        errors.New("no way unknown jose"),
-			expectedState: prowapi.TriggeredState,
-			expectError:   true,
+			pods:                map[string][]kube.Pod{"default": {}},
+			podErr:              errors.New("no way unknown jose"),
+			expectedState:       prowapi.TriggeredState,
+			expectedDescription: "Waiting: error starting pod: no way unknown jose",
+			expectError:         true,
+		},
+		{
+			name: "conflict error starting pod is retried while retries are left",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:        prowapi.TriggeredState,
+					ErrorRetries: 1,
+				},
+			},
+			pods:                 map[string][]kube.Pod{"default": {}},
+			podErr:               kube.NewConflictError(errors.New("no way jose")),
+			maxErrorRetries:      2,
+			expectedState:        prowapi.TriggeredState,
+			expectedDescription:  "Pod could not be started. Retrying (2/2).",
+			expectedErrorRetries: 2,
+		},
+		{
+			name: "conflict error starting pod errors once out of retries",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:        prowapi.TriggeredState,
+					ErrorRetries: 2,
+				},
+			},
+			pods:                 map[string][]kube.Pod{"default": {}},
+			podErr:               kube.NewConflictError(errors.New("no way jose")),
+			maxErrorRetries:      2,
+			expectedState:        prowapi.ErrorState,
+			expectedComplete:     true,
+			expectedReport:       true,
+			expectedDescription:  "Job cannot be processed.",
+			expectedErrorRetries: 2,
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.ErrorState,
+			},
+		},
+		{
+			name: "unprocessable error starting pod is not retried",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods:                map[string][]kube.Pod{"default": {}},
+			podErr:              kube.NewUnprocessableEntityError(errors.New("no way jose")),
+			maxErrorRetries:     2,
+			expectedState:       prowapi.ErrorState,
+			expectedComplete:    true,
+			expectedReport:      true,
+			expectedDescription: "Job cannot be processed.",
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.ErrorState,
+			},
+		},
+		{
+			name: "server error starting pod is retried while retries are left",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods:                 map[string][]kube.Pod{"default": {}},
+			podErr:               kube.NewStatusError(http.StatusInternalServerError, errors.New("no way jose")),
+			maxErrorRetries:      2,
+			expectedState:        prowapi.TriggeredState,
+			expectedDescription:  "Pod could not be started. Retrying (1/2).",
+			expectedErrorRetries: 1,
+		},
+		{
+			name: "bad request starting pod is not retried",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods:                map[string][]kube.Pod{"default": {}},
+			podErr:              kube.NewStatusError(http.StatusBadRequest, errors.New("no way jose")),
+			maxErrorRetries:     2,
+			expectedState:       prowapi.ErrorState,
+			expectedComplete:    true,
+			expectedReport:      true,
+			expectedDescription: "Pod was rejected: no way jose",
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.ErrorState,
+			},
+		},
+		{
+			name: "forbidden pod that exceeds a quota is retried",
+			pj: prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods:                map[string][]kube.Pod{"default": {}},
+			podErr:              kube.NewStatusError(http.StatusForbidden, errors.New("exceeded quota")),
+			maxErrorRetries:     2,
+			expectedState:       prowapi.TriggeredState,
+			expectedDescription: "Waiting: error starting pod: exceeded quota",
+			expectError:         true,
 		},
 		{
 			name: "running pod, failed prowjob update",
@@ -710,6 +1007,97 @@ func TestSyncTriggeredJobs(t *testing.T) {
 			expectedURL:     "foo/pending",
 			expectedBuildID: "0987654321",
 		},
+		{
+			name: "adopt pod created by a previous sync",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "adopted",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			pods: map[string][]kube.Pod{
+				"default": {
+					{
+						ObjectMeta: metav1.ObjectMeta{
+							Name: "adopted",
+						},
+						Spec: kube.PodSpec{
+							Containers: []kube.Container{{Name: "test", Env: []kube.EnvVar{{Name: "BUILD_ID", Value: "1234"}}}},
+						},
+					},
+				},
+			},
+			expectedState:      prowapi.PendingState,
+			expectedPodHasName: true,
+			expectedNumPods:    map[string]int{"default": 1},
+			expectedReport:     true,
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.PendingState,
+			},
+			expectedURL:     "adopted/pending",
+			expectedBuildID: "1234",
+		},
+		{
+			name: "job that is no longer configured is errored",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "renamed",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "test-bazel-built",
+					Type:    prowapi.PresubmitJob,
+					Refs:    &prowapi.Refs{Org: "kubernetes", Repo: "kubernetes", Pulls: []prowapi.Pull{{Number: 1}}},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			requireJobConfig:    true,
+			pods:                map[string][]kube.Pod{"default": {}},
+			expectedState:       prowapi.ErrorState,
+			expectedNumPods:     map[string]int{"default": 0},
+			expectedComplete:    true,
+			expectedReport:      true,
+			expectedDescription: "No config for job test-bazel-built.",
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.ErrorState,
+			},
+		},
+		{
+			name: "configured job is started when the config is required",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "configured",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "test-bazel-build",
+					Type:    prowapi.PresubmitJob,
+					Refs:    &prowapi.Refs{Org: "kubernetes", Repo: "kubernetes", Pulls: []prowapi.Pull{{Number: 1}}},
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.TriggeredState,
+				},
+			},
+			requireJobConfig:   true,
+			pods:               map[string][]kube.Pod{"default": {}},
+			expectedState:      prowapi.PendingState,
+			expectedPodHasName: true,
+			expectedNumPods:    map[string]int{"default": 1},
+			expectedReport:     true,
+			expectPrevReportState: map[string]prowapi.ProwJobState{
+				reporter.GithubReporterName: prowapi.PendingState,
+			},
+			expectedURL: "configured/pending",
+		},
 	}
 	for _, tc := range testcases {
 		totServ := httptest.NewServer(http.HandlerFunc(handleTot))
@@ -730,11 +1118,14 @@ func TestSyncTriggeredJobs(t *testing.T) {
 				err:  tc.podErr,
 			}
 		}
+		fca := newFakeConfigAgent(t, tc.maxConcurrency)
+		fca.c.Plank.MaxErrorRetries = tc.maxErrorRetries
+		fca.c.Plank.RequireJobConfig = tc.requireJobConfig
 		c := Controller{
 			kc:          fc,
 			pkcs:        pkcs,
 			log:         logrus.NewEntry(logrus.StandardLogger()),
-			config:      newFakeConfigAgent(t, tc.maxConcurrency).Config,
+			config:      fca.Config,
 			totURL:      totServ.URL,
 			pendingJobs: make(map[string]int),
 		}
@@ -743,7 +1134,7 @@ func TestSyncTriggeredJobs(t *testing.T) {
 		}
 
 		reports := make(chan prowapi.ProwJob, 100)
-		if err := c.syncTriggeredJob(tc.pj, pm, reports); (err != nil) != tc.expectError {
+		if err := c.bind(context.Background()).syncTriggeredJob(c.log, tc.pj, pm, reports); (err != nil) != tc.expectError {
 			if tc.expectError {
 				t.Errorf("for case %q expected an error, but got none", tc.name)
 			} else {
@@ -756,7 +1147,7 @@ func TestSyncTriggeredJobs(t *testing.T) {
 		numReports := len(reports)
 		// for asserting recorded report states
 		for report := range reports {
-			if err := c.setPreviousReportState(report); err != nil {
+			if err := c.bind(context.Background()).setPreviousReportState(report); err != nil {
 				t.Errorf("for case %q got error in setPreviousReportState : %v", tc.name, err)
 			}
 		}
@@ -765,6 +1156,12 @@ func TestSyncTriggeredJobs(t *testing.T) {
 		if actual.Status.State != tc.expectedState {
 			t.Errorf("for case %q got state %v", tc.name, actual.Status.State)
 		}
+		if tc.expectedDescription != "" && actual.Status.Description != tc.expectedDescription {
+			t.Errorf("for case %q got description %q, expected %q", tc.name, actual.Status.Description, tc.expectedDescription)
+		}
+		if actual.Status.ErrorRetries != tc.expectedErrorRetries {
+			t.Errorf("for case %q got %d error retries, expected %d", tc.name, actual.Status.ErrorRetries, tc.expectedErrorRetries)
+		}
 		if (actual.Status.PodName == "") && tc.expectedPodHasName {
 			t.Errorf("for case %q got no pod name, expected one", tc.name)
 		}
@@ -805,24 +1202,173 @@ func startTime(s time.Time) *metav1.Time {
 	return &start
 }
 
-func TestSyncPendingJob(t *testing.T) {
-	var testcases = []struct {
-		name string
-
-		pj   prowapi.ProwJob
-		pods []kube.Pod
-		err  error
-
-		expectedState      prowapi.ProwJobState
-		expectedNumPods    int
-		expectedComplete   bool
-		expectedCreatedPJs int
-		expectedReport     bool
-		expectedURL        string
-	}{
-		{
-			name: "reset when pod goes missing",
-			pj: prowapi.ProwJob{
+func TestSyncTriggeredJobAdoptsConflictingPod(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "racy"},
+		Spec: prowapi.ProwJobSpec{
+			Job:     "boop",
+			Type:    prowapi.PeriodicJob,
+			PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+		},
+		Status: prowapi.ProwJobStatus{
+			State: prowapi.TriggeredState,
+		},
+	}
+	fc := &fkc{prowjobs: []prowapi.ProwJob{pj}}
+	// The pod was created after the pods were listed for the sync, so it is
+	// not in the pod map and creating it again conflicts.
+	pkc := &fkc{
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "racy"},
+			Spec: kube.PodSpec{
+				Containers: []kube.Container{{Name: "test", Env: []kube.EnvVar{{Name: "BUILD_ID", Value: "1234"}}}},
+			},
+		}},
+		err: kube.NewConflictError(errors.New("pod already exists")),
+	}
+	fca := newFakeConfigAgent(t, 0)
+	c := Controller{
+		kc:          fc,
+		pkcs:        map[string]kubeClient{prowapi.DefaultClusterAlias: pkc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      fca.Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+
+	reports := make(chan prowapi.ProwJob, 1)
+	if err := c.bind(context.Background()).syncTriggeredJob(c.log, pj, map[string]kube.Pod{}, reports); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkc.pods) != 1 {
+		t.Errorf("expected the existing pod to be adopted, got %d pods", len(pkc.pods))
+	}
+	actual := fc.prowjobs[0]
+	if actual.Status.State != prowapi.PendingState {
+		t.Errorf("expected state %q, got %q", prowapi.PendingState, actual.Status.State)
+	}
+	if actual.Status.PodName != "racy" || actual.Status.BuildID != "1234" {
+		t.Errorf("expected pod racy with build 1234, got pod %q with build %q", actual.Status.PodName, actual.Status.BuildID)
+	}
+	if actual.Status.ErrorRetries != 0 {
+		t.Errorf("expected no error retries, got %d", actual.Status.ErrorRetries)
+	}
+}
+
+func TestMaxStartAttempts(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+
+	testcases := []struct {
+		name  string
+		state prowapi.ProwJobState
+		sync  func(s *syncer) syncFn
+	}{
+		{
+			name:  "triggered job",
+			state: prowapi.TriggeredState,
+			sync:  func(s *syncer) syncFn { return s.syncTriggeredJob },
+		},
+		{
+			name:  "pending job with a missing pod",
+			state: prowapi.PendingState,
+			sync:  func(s *syncer) syncFn { return s.syncPendingJob },
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fkc{
+				prowjobs: []prowapi.ProwJob{{
+					ObjectMeta: metav1.ObjectMeta{Name: "broken"},
+					Spec: prowapi.ProwJobSpec{
+						Job:     "boop",
+						Type:    prowapi.PeriodicJob,
+						PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: tc.state,
+					},
+				}},
+			}
+			fpc := &fkc{err: errors.New("no way unknown jose")}
+			fca := newFakeConfigAgent(t, 0)
+			fca.c.Plank.MaxStartAttempts = 3
+			c := &Controller{
+				kc:          fc,
+				pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      fca.Config,
+				totURL:      totServ.URL,
+				pendingJobs: make(map[string]int),
+			}
+			sync := tc.sync(c.bind(context.Background()))
+
+			for attempt := 1; attempt <= 3; attempt++ {
+				reports := make(chan prowapi.ProwJob, 100)
+				err := sync(c.log, fc.prowjobs[0], map[string]kube.Pod{}, reports)
+				close(reports)
+				actual := fc.prowjobs[0]
+				if actual.Status.StartFailures != attempt {
+					t.Errorf("attempt %d: expected %d start failures, got %d", attempt, attempt, actual.Status.StartFailures)
+				}
+				if attempt < 3 {
+					if err == nil {
+						t.Errorf("attempt %d: expected an error while attempts are left", attempt)
+					}
+					if actual.Status.State != tc.state || actual.Complete() {
+						t.Errorf("attempt %d: expected the job to stay %s, got state %s", attempt, tc.state, actual.Status.State)
+					}
+					if len(reports) != 0 {
+						t.Errorf("attempt %d: expected no reports, got %d", attempt, len(reports))
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("attempt %d: expected no error once out of attempts, got: %v", attempt, err)
+				}
+				if actual.Status.State != prowapi.ErrorState || !actual.Complete() {
+					t.Errorf("attempt %d: expected the job to complete with an error, got state %s", attempt, actual.Status.State)
+				}
+				if expected := "Pod could not be started: no way unknown jose"; actual.Status.Description != expected {
+					t.Errorf("attempt %d: expected description %q, got %q", attempt, expected, actual.Status.Description)
+				}
+				if len(reports) != 1 {
+					t.Errorf("attempt %d: expected one report, got %d", attempt, len(reports))
+				}
+			}
+		})
+	}
+}
+
+func TestSyncPendingJob(t *testing.T) {
+	var testcases = []struct {
+		name string
+
+		pj                prowapi.ProwJob
+		pods              []kube.Pod
+		err               error
+		maxPodEvictions   int
+		maxErrorRetries   int
+		podStateOverrides []config.PodStateOverride
+
+		expectedState         prowapi.ProwJobState
+		expectedNumPods       int
+		expectForceDelete     bool
+		expectedComplete      bool
+		expectedCreatedPJs    int
+		expectedReport        bool
+		expectedURL           string
+		expectedDescription   string
+		expectedPodEvictions  int
+		expectedErrorRetries  int
+		expectedUnschedulable string
+		expectedPodRunning    bool
+	}{
+		{
+			name: "reset when pod goes missing",
+			pj: prowapi.ProwJob{
 				ObjectMeta: metav1.ObjectMeta{
 					Name: "boop-41",
 				},
@@ -841,6 +1387,30 @@ func TestSyncPendingJob(t *testing.T) {
 			expectedNumPods: 1,
 			expectedURL:     "boop-41/pending",
 		},
+		{
+			name: "report restart when pod disappears after running",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-41",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Type:    prowapi.PostsubmitJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+					Refs:    &prowapi.Refs{Org: "fejtaverse"},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:       prowapi.PendingState,
+					Description: "Job triggered.",
+					PodName:     "boop-41",
+					PodRunning:  true,
+				},
+			},
+			expectedState:       prowapi.PendingState,
+			expectedReport:      true,
+			expectedNumPods:     1,
+			expectedURL:         "boop-41/pending",
+			expectedDescription: "Pod disappeared while running, restarting.",
+		},
 		{
 			name: "delete pod in unknown state",
 			pj: prowapi.ProwJob{
@@ -865,8 +1435,43 @@ func TestSyncPendingJob(t *testing.T) {
 					},
 				},
 			},
-			expectedState:   prowapi.PendingState,
-			expectedNumPods: 0,
+			expectedState:     prowapi.PendingState,
+			expectedNumPods:   0,
+			expectForceDelete: true,
+			expectedReport:    true,
+			expectedURL:       "boop-41/pending",
+		},
+		{
+			name: "reset pod running when deleting pod in unknown state",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-41",
+				},
+				Spec: prowapi.ProwJobSpec{
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:      prowapi.PendingState,
+					PodName:    "boop-41",
+					PodRunning: true,
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-41",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodUnknown,
+					},
+				},
+			},
+			expectedState:      prowapi.PendingState,
+			expectedNumPods:    0,
+			expectForceDelete:  true,
+			expectedReport:     true,
+			expectedURL:        "boop-41/pending",
+			expectedPodRunning: false,
 		},
 		{
 			name: "succeeded pod",
@@ -962,9 +1567,50 @@ func TestSyncPendingJob(t *testing.T) {
 					},
 				},
 			},
-			expectedComplete: false,
-			expectedState:    prowapi.PendingState,
-			expectedNumPods:  0,
+			maxPodEvictions:      3,
+			expectedComplete:     false,
+			expectedState:        prowapi.PendingState,
+			expectedNumPods:      0,
+			expectForceDelete:    true,
+			expectedReport:       true,
+			expectedURL:          "boop-42/pending",
+			expectedDescription:  "Pod evicted, retrying.",
+			expectedPodEvictions: 1,
+		},
+		{
+			name: "error when pod is evicted too many times",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:        prowapi.PendingState,
+					PodName:      "boop-42",
+					PodEvictions: 2,
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: kube.Evicted,
+					},
+				},
+			},
+			maxPodEvictions:      3,
+			expectedComplete:     true,
+			expectedState:        prowapi.ErrorState,
+			expectedNumPods:      1,
+			expectedReport:       true,
+			expectedURL:          "boop-42/error",
+			expectedDescription:  "Job pod was evicted by the cluster 3 times.",
+			expectedPodEvictions: 3,
 		},
 		{
 			name: "don't delete evicted pod w/ error_on_eviction, complete PJ instead",
@@ -998,6 +1644,109 @@ func TestSyncPendingJob(t *testing.T) {
 			expectedReport:   true,
 			expectedURL:      "boop-42/error",
 		},
+		{
+			name: "pod state override completes the job",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: "Quarantined",
+					},
+				},
+			},
+			podStateOverrides: []config.PodStateOverride{
+				{Phase: kube.PodFailed, Reason: "OutOfBudget", State: prowapi.ErrorState},
+				{Phase: kube.PodFailed, Reason: "Quarantined", State: prowapi.SuccessState},
+			},
+			expectedComplete:    true,
+			expectedState:       prowapi.SuccessState,
+			expectedNumPods:     1,
+			expectedReport:      true,
+			expectedURL:         "boop-42/success",
+			expectedDescription: "Job succeeded.",
+		},
+		{
+			name: "pod state override for another reason does not apply",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: "OutOfBudget",
+					},
+				},
+			},
+			podStateOverrides: []config.PodStateOverride{
+				{Phase: kube.PodFailed, Reason: "Quarantined", State: prowapi.SuccessState},
+			},
+			expectedComplete:    true,
+			expectedState:       prowapi.FailureState,
+			expectedNumPods:     1,
+			expectedReport:      true,
+			expectedURL:         "boop-42/failure",
+			expectedDescription: "Job failed.",
+		},
+		{
+			name: "pod killed at its active deadline",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "boop-42",
+				},
+				Spec: prowapi.ProwJobSpec{
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+				},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "boop-42",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "boop-42",
+					},
+					Status: kube.PodStatus{
+						Phase:  kube.PodFailed,
+						Reason: kube.DeadlineExceeded,
+					},
+				},
+			},
+			expectedComplete:    true,
+			expectedState:       prowapi.FailureState,
+			expectedNumPods:     1,
+			expectedReport:      true,
+			expectedURL:         "boop-42/failure",
+			expectedDescription: "Job timed out.",
+		},
 		{
 			name: "running pod",
 			pj: prowapi.ProwJob{
@@ -1020,8 +1769,9 @@ func TestSyncPendingJob(t *testing.T) {
 					},
 				},
 			},
-			expectedState:   prowapi.PendingState,
-			expectedNumPods: 1,
+			expectedState:      prowapi.PendingState,
+			expectedNumPods:    1,
+			expectedPodRunning: true,
 		},
 		{
 			name: "pod changes url status",
@@ -1104,67 +1854,474 @@ func TestSyncPendingJob(t *testing.T) {
 			expectedReport:   true,
 			expectedURL:      "nightmare/error",
 		},
-	}
-	for _, tc := range testcases {
-		t.Logf("Running test case %q", tc.name)
-		totServ := httptest.NewServer(http.HandlerFunc(handleTot))
-		defer totServ.Close()
-		pm := make(map[string]kube.Pod)
-		for i := range tc.pods {
-			pm[tc.pods[i].ObjectMeta.Name] = tc.pods[i]
-		}
-		fc := &fkc{
-			prowjobs: []prowapi.ProwJob{tc.pj},
-		}
-		fpc := &fkc{
-			pods: tc.pods,
-			err:  tc.err,
-		}
-		c := Controller{
-			kc:          fc,
-			pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
-			log:         logrus.NewEntry(logrus.StandardLogger()),
-			config:      newFakeConfigAgent(t, 0).Config,
-			totURL:      totServ.URL,
-			pendingJobs: make(map[string]int),
-		}
-
-		reports := make(chan prowapi.ProwJob, 100)
-		if err := c.syncPendingJob(tc.pj, pm, reports); err != nil {
-			t.Errorf("for case %q got an error: %v", tc.name, err)
-			continue
-		}
-		close(reports)
-
-		actual := fc.prowjobs[0]
-		if actual.Status.State != tc.expectedState {
-			t.Errorf("for case %q got state %v", tc.name, actual.Status.State)
-		}
-		if len(fpc.pods) != tc.expectedNumPods {
-			t.Errorf("for case %q got %d pods, expected %d", tc.name, len(fpc.pods), tc.expectedNumPods)
-		}
-		if actual.Complete() != tc.expectedComplete {
-			t.Errorf("for case %q got wrong completion", tc.name)
-		}
-		if len(fc.prowjobs) != tc.expectedCreatedPJs+1 {
-			t.Errorf("for case %q got %d created prowjobs", tc.name, len(fc.prowjobs)-1)
-		}
-		if tc.expectedReport && len(reports) != 1 {
-			t.Errorf("for case %q wanted one report but got %d", tc.name, len(reports))
-		}
-		if !tc.expectedReport && len(reports) != 0 {
-			t.Errorf("for case %q did not wany any reports but got %d", tc.name, len(reports))
-		}
-		if tc.expectedReport {
-			r := <-reports
-
-			if got, want := r.Status.URL, tc.expectedURL; got != want {
+		{
+			name: "stale pending prow job is retried while it has retries left",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "nightmare",
+				},
+				Spec: prowapi.ProwJobSpec{},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "nightmare",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "nightmare",
+					},
+					Status: kube.PodStatus{
+						Phase:     kube.PodPending,
+						StartTime: startTime(time.Now().Add(-podPendingTimeout)),
+					},
+				},
+			},
+			maxErrorRetries:      1,
+			expectedState:        prowapi.TriggeredState,
+			expectedNumPods:      0,
+			expectForceDelete:    true,
+			expectedReport:       true,
+			expectedURL:          "nightmare/triggered",
+			expectedDescription:  "Pod pending timeout. Retrying (1/1).",
+			expectedErrorRetries: 1,
+		},
+		{
+			name: "stale pending prow job errors once out of retries",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "nightmare",
+				},
+				Spec: prowapi.ProwJobSpec{},
+				Status: prowapi.ProwJobStatus{
+					State:        prowapi.PendingState,
+					PodName:      "nightmare",
+					ErrorRetries: 1,
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "nightmare",
+					},
+					Status: kube.PodStatus{
+						Phase:     kube.PodPending,
+						StartTime: startTime(time.Now().Add(-podPendingTimeout)),
+					},
+				},
+			},
+			maxErrorRetries:      1,
+			expectedState:        prowapi.ErrorState,
+			expectedNumPods:      1,
+			expectedComplete:     true,
+			expectedReport:       true,
+			expectedURL:          "nightmare/error",
+			expectedDescription:  "Pod pending timeout.",
+			expectedErrorRetries: 1,
+		},
+		{
+			name: "unschedulable pod is surfaced",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "stuck",
+				},
+				Spec: prowapi.ProwJobSpec{},
+				Status: prowapi.ProwJobStatus{
+					State:   prowapi.PendingState,
+					PodName: "stuck",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "stuck",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodPending,
+						Conditions: []v1.PodCondition{
+							{
+								Type:    v1.PodScheduled,
+								Status:  v1.ConditionFalse,
+								Reason:  v1.PodReasonUnschedulable,
+								Message: "0/3 nodes are available: 3 Insufficient cpu.",
+							},
+						},
+					},
+				},
+			},
+			expectedState:         prowapi.PendingState,
+			expectedNumPods:       1,
+			expectedUnschedulable: "0/3 nodes are available: 3 Insufficient cpu.",
+		},
+		{
+			name: "unschedulable reason is cleared once the pod runs",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "unstuck",
+				},
+				Spec: prowapi.ProwJobSpec{},
+				Status: prowapi.ProwJobStatus{
+					State:               prowapi.PendingState,
+					PodName:             "unstuck",
+					UnschedulableReason: "0/3 nodes are available: 3 Insufficient cpu.",
+				},
+			},
+			pods: []kube.Pod{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "unstuck",
+					},
+					Status: kube.PodStatus{
+						Phase: kube.PodRunning,
+						Conditions: []v1.PodCondition{
+							{
+								Type:   v1.PodScheduled,
+								Status: v1.ConditionTrue,
+							},
+						},
+					},
+				},
+			},
+			expectedState:      prowapi.PendingState,
+			expectedNumPods:    1,
+			expectedPodRunning: true,
+		},
+		{
+			name: "conflict starting missing pod is retried",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "jose",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PostsubmitJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+					Refs:    &prowapi.Refs{Org: "fejtaverse"},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.PendingState,
+				},
+			},
+			err:                  kube.NewConflictError(errors.New("no way jose")),
+			maxErrorRetries:      3,
+			expectedState:        prowapi.TriggeredState,
+			expectedReport:       true,
+			expectedURL:          "jose/triggered",
+			expectedDescription:  "Pod could not be started. Retrying (1/3).",
+			expectedErrorRetries: 1,
+		},
+		{
+			name: "unprocessable missing pod is not retried",
+			pj: prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "jose",
+				},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PostsubmitJob,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+					Refs:    &prowapi.Refs{Org: "fejtaverse"},
+				},
+				Status: prowapi.ProwJobStatus{
+					State: prowapi.PendingState,
+				},
+			},
+			err:                 kube.NewUnprocessableEntityError(errors.New("no way jose")),
+			maxErrorRetries:     3,
+			expectedState:       prowapi.ErrorState,
+			expectedComplete:    true,
+			expectedReport:      true,
+			expectedURL:         "jose/error",
+			expectedDescription: "Job cannot be processed.",
+		},
+	}
+	for _, tc := range testcases {
+		t.Logf("Running test case %q", tc.name)
+		totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+		defer totServ.Close()
+		pm := make(map[string]kube.Pod)
+		for i := range tc.pods {
+			pm[tc.pods[i].ObjectMeta.Name] = tc.pods[i]
+		}
+		fc := &fkc{
+			prowjobs: []prowapi.ProwJob{tc.pj},
+		}
+		fpc := &fkc{
+			pods: tc.pods,
+			err:  tc.err,
+		}
+		fca := newFakeConfigAgent(t, 0)
+		fca.c.Plank.MaxPodEvictions = tc.maxPodEvictions
+		fca.c.Plank.MaxErrorRetries = tc.maxErrorRetries
+		fca.c.Plank.PodStateOverrides = tc.podStateOverrides
+		c := Controller{
+			kc:          fc,
+			pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+			log:         logrus.NewEntry(logrus.StandardLogger()),
+			config:      fca.Config,
+			totURL:      totServ.URL,
+			pendingJobs: make(map[string]int),
+		}
+
+		reports := make(chan prowapi.ProwJob, 100)
+		if err := c.bind(context.Background()).syncPendingJob(c.log, tc.pj, pm, reports); err != nil {
+			t.Errorf("for case %q got an error: %v", tc.name, err)
+			continue
+		}
+		close(reports)
+
+		actual := fc.prowjobs[0]
+		if actual.Status.State != tc.expectedState {
+			t.Errorf("for case %q got state %v", tc.name, actual.Status.State)
+		}
+		if len(fpc.pods) != tc.expectedNumPods {
+			t.Errorf("for case %q got %d pods, expected %d", tc.name, len(fpc.pods), tc.expectedNumPods)
+		}
+		if tc.expectForceDelete {
+			if len(fpc.deleteOptions) != 1 {
+				t.Errorf("for case %q expected one pod deletion, got %d", tc.name, len(fpc.deleteOptions))
+			} else if gp := fpc.deleteOptions[0].GracePeriodSeconds; gp == nil || *gp != 0 {
+				t.Errorf("for case %q expected the pod to be deleted with a zero grace period, got %v", tc.name, gp)
+			}
+		}
+		if actual.Complete() != tc.expectedComplete {
+			t.Errorf("for case %q got wrong completion", tc.name)
+		}
+		if tc.expectedDescription != "" && actual.Status.Description != tc.expectedDescription {
+			t.Errorf("for case %q got description %q, expected %q", tc.name, actual.Status.Description, tc.expectedDescription)
+		}
+		if actual.Status.PodEvictions != tc.expectedPodEvictions {
+			t.Errorf("for case %q got %d pod evictions, expected %d", tc.name, actual.Status.PodEvictions, tc.expectedPodEvictions)
+		}
+		if actual.Status.ErrorRetries != tc.expectedErrorRetries {
+			t.Errorf("for case %q got %d error retries, expected %d", tc.name, actual.Status.ErrorRetries, tc.expectedErrorRetries)
+		}
+		if actual.Status.UnschedulableReason != tc.expectedUnschedulable {
+			t.Errorf("for case %q got unschedulable reason %q, expected %q", tc.name, actual.Status.UnschedulableReason, tc.expectedUnschedulable)
+		}
+		if actual.Status.PodRunning != tc.expectedPodRunning {
+			t.Errorf("for case %q got pod running %t, expected %t", tc.name, actual.Status.PodRunning, tc.expectedPodRunning)
+		}
+		if len(fc.prowjobs) != tc.expectedCreatedPJs+1 {
+			t.Errorf("for case %q got %d created prowjobs", tc.name, len(fc.prowjobs)-1)
+		}
+		if tc.expectedReport && len(reports) != 1 {
+			t.Errorf("for case %q wanted one report but got %d", tc.name, len(reports))
+		}
+		if !tc.expectedReport && len(reports) != 0 {
+			t.Errorf("for case %q did not wany any reports but got %d", tc.name, len(reports))
+		}
+		if tc.expectedReport {
+			r := <-reports
+
+			if got, want := r.Status.URL, tc.expectedURL; got != want {
 				t.Errorf("for case %q, report.Status.URL: got %q, want %q", tc.name, got, want)
 			}
 		}
 	}
 }
 
+func TestJobCompletionMetrics(t *testing.T) {
+	const job = "completion-metrics-job"
+	pendingJob := func(name string) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Type:    prowapi.PeriodicJob,
+				Job:     job,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:   prowapi.PendingState,
+				PodName: name,
+			},
+		}
+	}
+	pod := func(name string, phase v1.PodPhase) kube.Pod {
+		return kube.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     kube.PodStatus{Phase: phase},
+		}
+	}
+	pjs := []prowapi.ProwJob{pendingJob("succeeded"), pendingJob("failed"), pendingJob("failed-again"), pendingJob("running")}
+	pods := []kube.Pod{
+		pod("succeeded", kube.PodSucceeded),
+		pod("failed", kube.PodFailed),
+		pod("failed-again", kube.PodFailed),
+		pod("running", kube.PodRunning),
+	}
+	pm := map[string]kube.Pod{}
+	for _, pod := range pods {
+		pm[pod.ObjectMeta.Name] = pod
+	}
+
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	fc := &fkc{prowjobs: pjs}
+	c := Controller{
+		kc:          fc,
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: &fkc{pods: pods}},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	reports := make(chan prowapi.ProwJob, 100)
+	for _, pj := range pjs {
+		if err := c.bind(context.Background()).syncPendingJob(c.log, pj, pm, reports); err != nil {
+			t.Fatalf("unexpected error syncing %s: %v", pj.ObjectMeta.Name, err)
+		}
+	}
+	// Syncing a completed job again must not count it twice.
+	if err := c.bind(context.Background()).syncPendingJob(c.log, fc.prowjobs[0], pm, reports); err != nil {
+		t.Fatalf("unexpected error syncing completed job: %v", err)
+	}
+
+	// A job superseded by a newer run of the same presubmit is aborted.
+	now := time.Now()
+	dupes := []prowapi.ProwJob{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "superseded"},
+			Spec: prowapi.ProwJobSpec{
+				Type: prowapi.PresubmitJob,
+				Job:  job,
+				Refs: &prowapi.Refs{Pulls: []prowapi.Pull{{}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     prowapi.PendingState,
+				StartTime: metav1.NewTime(now.Add(-time.Hour)),
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "newest"},
+			Spec: prowapi.ProwJobSpec{
+				Type: prowapi.PresubmitJob,
+				Job:  job,
+				Refs: &prowapi.Refs{Pulls: []prowapi.Pull{{}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     prowapi.PendingState,
+				StartTime: metav1.NewTime(now),
+			},
+		},
+	}
+	fc.prowjobs = append(fc.prowjobs, dupes...)
+	if err := c.bind(context.Background()).terminateDupes(dupes, nil); err != nil {
+		t.Fatalf("unexpected error terminating dupes: %v", err)
+	}
+
+	expected := map[prowapi.ProwJobState]float64{
+		prowapi.SuccessState: 1,
+		prowapi.FailureState: 2,
+		prowapi.ErrorState:   0,
+		prowapi.AbortedState: 1,
+	}
+	for state, count := range expected {
+		var metric dto.Metric
+		if err := jobCompletions.WithLabelValues(job, string(state)).Write(&metric); err != nil {
+			t.Fatalf("failed to read metric: %v", err)
+		}
+		if actual := metric.GetCounter().GetValue(); actual != count {
+			t.Errorf("expected %v completions in state %s, got %v", count, state, actual)
+		}
+	}
+}
+
+// recordingHook keeps every log entry it is fired for.
+type recordingHook struct {
+	sync.Mutex
+	entries []logrus.Entry
+}
+
+func (h *recordingHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *recordingHook) Fire(entry *logrus.Entry) error {
+	h.Lock()
+	defer h.Unlock()
+	h.entries = append(h.entries, *entry)
+	return nil
+}
+
+func TestSyncLogFields(t *testing.T) {
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "prowjobs",
+		},
+		Spec: prowapi.ProwJobSpec{
+			Job:  "pull-foo",
+			Type: prowapi.PresubmitJob,
+			Refs: &prowapi.Refs{
+				Org:   "org",
+				Repo:  "repo",
+				Pulls: []prowapi.Pull{{Number: 1}},
+			},
+			PodSpec: &v1.PodSpec{Containers: []v1.Container{{Name: "test-name"}}},
+		},
+		Status: prowapi.ProwJobStatus{
+			State:   prowapi.PendingState,
+			PodName: "foo",
+		},
+	}
+	pm := map[string]v1.Pod{
+		"foo": {
+			ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+			Status:     v1.PodStatus{Phase: v1.PodSucceeded},
+		},
+	}
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+	hook := &recordingHook{}
+	logger.AddHook(hook)
+	c := Controller{
+		kc:          &fkc{prowjobs: []prowapi.ProwJob{pj}},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: &fkc{}},
+		log:         logrus.NewEntry(logger),
+		config:      newFakeConfigAgent(t, 0).Config,
+		pendingJobs: make(map[string]int),
+	}
+
+	jobs := make(chan prowapi.ProwJob, 1)
+	jobs <- pj
+	close(jobs)
+	reports := make(chan prowapi.ProwJob, 1)
+	errs := make(chan error, 1)
+	syncProwJobs(c.log, c.bind(context.Background()).syncPendingJob, 1, jobs, reports, errs, pm)
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error syncing job: %v", err)
+	}
+
+	expected := logrus.Fields{
+		"name":              "foo",
+		"job":               "pull-foo",
+		"type":              prowapi.PresubmitJob,
+		github.OrgLogField:  "org",
+		github.RepoLogField: "repo",
+		github.PrLogField:   1,
+		"from":              prowapi.PendingState,
+		"to":                prowapi.SuccessState,
+	}
+	var found bool
+	for _, entry := range hook.entries {
+		if entry.Message != "Transitioning states." {
+			continue
+		}
+		found = true
+		for key, value := range expected {
+			if actual, ok := entry.Data[key]; !ok || !reflect.DeepEqual(actual, value) {
+				t.Errorf("expected log field %s=%v, got %v", key, value, actual)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected the state transition to be logged")
+	}
+}
+
 // TestPeriodic walks through the happy path of a periodic job.
 func TestPeriodic(t *testing.T) {
 	per := config.Periodic{
@@ -1183,7 +2340,7 @@ func TestPeriodic(t *testing.T) {
 	}
 	c := Controller{
 		kc:          fc,
-		ghc:         &fghc{},
+		ghc:         &fakegithub.FakeClient{},
 		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: &fkc{}, "trusted": fc},
 		log:         logrus.NewEntry(logrus.StandardLogger()),
 		config:      newFakeConfigAgent(t, 0).Config,
@@ -1206,36 +2363,1086 @@ func TestPeriodic(t *testing.T) {
 	if len(fc.pods[0].Spec.Containers[0].Env) == 0 {
 		t.Fatal("Container has no env set.")
 	}
-	if err := c.Sync(); err != nil {
-		t.Fatalf("Error on second sync: %v", err)
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Error on second sync: %v", err)
+	}
+	if len(fc.pods) != 1 {
+		t.Fatalf("Wrong number of pods after second sync: %d", len(fc.pods))
+	}
+	fc.pods[0].Status.Phase = kube.PodSucceeded
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Error on third sync: %v", err)
+	}
+	if !fc.prowjobs[0].Complete() {
+		t.Fatal("Prow job didn't complete.")
+	}
+	if fc.prowjobs[0].Status.State != prowapi.SuccessState {
+		t.Fatalf("Should be success: %v", fc.prowjobs[0].Status.State)
+	}
+	if len(fc.prowjobs) != 1 {
+		t.Fatalf("Wrong number of prow jobs: %d", len(fc.prowjobs))
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Error on fourth sync: %v", err)
+	}
+}
+
+func TestSyncJobSelector(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	job := func(name, shard string) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{"shard": shard},
+			},
+			Spec: prowapi.ProwJobSpec{
+				Job:     name,
+				Type:    prowapi.PeriodicJob,
+				Agent:   prowapi.KubernetesAgent,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State: prowapi.TriggeredState,
+			},
+		}
+	}
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{job("mine", "a"), job("theirs", "b")},
+	}
+	fca := newFakeConfigAgent(t, 0)
+	fca.c.Plank.JobSelector = "shard=a"
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      fca.Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Unexpected error syncing: %v", err)
+	}
+	if len(fc.pods) != 1 || fc.pods[0].ObjectMeta.Name != "mine" {
+		t.Errorf("Expected only a pod for the selected job, got %v", fc.pods)
+	}
+	for _, pj := range fc.prowjobs {
+		expected := prowapi.TriggeredState
+		if pj.ObjectMeta.Name == "mine" {
+			expected = prowapi.PendingState
+		}
+		if pj.Status.State != expected {
+			t.Errorf("Expected job %s to be %s, got %s", pj.ObjectMeta.Name, expected, pj.Status.State)
+		}
+	}
+}
+
+func TestSyncQueuePositions(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	now := time.Now()
+	job := func(name string, state prowapi.ProwJobState, age time.Duration) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:            "limited",
+				Type:           prowapi.PeriodicJob,
+				Agent:          prowapi.KubernetesAgent,
+				MaxConcurrency: 1,
+				PodSpec:        &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(now.Add(-age)),
+				PodName:   name,
+			},
+		}
+	}
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{
+			job("second", prowapi.TriggeredState, 2*time.Minute),
+			job("running", prowapi.PendingState, time.Hour),
+			job("third", prowapi.TriggeredState, time.Minute),
+			job("first", prowapi.TriggeredState, 3*time.Minute),
+		},
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "running"},
+			Status:     kube.PodStatus{Phase: kube.PodRunning},
+		}},
+	}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Unexpected error syncing: %v", err)
+	}
+	expected := map[string]string{
+		"first":  "Waiting for a free slot, 1st in line.",
+		"second": "Waiting for a free slot, 2nd in line.",
+		"third":  "Waiting for a free slot, 3rd in line.",
+	}
+	for _, pj := range fc.prowjobs {
+		if pj.Status.State != prowapi.TriggeredState {
+			continue
+		}
+		if actual := pj.Status.Description; actual != expected[pj.ObjectMeta.Name] {
+			t.Errorf("Expected job %s to have description %q, got %q", pj.ObjectMeta.Name, expected[pj.ObjectMeta.Name], actual)
+		}
+	}
+	if len(fc.pods) != 1 {
+		t.Errorf("Expected no new pods, got %d pods", len(fc.pods))
+	}
+}
+
+func TestSyncPausedJobs(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	job := func(name string, state prowapi.ProwJobState, paused bool) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:            "limited",
+				Type:           prowapi.PeriodicJob,
+				Agent:          prowapi.KubernetesAgent,
+				MaxConcurrency: 1,
+				PodSpec:        &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:   state,
+				PodName: name,
+				Paused:  paused,
+			},
+		}
+	}
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{
+			job("paused-pending", prowapi.PendingState, true),
+			job("paused-triggered", prowapi.TriggeredState, true),
+			job("triggered", prowapi.TriggeredState, false),
+		},
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "paused-pending"},
+			Status:     kube.PodStatus{Phase: kube.PodSucceeded},
+		}},
+	}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	states := func() map[string]prowapi.ProwJobState {
+		states := map[string]prowapi.ProwJobState{}
+		for _, pj := range fc.prowjobs {
+			states[pj.ObjectMeta.Name] = pj.Status.State
+		}
+		return states
+	}
+
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Unexpected error syncing: %v", err)
+	}
+	expected := map[string]prowapi.ProwJobState{
+		"paused-pending":   prowapi.PendingState,
+		"paused-triggered": prowapi.TriggeredState,
+		// the paused pending job does not take the only slot
+		"triggered": prowapi.PendingState,
+	}
+	if actual := states(); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected states %v, got %v", expected, actual)
+	}
+	var pods []string
+	for _, pod := range fc.pods {
+		pods = append(pods, pod.ObjectMeta.Name)
+	}
+	if expected := []string{"paused-pending", "triggered"}; !reflect.DeepEqual(pods, expected) {
+		t.Errorf("Expected pods %v, got %v", expected, pods)
+	}
+
+	if state, err := c.SyncOne("paused-triggered"); err != nil || state != prowapi.TriggeredState {
+		t.Errorf("Expected SyncOne to leave the paused job triggered, got %s, %v", state, err)
+	}
+	if len(fc.pods) != 2 {
+		t.Errorf("Expected SyncOne to create no pod for the paused job, got %d pods", len(fc.pods))
+	}
+
+	fc.prowjobs[0].Status.Paused = false
+	if err := c.Sync(); err != nil {
+		t.Fatalf("Unexpected error syncing: %v", err)
+	}
+	if actual := states()["paused-pending"]; actual != prowapi.SuccessState {
+		t.Errorf("Expected the unpaused job to resume and succeed, got %s", actual)
+	}
+}
+
+type fakeReporter struct {
+	err      error
+	reported []prowapi.ProwJob
+	// deadlines records whether each report had a deadline.
+	deadlines []bool
+}
+
+func (r *fakeReporter) Report(ctx context.Context, pj prowapi.ProwJob) error {
+	r.reported = append(r.reported, pj)
+	_, ok := ctx.Deadline()
+	r.deadlines = append(r.deadlines, ok)
+	return r.err
+}
+
+// conflictingKc fails to replace ProwJobs, as if they changed in the
+// meantime.
+type conflictingKc struct {
+	*fkc
+}
+
+func (c conflictingKc) ReplaceProwJob(name string, job prowapi.ProwJob) (prowapi.ProwJob, error) {
+	return prowapi.ProwJob{}, kube.NewConflictError(fmt.Errorf("prowjob %s was modified", name))
+}
+
+func TestSyncReporters(t *testing.T) {
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{{
+			ObjectMeta: metav1.ObjectMeta{Name: "done"},
+			Spec: prowapi.ProwJobSpec{
+				Job:     "boop",
+				Type:    prowapi.PeriodicJob,
+				Agent:   prowapi.KubernetesAgent,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:   prowapi.PendingState,
+				PodName: "done",
+			},
+		}},
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "done"},
+			Status:     kube.PodStatus{Phase: kube.PodSucceeded},
+		}},
+	}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		pendingJobs: make(map[string]int),
+		skipReport:  true,
+	}
+	// a failing reporter does not keep the job from the others
+	failing := &fakeReporter{err: errors.New("chat is down")}
+	working := &fakeReporter{}
+	c.AddReporter(failing)
+	c.AddReporter(working)
+
+	if err := c.Sync(); err == nil {
+		t.Error("Expected the error of the failing reporter, got none")
+	}
+	for name, r := range map[string]*fakeReporter{"failing": failing, "working": working} {
+		if len(r.reported) != 1 {
+			t.Errorf("Expected the %s reporter to receive one job, got %d", name, len(r.reported))
+			continue
+		}
+		if pj := r.reported[0]; pj.ObjectMeta.Name != "done" || pj.Status.State != prowapi.SuccessState {
+			t.Errorf("Expected the %s reporter to receive the completed job, got %s in state %s", name, pj.ObjectMeta.Name, pj.Status.State)
+		}
+		if !r.deadlines[0] {
+			t.Errorf("Expected the %s reporter to be given a deadline", name)
+		}
+	}
+
+	// a completion that could not be saved is left for the next sync
+	fc.prowjobs[0].Status.State = prowapi.PendingState
+	fc.prowjobs[0].Status.CompletionTime = nil
+	unsaved := &fakeReporter{}
+	c.kc = conflictingKc{fkc: fc}
+	c.reporters = []Reporter{unsaved}
+	if err := c.Sync(); err == nil {
+		t.Error("Expected the error replacing the job, got none")
+	}
+	if len(unsaved.reported) != 0 {
+		t.Errorf("Expected the unsaved completion not to be reported, got %d reports", len(unsaved.reported))
+	}
+}
+
+func TestRequeueJob(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	job := func(name, job string, state prowapi.ProwJobState) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:            job,
+				Type:           prowapi.PeriodicJob,
+				Agent:          prowapi.KubernetesAgent,
+				MaxConcurrency: 3,
+				PodSpec:        &kube.PodSpec{Containers: []kube.Container{{Name: "test-name"}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:   state,
+				PodName: name,
+			},
+		}
+	}
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{
+			job("running", "wanted", prowapi.PendingState),
+			job("first", "wanted", prowapi.TriggeredState),
+			job("second", "wanted", prowapi.TriggeredState),
+			job("third", "wanted", prowapi.TriggeredState),
+			job("other", "unwanted", prowapi.TriggeredState),
+		},
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "running"},
+			Status:     kube.PodStatus{Phase: kube.PodRunning},
+		}},
+	}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	if err := c.RequeueJob("wanted"); err != nil {
+		t.Fatalf("Unexpected error requeueing: %v", err)
+	}
+
+	started := map[string]bool{}
+	for _, pj := range fc.prowjobs {
+		if pj.Spec.Job == "wanted" && pj.ObjectMeta.Name != "running" && pj.Status.State == prowapi.PendingState {
+			started[pj.ObjectMeta.Name] = true
+		}
+		if pj.ObjectMeta.Name == "other" && pj.Status.State != prowapi.TriggeredState {
+			t.Errorf("Expected the job of another name to stay triggered, got %s", pj.Status.State)
+		}
+	}
+	// one of the three slots is taken by the running job
+	if len(started) != 2 {
+		t.Errorf("Expected two of the triggered jobs to be started, got %v", started)
+	}
+	if len(fc.pods) != 3 {
+		t.Errorf("Expected two new pods, got %d pods", len(fc.pods))
+	}
+	for _, pod := range fc.pods {
+		if pod.ObjectMeta.Name == "other" {
+			t.Error("Expected no pod for the job of another name")
+		}
+	}
+
+	// RequeueJob waits for a sync in progress, whose pending jobs it
+	// would otherwise reset.
+	c.syncLock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.RequeueJob("wanted")
+	}()
+	select {
+	case <-done:
+		t.Error("Expected RequeueJob to wait for the sync in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.syncLock.Unlock()
+	<-done
+}
+
+func TestAbortJobsForPull(t *testing.T) {
+	job := func(name string, jobType prowapi.ProwJobType, repo string, state prowapi.ProwJobState, numbers ...int) prowapi.ProwJob {
+		pj := prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:   name,
+				Type:  jobType,
+				Agent: prowapi.KubernetesAgent,
+				Refs:  &prowapi.Refs{Org: "org", Repo: repo},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:   state,
+				PodName: name,
+			},
+		}
+		for _, number := range numbers {
+			pj.Spec.Refs.Pulls = append(pj.Spec.Refs.Pulls, prowapi.Pull{Number: number})
+		}
+		if state != prowapi.PendingState && state != prowapi.TriggeredState {
+			pj.SetComplete()
+		}
+		return pj
+	}
+	pod := func(name string) kube.Pod {
+		return kube.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status:     kube.PodStatus{Phase: kube.PodRunning},
+		}
+	}
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{
+			job("running", prowapi.PresubmitJob, "repo", prowapi.PendingState, 123),
+			job("triggered", prowapi.PresubmitJob, "repo", prowapi.TriggeredState, 123),
+			job("batch", prowapi.BatchJob, "repo", prowapi.PendingState, 123),
+			job("shared-batch", prowapi.BatchJob, "repo", prowapi.PendingState, 122, 123),
+			job("passed", prowapi.PresubmitJob, "repo", prowapi.SuccessState, 123),
+			job("other-pull", prowapi.PresubmitJob, "repo", prowapi.PendingState, 124),
+			job("other-batch", prowapi.BatchJob, "repo", prowapi.PendingState, 122, 124),
+			job("other-repo", prowapi.PresubmitJob, "other", prowapi.PendingState, 123),
+			job("postsubmit", prowapi.PostsubmitJob, "repo", prowapi.PendingState),
+		},
+		pods: []kube.Pod{pod("running"), pod("batch"), pod("shared-batch"), pod("other-pull"), pod("other-batch"), pod("other-repo")},
+	}
+	c := Controller{
+		kc:     fc,
+		pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: newFakeConfigAgent(t, 0).Config,
+	}
+	if err := c.AbortJobsForPull("org", "repo", 123); err != nil {
+		t.Fatalf("Unexpected error aborting jobs: %v", err)
+	}
+
+	aborted := map[string]bool{"running": true, "triggered": true, "batch": true}
+	for _, pj := range fc.prowjobs {
+		if aborted[pj.ObjectMeta.Name] {
+			if pj.Status.State != prowapi.AbortedState || !pj.Complete() {
+				t.Errorf("Expected %s to be aborted, got state %s", pj.ObjectMeta.Name, pj.Status.State)
+			}
+			continue
+		}
+		if pj.Status.State == prowapi.AbortedState {
+			t.Errorf("Expected %s not to be aborted", pj.ObjectMeta.Name)
+		}
+	}
+	var deleted []string
+	for _, pod := range fc.deletedPods {
+		deleted = append(deleted, pod.ObjectMeta.Name)
+	}
+	sort.Strings(deleted)
+	if expected := []string{"batch", "running"}; !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("Expected pods %v to be deleted, got %v", expected, deleted)
+	}
+
+	// AbortJobsForPull waits for a sync in progress, which may be
+	// replacing the same jobs.
+	c.syncLock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.AbortJobsForPull("org", "repo", 124)
+	}()
+	select {
+	case <-done:
+		t.Error("Expected AbortJobsForPull to wait for the sync in progress")
+	case <-time.After(100 * time.Millisecond):
+	}
+	c.syncLock.Unlock()
+	<-done
+}
+
+func TestOrdinal(t *testing.T) {
+	for n, expected := range map[int]string{1: "1st", 2: "2nd", 3: "3rd", 4: "4th", 11: "11th", 12: "12th", 13: "13th", 21: "21st", 102: "102nd", 111: "111th"} {
+		if actual := ordinal(n); actual != expected {
+			t.Errorf("Expected %d to be %q, got %q", n, expected, actual)
+		}
+	}
+}
+
+func TestStartPodExtraContainers(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	fc := &fkc{}
+	fca := newFakeConfigAgent(t, 0)
+	fca.c.Plank.ExtraContainers = []kube.Container{{Name: "logger", Image: "fluentd"}}
+	c := Controller{
+		pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: fca.Config,
+		totURL: totServ.URL,
+	}
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+		Spec: prowapi.ProwJobSpec{
+			Job:     "boop",
+			Type:    prowapi.PeriodicJob,
+			PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Image: "alpine"}}},
+		},
+	}
+	if _, _, err := c.bind(context.Background()).startPod(pj); err != nil {
+		t.Fatalf("Unexpected error starting pod: %v", err)
+	}
+	if len(fc.pods) != 1 {
+		t.Fatalf("Expected one pod, got %d", len(fc.pods))
+	}
+	containers := fc.pods[0].Spec.Containers
+	if len(containers) != 2 {
+		t.Fatalf("Expected the test container and the extra container, got %#v", containers)
+	}
+	if containers[0].Name != kube.TestContainerName || containers[0].Image != "alpine" {
+		t.Errorf("Expected the test container first, got %#v", containers[0])
+	}
+	if len(containers[0].Env) == 0 {
+		t.Error("Test container has no env set.")
+	}
+	if containers[1].Name != "logger" || containers[1].Image != "fluentd" {
+		t.Errorf("Expected the extra container second, got %#v", containers[1])
+	}
+	if len(containers[1].Env) != 0 {
+		t.Errorf("Extra container should not get the job env, got %v", containers[1].Env)
+	}
+	if len(fca.c.Plank.ExtraContainers[0].Env) != 0 {
+		t.Error("Starting a pod modified the configured extra containers.")
+	}
+}
+
+func TestStartPodInitContainers(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	fc := &fkc{}
+	c := Controller{
+		pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: newFakeConfigAgent(t, 0).Config,
+		totURL: totServ.URL,
+	}
+	initContainer := kube.Container{
+		Name:         "fetch-secrets",
+		Image:        "vault",
+		Args:         []string{"--out=/secrets"},
+		VolumeMounts: []kube.VolumeMount{{Name: "secrets", MountPath: "/secrets"}},
+	}
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+		Spec: prowapi.ProwJobSpec{
+			Job:  "boop",
+			Type: prowapi.PeriodicJob,
+			PodSpec: &kube.PodSpec{
+				InitContainers: []kube.Container{initContainer},
+				Containers:     []kube.Container{{Name: "test-name", Image: "alpine"}},
+			},
+		},
+	}
+	if _, _, err := c.bind(context.Background()).startPod(pj); err != nil {
+		t.Fatalf("Unexpected error starting pod: %v", err)
+	}
+	if len(fc.pods) != 1 {
+		t.Fatalf("Expected one pod, got %d", len(fc.pods))
+	}
+	if expected, actual := []kube.Container{initContainer}, fc.pods[0].Spec.InitContainers; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected the init container to be copied unchanged, got %#v", actual)
+	}
+	if len(fc.pods[0].Spec.Containers) != 1 || fc.pods[0].Spec.Containers[0].Image != "alpine" {
+		t.Errorf("Expected only the test container, got %#v", fc.pods[0].Spec.Containers)
+	}
+}
+
+func TestStartPodSpreadByJob(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	fc := &fkc{}
+	fca := newFakeConfigAgent(t, 0)
+	fca.c.Plank.SpreadPodsByJob = true
+	c := Controller{
+		pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:    logrus.NewEntry(logrus.StandardLogger()),
+		config: fca.Config,
+		totURL: totServ.URL,
+	}
+	nodeAffinity := &v1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+			NodeSelectorTerms: []v1.NodeSelectorTerm{{
+				MatchExpressions: []v1.NodeSelectorRequirement{{Key: "pool", Operator: v1.NodeSelectorOpIn, Values: []string{"builds"}}},
+			}},
+		},
+	}
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+		Spec: prowapi.ProwJobSpec{
+			Job:  "boop",
+			Type: prowapi.PeriodicJob,
+			PodSpec: &kube.PodSpec{
+				Containers: []kube.Container{{Name: "test-name", Image: "alpine"}},
+				Affinity:   &v1.Affinity{NodeAffinity: nodeAffinity},
+			},
+		},
+	}
+	if _, _, err := c.bind(context.Background()).startPod(pj); err != nil {
+		t.Fatalf("Unexpected error starting pod: %v", err)
+	}
+	if len(fc.pods) != 1 {
+		t.Fatalf("Expected one pod, got %d", len(fc.pods))
+	}
+	expected := &v1.Affinity{
+		NodeAffinity: nodeAffinity,
+		PodAntiAffinity: &v1.PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.WeightedPodAffinityTerm{{
+				Weight: 100,
+				PodAffinityTerm: v1.PodAffinityTerm{
+					LabelSelector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{kube.ProwJobAnnotation: "boop"},
+					},
+					TopologyKey: "kubernetes.io/hostname",
+				},
+			}},
+		},
+	}
+	if actual := fc.pods[0].Spec.Affinity; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected affinity %#v, got %#v", expected, actual)
+	}
+	if pj.Spec.PodSpec.Affinity.PodAntiAffinity != nil {
+		t.Error("Starting a pod modified the pod spec of the job.")
+	}
+}
+
+func TestStartPodActiveDeadline(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	decoration := func(timeout, gracePeriod time.Duration) *prowapi.DecorationConfig {
+		return &prowapi.DecorationConfig{
+			Timeout:     timeout,
+			GracePeriod: gracePeriod,
+			UtilityImages: &prowapi.UtilityImages{
+				CloneRefs:  "clonerefs:tag",
+				InitUpload: "initupload:tag",
+				Entrypoint: "entrypoint:tag",
+				Sidecar:    "sidecar:tag",
+			},
+			GCSConfiguration:     &prowapi.GCSConfiguration{Bucket: "bucket", PathStrategy: "explicit"},
+			GCSCredentialsSecret: "secret",
+		}
+	}
+	deadline := func(seconds int64) *int64 { return &seconds }
+	var testcases = []struct {
+		name             string
+		enabled          bool
+		margin           time.Duration
+		decorationConfig *prowapi.DecorationConfig
+		podDeadline      *int64
+		expected         *int64
+	}{
+		{
+			name:             "disabled",
+			decorationConfig: decoration(time.Hour, 0),
+		},
+		{
+			name:             "timeout plus grace period, rounded up",
+			enabled:          true,
+			decorationConfig: decoration(time.Hour, 1500*time.Millisecond),
+			expected:         deadline(3602),
+		},
+		{
+			name:             "margin for starting the pod",
+			enabled:          true,
+			margin:           10 * time.Minute,
+			decorationConfig: decoration(time.Hour, 15*time.Second),
+			expected:         deadline(3600 + 15 + 600),
+		},
+		{
+			name:    "undecorated job",
+			enabled: true,
+		},
+		{
+			name:             "decorated job without a timeout",
+			enabled:          true,
+			decorationConfig: decoration(0, 0),
+		},
+		{
+			name:             "deadline set by the job is kept",
+			enabled:          true,
+			decorationConfig: decoration(time.Hour, 0),
+			podDeadline:      deadline(60),
+			expected:         deadline(60),
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fkc{}
+			fca := newFakeConfigAgent(t, 0)
+			fca.c.Plank.PodActiveDeadline = tc.enabled
+			fca.c.Plank.PodActiveDeadlineMargin = tc.margin
+			c := Controller{
+				pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+				log:    logrus.NewEntry(logrus.StandardLogger()),
+				config: fca.Config,
+				totURL: totServ.URL,
+			}
+			pj := prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+				Spec: prowapi.ProwJobSpec{
+					Job:  "boop",
+					Type: prowapi.PeriodicJob,
+					PodSpec: &kube.PodSpec{
+						Containers:            []kube.Container{{Name: "test-name", Image: "alpine", Command: []string{"test"}}},
+						ActiveDeadlineSeconds: tc.podDeadline,
+					},
+					DecorationConfig: tc.decorationConfig,
+				},
+			}
+			if _, _, err := c.bind(context.Background()).startPod(pj); err != nil {
+				t.Fatalf("Unexpected error starting pod: %v", err)
+			}
+			actual := fc.pods[0].Spec.ActiveDeadlineSeconds
+			if !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected active deadline %v, got %v", tc.expected, actual)
+			}
+			if dc := tc.decorationConfig; tc.margin > 0 && actual != nil && time.Duration(*actual)*time.Second <= dc.Timeout+dc.GracePeriod {
+				t.Errorf("Expected the active deadline %ds to exceed the timeout and grace period", *actual)
+			}
+		})
+	}
+}
+
+func TestStartPodDecorationDefaults(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	defaults := &prowapi.DecorationConfig{
+		Timeout: time.Hour,
+		UtilityImages: &prowapi.UtilityImages{
+			CloneRefs:  "clonerefs:default",
+			InitUpload: "initupload:default",
+			Entrypoint: "entrypoint:default",
+			Sidecar:    "sidecar:default",
+		},
+		GCSConfiguration:     &prowapi.GCSConfiguration{Bucket: "bucket", PathStrategy: "explicit"},
+		GCSCredentialsSecret: "secret",
+	}
+	var testcases = []struct {
+		name             string
+		defaults         *prowapi.DecorationConfig
+		decorationConfig *prowapi.DecorationConfig
+		expectedSidecar  string
+		expectedDeadline int64
+		expectErr        bool
+	}{
+		{
+			name:             "job without its own config inherits the default",
+			defaults:         defaults,
+			decorationConfig: &prowapi.DecorationConfig{},
+			expectedSidecar:  "sidecar:default",
+			expectedDeadline: 3600,
+		},
+		{
+			name:     "job overrides win over the default",
+			defaults: defaults,
+			decorationConfig: &prowapi.DecorationConfig{
+				Timeout:       2 * time.Hour,
+				UtilityImages: &prowapi.UtilityImages{Sidecar: "sidecar:override"},
+			},
+			expectedSidecar:  "sidecar:override",
+			expectedDeadline: 7200,
+		},
+		{
+			name: "incomplete config without a default is rejected",
+			decorationConfig: &prowapi.DecorationConfig{
+				UtilityImages: &prowapi.UtilityImages{Sidecar: "sidecar:override"},
+			},
+			expectErr: true,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fkc{}
+			fca := newFakeConfigAgent(t, 0)
+			fca.c.Plank.DefaultDecorationConfig = tc.defaults
+			fca.c.Plank.PodActiveDeadline = true
+			c := Controller{
+				pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+				log:    logrus.NewEntry(logrus.StandardLogger()),
+				config: fca.Config,
+				totURL: totServ.URL,
+			}
+			pj := prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+				Spec: prowapi.ProwJobSpec{
+					Job:              "boop",
+					Type:             prowapi.PeriodicJob,
+					PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Image: "alpine", Command: []string{"test"}}}},
+					DecorationConfig: tc.decorationConfig,
+				},
+			}
+			_, _, err := c.bind(context.Background()).startPod(pj)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatal("Expected an error starting the pod, got none")
+				}
+				if err := c.startPodFailed(c.log, &pj, err); err != nil {
+					t.Fatalf("Expected the job to be errored, got %v", err)
+				}
+				if pj.Status.State != prowapi.ErrorState || len(fc.pods) != 0 {
+					t.Errorf("Expected the job to be errored without a pod, got state %s and %d pods", pj.Status.State, len(fc.pods))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error starting pod: %v", err)
+			}
+			pod := fc.pods[0]
+			var sidecar string
+			for _, container := range pod.Spec.Containers {
+				if container.Name == "sidecar" {
+					sidecar = container.Image
+				}
+			}
+			if sidecar != tc.expectedSidecar {
+				t.Errorf("Expected sidecar image %q, got %q", tc.expectedSidecar, sidecar)
+			}
+			if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != tc.expectedDeadline {
+				t.Errorf("Expected active deadline %d, got %v", tc.expectedDeadline, pod.Spec.ActiveDeadlineSeconds)
+			}
+		})
+	}
+}
+
+func TestStartPodDefaultTimeoutByType(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	testCases := []struct {
+		name     string
+		jobType  prowapi.ProwJobType
+		timeout  time.Duration
+		expected int64
+	}{
+		{
+			name:     "presubmit inherits the default of its type",
+			jobType:  prowapi.PresubmitJob,
+			expected: 30*60 + 15,
+		},
+		{
+			name:     "timeout of the job wins over the default of its type",
+			jobType:  prowapi.PresubmitJob,
+			timeout:  10 * time.Minute,
+			expected: 10*60 + 15,
+		},
+		{
+			name:     "type without a default uses the default decoration config",
+			jobType:  prowapi.PostsubmitJob,
+			expected: 2*60*60 + 15,
+		},
+		{
+			name:     "batch inherits the timeout its presubmit got from the config",
+			jobType:  prowapi.BatchJob,
+			timeout:  30 * time.Minute,
+			expected: 30*60 + 15,
+		},
+		{
+			name:     "batch without a timeout uses the default of its type",
+			jobType:  prowapi.BatchJob,
+			expected: 45*60 + 15,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pj := prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "job"},
+				Spec: prowapi.ProwJobSpec{
+					Job:              "job",
+					Type:             tc.jobType,
+					Agent:            prowapi.KubernetesAgent,
+					PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Command: []string{"test"}}}},
+					DecorationConfig: &prowapi.DecorationConfig{Timeout: tc.timeout},
+					Refs:             &prowapi.Refs{Org: "org", Repo: "repo", Pulls: []prowapi.Pull{{Number: 1}}},
+				},
+			}
+			fc := &fkc{}
+			fca := newFakeConfigAgent(t, 0)
+			fca.c.Plank.PodActiveDeadline = true
+			fca.c.Plank.DefaultTimeoutByType = map[prowapi.ProwJobType]time.Duration{prowapi.PresubmitJob: 30 * time.Minute, prowapi.BatchJob: 45 * time.Minute}
+			fca.c.Plank.DefaultDecorationConfig = &prowapi.DecorationConfig{
+				Timeout:     2 * time.Hour,
+				GracePeriod: 15 * time.Second,
+				UtilityImages: &prowapi.UtilityImages{
+					CloneRefs:  "clonerefs",
+					InitUpload: "initupload",
+					Entrypoint: "entrypoint",
+					Sidecar:    "sidecar",
+				},
+				GCSConfiguration: &prowapi.GCSConfiguration{
+					Bucket:       "bucket",
+					PathStrategy: "explicit",
+				},
+				GCSCredentialsSecret: "secret",
+			}
+			c := Controller{
+				kc:     fc,
+				pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+				log:    logrus.NewEntry(logrus.StandardLogger()),
+				config: fca.Config,
+				totURL: totServ.URL,
+			}
+			if _, _, err := c.bind(context.Background()).startPod(pj); err != nil {
+				t.Fatalf("unexpected error starting pod: %v", err)
+			}
+			if len(fc.pods) != 1 {
+				t.Fatalf("expected one pod, got %d", len(fc.pods))
+			}
+			deadline := fc.pods[0].Spec.ActiveDeadlineSeconds
+			if deadline == nil || *deadline != tc.expected {
+				t.Errorf("expected an active deadline of %d seconds, got %v", tc.expected, deadline)
+			}
+		})
+	}
+}
+
+func TestStartPodBuildNumberEnv(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	var testcases = []struct {
+		name       string
+		envName    string
+		expected   []string
+		unexpected []string
+	}{
+		{
+			name:     "default name",
+			expected: []string{"BUILD_ID", "BUILD_NUMBER"},
+		},
+		{
+			name:       "other name",
+			envName:    "PROW_BUILD_NUMBER",
+			expected:   []string{"BUILD_ID", "PROW_BUILD_NUMBER"},
+			unexpected: []string{"BUILD_NUMBER"},
+		},
+		{
+			name:       "name of another variable",
+			envName:    "BUILD_ID",
+			expected:   []string{"BUILD_ID"},
+			unexpected: []string{"BUILD_NUMBER"},
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fkc{}
+			fca := newFakeConfigAgent(t, 0)
+			fca.c.Plank.BuildNumberEnvName = tc.envName
+			c := Controller{
+				pkcs:   map[string]kubeClient{kube.DefaultClusterAlias: fc},
+				log:    logrus.NewEntry(logrus.StandardLogger()),
+				config: fca.Config,
+				totURL: totServ.URL,
+			}
+			pj := prowapi.ProwJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "blabla"},
+				Spec: prowapi.ProwJobSpec{
+					Job:     "boop",
+					Type:    prowapi.PeriodicJob,
+					Agent:   prowapi.KubernetesAgent,
+					PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Image: "alpine"}}},
+				},
+			}
+			buildID, _, err := c.bind(context.Background()).startPod(pj)
+			if err != nil {
+				t.Fatalf("Unexpected error starting pod: %v", err)
+			}
+			env := map[string][]string{}
+			for _, e := range fc.pods[0].Spec.Containers[0].Env {
+				env[e.Name] = append(env[e.Name], e.Value)
+			}
+			for _, name := range tc.expected {
+				if values := env[name]; !reflect.DeepEqual(values, []string{buildID}) {
+					t.Errorf("Expected %s to be set once to %q, got %q", name, buildID, values)
+				}
+			}
+			for _, name := range tc.unexpected {
+				if values, set := env[name]; set {
+					t.Errorf("Expected %s not to be set, got %q", name, values)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncOne(t *testing.T) {
+	newJob := func(name string) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:     name,
+				Type:    prowapi.PeriodicJob,
+				Agent:   prowapi.KubernetesAgent,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State: prowapi.TriggeredState,
+			},
+		}
+	}
+
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{newJob("other"), newJob("target")},
+	}
+	fpc := &fkc{}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+
+	state, err := c.SyncOne("target")
+	if err != nil {
+		t.Fatalf("unexpected error syncing job: %v", err)
 	}
-	if len(fc.pods) != 1 {
-		t.Fatalf("Wrong number of pods after second sync: %d", len(fc.pods))
+	if state != prowapi.PendingState {
+		t.Errorf("expected the job to be pending, got %v", state)
 	}
-	fc.pods[0].Status.Phase = kube.PodSucceeded
-	if err := c.Sync(); err != nil {
-		t.Fatalf("Error on third sync: %v", err)
+	if len(fpc.pods) != 1 || fpc.pods[0].ObjectMeta.Name != "target" {
+		t.Fatalf("expected a pod to be created for the job only, got %v", fpc.pods)
 	}
-	if !fc.prowjobs[0].Complete() {
-		t.Fatal("Prow job didn't complete.")
+	if other := fc.prowjobs[0]; other.Status.State != prowapi.TriggeredState {
+		t.Errorf("expected other jobs to be left alone, got state %v", other.Status.State)
 	}
-	if fc.prowjobs[0].Status.State != prowapi.SuccessState {
-		t.Fatalf("Should be success: %v", fc.prowjobs[0].Status.State)
+
+	fpc.pods[0].Status.Phase = kube.PodSucceeded
+	state, err = c.SyncOne("target")
+	if err != nil {
+		t.Fatalf("unexpected error syncing job: %v", err)
 	}
-	if len(fc.prowjobs) != 1 {
-		t.Fatalf("Wrong number of prow jobs: %d", len(fc.prowjobs))
+	if state != prowapi.SuccessState {
+		t.Errorf("expected the job to succeed, got %v", state)
 	}
-	if err := c.Sync(); err != nil {
-		t.Fatalf("Error on fourth sync: %v", err)
+
+	if _, err := c.SyncOne("missing"); err == nil {
+		t.Error("expected an error syncing a missing job")
+	}
+
+	// SyncOne waits for a sync in progress, whose pending jobs it would
+	// otherwise reset.
+	c.syncLock.Lock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.SyncOne("target")
+	}()
+	select {
+	case <-done:
+		t.Error("expected SyncOne to wait for the sync in progress")
+	case <-time.After(100 * time.Millisecond):
 	}
+	c.syncLock.Unlock()
+	<-done
 }
 
 func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 	tests := []struct {
-		name         string
-		pjs          []prowapi.ProwJob
-		pendingJobs  map[string]int
-		expectedPods int
+		name                  string
+		pjs                   []prowapi.ProwJob
+		pendingJobs           map[string]int
+		defaultMaxConcurrency map[prowapi.ProwJobType]int
+		expectedPods          int
 	}{
 		{
 			name: "avoid starting a triggered job",
@@ -1330,6 +3537,171 @@ func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 			pendingJobs:  map[string]int{"test-bazel-build": 5},
 			expectedPods: 0,
 		},
+		{
+			name: "differently named jobs sharing a concurrency group respect the group limit",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:              "test-bazel-build",
+						Type:             prowapi.PostsubmitJob,
+						MaxConcurrency:   1,
+						ConcurrencyGroup: "shared-resource",
+						PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:             &prowapi.Refs{Org: "fejtaverse"},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:              "test-bazel-test",
+						Type:             prowapi.PostsubmitJob,
+						MaxConcurrency:   1,
+						ConcurrencyGroup: "shared-resource",
+						PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:             &prowapi.Refs{Org: "fejtaverse"},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:  make(map[string]int),
+			expectedPods: 1,
+		},
+		{
+			name: "job cannot start when another job in its concurrency group is pending",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:              "test-bazel-test",
+						Type:             prowapi.PostsubmitJob,
+						MaxConcurrency:   1,
+						ConcurrencyGroup: "shared-resource",
+						PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:             &prowapi.Refs{Org: "fejtaverse"},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:  map[string]int{"shared-resource": 1},
+			expectedPods: 0,
+		},
+		{
+			name: "pending jobs of the same name outside the group do not count against it",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:              "test-bazel-test",
+						Type:             prowapi.PostsubmitJob,
+						MaxConcurrency:   1,
+						ConcurrencyGroup: "shared-resource",
+						PodSpec:          &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:             &prowapi.Refs{Org: "fejtaverse"},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:  map[string]int{"test-bazel-test": 1},
+			expectedPods: 1,
+		},
+		{
+			name: "presubmit without max concurrency falls through to the type default",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:     "test-bazel-build",
+						Type:    prowapi.PresubmitJob,
+						PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:    &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:     "test-bazel-build",
+						Type:    prowapi.PresubmitJob,
+						PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:    &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:           make(map[string]int),
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 1},
+			expectedPods:          1,
+		},
+		{
+			name: "job max concurrency takes precedence over the type default",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:            "test-bazel-build",
+						Type:           prowapi.PresubmitJob,
+						MaxConcurrency: 2,
+						PodSpec:        &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:           &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:            "test-bazel-build",
+						Type:           prowapi.PresubmitJob,
+						MaxConcurrency: 2,
+						PodSpec:        &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:           &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:           make(map[string]int),
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 1},
+			expectedPods:          2,
+		},
+		{
+			name: "type default does not apply to other job types",
+			pjs: []prowapi.ProwJob{
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:     "test-bazel-build",
+						Type:    prowapi.PeriodicJob,
+						PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:    &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+				{
+					Spec: prowapi.ProwJobSpec{
+						Job:     "test-bazel-build",
+						Type:    prowapi.PeriodicJob,
+						PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+						Refs:    &prowapi.Refs{Org: "fejtaverse", Pulls: []prowapi.Pull{{Number: 1}}},
+					},
+					Status: prowapi.ProwJobStatus{
+						State: prowapi.TriggeredState,
+					},
+				},
+			},
+			pendingJobs:           make(map[string]int),
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 1},
+			expectedPods:          2,
+		},
 	}
 
 	for _, test := range tests {
@@ -1344,11 +3716,13 @@ func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 			prowjobs: test.pjs,
 		}
 		fpc := &fkc{}
+		fca := newFakeConfigAgent(t, 0)
+		fca.c.Plank.DefaultMaxConcurrencyByType = test.defaultMaxConcurrency
 		c := Controller{
 			kc:          fc,
 			pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
 			log:         logrus.NewEntry(logrus.StandardLogger()),
-			config:      newFakeConfigAgent(t, 0).Config,
+			config:      fca.Config,
 			pendingJobs: test.pendingJobs,
 		}
 
@@ -1356,9 +3730,353 @@ func TestMaxConcurrencyWithNewlyTriggeredJobs(t *testing.T) {
 		errors := make(chan error, len(test.pjs))
 		pm := make(map[string]kube.Pod)
 
-		syncProwJobs(c.log, c.syncTriggeredJob, 20, jobs, reports, errors, pm)
+		syncProwJobs(c.log, c.bind(context.Background()).syncTriggeredJob, 20, jobs, reports, errors, pm)
 		if len(fpc.pods) != test.expectedPods {
 			t.Errorf("expected pods: %d, got: %d", test.expectedPods, len(fpc.pods))
 		}
 	}
 }
+
+func TestFairScheduling(t *testing.T) {
+	newJob := func(name string, i int) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              fmt.Sprintf("%s-%d", name, i),
+				CreationTimestamp: metav1.NewTime(time.Now().Add(time.Duration(i) * time.Second)),
+			},
+			Spec: prowapi.ProwJobSpec{
+				Job:     name,
+				Type:    prowapi.PeriodicJob,
+				PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+			},
+			Status: prowapi.ProwJobStatus{
+				State: prowapi.TriggeredState,
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		fairScheduling bool
+		pending        []string
+		expected       map[string]int
+	}{
+		{
+			name:     "first come, first served",
+			expected: map[string]int{"hog": 4},
+		},
+		{
+			name:           "slots are shared between job names",
+			fairScheduling: true,
+			expected:       map[string]int{"hog": 2, "other": 2},
+		},
+		{
+			name:           "names with pending jobs yield to the others",
+			fairScheduling: true,
+			pending:        []string{"hog"},
+			expected:       map[string]int{"hog": 1, "other": 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pjs []prowapi.ProwJob
+			for i := 0; i < 10; i++ {
+				pjs = append(pjs, newJob("hog", i))
+			}
+			for i := 10; i < 20; i++ {
+				pjs = append(pjs, newJob("other", i))
+			}
+			pendingJobs := map[string]int{}
+			for i, name := range test.pending {
+				pj := newJob(name, 100+i)
+				pj.Status.State = prowapi.PendingState
+				pjs = append(pjs, pj)
+				pendingJobs[name]++
+			}
+
+			fc := &fkc{
+				prowjobs: pjs,
+			}
+			fpc := &fkc{}
+			fca := newFakeConfigAgent(t, 4)
+			c := Controller{
+				kc:          fc,
+				pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fpc},
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      fca.Config,
+				pendingJobs: pendingJobs,
+			}
+
+			_, jobs := pjutil.PartitionActive(pjs)
+			if test.fairScheduling {
+				jobs = fairlyOrdered(pjs, jobs)
+			}
+			reports := make(chan prowapi.ProwJob, len(pjs))
+			errors := make(chan error, len(pjs))
+			syncProwJobs(c.log, c.bind(context.Background()).syncTriggeredJob, 1, jobs, reports, errors, map[string]kube.Pod{})
+			close(errors)
+			for err := range errors {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			started := map[string]int{}
+			for _, pj := range fc.prowjobs {
+				if pj.Status.State == prowapi.PendingState && pj.Status.PodName != "" {
+					started[pj.Spec.Job]++
+				}
+			}
+			if !reflect.DeepEqual(started, test.expected) {
+				t.Errorf("expected jobs to be started %v, got %v", test.expected, started)
+			}
+		})
+	}
+}
+
+func TestCanExecuteConcurrently(t *testing.T) {
+	tests := []struct {
+		name                  string
+		maxConcurrency        int
+		globalMaxConcurrency  int
+		defaultMaxConcurrency map[prowapi.ProwJobType]int
+		pendingJobs           map[string]int
+		expected              bool
+	}{
+		{
+			name:        "no limits",
+			pendingJobs: map[string]int{"job": 10},
+			expected:    true,
+		},
+		{
+			name:                  "zero falls back to the type default",
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 2},
+			pendingJobs:           map[string]int{"job": 2},
+		},
+		{
+			name:                  "zero is below the type default",
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 2},
+			pendingJobs:           map[string]int{"job": 1},
+			expected:              true,
+		},
+		{
+			name:                  "own limit takes precedence over the type default",
+			maxConcurrency:        3,
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 2},
+			pendingJobs:           map[string]int{"job": 2},
+			expected:              true,
+		},
+		{
+			name:                 "zero is held back by the global limit",
+			globalMaxConcurrency: 2,
+			pendingJobs:          map[string]int{"other": 2},
+		},
+		{
+			name:                  "unlimited ignores the type default",
+			maxConcurrency:        prowapi.UnlimitedConcurrency,
+			defaultMaxConcurrency: map[prowapi.ProwJobType]int{prowapi.PresubmitJob: 2},
+			pendingJobs:           map[string]int{"job": 2},
+			expected:              true,
+		},
+		{
+			name:                 "unlimited ignores the global limit",
+			maxConcurrency:       prowapi.UnlimitedConcurrency,
+			globalMaxConcurrency: 2,
+			pendingJobs:          map[string]int{"job": 1, "other": 1},
+			expected:             true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fca := newFakeConfigAgent(t, test.globalMaxConcurrency)
+			fca.c.Plank.DefaultMaxConcurrencyByType = test.defaultMaxConcurrency
+			c := Controller{
+				log:         logrus.NewEntry(logrus.StandardLogger()),
+				config:      fca.Config,
+				pendingJobs: test.pendingJobs,
+			}
+			pj := &prowapi.ProwJob{
+				Spec: prowapi.ProwJobSpec{
+					Job:            "job",
+					Type:           prowapi.PresubmitJob,
+					MaxConcurrency: test.maxConcurrency,
+				},
+			}
+			pending := test.pendingJobs["job"]
+			if actual := c.canExecuteConcurrently(pj); actual != test.expected {
+				t.Errorf("expected %t, got %t", test.expected, actual)
+			}
+			expectedPending := pending
+			if test.expected {
+				expectedPending++
+			}
+			if actual := c.pendingJobs["job"]; actual != expectedPending {
+				t.Errorf("expected %d pending jobs, got %d", expectedPending, actual)
+			}
+		})
+	}
+}
+
+func TestPendingJobsHandler(t *testing.T) {
+	c := Controller{
+		pendingJobs: map[string]int{"pull-e2e": 2, "release-group": 1},
+	}
+	handler := c.PendingJobsHandler()
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/debug/pending-jobs", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected content type application/json, got %s", contentType)
+	}
+	var actual map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &actual); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if !reflect.DeepEqual(actual, c.pendingJobs) {
+		t.Errorf("Expected pending jobs %v, got %v", c.pendingJobs, actual)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/debug/pending-jobs", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 for a POST, got %d", rr.Code)
+	}
+}
+
+func TestUseGenerateName(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "job"},
+		Spec: prowapi.ProwJobSpec{
+			Job:     "boop",
+			Type:    prowapi.PeriodicJob,
+			Agent:   prowapi.KubernetesAgent,
+			PodSpec: &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}},
+		},
+		Status: prowapi.ProwJobStatus{
+			State: prowapi.TriggeredState,
+		},
+	}
+	fc := &fkc{prowjobs: []prowapi.ProwJob{pj}}
+	pkc := &fkc{}
+	fca := newFakeConfigAgent(t, 0)
+	fca.c.Plank.UseGenerateName = true
+	c := Controller{
+		kc:          fc,
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: pkc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      fca.Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+
+	reports := make(chan prowapi.ProwJob, 2)
+	if err := c.bind(context.Background()).syncTriggeredJob(c.log, pj, map[string]kube.Pod{}, reports); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkc.pods) != 1 {
+		t.Fatalf("expected one pod, got %d", len(pkc.pods))
+	}
+	if expected, actual := "job-00000", pkc.pods[0].ObjectMeta.Name; actual != expected {
+		t.Errorf("expected the pod to get the generated name %q, got %q", expected, actual)
+	}
+	actual := fc.prowjobs[0]
+	if actual.Status.State != prowapi.PendingState {
+		t.Errorf("expected state %q, got %q", prowapi.PendingState, actual.Status.State)
+	}
+	if actual.Status.PodName != "job-00000" {
+		t.Errorf("expected the generated pod name to be recorded, got %q", actual.Status.PodName)
+	}
+
+	// The pod is found by its label on the next sync, so no other pod is
+	// started for the job.
+	pm := map[string]kube.Pod{}
+	for _, pod := range pkc.pods {
+		addPod(pm, pod)
+	}
+	if err := c.bind(context.Background()).syncPendingJob(c.log, actual, pm, reports); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pkc.pods) != 1 {
+		t.Errorf("expected the pod to be found, got %d pods", len(pkc.pods))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	totServ := httptest.NewServer(http.HandlerFunc(handleTot))
+	defer totServ.Close()
+	podSpec := &kube.PodSpec{Containers: []kube.Container{{Name: "test-name", Env: []kube.EnvVar{}}}}
+	job := func(name string, state prowapi.ProwJobState, started time.Time) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: prowapi.ProwJobSpec{
+				Job:     name,
+				Type:    prowapi.PeriodicJob,
+				Agent:   prowapi.KubernetesAgent,
+				PodSpec: podSpec,
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(started),
+			},
+		}
+	}
+	now := time.Now()
+	fc := &fkc{
+		prowjobs: []prowapi.ProwJob{
+			job("old-triggered", prowapi.TriggeredState, now.Add(-time.Hour)),
+			job("new-triggered", prowapi.TriggeredState, now.Add(-time.Minute)),
+			job("running", prowapi.PendingState, now.Add(-time.Minute)),
+			job("passed", prowapi.SuccessState, now.Add(-time.Minute)),
+		},
+		pods: []kube.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "running"},
+			Status:     kube.PodStatus{Phase: kube.PodRunning},
+		}},
+	}
+	c := Controller{
+		kc:          fc,
+		ghc:         &fakegithub.FakeClient{},
+		pkcs:        map[string]kubeClient{kube.DefaultClusterAlias: fc},
+		log:         logrus.NewEntry(logrus.StandardLogger()),
+		config:      newFakeConfigAgent(t, 0).Config,
+		totURL:      totServ.URL,
+		pendingJobs: make(map[string]int),
+	}
+	if !c.Snapshot().Synced.IsZero() {
+		t.Errorf("expected no sync time before the first sync, got %v", c.Snapshot().Synced)
+	}
+	if err := c.Sync(); err != nil {
+		t.Fatalf("unexpected error syncing: %v", err)
+	}
+
+	snapshot := c.Snapshot()
+	if snapshot.Synced.Before(now) {
+		t.Errorf("expected the sync time to be after %v, got %v", now, snapshot.Synced)
+	}
+	expected := map[prowapi.ProwJobState]int{
+		prowapi.TriggeredState: 2,
+		prowapi.PendingState:   1,
+		prowapi.SuccessState:   1,
+	}
+	if !reflect.DeepEqual(snapshot.JobsByState, expected) {
+		t.Errorf("expected jobs by state %v, got %v", expected, snapshot.JobsByState)
+	}
+	if snapshot.OldestTriggered < time.Hour || snapshot.OldestTriggered > time.Hour+time.Minute {
+		t.Errorf("expected the oldest triggered job to have waited an hour, got %v", snapshot.OldestTriggered)
+	}
+	// the running job and the two jobs that were started
+	if snapshot.PendingJobs != 3 {
+		t.Errorf("expected pending jobs to be counted for 3 jobs, got %d", snapshot.PendingJobs)
+	}
+
+	// The snapshot is a copy.
+	snapshot.JobsByState[prowapi.SuccessState] = 10
+	if c.Snapshot().JobsByState[prowapi.SuccessState] != 1 {
+		t.Error("expected changes to a snapshot not to affect the controller")
+	}
+}
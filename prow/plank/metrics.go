@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plank
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+)
+
+var jobCompletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "plank_job_completions",
+	Help: "Number of prowjobs completed by plank.",
+}, []string{
+	// name of the job
+	"job_name",
+	// final state of the prowjob: success, failure, error, aborted
+	"state",
+})
+
+func init() {
+	prometheus.MustRegister(jobCompletions)
+}
+
+// recordCompletion counts the job if it completed since it was in prevState.
+// It must only be called once the completed job has been saved.
+func recordCompletion(prevState prowapi.ProwJobState, pj prowapi.ProwJob) {
+	if !pj.Complete() || prevState == pj.Status.State {
+		return
+	}
+	jobCompletions.WithLabelValues(pj.Spec.Job, string(pj.Status.State)).Inc()
+}
+
+// Metrics is a snapshot of the health of the controller as of the end of
+// its last sync, for tests and tooling that cannot scrape the metrics.
+type Metrics struct {
+	// Synced is when the last sync ended, or the zero time before the
+	// first sync.
+	Synced time.Time
+	// JobsByState counts the kubernetes ProwJobs of the sync by the state
+	// they were listed in.
+	JobsByState map[prowapi.ProwJobState]int
+	// OldestTriggered is how long the oldest job that was listed as
+	// triggered has waited for its pod, or zero if none was triggered.
+	OldestTriggered time.Duration
+	// PendingJobs is the number of jobs and concurrency groups that
+	// pending jobs were counted for.
+	PendingJobs int
+}
+
+// Snapshot returns the metrics of the last sync.
+func (c *Controller) Snapshot() Metrics {
+	c.pjLock.RLock()
+	defer c.pjLock.RUnlock()
+	snapshot := c.snapshot
+	snapshot.JobsByState = make(map[prowapi.ProwJobState]int, len(c.snapshot.JobsByState))
+	for state, count := range c.snapshot.JobsByState {
+		snapshot.JobsByState[state] = count
+	}
+	return snapshot
+}
+
+// recordSnapshot records the metrics of a sync of the jobs.
+func (c *Controller) recordSnapshot(pjs []prowapi.ProwJob) {
+	now := time.Now()
+	snapshot := Metrics{
+		Synced:      now,
+		JobsByState: map[prowapi.ProwJobState]int{},
+	}
+	for _, pj := range pjs {
+		snapshot.JobsByState[pj.Status.State]++
+		if pj.Status.State != prowapi.TriggeredState {
+			continue
+		}
+		if waited := now.Sub(pj.Status.StartTime.Time); waited > snapshot.OldestTriggered {
+			snapshot.OldestTriggered = waited
+		}
+	}
+	c.lock.RLock()
+	snapshot.PendingJobs = len(c.pendingJobs)
+	c.lock.RUnlock()
+
+	c.pjLock.Lock()
+	c.snapshot = snapshot
+	c.pjLock.Unlock()
+}
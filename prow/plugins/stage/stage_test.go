@@ -17,49 +17,22 @@ limitations under the License.
 package stage
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/sirupsen/logrus"
 
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
 )
 
-type fakeClient struct {
-	// current labels
-	labels []string
-	// labels that are added
-	added []string
-	// labels that are removed
-	removed []string
-}
-
-func (c *fakeClient) AddLabel(owner, repo string, number int, label string) error {
-	c.added = append(c.added, label)
-	c.labels = append(c.labels, label)
-	return nil
-}
-
-func (c *fakeClient) RemoveLabel(owner, repo string, number int, label string) error {
-	c.removed = append(c.removed, label)
-
-	// remove from existing labels
-	for k, v := range c.labels {
-		if label == v {
-			c.labels = append(c.labels[:k], c.labels[k+1:]...)
-			break
-		}
+func formatLabels(labels ...string) []string {
+	var r []string
+	for _, l := range labels {
+		r = append(r, fmt.Sprintf("%s/%s#%d:%s", "org", "repo", 1, l))
 	}
-
-	return nil
-}
-
-func (c *fakeClient) GetIssueLabels(owner, repo string, number int) ([]github.Label, error) {
-	la := []github.Label{}
-	for _, l := range c.labels {
-		la = append(la, github.Label{Name: l})
-	}
-	return la, nil
+	return r
 }
 
 func TestStageLabels(t *testing.T) {
@@ -198,23 +171,23 @@ func TestStageLabels(t *testing.T) {
 		},
 	}
 	for _, tc := range testcases {
-		fc := &fakeClient{
-			labels:  tc.labels,
-			added:   []string{},
-			removed: []string{},
+		fc := &fakegithub.FakeClient{
+			IssueLabelsExisting: formatLabels(tc.labels...),
 		}
 		e := &github.GenericCommentEvent{
 			Body:   tc.body,
 			Action: github.GenericCommentActionCreated,
+			Repo:   github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			Number: 1,
 		}
 		err := handle(fc, logrus.WithField("plugin", "fake-lifecyle"), e)
 		switch {
 		case err != nil:
 			t.Errorf("%s: unexpected error: %v", tc.name, err)
-		case !reflect.DeepEqual(tc.added, fc.added):
-			t.Errorf("%s: added %v != actual %v", tc.name, tc.added, fc.added)
-		case !reflect.DeepEqual(tc.removed, fc.removed):
-			t.Errorf("%s: removed %v != actual %v", tc.name, tc.removed, fc.removed)
+		case !reflect.DeepEqual(formatLabels(tc.added...), fc.IssueLabelsAdded):
+			t.Errorf("%s: added %v != actual %v", tc.name, tc.added, fc.IssueLabelsAdded)
+		case !reflect.DeepEqual(formatLabels(tc.removed...), fc.IssueLabelsRemoved):
+			t.Errorf("%s: removed %v != actual %v", tc.name, tc.removed, fc.IssueLabelsRemoved)
 		}
 	}
 }
@@ -649,6 +649,59 @@ func TestHandleGenericComment(t *testing.T) {
 			ElideSkippedContexts: true,
 			ShouldReport:         false,
 		},
+		{
+			name: "/retest of SkipIfOnlyChanged job when only skipped files changed reports a skipped status",
+
+			Author: "trusted-member",
+			Body:   "/retest",
+			State:  "open",
+			IsPR:   true,
+			Presubmits: map[string][]config.Presubmit{
+				"org/repo": {
+					{
+						JobBase: config.JobBase{
+							Name: "jeb",
+						},
+						RegexpChangeMatcher: config.RegexpChangeMatcher{
+							SkipIfOnlyChanged: "CHANGED",
+						},
+						Reporter: config.Reporter{
+							Context: "pull-jeb",
+						},
+						Trigger:      `(?m)^/test (?:.*? )?jeb(?: .*?)?$`,
+						RerunCommand: `/test jeb`,
+					},
+				},
+			},
+			ShouldReport: true,
+		},
+		{
+			name: "/retest of SkipIfOnlyChanged job when other files changed runs it",
+
+			Author: "trusted-member",
+			Body:   "/retest",
+			State:  "open",
+			IsPR:   true,
+			Presubmits: map[string][]config.Presubmit{
+				"org/repo": {
+					{
+						JobBase: config.JobBase{
+							Name: "jeb",
+						},
+						RegexpChangeMatcher: config.RegexpChangeMatcher{
+							SkipIfOnlyChanged: "UNCHANGED",
+						},
+						Reporter: config.Reporter{
+							Context: "pull-jeb",
+						},
+						Trigger:      `(?m)^/test (?:.*? )?jeb(?: .*?)?$`,
+						RerunCommand: `/test jeb`,
+					},
+				},
+			},
+			ShouldBuild:   true,
+			StartsExactly: "pull-jeb",
+		},
 		{
 			name: "explicit /test for RunIfChanged job that doesn't need to run",
 
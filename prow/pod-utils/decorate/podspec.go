@@ -66,6 +66,12 @@ func VolumeMounts() []string {
 	return []string{logMountName, codeMountName, toolsMountName, gcsCredentialsMountName}
 }
 
+// InitContainerNames returns the names of the init containers that
+// decoration adds to the pod.
+func InitContainerNames() []string {
+	return []string{cloneRefsName, initUploadName, placeEntrypointName}
+}
+
 // VolumeMountPaths returns a string slice with *MountPath consts in it.
 func VolumeMountPaths() []string {
 	return []string{logMountPath, codeMountPath, toolsMountPath, gcsCredentialsMountPath}
@@ -138,7 +144,24 @@ func LabelsAndAnnotationsForJob(pj prowapi.ProwJob) (map[string]string, map[stri
 		extraLabels = map[string]string{}
 	}
 	extraLabels[kube.ProwJobIDLabel] = pj.ObjectMeta.Name
-	return LabelsAndAnnotationsForSpec(pj.Spec, extraLabels, nil)
+	extraAnnotations := map[string]string{}
+	for k, v := range pj.Spec.Annotations {
+		if prowManaged(k) {
+			logrus.WithFields(logrus.Fields{
+				"job": pj.Spec.Job,
+				"key": k,
+			}).Warn("Ignoring annotation managed by prow")
+			continue
+		}
+		extraAnnotations[k] = v
+	}
+	return LabelsAndAnnotationsForSpec(pj.Spec, extraLabels, extraAnnotations)
+}
+
+// prowManaged determines if the key is reserved for labels and annotations
+// that prow sets on the resources it creates.
+func prowManaged(key string) bool {
+	return key == kube.CreatedByProw || strings.HasPrefix(key, "prow.k8s.io/")
 }
 
 // ProwJobToPod converts a ProwJob to a Pod that will run the tests.
@@ -192,10 +215,16 @@ func CloneLogPath(logMount coreapi.VolumeMount) string {
 	return filepath.Join(logMount.MountPath, cloneLogPath)
 }
 
+// SidecarContainerName is the name of the container that decoration adds
+// to the pod next to the test container.
+const SidecarContainerName = "sidecar"
+
 // Exposed for testing
 const (
-	cloneRefsName    = "clonerefs"
-	cloneRefsCommand = "/clonerefs"
+	cloneRefsName       = "clonerefs"
+	cloneRefsCommand    = "/clonerefs"
+	initUploadName      = "initupload"
+	placeEntrypointName = "place-entrypoint"
 )
 
 // cloneEnv encodes clonerefs Options into json and puts it into an environment variable
@@ -408,7 +437,7 @@ func InjectEntrypoint(c *coreapi.Container, timeout, gracePeriod time.Duration,
 // PlaceEntrypoint will copy entrypoint from the entrypoint image to the tools volume
 func PlaceEntrypoint(image string, toolsMount coreapi.VolumeMount) coreapi.Container {
 	return coreapi.Container{
-		Name:         "place-entrypoint",
+		Name:         placeEntrypointName,
 		Image:        image,
 		Command:      []string{"/bin/cp"},
 		Args:         []string{"/entrypoint", entrypointLocation(toolsMount)},
@@ -456,7 +485,7 @@ func InitUpload(image string, opt gcsupload.Options, creds coreapi.VolumeMount,
 		return nil, fmt.Errorf("could not encode initupload configuration as JSON: %v", err)
 	}
 	return &coreapi.Container{
-		Name:    "initupload",
+		Name:    initUploadName,
 		Image:   image,
 		Command: []string{"/initupload"}, // TODO(fejta): remove this, use image's entrypoint and delete /initupload symlink
 		Env: kubeEnv(map[string]string{
@@ -574,7 +603,7 @@ func Sidecar(image string, gcsOptions gcsupload.Options, gcsMount, logMount core
 	}
 
 	return &coreapi.Container{
-		Name:    "sidecar",
+		Name:    SidecarContainerName,
 		Image:   image,
 		Command: []string{"/sidecar"}, // TODO(fejta): remove, use image's entrypoint
 		Env: kubeEnv(map[string]string{
@@ -18,6 +18,7 @@ package decorate
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -1812,3 +1813,31 @@ func TestProwJobToPod(t *testing.T) {
 		})
 	}
 }
+
+func TestProwJobToPodAnnotations(t *testing.T) {
+	pj := prowapi.ProwJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+		Spec: prowapi.ProwJobSpec{
+			Type:  prowapi.PeriodicJob,
+			Job:   "job-name",
+			Agent: prowapi.KubernetesAgent,
+			Annotations: map[string]string{
+				"example.com/trace-id":  "abc123",
+				kube.ProwJobAnnotation:  "other-job",
+				"prow.k8s.io/something": "else",
+			},
+			PodSpec: &coreapi.PodSpec{Containers: []coreapi.Container{{Image: "tester"}}},
+		},
+	}
+	pod, err := ProwJobToPod(pj, "build")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[string]string{
+		kube.ProwJobAnnotation: "job-name",
+		"example.com/trace-id": "abc123",
+	}
+	if !reflect.DeepEqual(pod.Annotations, expected) {
+		t.Errorf("unexpected pod annotations: %s", diff.ObjectReflectDiff(expected, pod.Annotations))
+	}
+}
@@ -83,8 +83,10 @@ const (
 	jobTypeEnv   = "JOB_TYPE"
 	prowJobIDEnv = "PROW_JOB_ID"
 
-	buildIDEnv     = "BUILD_ID"
-	prowBuildIDEnv = "BUILD_NUMBER" // Deprecated, will be removed in the future.
+	buildIDEnv = "BUILD_ID"
+	// BuildNumberEnv also holds the build ID, for jobs that predate
+	// BUILD_ID. Deprecated, will be removed in the future.
+	BuildNumberEnv = "BUILD_NUMBER"
 
 	repoOwnerEnv   = "REPO_OWNER"
 	repoNameEnv    = "REPO_NAME"
@@ -109,7 +111,7 @@ func EnvForSpec(spec JobSpec) (map[string]string, error) {
 	// in both $BUILD_ID and $BUILD_NUMBER for Prow agents
 	// and in both $buildId and $BUILD_NUMBER for Jenkins
 	if spec.agent == prowapi.KubernetesAgent {
-		env[prowBuildIDEnv] = spec.BuildID
+		env[BuildNumberEnv] = spec.BuildID
 	}
 
 	raw, err := json.Marshal(spec)
@@ -139,7 +141,7 @@ func EnvForSpec(spec JobSpec) (map[string]string, error) {
 
 // EnvForType returns the slice of environment variables to export for jobType
 func EnvForType(jobType prowapi.ProwJobType) []string {
-	baseEnv := []string{jobNameEnv, JobSpecEnv, jobTypeEnv, prowJobIDEnv, buildIDEnv, prowBuildIDEnv}
+	baseEnv := []string{jobNameEnv, JobSpecEnv, jobTypeEnv, prowJobIDEnv, buildIDEnv, BuildNumberEnv}
 	refsEnv := []string{repoOwnerEnv, repoNameEnv, pullBaseRefEnv, pullBaseShaEnv, pullRefsEnv}
 	pullEnv := []string{pullNumberEnv, pullPullShaEnv}
 
@@ -20,6 +20,8 @@ import (
 	"reflect"
 	"testing"
 
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 )
 
@@ -190,6 +192,35 @@ func TestEnvironmentForSpec(t *testing.T) {
 	}
 }
 
+// TestEnvForTypeMatchesSpec makes sure that the variables reserved for each
+// type of job are exactly those that are injected into its pods.
+func TestEnvForTypeMatchesSpec(t *testing.T) {
+	refs := &prowapi.Refs{
+		Org:     "org-name",
+		Repo:    "repo-name",
+		BaseRef: "base-ref",
+		BaseSHA: "base-sha",
+		Pulls:   []prowapi.Pull{{Number: 1, SHA: "pull-sha"}},
+	}
+	for _, jobType := range []prowapi.ProwJobType{prowapi.PeriodicJob, prowapi.PostsubmitJob, prowapi.BatchJob, prowapi.PresubmitJob} {
+		spec := prowapi.ProwJobSpec{Type: jobType, Job: "job-name", Agent: prowapi.KubernetesAgent}
+		if jobType != prowapi.PeriodicJob {
+			spec.Refs = refs
+		}
+		env, err := EnvForSpec(NewJobSpec(spec, "0", "prowjob"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", jobType, err)
+		}
+		actual := sets.NewString()
+		for name := range env {
+			actual.Insert(name)
+		}
+		if expected := sets.NewString(EnvForType(jobType)...); !actual.Equal(expected) {
+			t.Errorf("%s: injected %v but reserved %v", jobType, actual.List(), expected.List())
+		}
+	}
+}
+
 func TestGetRevisionFromSpec(t *testing.T) {
 	var tests = []struct {
 		name     string
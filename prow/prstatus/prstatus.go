@@ -22,7 +22,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	gogithub "github.com/google/go-github/github"
@@ -32,8 +35,10 @@ import (
 	"golang.org/x/oauth2"
 
 	"k8s.io/test-infra/pkg/ghclient"
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/pjutil"
 )
 
 const (
@@ -42,8 +47,17 @@ const (
 	tokenSession   = "access-token-session"
 	tokenKey       = "access-token"
 	loginKey       = "login"
+
+	// pullRequestCacheTTL is how long the pull requests found for a
+	// query are served again without asking GitHub.
+	pullRequestCacheTTL = time.Minute
+	// needsRebaseLabel is added to pull requests that do not merge.
+	needsRebaseLabel = "needs-rebase"
 )
 
+// loginRE matches GitHub logins, so that they can go into search queries.
+var loginRE = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
 type githubClient interface {
 	Query(context.Context, interface{}, map[string]interface{}) error
 	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
@@ -68,6 +82,24 @@ type UserData struct {
 type PullRequestWithContexts struct {
 	Contexts    []Context
 	PullRequest PullRequest
+	// ProwJobs are the latest runs of the presubmits on the head commit.
+	ProwJobs []ProwJob
+	// Failing, Pending and Passing hold the contexts of the head commit by
+	// state, including the ones of prow jobs that do not report a status.
+	Failing []string
+	Pending []string
+	Passing []string
+	// NeedsRebase is set if the pull request conflicts with its base
+	// branch or has the needs-rebase label.
+	NeedsRebase bool
+}
+
+// ProwJob is a run of a job on the head commit of a pull request.
+type ProwJob struct {
+	Job     string
+	Context string
+	State   prowapi.ProwJobState
+	URL     string
 }
 
 // DashboardAgent is responsible for handling request to /pr-status endpoint.
@@ -75,10 +107,21 @@ type PullRequestWithContexts struct {
 type DashboardAgent struct {
 	repos []string
 	goac  *config.GithubOAuthConfig
+	// prowJobs lists the ProwJobs to join the pull requests with.
+	prowJobs func() []prowapi.ProwJob
+
+	lock sync.Mutex
+	// cache holds the pull requests found for the queries of each user.
+	cache map[string]cachedPullRequests
 
 	log *logrus.Entry
 }
 
+type cachedPullRequests struct {
+	pullRequests []PullRequestWithContexts
+	expires      time.Time
+}
+
 // Label represents a Github label.
 type Label struct {
 	ID   githubql.ID
@@ -146,12 +189,14 @@ type searchQuery struct {
 	} `graphql:"search(type: ISSUE, first: 100, after: $searchCursor, query: $query)"`
 }
 
-// NewDashboardAgent creates a new user dashboard agent .
-func NewDashboardAgent(repos []string, config *config.GithubOAuthConfig, log *logrus.Entry) *DashboardAgent {
+// NewDashboardAgent creates a new user dashboard agent. The pull requests it
+// serves are joined with the ProwJobs that prowJobs lists.
+func NewDashboardAgent(repos []string, config *config.GithubOAuthConfig, prowJobs func() []prowapi.ProwJob, log *logrus.Entry) *DashboardAgent {
 	return &DashboardAgent{
-		repos: repos,
-		goac:  config,
-		log:   log,
+		repos:    repos,
+		goac:     config,
+		prowJobs: prowJobs,
+		log:      log,
 	}
 }
 
@@ -174,8 +219,17 @@ func invalidateGitHubSession(w http.ResponseWriter, r *http.Request, session *se
 // endpoint. The handler takes user access token stored in the cookie to query to Github on behalf
 // of the user and serve the data in return. The Query handler is passed to the method so as it
 // can be mocked in the unit test..
+//
+// The open pull requests of the user are served, or those of another user
+// given by the login parameter. The results are cached for a minute.
 func (da *DashboardAgent) HandlePrStatus(queryHandler PullRequestQueryHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		author := r.URL.Query().Get("login")
+		if author != "" && !loginRE.MatchString(author) {
+			http.Error(w, fmt.Sprintf("invalid login %q", author), http.StatusBadRequest)
+			return
+		}
+
 		serverError := func(action string, err error) {
 			da.log.WithError(err).Errorf("Error %s.", action)
 			msg := fmt.Sprintf("500 Internal server error %s: %v", action, err)
@@ -240,7 +294,10 @@ func (da *DashboardAgent) HandlePrStatus(queryHandler PullRequestQueryHandler) h
 
 			// Construct query
 			ghc := github.NewClient(func() []byte { return []byte(token.AccessToken) }, githubEndpoint)
-			query := da.ConstructSearchQuery(login)
+			if author == "" {
+				author = login
+			}
+			query := da.ConstructSearchQuery(author)
 			if err := r.ParseForm(); err == nil {
 				if q := r.Form.Get("query"); q != "" {
 					query = q
@@ -253,25 +310,31 @@ func (da *DashboardAgent) HandlePrStatus(queryHandler PullRequestQueryHandler) h
 					query += fmt.Sprintf(" repo:\"%s\"", v)
 				}
 			}
-			pullRequests, err := queryHandler.QueryPullRequests(context.Background(), ghc, query)
-			if err != nil {
-				serverError("Error with querying user data.", err)
-				return
-			}
-			var pullRequestWithContexts []PullRequestWithContexts
-			for _, pr := range pullRequests {
-				prcontexts, err := queryHandler.GetHeadContexts(ghc, pr)
+			// The results depend on who asks, as the user's token may see
+			// private repos.
+			cacheKey := login + " " + query
+			pullRequestWithContexts, ok := da.cached(cacheKey)
+			if !ok {
+				pullRequests, err := queryHandler.QueryPullRequests(context.Background(), ghc, query)
 				if err != nil {
-					serverError("Error with getting head context of pr", err)
-					continue
+					serverError("Error with querying user data.", err)
+					return
+				}
+				for _, pr := range pullRequests {
+					prcontexts, err := queryHandler.GetHeadContexts(ghc, pr)
+					if err != nil {
+						serverError("Error with getting head context of pr", err)
+						continue
+					}
+					pullRequestWithContexts = append(pullRequestWithContexts, PullRequestWithContexts{
+						Contexts:    prcontexts,
+						PullRequest: pr,
+					})
 				}
-				pullRequestWithContexts = append(pullRequestWithContexts, PullRequestWithContexts{
-					Contexts:    prcontexts,
-					PullRequest: pr,
-				})
+				da.store(cacheKey, pullRequestWithContexts)
 			}
 
-			data.PullRequestsWithContexts = pullRequestWithContexts
+			data.PullRequestsWithContexts = da.joinProwJobs(pullRequestWithContexts)
 		}
 
 		marshaledData, err := json.Marshal(data)
@@ -289,6 +352,118 @@ func (da *DashboardAgent) HandlePrStatus(queryHandler PullRequestQueryHandler) h
 	}
 }
 
+// cached returns the pull requests cached for the key, unless they expired.
+func (da *DashboardAgent) cached(key string) ([]PullRequestWithContexts, bool) {
+	da.lock.Lock()
+	defer da.lock.Unlock()
+	cached, ok := da.cache[key]
+	if !ok || time.Now().After(cached.expires) {
+		return nil, false
+	}
+	return cached.pullRequests, true
+}
+
+// store caches the pull requests for the key and drops expired ones.
+func (da *DashboardAgent) store(key string, prs []PullRequestWithContexts) {
+	da.lock.Lock()
+	defer da.lock.Unlock()
+	now := time.Now()
+	if da.cache == nil {
+		da.cache = map[string]cachedPullRequests{}
+	}
+	for k, cached := range da.cache {
+		if now.After(cached.expires) {
+			delete(da.cache, k)
+		}
+	}
+	da.cache[key] = cachedPullRequests{pullRequests: prs, expires: now.Add(pullRequestCacheTTL)}
+}
+
+// joinProwJobs returns copies of the pull requests with the latest runs of
+// the presubmits on their head commits, and with their contexts grouped by
+// state. The cached pull requests are left untouched.
+func (da *DashboardAgent) joinProwJobs(prs []PullRequestWithContexts) []PullRequestWithContexts {
+	var pjs []prowapi.ProwJob
+	if da.prowJobs != nil {
+		pjs = da.prowJobs()
+	}
+	var joined []PullRequestWithContexts
+	for _, pr := range prs {
+		pr.ProwJobs, pr.Failing, pr.Pending, pr.Passing = nil, nil, nil, nil
+		states := map[string]string{}
+		for _, status := range pr.Contexts {
+			states[status.Context] = status.State
+		}
+		for _, pj := range pjutil.GetLatestProwJobs(headProwJobs(pjs, pr.PullRequest), prowapi.PresubmitJob) {
+			pr.ProwJobs = append(pr.ProwJobs, ProwJob{
+				Job:     pj.Spec.Job,
+				Context: pj.Spec.Context,
+				State:   pj.Status.State,
+				URL:     pj.Status.URL,
+			})
+			if _, reported := states[pj.Spec.Context]; !reported && pj.Spec.Context != "" {
+				states[pj.Spec.Context] = contextState(pj.Status.State)
+			}
+		}
+		sort.Slice(pr.ProwJobs, func(i, j int) bool { return pr.ProwJobs[i].Job < pr.ProwJobs[j].Job })
+		for name, state := range states {
+			switch state {
+			case "SUCCESS":
+				pr.Passing = append(pr.Passing, name)
+			case "PENDING", "EXPECTED":
+				pr.Pending = append(pr.Pending, name)
+			default:
+				pr.Failing = append(pr.Failing, name)
+			}
+		}
+		sort.Strings(pr.Failing)
+		sort.Strings(pr.Pending)
+		sort.Strings(pr.Passing)
+		pr.NeedsRebase = pr.PullRequest.Mergeable == githubql.MergeableStateConflicting
+		for _, node := range pr.PullRequest.Labels.Nodes {
+			if string(node.Label.Name) == needsRebaseLabel {
+				pr.NeedsRebase = true
+			}
+		}
+		joined = append(joined, pr)
+	}
+	return joined
+}
+
+// headProwJobs returns the ProwJobs that ran on the head commit of the pull
+// request.
+func headProwJobs(pjs []prowapi.ProwJob, pr PullRequest) []prowapi.ProwJob {
+	var head []prowapi.ProwJob
+	for _, pj := range pjs {
+		refs := pj.Spec.Refs
+		if refs == nil || len(refs.Pulls) != 1 {
+			continue
+		}
+		if refs.Org != string(pr.Repository.Owner.Login) || refs.Repo != string(pr.Repository.Name) {
+			continue
+		}
+		if refs.Pulls[0].Number != int(pr.Number) || refs.Pulls[0].SHA != string(pr.HeadRefOID) {
+			continue
+		}
+		head = append(head, pj)
+	}
+	return head
+}
+
+// contextState returns the state of the status that a job in the state
+// reports.
+func contextState(state prowapi.ProwJobState) string {
+	switch state {
+	case prowapi.SuccessState:
+		return "SUCCESS"
+	case prowapi.TriggeredState, prowapi.PendingState:
+		return "PENDING"
+	case prowapi.FailureState:
+		return "FAILURE"
+	}
+	return "ERROR"
+}
+
 // QueryPullRequests is a query function that returns a list of open pull requests owned by the user whose access token
 // is consumed by the github client.
 func (da *DashboardAgent) QueryPullRequests(ctx context.Context, ghc githubClient, query string) ([]PullRequest, error) {
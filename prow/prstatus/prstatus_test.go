@@ -19,6 +19,7 @@ package prstatus
 import (
 	"context"
 	"encoding/gob"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -30,10 +31,13 @@ import (
 
 	gogithub "github.com/google/go-github/github"
 	"github.com/gorilla/sessions"
+	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 
 	"k8s.io/test-infra/pkg/ghclient"
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 )
@@ -41,9 +45,11 @@ import (
 type MockQueryHandler struct {
 	prs        []PullRequest
 	contextMap map[int][]Context
+	queries    []string
 }
 
 func (mh *MockQueryHandler) QueryPullRequests(ctx context.Context, ghc githubClient, query string) ([]PullRequest, error) {
+	mh.queries = append(mh.queries, query)
 	return mh.prs, nil
 }
 
@@ -163,7 +169,6 @@ func TestHandlePrStatusWithLogin(t *testing.T) {
 	mockConfig := &config.GithubOAuthConfig{
 		CookieStore: mockCookieStore,
 	}
-	mockAgent := createMockAgent(repos, mockConfig)
 
 	testCases := []struct {
 		prs          []PullRequest
@@ -235,6 +240,7 @@ func TestHandlePrStatusWithLogin(t *testing.T) {
 								State:       "SUCCESS",
 							},
 						},
+						Passing: []string{"gofmt-job"},
 					},
 					{
 						PullRequest: PullRequest{
@@ -248,6 +254,7 @@ func TestHandlePrStatusWithLogin(t *testing.T) {
 								State:       "FAILURE",
 							},
 						},
+						Failing: []string{"verify-bazel-job"},
 					},
 					{
 						PullRequest: PullRequest{
@@ -266,6 +273,8 @@ func TestHandlePrStatusWithLogin(t *testing.T) {
 								State:       "FAILURE",
 							},
 						},
+						Failing: []string{"verify-bazel-job"},
+						Passing: []string{"gofmt-job"},
 					},
 				},
 			},
@@ -273,6 +282,7 @@ func TestHandlePrStatusWithLogin(t *testing.T) {
 	}
 	for id, testcase := range testCases {
 		t.Logf("Test %d:", id)
+		mockAgent := createMockAgent(repos, mockConfig)
 		rr := httptest.NewRecorder()
 		request := httptest.NewRequest(http.MethodGet, "/pr-data.js", nil)
 		mockSession, err := sessions.GetRegistry(request).Get(mockCookieStore, tokenSession)
@@ -391,3 +401,123 @@ func TestConstructSearchQuery(t *testing.T) {
 		t.Errorf("Invalid query. Got: %v, expected %v", query, mockQuery)
 	}
 }
+
+func TestJoinProwJobs(t *testing.T) {
+	pr := PullRequest{Number: 1, HeadRefOID: "head", Mergeable: githubql.MergeableStateMergeable}
+	pr.Repository.Owner.Login = "org"
+	pr.Repository.Name = "repo"
+	rebase := pr
+	rebase.Number = 2
+	rebase.Labels.Nodes = append(rebase.Labels.Nodes, struct {
+		Label Label `graphql:"... on Label"`
+	}{Label: Label{Name: needsRebaseLabel}})
+	conflicting := pr
+	conflicting.Number = 3
+	conflicting.Mergeable = githubql.MergeableStateConflicting
+
+	job := func(name, context string, number int, sha string, state prowapi.ProwJobState, started time.Time) prowapi.ProwJob {
+		return prowapi.ProwJob{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-%d", name, started.Unix())},
+			Spec: prowapi.ProwJobSpec{
+				Type:    prowapi.PresubmitJob,
+				Job:     name,
+				Context: context,
+				Refs: &prowapi.Refs{
+					Org:   "org",
+					Repo:  "repo",
+					Pulls: []prowapi.Pull{{Number: number, SHA: sha}},
+				},
+			},
+			Status: prowapi.ProwJobStatus{
+				State:     state,
+				StartTime: metav1.NewTime(started),
+				URL:       "https://prow/" + name,
+			},
+		}
+	}
+	now := time.Now()
+	pjs := []prowapi.ProwJob{
+		job("reported", "ci/reported", 1, "head", prowapi.FailureState, now),
+		job("silent", "ci/silent", 1, "head", prowapi.SuccessState, now.Add(-time.Hour)),
+		job("silent", "ci/silent", 1, "head", prowapi.FailureState, now),
+		job("running", "ci/running", 1, "head", prowapi.PendingState, now),
+		job("outdated", "ci/outdated", 1, "old", prowapi.FailureState, now),
+		job("other", "ci/other", 4, "head", prowapi.FailureState, now),
+	}
+	da := &DashboardAgent{
+		prowJobs: func() []prowapi.ProwJob { return pjs },
+		log:      logrus.WithField("unit-test", "dashboard-agent"),
+	}
+	prs := []PullRequestWithContexts{
+		{
+			PullRequest: pr,
+			Contexts: []Context{
+				{Context: "ci/reported", State: "SUCCESS"},
+				{Context: "ci/external", State: "PENDING"},
+			},
+		},
+		{PullRequest: rebase},
+		{PullRequest: conflicting},
+	}
+
+	joined := da.joinProwJobs(prs)
+	expected := []PullRequestWithContexts{
+		{
+			PullRequest: pr,
+			Contexts:    prs[0].Contexts,
+			ProwJobs: []ProwJob{
+				{Job: "reported", Context: "ci/reported", State: prowapi.FailureState, URL: "https://prow/reported"},
+				{Job: "running", Context: "ci/running", State: prowapi.PendingState, URL: "https://prow/running"},
+				{Job: "silent", Context: "ci/silent", State: prowapi.FailureState, URL: "https://prow/silent"},
+			},
+			// the status wins over the job for contexts that were reported
+			Failing: []string{"ci/silent"},
+			Pending: []string{"ci/external", "ci/running"},
+			Passing: []string{"ci/reported"},
+		},
+		{PullRequest: rebase, NeedsRebase: true},
+		{PullRequest: conflicting, NeedsRebase: true},
+	}
+	if !reflect.DeepEqual(joined, expected) {
+		t.Errorf("Invalid pull requests. Got %+v, expected %+v.", joined, expected)
+	}
+	if prs[0].ProwJobs != nil || prs[0].Failing != nil {
+		t.Error("Expected the pull requests that were joined to be left untouched.")
+	}
+}
+
+func TestHandlePrStatusCache(t *testing.T) {
+	mockCookieStore := sessions.NewCookieStore([]byte("secret-key"))
+	mockAgent := createMockAgent([]string{"org/repo"}, &config.GithubOAuthConfig{CookieStore: mockCookieStore})
+	mockQueryHandler := newMockQueryHandler([]PullRequest{{Number: 1}}, map[int][]Context{})
+	gob.Register(oauth2.Token{})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		mockSession, err := sessions.GetRegistry(request).Get(mockCookieStore, tokenSession)
+		if err != nil {
+			t.Fatalf("Error with creating mock session: %v", err)
+		}
+		mockSession.Values[tokenKey] = &oauth2.Token{AccessToken: "secret-token", Expiry: time.Now().Add(time.Hour)}
+		mockAgent.HandlePrStatus(mockQueryHandler).ServeHTTP(rr, request)
+		return rr
+	}
+
+	for _, path := range []string{"/pr-data.js", "/pr-data.js", "/pr-data.js?login=someone-else", "/pr-data.js?login=someone-else"} {
+		if rr := get(path); rr.Code != http.StatusOK {
+			t.Fatalf("%s: bad status code: %d", path, rr.Code)
+		}
+	}
+	expected := []string{
+		"is:pr state:open author:random_user repo:\"org/repo\"",
+		"is:pr state:open author:someone-else repo:\"org/repo\"",
+	}
+	if !reflect.DeepEqual(mockQueryHandler.queries, expected) {
+		t.Errorf("Expected each query to be made once, got %v.", mockQueryHandler.queries)
+	}
+
+	if rr := get("/pr-data.js?login=someone%20repo:other/repo"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid login to be rejected, got status code %d.", rr.Code)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reporter posts the completion of ProwJobs to Slack.
+package reporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+)
+
+const (
+	// SlackReporterName is the name of the slack reporter.
+	SlackReporterName = "slack-reporter"
+
+	// maxRetries is how often a report that Slack rate limits is retried.
+	maxRetries = 5
+	// defaultRetryAfter is how long to wait before retrying a rate limited
+	// report if Slack does not say.
+	defaultRetryAfter = time.Second
+	// maxRetryAfter caps how long to wait before a single retry.
+	maxRetryAfter = 30 * time.Second
+)
+
+// Client reports ProwJobs to the incoming webhook of a Slack channel.
+type Client struct {
+	config config.Getter
+	client *http.Client
+	sleep  func(context.Context, time.Duration) error
+}
+
+// NewReporter returns a reporter that posts to the webhook in the
+// slack_reporter config.
+func NewReporter(cfg config.Getter) *Client {
+	return &Client{
+		config: cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		sleep:  sleep,
+	}
+}
+
+// sleep waits for the duration unless the context is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// GetName returns the name of the reporter.
+func (c *Client) GetName() string {
+	return SlackReporterName
+}
+
+// ShouldReport returns whether the ProwJob opted in to Slack reports and
+// completed in a state and is of a type that the config asks to report.
+func (c *Client) ShouldReport(pj prowapi.ProwJob) bool {
+	cfg := c.config().SlackReporter
+	if cfg.WebhookURL == "" || !pj.Spec.SlackReport || !pj.Complete() {
+		return false
+	}
+	if len(cfg.JobTypesToReport) > 0 && !hasType(cfg.JobTypesToReport, pj.Spec.Type) {
+		return false
+	}
+	return hasState(cfg.JobStatesToReport, pj.Status.State)
+}
+
+// message is the payload of an incoming webhook.
+type message struct {
+	Channel string `json:"channel,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Report posts the ProwJob to Slack if it should be reported, retrying
+// while Slack rate limits the webhook. It gives up once the context is
+// done, or right away if the context ends before the retry is due.
+func (c *Client) Report(ctx context.Context, pj prowapi.ProwJob) error {
+	if !c.ShouldReport(pj) {
+		return nil
+	}
+	cfg := c.config().SlackReporter
+	body, err := json.Marshal(message{Channel: cfg.Channel, Text: text(pj)})
+	if err != nil {
+		return err
+	}
+	for retry := 0; ; retry++ {
+		req, err := http.NewRequest(http.MethodPost, cfg.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("posting to slack: %v", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests && retry < maxRetries:
+			wait := retryAfter(resp.Header.Get("Retry-After"))
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return fmt.Errorf("slack rate limited the report for %v, longer than the time left to report", wait)
+			}
+			if err := c.sleep(ctx, wait); err != nil {
+				return fmt.Errorf("waiting to retry the report: %v", err)
+			}
+		case resp.StatusCode != http.StatusOK:
+			return fmt.Errorf("slack responded with status %d: %s", resp.StatusCode, string(b))
+		default:
+			return nil
+		}
+	}
+}
+
+// text describes the completion of the ProwJob.
+func text(pj prowapi.ProwJob) string {
+	t := fmt.Sprintf("Job *%s* of type %s ended with state *%s*.", pj.Spec.Job, pj.Spec.Type, pj.Status.State)
+	if pj.Status.URL != "" {
+		t += fmt.Sprintf(" <%s|View logs>", pj.Status.URL)
+	}
+	return t
+}
+
+// retryAfter parses the seconds of a Retry-After header.
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return defaultRetryAfter
+	}
+	if d := time.Duration(seconds) * time.Second; d < maxRetryAfter {
+		return d
+	}
+	return maxRetryAfter
+}
+
+func hasType(types []prowapi.ProwJobType, t prowapi.ProwJobType) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+func hasState(states []prowapi.ProwJobState, s prowapi.ProwJobState) bool {
+	for _, candidate := range states {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
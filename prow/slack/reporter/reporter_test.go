@@ -0,0 +1,216 @@
+/*
+Copyright 2019 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	prowapi "k8s.io/test-infra/prow/apis/prowjobs/v1"
+	"k8s.io/test-infra/prow/config"
+)
+
+func job(jobType prowapi.ProwJobType, state prowapi.ProwJobState, slackReport bool) prowapi.ProwJob {
+	pj := prowapi.ProwJob{
+		Spec: prowapi.ProwJobSpec{
+			Job:         "ci-kubernetes-e2e",
+			Type:        jobType,
+			SlackReport: slackReport,
+		},
+		Status: prowapi.ProwJobStatus{
+			State: state,
+			URL:   "https://prow.example.com/view/1",
+		},
+	}
+	if state != prowapi.PendingState {
+		pj.SetComplete()
+	}
+	return pj
+}
+
+func TestShouldReport(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   config.SlackReporter
+		pj       prowapi.ProwJob
+		expected bool
+	}{
+		{
+			name:     "failed job that opted in is reported",
+			config:   config.SlackReporter{WebhookURL: "https://hooks.slack.com/x", JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}},
+			pj:       job(prowapi.PresubmitJob, prowapi.FailureState, true),
+			expected: true,
+		},
+		{
+			name:   "job that did not opt in is not reported",
+			config: config.SlackReporter{WebhookURL: "https://hooks.slack.com/x", JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}},
+			pj:     job(prowapi.PresubmitJob, prowapi.FailureState, false),
+		},
+		{
+			name:   "nothing is reported without a webhook",
+			config: config.SlackReporter{JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}},
+			pj:     job(prowapi.PresubmitJob, prowapi.FailureState, true),
+		},
+		{
+			name:   "running job is not reported",
+			config: config.SlackReporter{WebhookURL: "https://hooks.slack.com/x", JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}},
+			pj:     job(prowapi.PresubmitJob, prowapi.PendingState, true),
+		},
+		{
+			name:   "job in a state that is not reported",
+			config: config.SlackReporter{WebhookURL: "https://hooks.slack.com/x", JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState}},
+			pj:     job(prowapi.PresubmitJob, prowapi.SuccessState, true),
+		},
+		{
+			name: "job of a type that is not reported",
+			config: config.SlackReporter{
+				WebhookURL:        "https://hooks.slack.com/x",
+				JobTypesToReport:  []prowapi.ProwJobType{prowapi.PeriodicJob},
+				JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState},
+			},
+			pj: job(prowapi.PresubmitJob, prowapi.FailureState, true),
+		},
+		{
+			name: "job of a type that is reported",
+			config: config.SlackReporter{
+				WebhookURL:        "https://hooks.slack.com/x",
+				JobTypesToReport:  []prowapi.ProwJobType{prowapi.PeriodicJob},
+				JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState},
+			},
+			pj:       job(prowapi.PeriodicJob, prowapi.FailureState, true),
+			expected: true,
+		},
+	}
+	for _, tc := range testCases {
+		c := NewReporter(func() *config.Config {
+			return &config.Config{ProwConfig: config.ProwConfig{SlackReporter: tc.config}}
+		})
+		if actual := c.ShouldReport(tc.pj); actual != tc.expected {
+			t.Errorf("%s: expected %t, got %t", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	var messages []message
+	rateLimited := 2
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rateLimited > 0 {
+			rateLimited--
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		var m message
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Errorf("failed to decode the message: %v", err)
+		}
+		messages = append(messages, m)
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	c := NewReporter(func() *config.Config {
+		return &config.Config{ProwConfig: config.ProwConfig{SlackReporter: config.SlackReporter{
+			WebhookURL:        s.URL,
+			Channel:           "#ci",
+			JobStatesToReport: []prowapi.ProwJobState{prowapi.FailureState},
+		}}}
+	})
+	var slept []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	if err := c.Report(context.Background(), job(prowapi.PeriodicJob, prowapi.FailureState, true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := []time.Duration{3 * time.Second, 3 * time.Second}; !reflect.DeepEqual(slept, expected) {
+		t.Errorf("expected to wait %v for the rate limit, waited %v", expected, slept)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected one message, got %v", messages)
+	}
+	if messages[0].Channel != "#ci" {
+		t.Errorf("expected the message to go to #ci, got %q", messages[0].Channel)
+	}
+	for _, part := range []string{"ci-kubernetes-e2e", "failure", "https://prow.example.com/view/1"} {
+		if !strings.Contains(messages[0].Text, part) {
+			t.Errorf("expected the message to contain %q, got %q", part, messages[0].Text)
+		}
+	}
+
+	if err := c.Report(context.Background(), job(prowapi.PeriodicJob, prowapi.SuccessState, true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Errorf("expected no message for a job that should not be reported, got %v", messages[1:])
+	}
+
+	rateLimited = maxRetries + 1
+	if err := c.Report(context.Background(), job(prowapi.PeriodicJob, prowapi.FailureState, true)); err == nil {
+		t.Error("expected an error when the rate limit outlasts the retries, got none")
+	}
+
+	// The retry is due after the time left to report.
+	rateLimited = 1
+	slept = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Report(ctx, job(prowapi.PeriodicJob, prowapi.FailureState, true)); err == nil {
+		t.Error("expected an error when the retry is due after the deadline, got none")
+	}
+	if len(slept) != 0 {
+		t.Errorf("expected not to wait for a retry after the deadline, waited %v", slept)
+	}
+	if len(messages) != 1 {
+		t.Errorf("expected no message after the deadline, got %v", messages[1:])
+	}
+}
+
+func TestSleep(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sleep(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+	if err := sleep(context.Background(), time.Millisecond); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"":     defaultRetryAfter,
+		"soon": defaultRetryAfter,
+		"0":    defaultRetryAfter,
+		"2":    2 * time.Second,
+		"3600": maxRetryAfter,
+	}
+	for header, expected := range testCases {
+		if actual := retryAfter(header); actual != expected {
+			t.Errorf("Retry-After %q: expected %v, got %v", header, expected, actual)
+		}
+	}
+}
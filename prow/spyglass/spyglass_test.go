@@ -19,6 +19,8 @@ package spyglass
 import (
 	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"k8s.io/test-infra/prow/gcsupload"
 	"k8s.io/test-infra/prow/pod-utils/downwardapi"
 	"os"
@@ -87,6 +89,14 @@ func (f fpkc) GetLogTail(pod, container string, n int64) ([]byte, error) {
 	return nil, fmt.Errorf("pod not found: %s", pod)
 }
 
+func (f fpkc) FollowContainerLog(pod, container string) (io.ReadCloser, error) {
+	log, err := f.GetContainerLog(pod, container)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(strings.NewReader(string(log))), nil
+}
+
 type fca struct {
 	c config.Config
 }
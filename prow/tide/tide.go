@@ -20,6 +20,7 @@ limitations under the License.
 package tide
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -27,6 +28,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -79,6 +81,11 @@ type Controller struct {
 
 	m     sync.Mutex
 	pools []Pool
+	// synced is when the pools were last synced successfully.
+	synced time.Time
+	// syncError is why the last sync failed, and failed when it did.
+	syncError string
+	failed    time.Time
 
 	// changedFiles caches the names of files changed by PRs.
 	// Cache entries expire if they are not used during a sync loop.
@@ -134,6 +141,19 @@ type Pool struct {
 	Error    string
 }
 
+// Status is the state of the pools, as served on /queue.
+type Status struct {
+	// Pools are the pools as of the last successful sync.
+	Pools []Pool
+	// Synced is when the pools were last synced successfully.
+	Synced time.Time
+	// Error is why the last sync failed, for example because the search
+	// for blocking issues failed, or empty if it succeeded.
+	Error string
+	// Failed is when a sync last failed.
+	Failed time.Time
+}
+
 // Prometheus Metrics
 var (
 	tideMetrics = struct {
@@ -264,13 +284,22 @@ func contextsToStrings(contexts []Context) []string {
 }
 
 // Sync runs one sync iteration.
-func (c *Controller) Sync() error {
+func (c *Controller) Sync() (err error) {
 	start := time.Now()
 	defer func() {
 		duration := time.Since(start)
 		c.logger.WithField("duration", duration.String()).Info("Synced")
 		tideMetrics.syncDuration.Set(duration.Seconds())
 	}()
+	defer func() {
+		if err == nil {
+			return
+		}
+		c.m.Lock()
+		defer c.m.Unlock()
+		c.syncError = err.Error()
+		c.failed = time.Now()
+	}()
 	defer c.changedFiles.prune()
 
 	ctx := context.Background()
@@ -291,7 +320,6 @@ func (c *Controller) Sync() error {
 
 	var pjs []prowapi.ProwJob
 	var blocks blockers.Blockers
-	var err error
 	if len(prs) > 0 {
 		start := time.Now()
 		pjList, err := c.prowJobClient.List(metav1.ListOptions{LabelSelector: labels.Everything().String()})
@@ -312,7 +340,7 @@ func (c *Controller) Sync() error {
 			orgRepoQuery := orgRepoQueryString(orgs, repos.UnsortedList(), orgExcepts)
 			blocks, err = blockers.FindAll(c.ghc, c.logger, label, orgRepoQuery)
 			if err != nil {
-				return err
+				return fmt.Errorf("error searching for blocking issues: %v", err)
 			}
 		}
 	}
@@ -355,6 +383,8 @@ func (c *Controller) Sync() error {
 	c.m.Lock()
 	defer c.m.Unlock()
 	c.pools = pools
+	c.synced = time.Now()
+	c.syncError = ""
 	return nil
 }
 
@@ -371,6 +401,31 @@ func (c *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// QueueHandler serves the Status of the pools as JSON.
+func (c *Controller) QueueHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.m.Lock()
+		// The pools are replaced, never modified, by syncs.
+		status := Status{
+			Pools:  c.pools,
+			Synced: c.synced,
+			Error:  c.syncError,
+			Failed: c.failed,
+		}
+		c.m.Unlock()
+		b, err := json.Marshal(status)
+		if err != nil {
+			c.logger.WithError(err).Error("Encoding JSON.")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(b); err != nil {
+			c.logger.WithError(err).Error("Writing JSON response.")
+		}
+	})
+}
+
 func subpoolsInParallel(goroutines int, sps map[string]*subpool, process func(*subpool)) {
 	// Load the subpools into a channel for use as a work queue.
 	queue := make(chan *subpool, len(sps))
@@ -824,11 +879,9 @@ func (c *Controller) mergePRs(sp subpool, prs []PullRequest) error {
 				}
 			}
 		}
+		details := mergeDetails(log, c.config().Tide.MergeCommitTemplate(sp.org, sp.repo), pr, mergeMethod)
 		for retry := 0; retry < maxRetries; retry++ {
-			if err := c.ghc.Merge(sp.org, sp.repo, int(pr.Number), github.MergeDetails{
-				SHA:         string(pr.HeadRefOID),
-				MergeMethod: string(mergeMethod),
-			}); err != nil {
+			if err := c.ghc.Merge(sp.org, sp.repo, int(pr.Number), details); err != nil {
 				// TODO: Add a config option to abort batches if a PR in the batch
 				// cannot be merged for any reason. This would skip merging
 				// not just the changed PR, but also the other PRs in the batch.
@@ -895,6 +948,30 @@ func (c *Controller) mergePRs(sp subpool, prs []PullRequest) error {
 	return nil
 }
 
+// mergeDetails returns the details of the merge of the PR, with the commit
+// title and message executed from the templates configured for the repo.
+// GitHub's defaults are used for templates that fail to execute.
+func mergeDetails(log *logrus.Entry, templates config.TideMergeCommitTemplate, pr PullRequest, mergeMethod github.PullRequestMergeType) github.MergeDetails {
+	details := github.MergeDetails{
+		SHA:         string(pr.HeadRefOID),
+		MergeMethod: string(mergeMethod),
+	}
+	execute := func(t *template.Template) string {
+		if t == nil {
+			return ""
+		}
+		buf := new(bytes.Buffer)
+		if err := t.Execute(buf, pr); err != nil {
+			log.WithError(err).Warningf("Failed to execute the merge commit %s template, using the default.", t.Name())
+			return ""
+		}
+		return buf.String()
+	}
+	details.CommitTitle = execute(templates.Title)
+	details.CommitMessage = execute(templates.Body)
+	return details
+}
+
 func (c *Controller) trigger(sp subpool, presubmits map[int][]config.Presubmit, prs []PullRequest) error {
 	refs := prowapi.Refs{
 		Org:     sp.org,
@@ -1025,6 +1102,10 @@ func (c *changedFilesAgent) prChanges(pr *PullRequest) config.ChangedFilesProvid
 			string(pr.Repository.Name),
 			int(pr.Number),
 		)
+		if _, tooMany := err.(github.TooManyFilesError); tooMany {
+			// Callers need to tell this error apart from the others.
+			return nil, err
+		}
 		if err != nil {
 			return nil, fmt.Errorf("error getting PR changes for #%d: %v", int(pr.Number), err)
 		}
@@ -1268,6 +1349,7 @@ type PullRequest struct {
 		Title githubql.String
 	}
 	Title githubql.String
+	Body  githubql.String
 }
 
 // Commit holds graphql data about commits and which contexts they have
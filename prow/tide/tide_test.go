@@ -24,7 +24,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"text/template"
+	"time"
 
 	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
@@ -37,6 +41,7 @@ import (
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/git/localgit"
 	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/tide/blockers"
 	"k8s.io/test-infra/prow/tide/history"
 )
 
@@ -532,6 +537,9 @@ func (f *fgc) GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus,
 }
 
 func (f *fgc) GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error) {
+	if number == 3000 {
+		return []github.PullRequestChange{{Filename: "CHANGED"}}, github.TooManyFilesError{Org: org, Repo: repo, Number: number}
+	}
 	if number != 100 {
 		return nil, nil
 	}
@@ -1153,6 +1161,46 @@ func TestTakeAction(t *testing.T) {
 	}
 }
 
+func TestMergeDetails(t *testing.T) {
+	pr := PullRequest{
+		Number:     githubql.Int(5),
+		HeadRefOID: githubql.String("abcdef"),
+		Title:      githubql.String("Fix the flake"),
+		Body:       githubql.String("It was racy."),
+	}
+	testCases := []struct {
+		name      string
+		templates config.TideMergeCommitTemplate
+		expected  github.MergeDetails
+	}{
+		{
+			name:     "no templates",
+			expected: github.MergeDetails{SHA: "abcdef", MergeMethod: "squash"},
+		},
+		{
+			name: "title and body templates",
+			templates: config.TideMergeCommitTemplate{
+				Title: template.Must(template.New("CommitTitle").Parse("{{ .Title }} (#{{ .Number }})")),
+				Body:  template.Must(template.New("CommitBody").Parse("{{ .Body }}")),
+			},
+			expected: github.MergeDetails{SHA: "abcdef", MergeMethod: "squash", CommitTitle: "Fix the flake (#5)", CommitMessage: "It was racy."},
+		},
+		{
+			name: "failing template falls back to the default",
+			templates: config.TideMergeCommitTemplate{
+				Title: template.Must(template.New("CommitTitle").Parse("{{ .Missing }}")),
+				Body:  template.Must(template.New("CommitBody").Parse("{{ .Body }}")),
+			},
+			expected: github.MergeDetails{SHA: "abcdef", MergeMethod: "squash", CommitMessage: "It was racy."},
+		},
+	}
+	for _, tc := range testCases {
+		if actual := mergeDetails(logrus.WithField("test", tc.name), tc.templates, pr, github.MergeSquash); actual != tc.expected {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	pr1 := PullRequest{}
 	pr1.Commits.Nodes = append(pr1.Commits.Nodes, struct{ Commit Commit }{})
@@ -1185,6 +1233,170 @@ func TestServeHTTP(t *testing.T) {
 	}
 }
 
+func TestQueueHandler(t *testing.T) {
+	synced := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	failed := synced.Add(time.Minute)
+	pr := testPR("org", "repo", "master", 5, githubql.MergeableStateMergeable)
+	c := &Controller{
+		pools: []Pool{
+			{
+				Org:        "org",
+				Repo:       "repo",
+				Branch:     "master",
+				SuccessPRs: []PullRequest{pr},
+				Action:     Merge,
+				Target:     []PullRequest{pr},
+				Blockers:   []blockers.Blocker{{Number: 1, Title: "blocked"}},
+			},
+		},
+		synced:    synced,
+		syncError: "error searching for blocking issues: broken",
+		failed:    failed,
+		logger:    logrus.WithField("controller", "sync"),
+	}
+	s := httptest.NewServer(c.QueueHandler())
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q.", contentType)
+	}
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("JSON decoding error: %v", err)
+	}
+	expected := Status{
+		Pools:  c.pools,
+		Synced: synced,
+		Error:  "error searching for blocking issues: broken",
+		Failed: failed,
+	}
+	if !reflect.DeepEqual(status, expected) {
+		t.Errorf("Received status %s does not match expected status.", diff.ObjectReflectDiff(expected, status))
+	}
+}
+
+func TestQueueHandlerDuringSync(t *testing.T) {
+	mergeable := testPR("org", "repo", "A", 5, githubql.MergeableStateMergeable)
+	fgc := &fgc{prs: []PullRequest{mergeable}}
+	ca := &config.Agent{}
+	ca.Set(&config.Config{
+		ProwConfig: config.ProwConfig{
+			Tide: config.Tide{
+				Queries:       []config.TideQuery{{}},
+				MaxGoroutines: 4,
+			},
+		},
+	})
+	sc := &statusController{
+		logger:         logrus.WithField("controller", "status-update"),
+		ghc:            fgc,
+		config:         ca.Config,
+		newPoolPending: make(chan bool, 1),
+		shutDown:       make(chan bool),
+	}
+	go sc.run()
+	defer sc.shutdown()
+	c := &Controller{
+		config:        ca.Config,
+		ghc:           fgc,
+		prowJobClient: fake.NewSimpleClientset().ProwV1().ProwJobs("prowjobs"),
+		logger:        logrus.WithField("controller", "sync"),
+		sc:            sc,
+		changedFiles: &changedFilesAgent{
+			ghc:             fgc,
+			nextChangeCache: make(map[changeCacheKey][]string),
+		},
+		History: history.New(100),
+	}
+	s := httptest.NewServer(c.QueueHandler())
+	defer s.Close()
+
+	get := func() (Status, error) {
+		var status Status
+		resp, err := http.Get(s.URL)
+		if err != nil {
+			return status, err
+		}
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		return status, err
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error, 4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				status, err := get()
+				if err != nil {
+					errs <- err
+					return
+				}
+				// A sync either has not finished yet or has recorded its pool.
+				if len(status.Pools) > 1 || (len(status.Pools) == 0) != status.Synced.IsZero() {
+					errs <- fmt.Errorf("inconsistent status: %+v", status)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := c.Sync(); err != nil {
+			t.Errorf("Unexpected error from 'Sync()': %v.", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Error reading the queue during syncs: %v.", err)
+	}
+
+	status, err := get()
+	if err != nil {
+		t.Fatalf("Error reading the queue: %v.", err)
+	}
+	if len(status.Pools) != 1 || status.Pools[0].Action != Merge || status.Error != "" {
+		t.Errorf("Expected one pool merging and no error after successful syncs, got %+v.", status)
+	}
+
+	// The fake client cannot search for blocking issues.
+	ca.Set(&config.Config{
+		ProwConfig: config.ProwConfig{
+			Tide: config.Tide{
+				Queries:       []config.TideQuery{{Orgs: []string{"org"}}},
+				MaxGoroutines: 4,
+				BlockerLabel:  "blocker",
+			},
+		},
+	})
+	if err := c.Sync(); err == nil {
+		t.Fatal("Expected an error from 'Sync()' when searching for blocking issues fails.")
+	}
+	failed, err := get()
+	if err != nil {
+		t.Fatalf("Error reading the queue: %v.", err)
+	}
+	if !strings.HasPrefix(failed.Error, "error searching for blocking issues") || failed.Failed.IsZero() {
+		t.Errorf("Expected the failure to search for blocking issues to be recorded, got %+v.", failed)
+	}
+	if !reflect.DeepEqual(failed.Pools, status.Pools) || !failed.Synced.Equal(status.Synced) {
+		t.Errorf("Expected the pools of the last successful sync to be kept, got %+v.", failed)
+	}
+}
+
 func TestHeadContexts(t *testing.T) {
 	type commitContext struct {
 		// one context per commit for testing
@@ -1873,6 +2085,44 @@ func TestIsPassing(t *testing.T) {
 	}
 }
 
+func TestPresubmitsByPullTooManyFiles(t *testing.T) {
+	presubmit := config.Presubmit{
+		Reporter: config.Reporter{Context: "presubmit"},
+		RegexpChangeMatcher: config.RegexpChangeMatcher{
+			RunIfChanged: "^foo$",
+		},
+	}
+	cfg := &config.Config{}
+	cfg.SetPresubmits(map[string][]config.Presubmit{"org/repo": {presubmit}})
+	cfgAgent := &config.Agent{}
+	cfgAgent.Set(cfg)
+	sp := &subpool{
+		org:    "org",
+		repo:   "repo",
+		branch: "master",
+		prs: []PullRequest{{
+			Number:     githubql.Int(3000),
+			HeadRefOID: githubql.String("sha"),
+		}},
+	}
+	c := &Controller{
+		config: cfgAgent.Config,
+		ghc:    &fgc{},
+		changedFiles: &changedFilesAgent{
+			ghc:             &fgc{},
+			nextChangeCache: make(map[changeCacheKey][]string),
+		},
+	}
+	presubmits, err := c.presubmitsByPull(sp)
+	if err != nil {
+		t.Fatalf("unexpected error from presubmitsByPull: %v", err)
+	}
+	// Not every change is known, so the presubmit is required.
+	if jobs := presubmits[3000]; len(jobs) != 1 || jobs[0].Context != "presubmit" {
+		t.Errorf("expected the presubmit to be required for a PR with too many files, got %v", presubmits)
+	}
+}
+
 func TestPresubmitsByPull(t *testing.T) {
 	samplePR := PullRequest{
 		Number:     githubql.Int(100),
@@ -196,7 +196,9 @@ func makeCommenter(comment string, useTemplate bool) func(meta) (string, error)
 func run(c client, query, sort string, asc bool, commenter func(meta) (string, error), ceiling int) error {
 	log.Printf("Searching: %s", query)
 	issues, err := c.FindIssues(query, sort, asc)
-	if err != nil {
+	if truncated, ok := err.(*github.SearchResultsTruncated); ok {
+		log.Printf("Warning: %v", truncated)
+	} else if err != nil {
 		return fmt.Errorf("search failed: %v", err)
 	}
 	problems := []string{}
@@ -166,6 +166,8 @@ func makeIssue(owner, repo string, number int, title string) github.Issue {
 type fakeClient struct {
 	comments []int
 	issues   []github.Issue
+	// maxResults truncates searches that match more issues, if set.
+	maxResults int
 }
 
 // Fakes Creating a client, using the same signature as github.Client
@@ -188,6 +190,9 @@ func (c *fakeClient) FindIssues(query, sort string, asc bool) ([]github.Issue, e
 			ret = append(ret, i)
 		}
 	}
+	if c.maxResults > 0 && len(ret) > c.maxResults {
+		return ret[:c.maxResults], &github.SearchResultsTruncated{Query: query, Total: len(ret)}
+	}
 	return ret, nil
 }
 
@@ -224,6 +229,13 @@ func TestRun(t *testing.T) {
 			client:   fakeClient{issues: manyIssues},
 			expected: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
 		},
+		{
+			name:     "truncated search",
+			query:    "many",
+			comment:  "hey",
+			client:   fakeClient{issues: manyIssues, maxResults: 5},
+			expected: []int{0, 1, 2, 3, 4},
+		},
 		{
 			name:    "find none",
 			query:   "none",